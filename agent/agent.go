@@ -0,0 +1,354 @@
+// Package agent runs a planner, a worker and a critic, each an agent on its
+// own sequence and possibly its own model, under a supervision loop. The
+// planner breaks the task into steps, the worker carries them out and writes
+// an answer, and the critic approves the answer or sends feedback back to the
+// planner for another iteration, until the iteration budget runs out.
+//
+//	result, err := agent.Run(ctx, client, "Compare the tides of two ports", agent.Options{
+//	    Planner: agent.Agent{Model: "meta/llama3.1-70b-instruct"},
+//	    Worker:  agent.Agent{Model: "meta/llama3.1-8b-instruct-free", OpenOptions: tools},
+//	    Critic:  agent.Agent{Model: "meta/llama3.1-70b-instruct"},
+//	})
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// Defaults for Options.
+const (
+	DefaultMaxIterations = 3
+	DefaultMaxSteps      = 8
+)
+
+// Approved starts the critic's reply when it accepts the answer.
+const Approved = "APPROVED"
+
+// Role is an agent's part in a run.
+type Role string
+
+// Roles. The supervisor is the loop itself, which hands the task to the
+// planner and receives the approved answer.
+const (
+	RoleSupervisor Role = "supervisor"
+	RolePlanner    Role = "planner"
+	RoleWorker     Role = "worker"
+	RoleCritic     Role = "critic"
+)
+
+// Default system prompts, used when an Agent has none.
+const (
+	DefaultPlannerPrompt = "You plan work for another assistant. Break each task into a short " +
+		"numbered list of concrete steps, one per line, and reply with the list only."
+	DefaultWorkerPrompt = "You carry out the steps of a plan one at a time, then write the " +
+		"final answer to the task."
+	DefaultCriticPrompt = "You review answers. If an answer fully and correctly completes its " +
+		"task, reply " + Approved + ". Otherwise reply with specific feedback on what to fix."
+)
+
+// Agent configures one role's sequence.
+type Agent struct {
+	// Model is the model the agent's sequence is opened with.
+	Model string
+
+	// SystemPrompt is appended when the sequence opens. Defaults to the
+	// role's default prompt.
+	SystemPrompt string
+
+	// OpenOptions and GenOptions apply to the agent's sequence and its
+	// generations, e.g. [modelsocket.WithToolbox] for a worker that calls
+	// tools. The agent runs the tools the model calls before replying.
+	OpenOptions []modelsocket.OpenOption
+	GenOptions  []modelsocket.GenOption
+}
+
+// Options configures Run.
+type Options struct {
+	Planner Agent
+	Worker  Agent
+
+	// Critic reviews each answer. Without a Model, the first answer is
+	// accepted.
+	Critic Agent
+
+	// MaxIterations bounds the plan, work and review rounds. Defaults to
+	// DefaultMaxIterations.
+	MaxIterations int
+
+	// MaxSteps bounds the steps of a plan the worker carries out; later
+	// steps are dropped. Defaults to DefaultMaxSteps.
+	MaxSteps int
+
+	// OnMessage, if set, is called with each message as it is passed.
+	OnMessage func(Message)
+
+	// Blackboard, if set, is shared by the agents' tools, which find it
+	// with [modelsocket.BlackboardFromContext]. Add its
+	// [modelsocket.Blackboard.Tools] to an agent's toolbox to let the model
+	// use it directly.
+	Blackboard *modelsocket.Blackboard
+}
+
+// Message is text passed from one role to another.
+type Message struct {
+	Iteration int // From 1
+	From      Role
+	To        Role
+	Text      string
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	Answer     string    // The latest answer
+	Plan       []string  // The latest plan's steps
+	Iterations int       // Rounds run
+	Approved   bool      // Whether the critic approved the answer
+	Messages   []Message // Every message passed, in order
+
+	// RunID is the run the agents' sequences were part of: the one ctx
+	// carried, or a new one from [modelsocket.Client.NewRunID].
+	RunID string
+}
+
+// AgentError reports the role whose turn failed.
+type AgentError struct {
+	Role      Role
+	Iteration int
+	Err       error
+}
+
+func (e *AgentError) Error() string {
+	return fmt.Sprintf("agent: %s in iteration %d: %v", e.Role, e.Iteration, e.Err)
+}
+
+func (e *AgentError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// ErrNoModel is returned when the planner or worker has no Model.
+	ErrNoModel = errors.New("agent: Planner and Worker need a Model")
+
+	// ErrMaxIterations is returned, along with the latest Result, when the
+	// critic hasn't approved an answer within MaxIterations.
+	ErrMaxIterations = errors.New("agent: answer not approved within the iteration budget")
+)
+
+// Run carries out task with the agents in opts. Each agent's sequence keeps
+// its conversation across iterations and is closed when Run returns. Run
+// stops at the first failed turn with an [*AgentError].
+func Run(ctx context.Context, client *modelsocket.Client, task string, opts Options) (*Result, error) {
+	if opts.Planner.Model == "" || opts.Worker.Model == "" {
+		return nil, ErrNoModel
+	}
+	if opts.MaxIterations <= 0 {
+		opts.MaxIterations = DefaultMaxIterations
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = DefaultMaxSteps
+	}
+
+	if opts.Blackboard != nil {
+		ctx = modelsocket.ContextWithBlackboard(ctx, opts.Blackboard)
+	}
+	runID := modelsocket.RunIDFromContext(ctx)
+	if runID == "" {
+		runID = client.NewRunID()
+		ctx = modelsocket.ContextWithRunID(ctx, runID)
+	}
+
+	r := &runner{opts: opts, result: &Result{RunID: runID}}
+	defer r.close(ctx)
+
+	var err error
+	if r.planner, err = r.join(ctx, client, RolePlanner, opts.Planner, DefaultPlannerPrompt); err != nil {
+		return nil, err
+	}
+	if r.worker, err = r.join(ctx, client, RoleWorker, opts.Worker, DefaultWorkerPrompt); err != nil {
+		return nil, err
+	}
+	if opts.Critic.Model != "" {
+		if r.critic, err = r.join(ctx, client, RoleCritic, opts.Critic, DefaultCriticPrompt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.run(ctx, task); err != nil {
+		if errors.Is(err, ErrMaxIterations) {
+			return r.result, err
+		}
+		return nil, err
+	}
+	return r.result, nil
+}
+
+// member is a role's agent and the chat session it runs in.
+type member struct {
+	role Role
+	chat *modelsocket.ChatSession
+}
+
+// runner holds the state of one call to Run.
+type runner struct {
+	opts   Options
+	result *Result
+
+	planner, worker, critic *member
+	iteration               int
+}
+
+// join starts a role's chat session with its system prompt.
+func (r *runner) join(ctx context.Context, client *modelsocket.Client, role Role, agent Agent, prompt string) (*member, error) {
+	if agent.SystemPrompt != "" {
+		prompt = agent.SystemPrompt
+	}
+	chat, err := modelsocket.NewChatSession(ctx, client, agent.Model,
+		modelsocket.WithChatSystemPrompt(prompt),
+		modelsocket.WithChatOpenOptions(agent.OpenOptions...),
+		modelsocket.WithChatGenOptions(agent.GenOptions...),
+	)
+	if err != nil {
+		return nil, &AgentError{Role: role, Err: err}
+	}
+	return &member{role: role, chat: chat}, nil
+}
+
+// close closes the members' sequences.
+func (r *runner) close(ctx context.Context) {
+	for _, m := range []*member{r.planner, r.worker, r.critic} {
+		if m != nil {
+			m.chat.Close(context.WithoutCancel(ctx))
+		}
+	}
+}
+
+// run is the supervision loop.
+func (r *runner) run(ctx context.Context, task string) error {
+	prompt := fmt.Sprintf("Task: %s\n\nPlan the steps.", task)
+	r.iteration = 1
+	r.send(RoleSupervisor, RolePlanner, task)
+
+	for ; r.iteration <= r.opts.MaxIterations; r.iteration++ {
+		r.result.Iterations = r.iteration
+
+		reply, err := r.ask(ctx, r.planner, prompt)
+		if err != nil {
+			return err
+		}
+		steps := Steps(reply)
+		if len(steps) > r.opts.MaxSteps {
+			steps = steps[:r.opts.MaxSteps]
+		}
+		r.result.Plan = steps
+
+		for i, step := range steps {
+			r.send(RolePlanner, RoleWorker, step)
+			prompt := fmt.Sprintf("Step %d of %d: %s", i+1, len(steps), step)
+			if i == 0 {
+				prompt = fmt.Sprintf("Task: %s\n\nPlan:\n%s\n\n%s", task, numbered(steps), prompt)
+			}
+			output, err := r.ask(ctx, r.worker, prompt)
+			if err != nil {
+				return err
+			}
+			r.send(RoleWorker, RoleSupervisor, output)
+		}
+
+		answer, err := r.ask(ctx, r.worker, "Write the final answer to the task, and nothing else.")
+		if err != nil {
+			return err
+		}
+		r.result.Answer = answer
+
+		if r.critic == nil {
+			r.send(RoleWorker, RoleSupervisor, answer)
+			r.result.Approved = true
+			return nil
+		}
+		r.send(RoleWorker, RoleCritic, answer)
+
+		verdict, err := r.ask(ctx, r.critic, fmt.Sprintf("Task: %s\n\nAnswer:\n%s", task, answer))
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(strings.ToUpper(verdict), Approved) {
+			r.send(RoleCritic, RoleSupervisor, verdict)
+			r.result.Approved = true
+			return nil
+		}
+		r.send(RoleCritic, RolePlanner, verdict)
+		prompt = fmt.Sprintf("A reviewer rejected the answer:\n%s\n\nRevise the plan.", verdict)
+	}
+	return ErrMaxIterations
+}
+
+// ask appends prompt to m's sequence as the user and returns the reply.
+func (r *runner) ask(ctx context.Context, m *member, prompt string) (string, error) {
+	text, err := m.ask(ctx, prompt)
+	if err != nil {
+		return "", &AgentError{Role: m.role, Iteration: r.iteration, Err: err}
+	}
+	return text, nil
+}
+
+// ask sends prompt as the user and returns the reply: the text generated
+// after the last tool call, if the model called tools.
+func (m *member) ask(ctx context.Context, prompt string) (string, error) {
+	stream, err := m.chat.Send(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	var reply strings.Builder
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			return "", err
+		}
+		reply.WriteString(chunk.Text)
+		if len(chunk.ToolCalls) > 0 {
+			reply.Reset()
+		}
+	}
+	return strings.TrimSpace(reply.String()), nil
+}
+
+// send records a message.
+func (r *runner) send(from, to Role, text string) {
+	msg := Message{Iteration: r.iteration, From: from, To: to, Text: text}
+	r.result.Messages = append(r.result.Messages, msg)
+	if r.opts.OnMessage != nil {
+		r.opts.OnMessage(msg)
+	}
+}
+
+// Steps splits a plan into its steps: its non-empty lines, without list
+// markers such as "1. ", "2) " or "-". A plan without line breaks is one
+// step.
+func Steps(plan string) []string {
+	var steps []string
+	for _, line := range strings.Split(plan, "\n") {
+		line = strings.TrimSpace(line)
+		rest := strings.TrimLeft(line, "0123456789")
+		if len(rest) < len(line) && (strings.HasPrefix(rest, ". ") || strings.HasPrefix(rest, ") ")) {
+			line = rest[2:]
+		}
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*•"))
+		if line != "" {
+			steps = append(steps, line)
+		}
+	}
+	return steps
+}
+
+// numbered formats steps as a numbered list.
+func numbered(steps []string) string {
+	var b strings.Builder
+	for i, step := range steps {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers each generation with reply
+// applied to the sequence's model and last appended text. A reply of
+// "call:<name>" calls that tool, and the tool's result is echoed back.
+func newServer(reply func(model, prompt string) (string, error)) *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		if g.Results != nil {
+			return mstest.Reply(g.Results[0].Result)
+		}
+		text, err := reply(g.Model, g.Prompt())
+		if err != nil {
+			return []*modelsocket.MSEvent{mstest.Error(err.Error())}
+		}
+		if name, ok := strings.CutPrefix(text, "call:"); ok {
+			return []*modelsocket.MSEvent{mstest.ToolCall(name, "{}")}
+		}
+		return mstest.Reply(text)
+	})
+}
+
+func newClient(t *testing.T, transport *mstest.Server) *modelsocket.Client {
+	t.Helper()
+
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, transport)
+	t.Cleanup(func() { client.Close(ctx) })
+	return client
+}
+
+// team answers as the planner, worker and critic by model. The planner plans
+// two steps, the worker echoes steps and answers "final", and the critic
+// rejects the first rejections answers and approves the rest.
+func team(rejections int) func(model, prompt string) (string, error) {
+	var reviewed int
+	return func(model, prompt string) (string, error) {
+		switch model {
+		case "planner":
+			return "1. Gather\n2) Write", nil
+		case "worker":
+			if strings.HasPrefix(prompt, "Write the final answer") {
+				return "final", nil
+			}
+			return "did " + prompt[strings.LastIndex(prompt, ": ")+2:], nil
+		case "critic":
+			reviewed++
+			if reviewed <= rejections {
+				return "Too short.", nil
+			}
+			return "Approved.", nil
+		}
+		return "", fmt.Errorf("unexpected model %q", model)
+	}
+}
+
+func TestRun(t *testing.T) {
+	transport := newServer(team(1))
+	client := newClient(t, transport)
+
+	var messages []Message
+	result, err := Run(context.Background(), client, "a report", Options{
+		Planner:   Agent{Model: "planner"},
+		Worker:    Agent{Model: "worker"},
+		Critic:    Agent{Model: "critic"},
+		OnMessage: func(m Message) { messages = append(messages, m) },
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if result.Answer != "final" || !result.Approved || result.Iterations != 2 {
+		t.Errorf("Result = %+v, want final approved in the second iteration", result)
+	}
+	if result.RunID == "" {
+		t.Error("RunID is empty, want a new run")
+	}
+	if fmt.Sprint(result.Plan) != "[Gather Write]" {
+		t.Errorf("Plan = %q, want the steps without markers", result.Plan)
+	}
+
+	var flow []string
+	for _, m := range messages {
+		flow = append(flow, fmt.Sprintf("%d %s>%s %s", m.Iteration, m.From, m.To, m.Text))
+	}
+	want := []string{
+		"1 supervisor>planner a report",
+		"1 planner>worker Gather",
+		"1 worker>supervisor did Gather",
+		"1 planner>worker Write",
+		"1 worker>supervisor did Write",
+		"1 worker>critic final",
+		"1 critic>planner Too short.",
+		"2 planner>worker Gather",
+		"2 worker>supervisor did Gather",
+		"2 planner>worker Write",
+		"2 worker>supervisor did Write",
+		"2 worker>critic final",
+		"2 critic>supervisor Approved.",
+	}
+	if strings.Join(flow, "\n") != strings.Join(want, "\n") {
+		t.Errorf("messages:\n%s\nwant:\n%s", strings.Join(flow, "\n"), strings.Join(want, "\n"))
+	}
+	if fmt.Sprint(result.Messages) != fmt.Sprint(messages) {
+		t.Error("Result.Messages differs from the messages passed to OnMessage")
+	}
+
+	if opened, closed := transport.Opened(), transport.Closed(); opened != 3 || closed != 3 {
+		t.Errorf("opened %d and closed %d sequences, want 3 of each", opened, closed)
+	}
+}
+
+func TestRun_MaxIterations(t *testing.T) {
+	transport := newServer(team(5))
+	client := newClient(t, transport)
+
+	result, err := Run(context.Background(), client, "a report", Options{
+		Planner:       Agent{Model: "planner"},
+		Worker:        Agent{Model: "worker"},
+		Critic:        Agent{Model: "critic"},
+		MaxIterations: 2,
+		MaxSteps:      1,
+	})
+	if !errors.Is(err, ErrMaxIterations) {
+		t.Fatalf("err = %v, want ErrMaxIterations", err)
+	}
+	if result == nil || result.Approved || result.Iterations != 2 || len(result.Plan) != 1 {
+		t.Errorf("Result = %+v, want the unapproved second iteration with one step", result)
+	}
+}
+
+func TestRun_NoCritic(t *testing.T) {
+	transport := newServer(team(0))
+	client := newClient(t, transport)
+
+	result, err := Run(context.Background(), client, "a report", Options{
+		Planner: Agent{Model: "planner"},
+		Worker:  Agent{Model: "worker"},
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if result.Answer != "final" || !result.Approved || result.Iterations != 1 {
+		t.Errorf("Result = %+v, want the first answer accepted", result)
+	}
+}
+
+func TestRun_Blackboard(t *testing.T) {
+	// The worker calls a tool on its first step
+	transport := newServer(func(model, prompt string) (string, error) {
+		if model == "worker" && strings.HasPrefix(prompt, "Task:") {
+			return "call:note", nil
+		}
+		return team(0)(model, prompt)
+	})
+	client := newClient(t, transport)
+
+	toolbox := modelsocket.NewToolbox()
+	toolbox.Add(modelsocket.NewFuncTool(modelsocket.ToolDefinition{Name: "note"}, func(ctx context.Context, args string) (string, error) {
+		modelsocket.BlackboardFromContext(ctx).Set("note", "gathered")
+		return "noted", nil
+	}))
+
+	board := modelsocket.NewBlackboard()
+	result, err := Run(context.Background(), client, "a report", Options{
+		Planner:    Agent{Model: "planner"},
+		Worker:     Agent{Model: "worker", OpenOptions: []modelsocket.OpenOption{modelsocket.WithToolbox(toolbox)}},
+		Blackboard: board,
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if note, _ := board.Get("note"); note != "gathered" {
+		t.Errorf("note = %v, want the tool's entry", note)
+	}
+	if got := result.Messages[2].Text; got != "noted" {
+		t.Errorf("first step output = %q, want the reply after the tool call", got)
+	}
+}
+
+func TestRun_AgentError(t *testing.T) {
+	transport := newServer(func(model, prompt string) (string, error) {
+		if model == "worker" {
+			return "", errors.New("model failed")
+		}
+		return team(0)(model, prompt)
+	})
+	client := newClient(t, transport)
+
+	_, err := Run(context.Background(), client, "a report", Options{
+		Planner: Agent{Model: "planner"},
+		Worker:  Agent{Model: "worker"},
+	})
+
+	var agentErr *AgentError
+	if !errors.As(err, &agentErr) || agentErr.Role != RoleWorker || agentErr.Iteration != 1 {
+		t.Fatalf("err = %v, want the worker's *AgentError", err)
+	}
+	var protoErr *modelsocket.ProtocolError
+	if !errors.As(err, &protoErr) {
+		t.Errorf("err = %v, want wrapped *ProtocolError", err)
+	}
+}
+
+func TestRun_NoModel(t *testing.T) {
+	if _, err := Run(context.Background(), nil, "task", Options{Planner: Agent{Model: "m"}}); !errors.Is(err, ErrNoModel) {
+		t.Errorf("err = %v, want ErrNoModel", err)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	tests := []struct {
+		plan string
+		want []string
+	}{
+		{"1. One\n2. Two", []string{"One", "Two"}},
+		{"- One\n\n* Two\n10) Three", []string{"One", "Two", "Three"}},
+		{"Just do it", []string{"Just do it"}},
+		{"3.5 percent is fine", []string{"3.5 percent is fine"}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		if got := Steps(tt.plan); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("Steps(%q) = %q, want %q", tt.plan, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package modelsocket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Audit record kinds.
+const (
+	AuditAppend     = "append"
+	AuditGeneration = "generation"
+	AuditToolCall   = "tool_call"
+	AuditToolResult = "tool_result"
+)
+
+// AuditRecord is one entry in the audit log written by [WithAudit]. Text and
+// tool fields are redacted by the [AuditPolicy] before the sink sees them.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	SeqID  string    `json:"seq_id"`
+	CID    string    `json:"cid,omitempty"`
+	Model  string    `json:"model"`
+	Role   Role      `json:"role,omitempty"`
+	Hidden bool      `json:"hidden,omitempty"`
+
+	// Text is the appended or generated text.
+	Text string `json:"text,omitempty"`
+
+	// Tool is set for tool calls and results.
+	ToolName   string `json:"tool_name,omitempty"`
+	ToolArgs   string `json:"tool_args,omitempty"`
+	ToolResult string `json:"tool_result,omitempty"`
+
+	// Token counts are set for generations.
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+
+	// Tags are the sequence's tags, set with [WithSeqTag].
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// AuditSink receives audit records. WriteAudit is called synchronously as
+// records occur, from multiple goroutines; sinks that do slow I/O should
+// buffer.
+type AuditSink interface {
+	WriteAudit(rec AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to an [AuditSink].
+type AuditSinkFunc func(rec AuditRecord) error
+
+func (f AuditSinkFunc) WriteAudit(rec AuditRecord) error {
+	return f(rec)
+}
+
+// jsonAuditSink writes records as JSON lines.
+type jsonAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditSink returns a sink writing each record as a line of JSON to w.
+// Writes are serialized, so w need not be safe for concurrent use.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonAuditSink) WriteAudit(rec AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(rec)
+}
+
+// Redaction transforms a field before it is audited.
+type Redaction func(value string) string
+
+// Redactions for [AuditPolicy]. A nil Redaction keeps the field.
+var (
+	// RedactDrop removes the field.
+	RedactDrop Redaction = func(string) string { return "" }
+
+	// RedactHash replaces the field with its SHA-256, so equal values can
+	// be matched without storing them. Use [RedactHMAC] for values that
+	// could be guessed.
+	RedactHash Redaction = func(value string) string {
+		if value == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+)
+
+// RedactHMAC replaces the field with its HMAC-SHA256 under key. Unlike
+// [RedactHash], short or predictable values can't be recovered by hashing
+// guesses without the key.
+func RedactHMAC(key []byte) Redaction {
+	return func(value string) string {
+		if value == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+// AuditPolicy sets how each field of an audit record is redacted. The zero
+// policy keeps everything.
+//
+//	// Hash what users write, keep everything else
+//	modelsocket.AuditPolicy{
+//	    TextByRole: map[modelsocket.Role]modelsocket.Redaction{
+//	        modelsocket.RoleUser: modelsocket.RedactHash,
+//	    },
+//	}
+type AuditPolicy struct {
+	// Text redacts appended and generated text.
+	Text Redaction
+
+	// TextByRole overrides Text for messages with a role.
+	TextByRole map[Role]Redaction
+
+	ToolNames   Redaction
+	ToolArgs    Redaction
+	ToolResults Redaction
+}
+
+// apply redacts rec's fields.
+func (p *AuditPolicy) apply(rec *AuditRecord) {
+	text := p.Text
+	if r, ok := p.TextByRole[rec.Role]; ok {
+		text = r
+	}
+	redact(&rec.Text, text)
+	redact(&rec.ToolName, p.ToolNames)
+	redact(&rec.ToolArgs, p.ToolArgs)
+	redact(&rec.ToolResult, p.ToolResults)
+}
+
+func redact(field *string, r Redaction) {
+	if r != nil && *field != "" {
+		*field = r(*field)
+	}
+}
+
+// audit is the client's audit configuration.
+type audit struct {
+	sink   AuditSink
+	policy AuditPolicy
+}
+
+// audit redacts and writes records about the sequence. Sink failures are
+// logged and never interrupt the sequence.
+func (s *Seq) audit(recs ...AuditRecord) {
+	a := s.client.cfg.audit
+	if a == nil {
+		return
+	}
+
+	now := time.Now()
+	tags := s.Tags()
+	for _, rec := range recs {
+		rec.Time = now
+		rec.SeqID = s.id
+		rec.Model = s.model
+		rec.Tags = tags
+		a.policy.apply(&rec)
+
+		if err := a.sink.WriteAudit(rec); err != nil {
+			s.client.log(slog.LevelWarn, "", "audit write failed",
+				slog.String(logKeySeqID, s.id),
+				slog.Any(logKeyError, err),
+			)
+		}
+	}
+}
+
+// auditMessage records an appended or generated message and the tool calls
+// it made.
+func (s *Seq) auditMessage(kind, cid string, msg Message, inputTokens, outputTokens int) {
+	if s.client.cfg.audit == nil {
+		return
+	}
+
+	recs := []AuditRecord{{
+		Kind:         kind,
+		CID:          cid,
+		Role:         msg.Role,
+		Hidden:       msg.Hidden,
+		Text:         msg.Text,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+	}}
+	for _, call := range msg.ToolCalls {
+		recs = append(recs, AuditRecord{
+			Kind:     AuditToolCall,
+			CID:      cid,
+			Role:     msg.Role,
+			ToolName: call.Name,
+			ToolArgs: call.Args,
+		})
+	}
+	s.audit(recs...)
+}
+
+// auditToolResults records tool results returned with ToolReturn.
+func (s *Seq) auditToolResults(cid string, results []ToolResult) {
+	if s.client.cfg.audit == nil {
+		return
+	}
+
+	recs := make([]AuditRecord, len(results))
+	for i, result := range results {
+		recs[i] = AuditRecord{Kind: AuditToolResult, CID: cid, Role: RoleTool, ToolName: result.Name, ToolResult: result.Result}
+	}
+	s.audit(recs...)
+}
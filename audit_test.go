@@ -0,0 +1,171 @@
+package modelsocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// auditRecorder collects audit records.
+type auditRecorder struct {
+	mu   sync.Mutex
+	recs []AuditRecord
+}
+
+func (r *auditRecorder) WriteAudit(rec AuditRecord) error {
+	r.mu.Lock()
+	r.recs = append(r.recs, rec)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *auditRecorder) records() []AuditRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]AuditRecord(nil), r.recs...)
+}
+
+func TestWithAudit(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	rec := &auditRecorder{}
+	client := NewWithTransport(ctx, transport, WithAudit(rec, AuditPolicy{
+		TextByRole:  map[Role]Redaction{RoleUser: RedactHash},
+		ToolArgs:    RedactDrop,
+		ToolResults: RedactHMAC([]byte("key")),
+	}))
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1", WithSeqTag("tenant", "acme"))
+
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		switch req.Data.(type) {
+		case appendCommandData:
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "Checking."},
+				{Event: "seq_tool_call", SeqID: req.SeqID, CID: req.CID, ToolCalls: []SeqToolCall{{Name: "weather", Args: `{"city":"Paris"}`}}},
+			}
+		case toolReturnCommandData:
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "Sunny."},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, InputTokens: 20, OutputTokens: 4},
+			}
+		}
+		return nil
+	})
+
+	if err := seq.Append(ctx, "Weather in Paris?", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	stream, err := seq.Generate(ctx, GenerateAsAssistant())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	for {
+		chunk, err := stream.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next error: %v", err)
+		}
+		if len(chunk.ToolCalls) > 0 {
+			break
+		}
+	}
+	stream, err = seq.ToolReturn(ctx, []ToolResult{{Name: "weather", Result: "sunny"}}, GenerateAsAssistant())
+	if err != nil {
+		t.Fatalf("ToolReturn error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	recs := rec.records()
+	var kinds []string
+	for _, r := range recs {
+		kinds = append(kinds, r.Kind)
+		if r.SeqID != "seq-1" || r.Model != "test-model" || r.Tags["tenant"] != "acme" || r.Time.IsZero() {
+			t.Errorf("record %+v missing sequence details", r)
+		}
+	}
+	if got := strings.Join(kinds, ","); got != "append,generation,tool_call,tool_result,generation" {
+		t.Fatalf("kinds = %s", got)
+	}
+
+	if recs[0].Text != RedactHash("Weather in Paris?") || !strings.HasPrefix(recs[0].Text, "sha256:") {
+		t.Errorf("user text = %q, want hashed", recs[0].Text)
+	}
+	if recs[1].Text != "Checking." {
+		t.Errorf("assistant text = %q, want kept", recs[1].Text)
+	}
+	if recs[2].ToolName != "weather" || recs[2].ToolArgs != "" {
+		t.Errorf("tool call = %+v, want name kept and args dropped", recs[2])
+	}
+	if !strings.HasPrefix(recs[3].ToolResult, "hmac-sha256:") || recs[3].ToolName != "weather" {
+		t.Errorf("tool result = %+v, want HMAC result", recs[3])
+	}
+	if last := recs[4]; last.Text != "Sunny." || last.InputTokens != 20 || last.OutputTokens != 4 {
+		t.Errorf("final generation = %+v, want text and tokens", last)
+	}
+}
+
+func TestWithAudit_SinkError(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	h := &recordHandler{}
+	failing := AuditSinkFunc(func(AuditRecord) error { return errors.New("disk full") })
+	client := NewWithTransport(ctx, transport, WithAudit(failing, AuditPolicy{}), WithLogger(slog.New(h)))
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+	})
+
+	// The append succeeds; the failure is only logged
+	if err := seq.Append(ctx, "Hello", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	r, ok := h.find("audit write failed")
+	if !ok {
+		t.Fatal("audit failure not logged")
+	}
+	if got := attrs(r)[logKeySeqID].String(); got != "seq-1" {
+		t.Errorf("logged seq_id = %q, want seq-1", got)
+	}
+}
+
+func TestNewJSONAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONAuditSink(&buf)
+	if err := sink.WriteAudit(AuditRecord{Kind: AuditAppend, SeqID: "seq-1", Text: "hi"}); err != nil {
+		t.Fatalf("WriteAudit error: %v", err)
+	}
+
+	var rec AuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Kind != AuditAppend || rec.Text != "hi" {
+		t.Errorf("record = %+v", rec)
+	}
+}
+
+func TestRedactions(t *testing.T) {
+	if RedactHash("a") == RedactHash("b") || RedactHash("a") != RedactHash("a") {
+		t.Error("RedactHash isn't a stable hash")
+	}
+	if RedactHMAC([]byte("k1"))("a") == RedactHMAC([]byte("k2"))("a") {
+		t.Error("RedactHMAC ignores the key")
+	}
+	if RedactHash("") != "" || RedactDrop("x") != "" {
+		t.Error("empty and dropped fields should be empty")
+	}
+}
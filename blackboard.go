@@ -0,0 +1,198 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Blackboard is a key-value store shared by the sequences, tools and agents
+// of a run, so they can exchange structured intermediate results without
+// passing everything through prompts. It is safe for concurrent use.
+//
+// Tools reach the run's blackboard through their context, where
+// [ContextWithBlackboard] puts it; [Blackboard.Tools] lets models read and
+// write it too.
+type Blackboard struct {
+	mu      sync.RWMutex
+	values  map[string]any
+	version uint64
+	hooks   map[int]func(BlackboardChange)
+	nextID  int
+}
+
+// BlackboardChange describes a change to a [Blackboard].
+type BlackboardChange struct {
+	Key     string
+	Old     any  // The previous value, or nil
+	New     any  // The new value, or nil if deleted
+	Deleted bool // The key was deleted
+	Version uint64
+}
+
+// NewBlackboard returns an empty blackboard.
+func NewBlackboard() *Blackboard {
+	return &Blackboard{
+		values: make(map[string]any),
+		hooks:  make(map[int]func(BlackboardChange)),
+	}
+}
+
+// Get returns the value for key, and whether it is set.
+func (b *Blackboard) Get(key string) (any, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	value, ok := b.values[key]
+	return value, ok
+}
+
+// BlackboardValue returns the value for key as a T, and whether it is set
+// and is one.
+func BlackboardValue[T any](b *Blackboard, key string) (T, bool) {
+	value, _ := b.Get(key)
+	v, ok := value.(T)
+	return v, ok
+}
+
+// Set sets the value for key.
+func (b *Blackboard) Set(key string, value any) {
+	b.mu.Lock()
+	old := b.values[key]
+	b.values[key] = value
+	b.notifyLocked(BlackboardChange{Key: key, Old: old, New: value})
+}
+
+// Delete removes key.
+func (b *Blackboard) Delete(key string) {
+	b.mu.Lock()
+	old, ok := b.values[key]
+	if !ok {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.values, key)
+	b.notifyLocked(BlackboardChange{Key: key, Old: old, Deleted: true})
+}
+
+// Keys returns the keys that are set, sorted.
+func (b *Blackboard) Keys() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return slices.Sorted(maps.Keys(b.values))
+}
+
+// Snapshot returns a copy of the values.
+func (b *Blackboard) Snapshot() map[string]any {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return maps.Clone(b.values)
+}
+
+// Version returns the number of changes made so far.
+func (b *Blackboard) Version() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.version
+}
+
+// OnChange registers fn to be called after each change, and returns a
+// function that unregisters it. fn runs on the goroutine that made the
+// change, after the blackboard is unlocked, so it may read or change the
+// blackboard; changes made concurrently may be reported out of order, which
+// BlackboardChange.Version tells apart.
+func (b *Blackboard) OnChange(fn func(BlackboardChange)) (cancel func()) {
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.hooks[id] = fn
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		delete(b.hooks, id)
+		b.mu.Unlock()
+	}
+}
+
+// notifyLocked records change and calls the hooks. b.mu must be held; it is
+// released.
+func (b *Blackboard) notifyLocked(change BlackboardChange) {
+	b.version++
+	change.Version = b.version
+	hooks := slices.Collect(maps.Values(b.hooks))
+	b.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(change)
+	}
+}
+
+// blackboardKey is the context key for a run's blackboard.
+type blackboardKey struct{}
+
+// ContextWithBlackboard returns a copy of ctx carrying b, for the tools
+// called with it.
+func ContextWithBlackboard(ctx context.Context, b *Blackboard) context.Context {
+	return context.WithValue(ctx, blackboardKey{}, b)
+}
+
+// BlackboardFromContext returns the blackboard carried by ctx, or nil.
+func BlackboardFromContext(ctx context.Context) *Blackboard {
+	b, _ := ctx.Value(blackboardKey{}).(*Blackboard)
+	return b
+}
+
+// Tools returns blackboard_get and blackboard_set tools, which let models
+// read and write the blackboard. Values are exchanged as JSON.
+func (b *Blackboard) Tools() []Tool {
+	keyParams := map[string]ToolProperty{
+		"key": {Type: "string", Description: "The entry's key"},
+	}
+
+	get := NewFuncTool(ToolDefinition{
+		Name:        "blackboard_get",
+		Description: "Read an entry from the blackboard shared with other assistants.",
+		Parameters:  ToolParameters{Type: "object", Properties: keyParams, Required: []string{"key"}},
+	}, func(ctx context.Context, args string) (string, error) {
+		var in struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal([]byte(args), &in); err != nil {
+			return "", &ToolArgsError{Name: "blackboard_get", Args: args, Err: err}
+		}
+		value, ok := b.Get(in.Key)
+		if !ok {
+			return "", errors.New("no entry for " + in.Key)
+		}
+		text, err := json.Marshal(value)
+		return string(text), err
+	})
+
+	setParams := maps.Clone(keyParams)
+	setParams["value"] = ToolProperty{Type: "string", Description: "The entry's value, as JSON"}
+	set := NewFuncTool(ToolDefinition{
+		Name:        "blackboard_set",
+		Description: "Write an entry to the blackboard shared with other assistants.",
+		Parameters:  ToolParameters{Type: "object", Properties: setParams, Required: []string{"key", "value"}},
+	}, func(ctx context.Context, args string) (string, error) {
+		var in struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(args), &in); err != nil {
+			return "", &ToolArgsError{Name: "blackboard_set", Args: args, Err: err}
+		}
+		var value any = in.Value
+		var decoded any
+		if json.Unmarshal([]byte(in.Value), &decoded) == nil {
+			value = decoded
+		}
+		b.Set(in.Key, value)
+		return "ok", nil
+	})
+
+	return []Tool{get, set}
+}
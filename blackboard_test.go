@@ -0,0 +1,103 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestBlackboard(t *testing.T) {
+	b := NewBlackboard()
+
+	var changes []BlackboardChange
+	cancel := b.OnChange(func(c BlackboardChange) { changes = append(changes, c) })
+
+	b.Set("plan", []string{"a", "b"})
+	b.Set("count", 1)
+	b.Set("count", 2)
+	b.Delete("plan")
+	b.Delete("missing")
+
+	if got, ok := BlackboardValue[int](b, "count"); !ok || got != 2 {
+		t.Errorf("count = %v, %v, want 2", got, ok)
+	}
+	if _, ok := BlackboardValue[string](b, "count"); ok {
+		t.Error("count read as a string")
+	}
+	if keys := b.Keys(); fmt.Sprint(keys) != "[count]" {
+		t.Errorf("Keys = %v, want [count]", keys)
+	}
+
+	want := []string{"plan <nil> [a b] 1", "count <nil> 1 2", "count 1 2 3", "plan [a b] <nil> 4 deleted"}
+	var got []string
+	for _, c := range changes {
+		s := fmt.Sprintf("%s %v %v %d", c.Key, c.Old, c.New, c.Version)
+		if c.Deleted {
+			s += " deleted"
+		}
+		got = append(got, s)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+
+	cancel()
+	b.Set("count", 3)
+	if len(changes) != 4 || b.Version() != 5 {
+		t.Errorf("%d changes at version %d after cancel, want 4 at 5", len(changes), b.Version())
+	}
+}
+
+func TestBlackboard_Concurrent(t *testing.T) {
+	b := NewBlackboard()
+
+	// Hooks may change the blackboard themselves
+	b.OnChange(func(c BlackboardChange) {
+		if c.Key != "last" {
+			b.Set("last", c.Key)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Set(fmt.Sprint(i), i)
+			b.Snapshot()
+		}()
+	}
+	wg.Wait()
+
+	if n := len(b.Keys()); n != 11 {
+		t.Errorf("%d keys, want 11", n)
+	}
+}
+
+func TestBlackboard_Tools(t *testing.T) {
+	ctx := context.Background()
+
+	b := NewBlackboard()
+	toolbox := NewToolbox()
+	for _, tool := range b.Tools() {
+		toolbox.Add(tool)
+	}
+
+	if _, err := toolbox.Call(ctx, "blackboard_set", `{"key": "cities", "value": "[\"Paris\"]"}`); err != nil {
+		t.Fatalf("blackboard_set error: %v", err)
+	}
+	if cities, ok := BlackboardValue[[]any](b, "cities"); !ok || len(cities) != 1 || cities[0] != "Paris" {
+		t.Errorf("cities = %v, want the decoded JSON", cities)
+	}
+	if got, err := toolbox.Call(ctx, "blackboard_get", `{"key": "cities"}`); err != nil || got != `["Paris"]` {
+		t.Errorf("blackboard_get = %q, %v, want the JSON value", got, err)
+	}
+	if _, err := toolbox.Call(ctx, "blackboard_get", `{"key": "towns"}`); err == nil {
+		t.Error("blackboard_get of a missing key should fail")
+	}
+
+	if BlackboardFromContext(ContextWithBlackboard(ctx, b)) != b || BlackboardFromContext(ctx) != nil {
+		t.Error("BlackboardFromContext should return the blackboard the context carries")
+	}
+}
@@ -0,0 +1,180 @@
+package modelsocket
+
+import "sync"
+
+// Budget caps the tokens and cost consumed by a client, a sequence or a
+// single generation. Zero fields are unlimited.
+type Budget struct {
+	// MaxInputTokens caps the context tokens processed, summed over
+	// generations.
+	MaxInputTokens int
+
+	// MaxOutputTokens caps the generated tokens.
+	MaxOutputTokens int
+
+	// MaxCost caps the cost of generations, priced with [WithPricing] or
+	// [WithCostFunc]. It has no effect without either.
+	MaxCost float64
+}
+
+// Budget scopes reported by [BudgetExceededError].
+const (
+	BudgetScopeClient   = "client"
+	BudgetScopeSequence = "sequence"
+	BudgetScopeCall     = "call"
+	BudgetScopeSpawn    = "spawn"
+)
+
+// budget tracks consumption against a Budget.
+type budget struct {
+	scope string
+	limit Budget
+
+	mu           sync.Mutex
+	inputTokens  int
+	outputTokens int
+	cost         float64
+}
+
+// newBudget returns a counter for limit. Options hold only the limit, so
+// an option reused across calls or sequences doesn't share a counter; the
+// counter is created when the client, sequence, call or spawn tool it
+// scopes is.
+func newBudget(scope string, limit Budget) *budget {
+	return &budget{scope: scope, limit: limit}
+}
+
+// exhausted returns an error if nothing more may be generated within the
+// budget.
+func (b *budget) exhausted() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l := b.limit
+	if (l.MaxInputTokens > 0 && b.inputTokens >= l.MaxInputTokens) ||
+		(l.MaxOutputTokens > 0 && b.outputTokens >= l.MaxOutputTokens) ||
+		(l.MaxCost > 0 && b.cost >= l.MaxCost) {
+		return b.errorLocked(0, 0)
+	}
+	return nil
+}
+
+// exceededBy returns an error if a generation in progress, having streamed
+// outputTokens costing cost so far, takes consumption over the budget.
+func (b *budget) exceededBy(outputTokens int, cost float64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l := b.limit
+	if (l.MaxOutputTokens > 0 && b.outputTokens+outputTokens > l.MaxOutputTokens) ||
+		(l.MaxCost > 0 && b.cost+cost > l.MaxCost) {
+		return b.errorLocked(outputTokens, cost)
+	}
+	return nil
+}
+
+// overInput returns an error if charged input tokens exceed the budget.
+func (b *budget) overInput() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit.MaxInputTokens > 0 && b.inputTokens > b.limit.MaxInputTokens {
+		return b.errorLocked(0, 0)
+	}
+	return nil
+}
+
+// charge adds a finished generation's usage.
+func (b *budget) charge(inputTokens, outputTokens int, cost float64) {
+	b.mu.Lock()
+	b.inputTokens += inputTokens
+	b.outputTokens += outputTokens
+	b.cost += cost
+	b.mu.Unlock()
+}
+
+// errorLocked reports consumption, including a generation in progress.
+func (b *budget) errorLocked(outputTokens int, cost float64) *BudgetExceededError {
+	return &BudgetExceededError{
+		Scope:        b.scope,
+		Budget:       b.limit,
+		InputTokens:  b.inputTokens,
+		OutputTokens: b.outputTokens + outputTokens,
+		Cost:         b.cost + cost,
+	}
+}
+
+// budgets returns the budgets a generation with cfg counts against, from
+// the narrowest scope out.
+func (s *Seq) budgets(cfg genConfig) []*budget {
+	var budgets []*budget
+	for _, b := range []*budget{cfg.budget, s.cfg.budget, s.client.cfg.budget} {
+		if b != nil {
+			budgets = append(budgets, b)
+		}
+	}
+	return budgets
+}
+
+// cost returns the cost of tokens generated by the sequence's model, or 0
+// without a cost function.
+func (s *Seq) cost(inputTokens, outputTokens int) float64 {
+	if fn := s.client.cfg.costFunc; fn != nil {
+		return fn(s.model, inputTokens, outputTokens)
+	}
+	return 0
+}
+
+// checkBudget returns an error if any budget for the generation is used up,
+// so it isn't started.
+func (g *GenStream) checkBudget() error {
+	for _, b := range g.budgets {
+		if err := b.exhausted(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countOutput adds streamed tokens to the generation's running total and
+// returns an error once that takes it over a budget.
+func (g *GenStream) countOutput(tokens int) error {
+	if len(g.budgets) == 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	g.streamed += tokens
+	streamed := g.streamed
+	g.mu.Unlock()
+
+	cost := g.seq.cost(0, streamed)
+	for _, b := range g.budgets {
+		if err := b.exceededBy(streamed, cost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputOverBudget returns an error if the generation's finish, once charged,
+// took input tokens over a budget.
+func (g *GenStream) inputOverBudget() error {
+	for _, b := range g.budgets {
+		if err := b.overInput(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// charge adds a finished generation's usage to budgets.
+func (s *Seq) charge(budgets []*budget, inputTokens, outputTokens int) {
+	if len(budgets) == 0 {
+		return
+	}
+	cost := s.cost(inputTokens, outputTokens)
+	for _, b := range budgets {
+		b.charge(inputTokens, outputTokens, cost)
+	}
+}
@@ -0,0 +1,184 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// budgetServer generates words as separate text events on any sequence.
+func budgetServer(words ...string) func(req *MSRequest) []*MSEvent {
+	return func(req *MSRequest) []*MSEvent {
+		if _, ok := req.Data.(genCommandData); !ok {
+			return nil
+		}
+		var events []*MSEvent
+		for _, word := range words {
+			events = append(events, &MSEvent{Event: "seq_text", SeqID: req.SeqID, Text: word})
+		}
+		return append(events, &MSEvent{
+			Event:        "seq_gen_finish",
+			SeqID:        req.SeqID,
+			CID:          req.CID,
+			InputTokens:  10,
+			OutputTokens: len(words),
+		})
+	}
+}
+
+func TestSeq_Generate_CallBudgetExceeded(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	seen := serveCommands(t, transport, budgetServer("one", " two", " three"))
+
+	stream, err := seq.Generate(ctx, WithBudget(0, 2, 0))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	text, err := stream.Text(ctx)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Text error = %v, want BudgetExceededError", err)
+	}
+	if budgetErr.Scope != BudgetScopeCall || budgetErr.OutputTokens != 3 || budgetErr.Budget.MaxOutputTokens != 2 {
+		t.Errorf("error = %+v, want call scope with 3 of 2 output tokens", budgetErr)
+	}
+	if text != "one two" {
+		t.Errorf("text = %q, want the text within budget", text)
+	}
+
+	// The generation is cancelled on the server
+	if got := commandsFor(seen, "seq-1", 100*time.Millisecond); len(got) != 2 || got[1] != "cancel" {
+		t.Errorf("commands = %v, want [gen cancel]", got)
+	}
+}
+
+func TestSeq_Generate_CallBudgetReused(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, budgetServer("one", " two"))
+
+	// Each call counts against its own copy of the budget, however many
+	// calls share the option
+	opt := WithBudget(0, 2, 0)
+	for i := range 3 {
+		stream, err := seq.Generate(ctx, opt)
+		if err != nil {
+			t.Fatalf("Generate %d error: %v", i, err)
+		}
+		if _, err := stream.Text(ctx); err != nil {
+			t.Fatalf("Text %d error: %v", i, err)
+		}
+	}
+}
+
+func TestSeq_Generate_CallInputBudgetExceeded(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, budgetServer("one"))
+
+	// Input tokens are reported on finish, which fails the stream
+	stream, err := seq.Generate(ctx, WithBudget(5, 0, 0))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	_, err = stream.Text(ctx)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Text error = %v, want BudgetExceededError", err)
+	}
+	if budgetErr.Scope != BudgetScopeCall || budgetErr.InputTokens != 10 || budgetErr.Budget.MaxInputTokens != 5 {
+		t.Errorf("error = %+v, want call scope with 10 of 5 input tokens", budgetErr)
+	}
+}
+
+func TestSeq_Generate_SeqBudgetUsedUp(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1", WithSeqBudget(0, 2, 0))
+	serveCommands(t, transport, budgetServer("one", " two"))
+
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	// The budget is used up, so the next generation isn't started
+	_, err = seq.Generate(ctx)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Generate error = %v, want BudgetExceededError", err)
+	}
+	if budgetErr.Scope != BudgetScopeSequence || budgetErr.InputTokens != 10 || budgetErr.OutputTokens != 2 {
+		t.Errorf("error = %+v, want sequence scope with 10/2 tokens", budgetErr)
+	}
+
+	gens := 0
+	for _, req := range transport.getRequests() {
+		if _, ok := req.Data.(genCommandData); ok {
+			gens++
+		}
+	}
+	if gens != 1 {
+		t.Errorf("sent %d gen commands, want 1", gens)
+	}
+}
+
+func TestClient_BudgetCost(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	var costModel string
+	client := NewWithTransport(ctx, transport,
+		WithClientBudget(0, 0, 1),
+		WithCostFunc(func(model string, inputTokens, outputTokens int) float64 {
+			costModel = model
+			return float64(outputTokens) * 0.4
+		}),
+	)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, budgetServer("a", "b", "c"))
+
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	_, err = stream.Text(ctx)
+	var budgetErr *BudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Text error = %v, want BudgetExceededError", err)
+	}
+	if budgetErr.Scope != BudgetScopeClient || budgetErr.Cost <= 1 {
+		t.Errorf("error = %+v, want client scope over cost 1", budgetErr)
+	}
+	if costModel != "test-model" {
+		t.Errorf("cost func model = %q, want test-model", costModel)
+	}
+}
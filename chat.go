@@ -0,0 +1,463 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// DefaultChatMaxToolRounds is the number of tool call rounds a
+// [ChatSession] runs for one message unless [WithChatMaxToolRounds] sets
+// another limit.
+const DefaultChatMaxToolRounds = 8
+
+// ChatOption configures a [ChatSession].
+type ChatOption func(*chatConfig)
+
+type chatConfig struct {
+	systemPrompt  string
+	openOptions   []OpenOption
+	genOptions    []GenOption
+	maxMessages   int
+	maxToolRounds int
+
+	summarizeAt float64
+	summaryKeep int
+}
+
+// WithChatSystemPrompt appends prompt as a system message when the session
+// starts.
+func WithChatSystemPrompt(prompt string) ChatOption {
+	return func(c *chatConfig) {
+		c.systemPrompt = prompt
+	}
+}
+
+// WithChatOpenOptions configures the session's sequences. Pass
+// [WithToolbox] here to have the session run tool calls.
+func WithChatOpenOptions(opts ...OpenOption) ChatOption {
+	return func(c *chatConfig) {
+		c.openOptions = append(slices.Clip(c.openOptions), opts...)
+	}
+}
+
+// WithChatGenOptions configures each generation. Replies are generated as
+// the assistant unless these say otherwise.
+func WithChatGenOptions(opts ...GenOption) ChatOption {
+	return func(c *chatConfig) {
+		c.genOptions = append(slices.Clip(c.genOptions), opts...)
+	}
+}
+
+// WithChatMaxMessages limits the conversation to n messages, not counting
+// the system prompt. Before a message is sent, the oldest messages are
+// dropped so that it and its reply fit, and the rest are replayed onto a new
+// sequence. The kept messages start at a user message, so tool calls stay
+// with their results.
+func WithChatMaxMessages(n int) ChatOption {
+	return func(c *chatConfig) {
+		c.maxMessages = n
+	}
+}
+
+// WithChatSummarize summarizes older messages as the context fills up: before
+// a message is sent, if the sequence's context has reached threshold of its
+// model's window, as set with [WithContextWindows], everything but the last
+// keep messages is summarized as by [Seq.Summarize], on a sequence replaying
+// just those messages after the system prompt and any earlier summary. The
+// summary replaces them: it follows the system prompt as a system message,
+// and the kept messages are replayed onto a new sequence after it. The kept
+// messages start at a user message, so tool calls stay with their results.
+func WithChatSummarize(threshold float64, keep int) ChatOption {
+	return func(c *chatConfig) {
+		c.summarizeAt = threshold
+		c.summaryKeep = keep
+	}
+}
+
+// WithChatMaxToolRounds limits the tool call rounds run for one message.
+// Defaults to [DefaultChatMaxToolRounds].
+func WithChatMaxToolRounds(n int) ChatOption {
+	return func(c *chatConfig) {
+		c.maxToolRounds = n
+	}
+}
+
+// ChatSession is a multi-turn conversation for chat frontends. It wraps a
+// sequence: each [ChatSession.Send] appends the user's message and streams
+// the reply, running any tool calls the model makes with the toolbox set by
+// [WithChatOpenOptions] along the way. The history is trimmed as set by
+// [WithChatMaxMessages].
+//
+// A session is safe for concurrent use, but only one message is answered at
+// a time.
+type ChatSession struct {
+	cfg  chatConfig
+	open openConfig
+
+	mu      sync.Mutex
+	seq     *Seq
+	turn    *GenStream // The latest reply
+	summary string     // Of the messages dropped by WithChatSummarize
+}
+
+// NewChatSession opens a sequence on client and starts a chat session on it.
+func NewChatSession(ctx context.Context, client *Client, model string, opts ...ChatOption) (*ChatSession, error) {
+	cfg := chatConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.maxToolRounds <= 0 {
+		cfg.maxToolRounds = DefaultChatMaxToolRounds
+	}
+
+	c := &ChatSession{cfg: cfg}
+	for _, opt := range cfg.openOptions {
+		opt(&c.open)
+	}
+
+	seq, err := client.replay(ctx, model, c.setup(), c.open)
+	if err != nil {
+		return nil, err
+	}
+	c.seq = seq
+	return c, nil
+}
+
+// Seq returns the session's current sequence. It changes when the history
+// is trimmed or replayed, so don't keep it across calls.
+func (c *ChatSession) Seq() *Seq {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// Summary returns the summary of the messages dropped by
+// [WithChatSummarize], or "" if none have been.
+func (c *ChatSession) Summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summary
+}
+
+// History returns the conversation, without the system prompt or summary.
+func (c *ChatSession) History() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dialogue()
+}
+
+// Send appends text as a user message and returns a stream of the reply.
+// When the model calls tools, the session runs them and returns the results,
+// and the stream carries on with the continuation: it delivers the chunks
+// of every round, including those with tool calls, and ends once the model
+// replies without calling a tool. It fails with ErrInvalidState while the
+// previous reply is still streaming. ctx covers the whole reply, as for
+// [Seq.Generate].
+func (c *ChatSession) Send(ctx context.Context, text string) (*GenStream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replying() {
+		return nil, ErrInvalidState
+	}
+	if err := c.summarize(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.trim(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.seq.Append(ctx, text, AsUser()); err != nil {
+		return nil, err
+	}
+	return c.reply(ctx)
+}
+
+// Regenerate discards the reply to the latest user message and streams a
+// new one. The conversation up to that message is replayed onto a new
+// sequence, as the protocol can't remove messages from one. It fails with
+// ErrInvalidState while a reply is streaming or if there is no user message.
+func (c *ChatSession) Regenerate(ctx context.Context) (*GenStream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replying() {
+		return nil, ErrInvalidState
+	}
+
+	dialogue := c.dialogue()
+	last := -1
+	for i, msg := range dialogue {
+		if msg.Role == RoleUser {
+			last = i
+		}
+	}
+	if last < 0 {
+		return nil, fmt.Errorf("%w: no user message to regenerate a reply to", ErrInvalidState)
+	}
+
+	// Nothing to discard if the last reply failed before it was recorded
+	if last < len(dialogue)-1 {
+		if err := c.rebuild(ctx, dialogue[:last+1]); err != nil {
+			return nil, err
+		}
+	}
+	return c.reply(ctx)
+}
+
+// EditUserMessage replaces the user message at index in [ChatSession.History]
+// with text, discards everything after it and streams a new reply. The
+// conversation before the message is replayed onto a new sequence. It fails
+// with ErrInvalidState while a reply is streaming or if index isn't a user
+// message.
+func (c *ChatSession) EditUserMessage(ctx context.Context, index int, text string) (*GenStream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replying() {
+		return nil, ErrInvalidState
+	}
+
+	dialogue := c.dialogue()
+	if index < 0 || index >= len(dialogue) || dialogue[index].Role != RoleUser {
+		return nil, fmt.Errorf("%w: no user message at index %d", ErrInvalidState, index)
+	}
+
+	if err := c.rebuild(ctx, dialogue[:index]); err != nil {
+		return nil, err
+	}
+	if err := c.seq.Append(ctx, text, AsUser()); err != nil {
+		return nil, err
+	}
+	return c.reply(ctx)
+}
+
+// SetSystemPrompt replaces the system prompt mid-conversation, e.g. to
+// switch personas. The protocol can't edit a sequence's context, so the
+// conversation is replayed onto a new sequence that starts with the new
+// prompt; an empty prompt removes it. It fails with ErrInvalidState while a
+// reply is streaming.
+func (c *ChatSession) SetSystemPrompt(ctx context.Context, prompt string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replying() {
+		return ErrInvalidState
+	}
+
+	dialogue := c.dialogue()
+	old := c.cfg.systemPrompt
+	c.cfg.systemPrompt = prompt
+	if err := c.rebuild(ctx, dialogue); err != nil {
+		c.cfg.systemPrompt = old
+		return err
+	}
+	return nil
+}
+
+// SystemPrompt returns the session's system prompt.
+func (c *ChatSession) SystemPrompt() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg.systemPrompt
+}
+
+// Close closes the session's sequence.
+func (c *ChatSession) Close(ctx context.Context) error {
+	return c.Seq().Close(ctx)
+}
+
+// setup returns the messages a new sequence starts with.
+func (c *ChatSession) setup() []Message {
+	var setup []Message
+	if c.cfg.systemPrompt != "" {
+		setup = append(setup, Message{Role: RoleSystem, Text: c.cfg.systemPrompt})
+	}
+	if c.summary != "" {
+		setup = append(setup, Message{Role: RoleSystem, Text: "Summary of the earlier conversation:\n\n" + c.summary})
+	}
+	return setup
+}
+
+// dialogue returns the sequence's history after the setup messages. c.mu
+// must be held.
+func (c *ChatSession) dialogue() []Message {
+	history := c.seq.History()
+	return history[min(len(c.setup()), len(history)):]
+}
+
+// replying reports whether the latest reply is still streaming. c.mu must
+// be held.
+func (c *ChatSession) replying() bool {
+	if c.turn == nil {
+		return false
+	}
+	select {
+	case <-c.turn.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// trim drops the oldest messages when a message and its reply would exceed
+// the limit set with WithChatMaxMessages. c.mu must be held.
+func (c *ChatSession) trim(ctx context.Context) error {
+	limit := c.cfg.maxMessages
+	if limit <= 0 {
+		return nil
+	}
+	dialogue := c.dialogue()
+	if len(dialogue)+2 <= limit {
+		return nil
+	}
+
+	start := min(len(dialogue)-(limit-2), len(dialogue))
+	for start < len(dialogue) && dialogue[start].Role != RoleUser {
+		start++
+	}
+	return c.rebuild(ctx, dialogue[start:])
+}
+
+// summarize replaces the older messages with a summary when the context has
+// reached the threshold set with WithChatSummarize. c.mu must be held.
+func (c *ChatSession) summarize(ctx context.Context) error {
+	if c.cfg.summarizeAt <= 0 {
+		return nil
+	}
+	tokens, window := c.seq.ContextUsage()
+	if window <= 0 || float64(tokens) < c.cfg.summarizeAt*float64(window) {
+		return nil
+	}
+
+	dialogue := c.dialogue()
+	start := max(len(dialogue)-c.cfg.summaryKeep, 0)
+	for start < len(dialogue) && dialogue[start].Role != RoleUser {
+		start++
+	}
+	if start == 0 {
+		return nil
+	}
+
+	// Only the messages being replaced are summarized, on a sequence
+	// replaying them after the setup messages
+	older, err := c.replay(ctx, dialogue[:start])
+	if err != nil {
+		return err
+	}
+	defer func() { go older.Close(older.client.ctx) }()
+	summary, err := older.summarize(ctx, "")
+	if err != nil {
+		return err
+	}
+	old := c.summary
+	c.summary = summary
+	if err := c.rebuild(ctx, dialogue[start:]); err != nil {
+		c.summary = old
+		return err
+	}
+	return nil
+}
+
+// rebuild replaces the session's sequence with a new one holding the setup
+// messages and dialogue. c.mu must be held.
+func (c *ChatSession) rebuild(ctx context.Context, dialogue []Message) error {
+	seq, err := c.replay(ctx, dialogue)
+	if err != nil {
+		return err
+	}
+
+	old := c.seq
+	c.seq = seq
+	go old.Close(old.client.ctx)
+	return nil
+}
+
+// replay opens a sequence in the session's run holding the setup messages
+// and dialogue. c.mu must be held.
+func (c *ChatSession) replay(ctx context.Context, dialogue []Message) (*Seq, error) {
+	history := append(c.setup(), dialogue...)
+	open := c.open
+	open.runID = c.seq.RunID()
+	open.budget = c.seq.cfg.budget // Keep counting against the sequence budget
+	return c.seq.client.replay(ctx, c.seq.Model(), history, open)
+}
+
+// reply generates a reply on the session's sequence. c.mu must be held.
+func (c *ChatSession) reply(ctx context.Context) (*GenStream, error) {
+	opts := append([]GenOption{GenerateAsAssistant()}, c.cfg.genOptions...)
+	inner, err := c.seq.Generate(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := newGenStream(c.seq, inner.cid)
+	stream.ctx = inner.ctx
+	stream.zeroCopy = inner.zeroCopy
+	stream.markSent()
+	c.turn = stream
+
+	go c.runTools(ctx, stream, inner, opts)
+	return stream, nil
+}
+
+// runTools forwards the reply in inner to stream. When the model calls
+// tools, it runs them and forwards the continuation, until the model replies
+// without calling a tool.
+func (c *ChatSession) runTools(ctx context.Context, stream, inner *GenStream, opts []GenOption) {
+	var outputTokens int
+	for rounds := 0; ; rounds++ {
+		var calls []ToolCall
+		for {
+			chunk, err := inner.Next(stream.ctx)
+			if err != nil {
+				stream.handleError(err)
+				return
+			}
+			if chunk == nil {
+				break
+			}
+			stream.forward(chunk)
+
+			// The server waits for the results before continuing
+			if len(chunk.ToolCalls) > 0 {
+				calls = chunk.ToolCalls
+				break
+			}
+		}
+		outputTokens += inner.OutputTokens()
+
+		// Retries can move the conversation to a new sequence
+		seq := inner.Seq()
+		c.mu.Lock()
+		c.seq = seq
+		c.mu.Unlock()
+		stream.mu.Lock()
+		stream.seq = seq
+		stream.mu.Unlock()
+
+		if len(calls) == 0 || seq.cfg.tools == nil {
+			stream.handleFinish(&MSEvent{InputTokens: inner.InputTokens(), OutputTokens: outputTokens})
+			return
+		}
+		if rounds >= c.cfg.maxToolRounds {
+			stream.handleError(fmt.Errorf("%w: stopped after %d rounds", ErrToolLoop, rounds))
+			return
+		}
+
+		// Sub-agents the tools start join the sequence's run
+		toolCtx := ctx
+		if runID := seq.RunID(); runID != "" {
+			toolCtx = ContextWithRunID(ctx, runID)
+		}
+		results, err := seq.cfg.tools.CallTools(toolCtx, calls)
+		if err == nil {
+			inner, err = seq.ToolReturn(ctx, results, opts...)
+		}
+		if err != nil {
+			stream.handleError(err)
+			return
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// chatServer opens and forks sequences seq-1, seq-2 and so on, completes
+// appends and answers generations with reply. Generations after "weather?"
+// call the get_weather tool first, and call it again while it returns
+// "again". DefaultSummaryPrompt is answered with "In brief.".
+func chatServer(reply string) func(req *MSRequest) []*MSEvent {
+	var opened atomic.Int32
+	var lastAppend atomic.Value
+	return func(req *MSRequest) []*MSEvent {
+		if req.Request == "seq_open" {
+			id := fmt.Sprintf("seq-%d", opened.Add(1))
+			return []*MSEvent{{Event: "seq_opened", CID: req.CID, SeqID: id}}
+		}
+
+		switch data := req.Data.(type) {
+		case forkCommandData:
+			id := fmt.Sprintf("seq-%d", opened.Add(1))
+			return []*MSEvent{{Event: "seq_fork_finish", SeqID: req.SeqID, CID: req.CID, ChildSeqID: id}}
+		case appendCommandData:
+			lastAppend.Store(data.Text)
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			if text, _ := lastAppend.Load().(string); text == "weather?" {
+				return []*MSEvent{{
+					Event:     "seq_tool_call",
+					SeqID:     req.SeqID,
+					CID:       req.CID,
+					ToolCalls: []SeqToolCall{{Name: "get_weather", Args: `{}`}},
+				}}
+			}
+			text := reply
+			if last, _ := lastAppend.Load().(string); last == DefaultSummaryPrompt {
+				text = "In brief."
+			}
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: text},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID},
+			}
+		case toolReturnCommandData:
+			if data.Results[0].Result == "again" {
+				return []*MSEvent{{
+					Event:     "seq_tool_call",
+					SeqID:     req.SeqID,
+					CID:       req.CID,
+					ToolCalls: []SeqToolCall{{Name: "get_weather", Args: `{}`}},
+				}}
+			}
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "It is " + data.Results[0].Result},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID},
+			}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		}
+		return nil
+	}
+}
+
+func TestChatSession_Send(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	chat, err := NewChatSession(ctx, client, "test-model", WithChatSystemPrompt("Be brief."))
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+
+	stream, err := chat.Send(ctx, "Hello")
+	if err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if text, err := stream.Text(ctx); err != nil || text != "Hi!" {
+		t.Fatalf("Text = %q, %v, want Hi!", text, err)
+	}
+	chat.Seq().Wait(ctx)
+
+	history := chat.History()
+	if len(history) != 2 || history[0].Text != "Hello" || history[1].Text != "Hi!" {
+		t.Errorf("History = %+v, want the exchange without the system prompt", history)
+	}
+	if full := chat.Seq().History(); len(full) != 3 || full[0].Role != RoleSystem {
+		t.Errorf("sequence history = %+v, want the system prompt first", full)
+	}
+}
+
+func TestChatSession_Tools(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	toolbox := NewToolbox()
+	toolbox.Add(NewFuncTool(ToolDefinition{Name: "get_weather"}, func(ctx context.Context, args string) (string, error) {
+		return "sunny", nil
+	}))
+
+	chat, err := NewChatSession(ctx, client, "test-model", WithChatOpenOptions(WithToolbox(toolbox)))
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+
+	stream, err := chat.Send(ctx, "weather?")
+	if err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	var calls int
+	var text string
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		calls += len(chunk.ToolCalls)
+		text += chunk.Text
+	}
+	if calls != 1 || text != "It is sunny" {
+		t.Errorf("stream = %d calls, %q, want the call and the continuation", calls, text)
+	}
+}
+
+func TestChatSession_MaxToolRounds(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	toolbox := NewToolbox()
+	toolbox.Add(NewFuncTool(ToolDefinition{Name: "get_weather"}, func(ctx context.Context, args string) (string, error) {
+		return "again", nil
+	}))
+
+	chat, err := NewChatSession(ctx, client, "test-model",
+		WithChatOpenOptions(WithToolbox(toolbox)),
+		WithChatMaxToolRounds(2),
+	)
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+
+	stream, err := chat.Send(ctx, "weather?")
+	if err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if _, err := stream.Text(ctx); !errors.Is(err, ErrToolLoop) {
+		t.Errorf("Text error = %v, want ErrToolLoop", err)
+	}
+}
+
+func TestChatSession_MaxMessages(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("ok"))
+
+	chat, err := NewChatSession(ctx, client, "test-model",
+		WithChatSystemPrompt("Be brief."),
+		WithChatMaxMessages(3),
+	)
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+
+	for _, text := range []string{"one", "two"} {
+		stream, err := chat.Send(ctx, text)
+		if err != nil {
+			t.Fatalf("Send error: %v", err)
+		}
+		if _, err := stream.Text(ctx); err != nil {
+			t.Fatalf("Text error: %v", err)
+		}
+		chat.Seq().Wait(ctx)
+	}
+
+	// The first exchange was dropped to make room for the second
+	if id := chat.Seq().ID(); id != "seq-2" {
+		t.Errorf("Seq().ID() = %s, want the replayed seq-2", id)
+	}
+	history := chat.History()
+	if len(history) != 2 || history[0].Text != "two" {
+		t.Errorf("History = %+v, want only the second exchange", history)
+	}
+	if full := chat.Seq().History(); len(full) != 3 || full[0].Text != "Be brief." {
+		t.Errorf("sequence history = %+v, want the system prompt kept", full)
+	}
+}
+
+func TestChatSession_Summarize(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport, WithContextWindows(ContextWindows{"test-model": 100}))
+	defer client.Close(ctx)
+
+	// Each exchange fills 80 tokens of the window
+	server := chatServer("ok")
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		events := server(req)
+		for _, event := range events {
+			switch event.Event {
+			case "seq_append_finish":
+				event.InputTokens = 30
+			case "seq_gen_finish":
+				event.InputTokens, event.OutputTokens = 60, 20
+			}
+		}
+		return events
+	})
+
+	chat, err := NewChatSession(ctx, client, "test-model",
+		WithChatSystemPrompt("Be brief."),
+		WithChatSummarize(0.75, 2),
+	)
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+
+	for _, text := range []string{"one", "two", "three"} {
+		stream, err := chat.Send(ctx, text)
+		if err != nil {
+			t.Fatalf("Send error: %v", err)
+		}
+		if _, err := stream.Text(ctx); err != nil {
+			t.Fatalf("Text error: %v", err)
+		}
+		chat.Seq().Wait(ctx)
+	}
+
+	// The first exchange was summarized before the third was sent
+	if got := chat.Summary(); got != "In brief." {
+		t.Errorf("Summary = %q, want In brief.", got)
+	}
+	history := chat.History()
+	if len(history) != 4 || history[0].Text != "two" {
+		t.Errorf("History = %+v, want the second and third exchanges", history)
+	}
+	full := chat.Seq().History()
+	if len(full) != 6 || full[0].Text != "Be brief." || !strings.HasSuffix(full[1].Text, "In brief.") {
+		t.Errorf("sequence history = %+v, want the system prompt and the summary first", full)
+	}
+
+	// The summary saw only the summarized exchange
+	var summarySeq string
+	appended := make(map[string][]string)
+	for _, req := range transport.getRequests() {
+		if data, ok := req.Data.(appendCommandData); ok {
+			appended[req.SeqID] = append(appended[req.SeqID], data.Text)
+			if data.Text == DefaultSummaryPrompt {
+				summarySeq = req.SeqID
+			}
+		}
+	}
+	if got := appended[summarySeq]; strings.Join(got, "|") != "Be brief.|one|ok|"+DefaultSummaryPrompt {
+		t.Errorf("summary sequence %s appended %q, want the first exchange only", summarySeq, got)
+	}
+}
+
+func TestChatSession_SetSystemPrompt(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	chat, err := NewChatSession(ctx, client, "test-model", WithChatSystemPrompt("Be brief."))
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+	stream, err := chat.Send(ctx, "Hello")
+	if err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	chat.Seq().Wait(ctx)
+
+	if err := chat.SetSystemPrompt(ctx, "Talk like a pirate."); err != nil {
+		t.Fatalf("SetSystemPrompt error: %v", err)
+	}
+
+	full := chat.Seq().History()
+	if chat.Seq().ID() != "seq-2" || len(full) != 3 || full[0].Text != "Talk like a pirate." {
+		t.Errorf("sequence %s history = %+v, want the new prompt before the dialogue", chat.Seq().ID(), full)
+	}
+	if history := chat.History(); len(history) != 2 || history[0].Text != "Hello" {
+		t.Errorf("History = %+v, want the dialogue kept", history)
+	}
+
+	// Removing the prompt leaves just the dialogue
+	if err := chat.SetSystemPrompt(ctx, ""); err != nil {
+		t.Fatalf("SetSystemPrompt error: %v", err)
+	}
+	if full := chat.Seq().History(); len(full) != 2 || full[0].Role != RoleUser {
+		t.Errorf("sequence history = %+v, want no system prompt", full)
+	}
+}
+
+// chatTurn starts a reply with send and waits for it to be recorded.
+func chatTurn(t *testing.T, chat *ChatSession, send func() (*GenStream, error)) string {
+	t.Helper()
+
+	stream, err := send()
+	if err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	text, err := stream.Text(context.Background())
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	chat.Seq().Wait(context.Background())
+	return text
+}
+
+func TestChatSession_Regenerate(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	chat, err := NewChatSession(ctx, client, "test-model")
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+	if _, err := chat.Regenerate(ctx); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Regenerate without messages = %v, want ErrInvalidState", err)
+	}
+
+	chatTurn(t, chat, func() (*GenStream, error) { return chat.Send(ctx, "one") })
+	chatTurn(t, chat, func() (*GenStream, error) { return chat.Send(ctx, "two") })
+	chatTurn(t, chat, func() (*GenStream, error) { return chat.Regenerate(ctx) })
+
+	history := chat.History()
+	var texts []string
+	for _, msg := range history {
+		texts = append(texts, msg.Text)
+	}
+	if len(texts) != 4 || texts[2] != "two" || texts[3] != "Hi!" {
+		t.Errorf("History = %q, want one reply to two", texts)
+	}
+	if chat.Seq().ID() != "seq-2" {
+		t.Errorf("Seq().ID() = %s, want the replayed seq-2", chat.Seq().ID())
+	}
+
+	// The discarded reply isn't replayed
+	var replayed []string
+	for _, req := range transport.getRequests() {
+		if data, ok := req.Data.(appendCommandData); ok && req.SeqID == "seq-2" {
+			replayed = append(replayed, data.Text)
+		}
+	}
+	if len(replayed) != 3 || replayed[2] != "two" {
+		t.Errorf("replayed = %q, want the conversation up to two", replayed)
+	}
+}
+
+func TestChatSession_EditUserMessage(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	chat, err := NewChatSession(ctx, client, "test-model", WithChatSystemPrompt("Be brief."))
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+	chatTurn(t, chat, func() (*GenStream, error) { return chat.Send(ctx, "one") })
+	chatTurn(t, chat, func() (*GenStream, error) { return chat.Send(ctx, "two") })
+
+	if _, err := chat.EditUserMessage(ctx, 1, "edited"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("EditUserMessage of a reply = %v, want ErrInvalidState", err)
+	}
+
+	chatTurn(t, chat, func() (*GenStream, error) { return chat.EditUserMessage(ctx, 0, "uno") })
+
+	var texts []string
+	for _, msg := range chat.History() {
+		texts = append(texts, msg.Text)
+	}
+	if len(texts) != 2 || texts[0] != "uno" || texts[1] != "Hi!" {
+		t.Errorf("History = %q, want the edited message and its reply", texts)
+	}
+	if full := chat.Seq().History(); full[0].Text != "Be brief." {
+		t.Errorf("sequence history = %+v, want the system prompt kept", full)
+	}
+}
@@ -0,0 +1,56 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+)
+
+// Checkpoint marks a point in a conversation, made by [Seq.Checkpoint], that
+// [Seq.RollbackTo] can return to.
+type Checkpoint struct {
+	messages int    // Length of the history at the checkpoint
+	hash     string // TranscriptHash of that history
+}
+
+// Checkpoint marks the conversation as it is now, so an agent can explore a
+// risky path and revert with [Seq.RollbackTo] if it fails. A generation
+// still in progress isn't part of the checkpoint.
+func (s *Seq) Checkpoint() Checkpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Checkpoint{messages: len(s.history), hash: TranscriptHash(s.history)}
+}
+
+// RollbackTo returns a sequence holding the conversation as it was at cp.
+// The protocol can't remove messages from a sequence, so the history up to
+// cp is replayed onto a new sequence, opened with the same model and
+// options, and s is closed; see [Client.Replay] for how the history is
+// recreated. If nothing was added since cp, s itself is returned.
+//
+// cp may come from s or from a sequence s was rolled back from, as long as
+// the conversation still starts with the history at cp. It fails with
+// ErrInvalidState otherwise, or while a generation is in progress.
+func (s *Seq) RollbackTo(ctx context.Context, cp Checkpoint) (*Seq, error) {
+	s.mu.RLock()
+	closed, generating := s.closed, s.gens.busy()
+	history := append([]Message(nil), s.history...)
+	s.mu.RUnlock()
+
+	switch {
+	case closed:
+		return nil, ErrSeqClosed
+	case generating:
+		return nil, ErrInvalidState
+	case cp.messages > len(history) || TranscriptHash(history[:cp.messages]) != cp.hash:
+		return nil, fmt.Errorf("%w: checkpoint isn't part of the conversation", ErrInvalidState)
+	case cp.messages == len(history):
+		return s, nil
+	}
+
+	seq, err := s.client.replay(ctx, s.model, history[:cp.messages], s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	go s.Close(s.client.ctx)
+	return seq, nil
+}
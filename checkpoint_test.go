@@ -0,0 +1,80 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSeq_RollbackTo(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	seq, err := client.Open(ctx, "test-model", WithSeqTag("agent", "planner"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Append(ctx, "plan", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	cp := seq.Checkpoint()
+
+	// Explore a path, then revert it
+	if err := seq.Append(ctx, "risky step", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	seq.Wait(ctx)
+
+	rolled, err := seq.RollbackTo(ctx, cp)
+	if err != nil {
+		t.Fatalf("RollbackTo error: %v", err)
+	}
+	if rolled.ID() != "seq-2" || rolled.Tags()["agent"] != "planner" {
+		t.Errorf("rolled back to %s with tags %v, want seq-2 with the original options", rolled.ID(), rolled.Tags())
+	}
+	if history := rolled.History(); len(history) != 1 || history[0].Text != "plan" {
+		t.Errorf("History = %+v, want the conversation at the checkpoint", history)
+	}
+
+	// Rolling back to where the sequence already is keeps it
+	if again, err := rolled.RollbackTo(ctx, cp); err != nil || again != rolled {
+		t.Errorf("RollbackTo at checkpoint = %v, %v, want the same sequence", again, err)
+	}
+}
+
+func TestSeq_RollbackTo_OtherConversation(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, chatServer("Hi!"))
+
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Append(ctx, "one", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	cp := seq.Checkpoint()
+
+	other, err := client.Replay(ctx, "test-model", []Message{{Role: RoleUser, Text: "two"}, {Role: RoleUser, Text: "three"}})
+	if err != nil {
+		t.Fatalf("Replay error: %v", err)
+	}
+	if _, err := other.RollbackTo(ctx, cp); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("RollbackTo error = %v, want ErrInvalidState", err)
+	}
+}
@@ -0,0 +1,120 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Choose makes the model pick one of options as the continuation of the
+// sequence and returns its index. Append the question before calling it;
+// the sequence is left unchanged.
+//
+// Each option is scored with [Seq.Score] and the most likely one wins. If the
+// server doesn't support scoring, Choose instead generates hidden text on a
+// fork, constrained by a regex mask to exactly one of the options; opts
+// configure that generation.
+func (s *Seq) Choose(ctx context.Context, options []string, opts ...GenOption) (int, error) {
+	idx, _, err := s.choose(ctx, options, opts)
+	return idx, err
+}
+
+// choose picks one of options, returning the log probability of each option
+// if the server supports scoring.
+func (s *Seq) choose(ctx context.Context, options []string, opts []GenOption) (int, []float64, error) {
+	if len(options) == 0 {
+		return 0, nil, errors.New("modelsocket: no options to choose from")
+	}
+
+	if !s.client.noScore.Load() {
+		idx, logprobs, err := s.chooseByScore(ctx, options)
+		var protoErr *ProtocolError
+		if !errors.As(err, &protoErr) {
+			return idx, logprobs, err
+		}
+		// Fall back for this choice, and for good if the server doesn't
+		// know the command
+		if isUnknownCommand(err) {
+			s.client.noScore.Store(true)
+		}
+	}
+
+	idx, err := s.chooseByMask(ctx, options, opts)
+	return idx, nil, err
+}
+
+// chooseByScore returns the option with the highest log probability.
+func (s *Seq) chooseByScore(ctx context.Context, options []string) (int, []float64, error) {
+	best := 0
+	logprobs := make([]float64, len(options))
+	for i, option := range options {
+		logprob, _, err := s.Score(ctx, option)
+		if err != nil {
+			return 0, nil, err
+		}
+		logprobs[i] = logprob
+		if logprob > logprobs[best] {
+			best = i
+		}
+	}
+	return best, logprobs, nil
+}
+
+// chooseByMask generates one of the options under a regex mask, on a fork
+// so the sequence is left unchanged.
+func (s *Seq) chooseByMask(ctx context.Context, options []string, opts []GenOption) (int, error) {
+	quoted := make([]string, len(options))
+	for i, option := range options {
+		quoted[i] = regexp.QuoteMeta(option)
+	}
+	pattern := "(?:" + strings.Join(quoted, "|") + ")"
+
+	opts = append(opts[:len(opts):len(opts)], WithRegexMask(pattern), WithHidden())
+	fork, err := s.Fork(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { go fork.Close(fork.client.ctx) }()
+
+	stream, err := fork.Generate(ctx, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	// Text skips hidden chunks, so collect them here
+	var text strings.Builder
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			return 0, err
+		}
+		text.WriteString(chunk.Text)
+	}
+
+	return matchOption(text.String(), options)
+}
+
+// matchOption returns the index of the option text names. Generation can
+// stop early, so a prefix of exactly one option also matches.
+func matchOption(text string, options []string) (int, error) {
+	text = strings.TrimSpace(text)
+	if i := slices.Index(options, text); i >= 0 {
+		return i, nil
+	}
+
+	match := -1
+	for i, option := range options {
+		if text != "" && strings.HasPrefix(option, text) {
+			if match >= 0 {
+				return 0, fmt.Errorf("modelsocket: choice %q matches more than one option", text)
+			}
+			match = i
+		}
+	}
+	if match < 0 {
+		return 0, fmt.Errorf("modelsocket: choice %q matches no option", text)
+	}
+	return match, nil
+}
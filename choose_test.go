@@ -0,0 +1,179 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSeq_Choose_Score(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	logprobs := map[string]float64{"red": -3, "green": -0.5, "blue": -2}
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		data, ok := req.Data.(scoreCommandData)
+		if !ok {
+			t.Errorf("unexpected request %T", req.Data)
+			return nil
+		}
+		return []*MSEvent{{Event: "seq_score_finish", SeqID: req.SeqID, CID: req.CID, LogProb: logprobs[data.Text]}}
+	})
+
+	idx, err := seq.Choose(ctx, []string{"red", "green", "blue"})
+	if err != nil {
+		t.Fatalf("Choose error: %v", err)
+	}
+	if idx != 1 {
+		t.Errorf("idx = %d, want 1", idx)
+	}
+}
+
+func TestSeq_Choose_Mask(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	var forks atomic.Int32
+	gens := make(chan *MSRequest, 2)
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		switch req.Data.(type) {
+		case scoreCommandData:
+			return []*MSEvent{{Event: "error", SeqID: req.SeqID, CID: req.CID, Message: "unknown command"}}
+		case forkCommandData:
+			child := fmt.Sprintf("fork-%d", forks.Add(1))
+			return []*MSEvent{{Event: "seq_fork_finish", SeqID: req.SeqID, CID: req.CID, ChildSeqID: child}}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			gens <- req
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "blu", Hidden: true},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID},
+			}
+		}
+		return nil
+	})
+
+	for range 2 {
+		idx, err := seq.Choose(ctx, []string{"red", "green", "blue?"}, WithTemperature(0))
+		if err != nil {
+			t.Fatalf("Choose error: %v", err)
+		}
+		if idx != 2 {
+			t.Errorf("idx = %d, want 2", idx)
+		}
+	}
+
+	req := <-gens
+	if req.SeqID == "seq-1" {
+		t.Error("generated on the sequence, want a fork")
+	}
+	data := req.Data.(genCommandData)
+	if data.RegexMask == nil || *data.RegexMask != `(?:red|green|blue\?)` {
+		t.Errorf("RegexMask = %v, want (?:red|green|blue\\?)", data.RegexMask)
+	}
+	if !data.Hidden {
+		t.Error("Hidden = false, want true")
+	}
+	if data.Temperature == nil || *data.Temperature != 0 {
+		t.Errorf("Temperature = %v, want 0", data.Temperature)
+	}
+	if history := seq.History(); len(history) != 0 {
+		t.Errorf("history = %+v, want the sequence unchanged", history)
+	}
+
+	// Scoring is only attempted once
+	scores := 0
+	for _, req := range transport.getRequests() {
+		if _, ok := req.Data.(scoreCommandData); ok {
+			scores++
+		}
+	}
+	if scores != 1 {
+		t.Errorf("score requests = %d, want 1", scores)
+	}
+}
+
+func TestSeq_Choose_ScoreErrorFallsBackOnce(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	var failed atomic.Bool
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		switch data := req.Data.(type) {
+		case scoreCommandData:
+			if !failed.Swap(true) {
+				return []*MSEvent{{Event: "error", SeqID: req.SeqID, CID: req.CID, Message: "server overloaded"}}
+			}
+			logprob := -1.0
+			if data.Text == "no" {
+				logprob = -0.1
+			}
+			return []*MSEvent{{Event: "seq_score_finish", SeqID: req.SeqID, CID: req.CID, LogProb: logprob}}
+		case forkCommandData:
+			return []*MSEvent{{Event: "seq_fork_finish", SeqID: req.SeqID, CID: req.CID, ChildSeqID: "fork-1"}}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "yes", Hidden: true},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID},
+			}
+		}
+		return nil
+	})
+
+	options := []string{"yes", "no"}
+	if idx, err := seq.Choose(ctx, options); err != nil || idx != 0 {
+		t.Fatalf("Choose = %d, %v, want the masked choice 0", idx, err)
+	}
+
+	// A transient error doesn't stop scoring
+	if idx, err := seq.Choose(ctx, options); err != nil || idx != 1 {
+		t.Fatalf("Choose = %d, %v, want the scored choice 1", idx, err)
+	}
+}
+
+func TestMatchOption(t *testing.T) {
+	options := []string{"not sure", "yes", "no"}
+
+	tests := []struct {
+		text    string
+		want    int
+		wantErr bool
+	}{
+		{"yes", 1, false},
+		{" no\n", 2, false},
+		{"not", 0, false},
+		{"n", 0, true},
+		{"maybe", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := matchOption(tt.text, options)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("matchOption(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("matchOption(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
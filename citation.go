@@ -0,0 +1,34 @@
+package modelsocket
+
+import "slices"
+
+// Citation attributes part of a generation to a source, on servers that
+// ground generations in retrieved documents.
+type Citation struct {
+	// SourceID identifies the cited source, as it was given to the model.
+	SourceID string `json:"source_id"`
+
+	// Start and End delimit the cited span as character offsets into the
+	// generation's text, End exclusive. They count from the start of the
+	// generation rather than the chunk, as a span may cover several chunks.
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Span returns the cited part of text, the generation's full text. Offsets
+// outside text are clamped.
+func (c Citation) Span(text string) string {
+	runes := []rune(text)
+	end := min(max(c.End, 0), len(runes))
+	start := min(max(c.Start, 0), end)
+	return string(runes[start:end])
+}
+
+// Citations returns the citations the server has sent for the generation so
+// far, in the order they arrived. It is empty for servers that don't cite
+// sources.
+func (g *GenStream) Citations() []Citation {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.citations)
+}
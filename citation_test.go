@@ -0,0 +1,67 @@
+package modelsocket
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCitations(t *testing.T) {
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectGenerate().
+		Respond(&MSEvent{Event: "seq_text", Text: "Café prices "}).
+		Respond(&MSEvent{Event: "seq_text", Text: "rose 5%.", Citations: []Citation{{SourceID: "doc-1", Start: 0, End: 20}}}).
+		Respond(&MSEvent{Event: "seq_gen_finish", Citations: []Citation{{SourceID: "doc-2", Start: 5, End: 11}}})
+	client := sc.Client()
+
+	ctx := context.Background()
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	var text string
+	var chunkCitations [][]Citation
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		text += chunk.Text
+		chunkCitations = append(chunkCitations, chunk.Citations)
+	}
+	if len(chunkCitations) != 2 || chunkCitations[0] != nil || len(chunkCitations[1]) != 1 {
+		t.Errorf("chunk citations = %+v, want one on the second chunk", chunkCitations)
+	}
+
+	citations := stream.Citations()
+	want := []Citation{{SourceID: "doc-1", Start: 0, End: 20}, {SourceID: "doc-2", Start: 5, End: 11}}
+	if !reflect.DeepEqual(citations, want) {
+		t.Fatalf("Citations = %+v, want %+v", citations, want)
+	}
+	if got := citations[0].Span(text); got != "Café prices rose 5%." {
+		t.Errorf("Span = %q, want the whole text", got)
+	}
+	if got := citations[1].Span(text); got != "prices" {
+		t.Errorf("Span = %q, want a span counted in characters", got)
+	}
+}
+
+func TestCitation_SpanClamped(t *testing.T) {
+	tests := []struct {
+		citation Citation
+		want     string
+	}{
+		{Citation{Start: 2, End: 100}, "llo"},
+		{Citation{Start: -1, End: 2}, "he"},
+		{Citation{Start: 4, End: 2}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.citation.Span("hello"); got != tt.want {
+			t.Errorf("%+v.Span = %q, want %q", tt.citation, got, tt.want)
+		}
+	}
+}
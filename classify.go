@@ -0,0 +1,70 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// classifyPrompt asks the model to label the input. It is followed by the
+// labels and the input.
+const classifyPrompt = "Classify the following input. Answer with exactly one of these labels: %s.\n\nInput:\n%s"
+
+// Classify asks the model which of labels applies to input and returns it
+// along with a confidence between 0 and 1. The prompt is appended to a fork
+// of seq, which is left unchanged, so a sequence holding instructions or
+// examples can classify many inputs.
+//
+// The answer is constrained to the label set with [Seq.Choose]. Confidence is
+// the label's share of the probability across all labels, and is 0 if the
+// server doesn't support scoring.
+//
+//	type Sentiment string
+//
+//	label, conf, err := modelsocket.Classify(ctx, seq, review,
+//	    []Sentiment{"positive", "negative", "neutral"})
+func Classify[T ~string](ctx context.Context, seq *Seq, input string, labels []T) (T, float64, error) {
+	var zero T
+
+	options := make([]string, len(labels))
+	for i, label := range labels {
+		options[i] = string(label)
+	}
+
+	fork, err := seq.Fork(ctx)
+	if err != nil {
+		return zero, 0, err
+	}
+	defer func() { go fork.Close(fork.client.ctx) }()
+
+	prompt := fmt.Sprintf(classifyPrompt, strings.Join(options, ", "), input)
+	if err := fork.Append(ctx, prompt, AsUser()); err != nil {
+		return zero, 0, err
+	}
+
+	idx, logprobs, err := fork.choose(ctx, options, []GenOption{GenerateAsAssistant()})
+	if err != nil {
+		return zero, 0, err
+	}
+	return labels[idx], softmaxAt(logprobs, idx), nil
+}
+
+// softmaxAt returns the normalized probability of logprobs[i], or 0 if there
+// are no log probabilities.
+func softmaxAt(logprobs []float64, i int) float64 {
+	if len(logprobs) == 0 {
+		return 0
+	}
+
+	peak := logprobs[0]
+	for _, lp := range logprobs[1:] {
+		peak = max(peak, lp)
+	}
+
+	var sum float64
+	for _, lp := range logprobs {
+		sum += math.Exp(lp - peak)
+	}
+	return math.Exp(logprobs[i]-peak) / sum
+}
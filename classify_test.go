@@ -0,0 +1,69 @@
+package modelsocket
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+type testSentiment string
+
+func TestClassify(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	logprobs := map[string]float64{"positive": math.Log(0.6), "negative": math.Log(0.2)}
+	prompts := make(chan *MSRequest, 1)
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		switch data := req.Data.(type) {
+		case forkCommandData:
+			return []*MSEvent{{Event: "seq_fork_finish", SeqID: req.SeqID, CID: req.CID, ChildSeqID: "fork-1"}}
+		case appendCommandData:
+			prompts <- req
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case scoreCommandData:
+			return []*MSEvent{{Event: "seq_score_finish", SeqID: req.SeqID, CID: req.CID, LogProb: logprobs[data.Text]}}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		}
+		return nil
+	})
+
+	label, conf, err := Classify(ctx, seq, "Loved it!", []testSentiment{"positive", "negative"})
+	if err != nil {
+		t.Fatalf("Classify error: %v", err)
+	}
+	if label != "positive" {
+		t.Errorf("label = %s, want positive", label)
+	}
+	if math.Abs(conf-0.75) > 1e-9 {
+		t.Errorf("conf = %v, want 0.75", conf)
+	}
+
+	req := <-prompts
+	if req.SeqID != "fork-1" {
+		t.Errorf("prompt appended to %s, want fork-1", req.SeqID)
+	}
+	text := req.Data.(appendCommandData).Text
+	if !strings.Contains(text, "positive, negative") || !strings.Contains(text, "Loved it!") {
+		t.Errorf("prompt = %q, want labels and input", text)
+	}
+}
+
+func TestSoftmaxAt(t *testing.T) {
+	if got := softmaxAt(nil, 0); got != 0 {
+		t.Errorf("softmaxAt(nil) = %v, want 0", got)
+	}
+
+	// Large magnitudes don't underflow
+	got := softmaxAt([]float64{-1000, -1000 + math.Log(3)}, 1)
+	if math.Abs(got-0.75) > 1e-9 {
+		t.Errorf("softmaxAt = %v, want 0.75", got)
+	}
+}
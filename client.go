@@ -2,8 +2,12 @@ package modelsocket
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -18,29 +22,61 @@ type Client struct {
 
 	mu       sync.RWMutex
 	seqs     map[string]*Seq          // active sequences by seq_id
+	labels   map[string]*Seq          // active sequences by WithSeqLabel
 	pending  map[string]chan *MSEvent // pending opens by cid
 	closed   bool
 	closeErr error
+	pendErr  error // What requests pending at termination fail with
+
+	done      chan struct{} // closed once closeErr is set
+	closeOnce sync.Once
+
+	// Set once the server has rejected a score command
+	noScore atomic.Bool
+
+	// Events for sequences the client doesn't know
+	orphans atomic.Int64
+
+	// The CID servers continue generations under after a tool return, once
+	// seen; see noteResume
+	resumeCID atomic.Int32
+
+	// Generations shared by WithCoalesce, by key
+	flightMu sync.Mutex
+	flights  map[string]*flight
+
+	// Requests waiting to be sent, with WithPriorityScheduling
+	sendQueue *sendQueue
+
+	// Observed generation speed by model, for WithDeadlineBudget
+	rates tokenRates
 }
 
 // Connect establishes a connection to a ModelSocket server.
 func Connect(ctx context.Context, url string, apiKey string, opts ...ClientOption) (*Client, error) {
-	transport, err := Dial(ctx, url, apiKey, nil)
+	cfg := newClientConfig(opts)
+
+	transport, err := Dial(ctx, url, apiKey, cfg.dialOptions())
 	if err != nil {
 		return nil, err
 	}
 
-	return NewWithTransport(ctx, transport, opts...), nil
+	return newClient(ctx, transport, cfg), nil
 }
 
 // NewWithTransport creates a Client with a custom transport.
 // This is useful for testing or custom transport implementations.
+// Options that configure the WebSocket connection, such as [WithWireDebug],
+// have no effect.
 func NewWithTransport(ctx context.Context, transport Transport, opts ...ClientOption) *Client {
-	ctx, cancel := context.WithCancel(ctx)
+	return newClient(ctx, transport, newClientConfig(opts))
+}
 
-	cfg := clientConfig{}
-	for _, opt := range opts {
-		opt(&cfg)
+// newClient creates a Client and starts its read loop.
+func newClient(ctx context.Context, transport Transport, cfg clientConfig) *Client {
+	ctx, cancel := context.WithCancel(ctx)
+	if cfg.budgetLimit != nil {
+		cfg.budget = newBudget(BudgetScopeClient, *cfg.budgetLimit)
 	}
 
 	c := &Client{
@@ -49,22 +85,50 @@ func NewWithTransport(ctx context.Context, transport Transport, opts ...ClientOp
 		ctx:       ctx,
 		cancel:    cancel,
 		seqs:      make(map[string]*Seq),
+		labels:    make(map[string]*Seq),
 		pending:   make(map[string]chan *MSEvent),
+		flights:   make(map[string]*flight),
+		done:      make(chan struct{}),
 	}
 
 	go c.readLoop()
+	if cfg.priorityScheduling {
+		c.sendQueue = newSendQueue()
+		go c.sendLoop()
+	}
 
 	return c
 }
 
-// Open creates a new sequence with the specified model.
+// DefaultOpenTimeout bounds the wait for the server to open a sequence when
+// the context passed to [Client.Open] has no deadline, unless
+// [WithOpenTimeout] sets another.
+const DefaultOpenTimeout = 30 * time.Second
+
+// Open creates a new sequence with the specified model. If ctx has no
+// deadline, it fails with an [*OpenTimeoutError] once the server hasn't
+// opened the sequence within the client's open timeout.
 func (c *Client) Open(ctx context.Context, model string, opts ...OpenOption) (*Seq, error) {
 	cfg := openConfig{}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	return c.open(ctx, model, cfg)
+}
 
-	cid := uuid.New().String()
+// open creates a new sequence configured by cfg.
+func (c *Client) open(ctx context.Context, model string, cfg openConfig) (*Seq, error) {
+	if err := cfg.conflict(); err != nil {
+		return nil, err
+	}
+	if cfg.runID == "" {
+		cfg.runID = RunIDFromContext(ctx)
+	}
+	if cfg.budget == nil && cfg.budgetLimit != nil {
+		cfg.budget = newBudget(BudgetScopeSequence, *cfg.budgetLimit)
+	}
+
+	cid := c.newID()
 
 	// Create channel to receive the SeqOpened event
 	ch := make(chan *MSEvent, 1)
@@ -86,14 +150,22 @@ func (c *Client) Open(ctx context.Context, model string, opts ...OpenOption) (*S
 	data := SeqOpenData{
 		Model:        model,
 		SkipPrelude:  cfg.skipPrelude,
-		ToolsEnabled: cfg.toolbox != nil,
+		ToolsEnabled: cfg.tools != nil,
 	}
 
-	if cfg.toolbox != nil && cfg.toolbox.toolInstructions != "" {
-		data.ToolPrompt = cfg.toolbox.toolInstructions
+	if cfg.tools != nil {
+		data.ToolPrompt = cfg.tools.ToolInstructions()
+	}
+	if cfg.toolPrompt != nil {
+		data.ToolPrompt = *cfg.toolPrompt
 	}
 
 	req := NewSeqOpenRequest(cid, data)
+	req.priority = PriorityNormal
+	req.runID = cfg.runID
+	if cfg.priority != nil {
+		req.priority = *cfg.priority
+	}
 
 	// Send the request
 	if err := c.send(ctx, req); err != nil {
@@ -101,11 +173,22 @@ func (c *Client) Open(ctx context.Context, model string, opts ...OpenOption) (*S
 	}
 
 	// Wait for response
+	var timeout <-chan time.Time
+	if d := c.openTimeout(); d > 0 {
+		if _, ok := ctx.Deadline(); !ok {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+	}
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
+	case <-timeout:
+		return nil, &OpenTimeoutError{CID: cid, Timeout: c.openTimeout()}
 	case <-c.ctx.Done():
-		return nil, ErrClosed
+		return nil, c.terminalErr()
 	case event := <-ch:
 		if event.IsError() {
 			return nil, &ProtocolError{
@@ -119,14 +202,15 @@ func (c *Client) Open(ctx context.Context, model string, opts ...OpenOption) (*S
 		}
 
 		// Create and register the sequence
-		seq := newSeq(c, event.SeqID, cfg.toolbox)
-		c.mu.Lock()
-		c.seqs[seq.id] = seq
-		c.mu.Unlock()
+		seq := newSeq(c, event.SeqID, model, cfg)
+		if err := c.registerSeq(seq); err != nil {
+			return nil, err
+		}
 
-		// If a toolbox is configured with instructions, send them as a system message
-		if cfg.toolbox != nil {
-			if err := seq.Append(ctx, cfg.toolbox.ToolDefinitionPrompt(), AsSystem()); err != nil {
+		// If a toolbox is configured with instructions, send them as a system
+		// message. This bypasses the input filter, which is meant for user content.
+		if cfg.tools != nil {
+			if _, err := seq.append(ctx, cfg.tools.ToolDefinitionPrompt(), appendConfig{role: RoleSystem}); err != nil {
 				return nil, err
 			}
 		}
@@ -135,19 +219,83 @@ func (c *Client) Open(ctx context.Context, model string, opts ...OpenOption) (*S
 	}
 }
 
-// Close closes the connection and all sequences.
-func (c *Client) Close(ctx context.Context) error {
-	c.mu.Lock()
-	if c.closed {
-		c.mu.Unlock()
-		return nil
+// openTimeout returns how long Open waits for a sequence when its context
+// has no deadline, or 0 for no limit.
+func (c *Client) openTimeout() time.Duration {
+	switch d := c.cfg.openTimeout; {
+	case d == 0:
+		return DefaultOpenTimeout
+	case d < 0:
+		return 0
+	default:
+		return d
 	}
-	c.closed = true
-	c.mu.Unlock()
+}
 
-	c.cancel()
+// newID returns a command ID.
+func (c *Client) newID() string {
+	if fn := c.cfg.idGenerator; fn != nil {
+		return fn()
+	}
+	return uuid.New().String()
+}
+
+// Ping measures the round-trip latency to the server. It returns
+// ErrNotSupported if the transport doesn't implement [Pinger].
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	if !c.Healthy() {
+		return 0, ErrClosed
+	}
+
+	pinger, ok := c.transport.(Pinger)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+
+	start := time.Now()
+	if err := pinger.Ping(ctx); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
 
-	// Close all sequences
+// Healthy reports whether the connection is open and its read loop is
+// running. It is cheap enough to back a readiness probe; combine it with
+// [Client.Ping] to also check the server responds.
+func (c *Client) Healthy() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.closed
+}
+
+// Done returns a channel that is closed when the connection terminates,
+// either because the read loop failed or [Client.Close] was called.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that terminated the connection, or nil while it is
+// open. After [Client.Close] it returns ErrClosed.
+func (c *Client) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closeErr
+}
+
+// Close closes the connection and all sequences.
+func (c *Client) Close(ctx context.Context) error {
+	c.terminate(ErrClosed, ErrClosed)
+
+	var err error
+	c.closeOnce.Do(func() {
+		c.closeSeqs(nil)
+		err = c.transport.Close()
+	})
+	return err
+}
+
+// closeSeqs closes all sequences locally, ending their streams with cause.
+func (c *Client) closeSeqs(cause error) {
 	c.mu.RLock()
 	seqs := make([]*Seq, 0, len(c.seqs))
 	for _, seq := range c.seqs {
@@ -156,22 +304,71 @@ func (c *Client) Close(ctx context.Context) error {
 	c.mu.RUnlock()
 
 	for _, seq := range seqs {
-		seq.handleClose(nil)
+		seq.closeWith(nil, cause)
 	}
+}
 
-	return c.transport.Close()
+// terminate marks the connection closed with err, stops the read loop and
+// closes Done. Pending requests fail with pendErr. It reports whether this
+// call terminated the connection; only the first error is kept.
+func (c *Client) terminate(err, pendErr error) bool {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return false
+	}
+	c.closed = true
+	c.closeErr = err
+	c.pendErr = pendErr
+	c.mu.Unlock()
+
+	c.cancel()
+	close(c.done)
+	return true
+}
+
+// terminalErr returns the error requests pending when the connection
+// terminated fail with: ErrClosed after Close, else ErrConnectionLost
+// wrapping the read error.
+func (c *Client) terminalErr() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.pendErr == nil {
+		return ErrClosed
+	}
+	return c.pendErr
 }
 
 // readLoop reads events from the transport and routes them.
 func (c *Client) readLoop() {
 	for {
 		event, err := c.transport.Receive(c.ctx)
+
+		// A bad frame doesn't break the connection
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			c.log(slog.LevelError, "", "discarding undecodable frame", slog.Any(logKeyError, err))
+			continue
+		}
+		var tooLarge *FrameTooLargeError
+		if errors.As(err, &tooLarge) {
+			c.log(slog.LevelError, "", "discarding oversized frame",
+				slog.Int64("limit", tooLarge.Limit),
+				slog.Int64("size", tooLarge.Size),
+			)
+			continue
+		}
+
 		if err != nil {
-			c.mu.Lock()
-			c.closeErr = err
-			c.closed = true
-			c.mu.Unlock()
-			c.cancel()
+			// Errors after Close are expected; anything else lost the connection
+			lost := fmt.Errorf("%w: %w", ErrConnectionLost, err)
+			if c.terminate(err, lost) {
+				c.log(slog.LevelError, "", "connection lost", slog.Any(logKeyError, err))
+				c.closeSeqs(lost)
+				if c.cfg.onDisconnect != nil {
+					c.cfg.onDisconnect(err)
+				}
+			}
 			return
 		}
 
@@ -180,45 +377,46 @@ func (c *Client) readLoop() {
 			c.cfg.onReceive(event)
 		}
 
-		// Log if logger configured
-		if c.cfg.logger != nil {
-			c.cfg.logger.Debug("received event",
-				slog.String("event", event.Event),
-				slog.String("seq_id", event.SeqID),
-				slog.String("cid", event.CID),
-			)
+		if c.cfg.eventLog != nil {
+			if err := c.cfg.eventLog.logEvent(event); err != nil {
+				c.logEventLogError(err)
+			}
 		}
 
+		c.logEvent(event)
+
 		c.routeEvent(event)
 	}
 }
 
 // routeEvent routes an event to the appropriate handler.
 func (c *Client) routeEvent(event *MSEvent) {
-	// Handle SeqOpened - route to pending channel
+	// Events the client doesn't understand could be mistaken for command
+	// completions, so they only go to the hook
+	if !event.isKnown() {
+		if fn := c.cfg.onUnknown; fn != nil {
+			fn(event)
+		}
+		return
+	}
+
+	// Handle SeqOpened - route to pending channel. Nobody is waiting for a
+	// sequence whose Open gave up, so it is closed rather than left open on
+	// the server.
 	if event.IsSeqOpened() {
-		c.mu.RLock()
-		ch, ok := c.pending[event.CID]
-		c.mu.RUnlock()
-		if ok {
-			select {
-			case ch <- event:
-			default:
-			}
+		if ch := c.takePending(event.CID); ch != nil {
+			ch <- event
+		} else {
+			c.handleOrphan(event)
+			c.closeOrphan(event.SeqID)
 		}
 		return
 	}
 
 	// Handle errors that might be for pending opens
 	if event.IsError() && event.CID != "" {
-		c.mu.RLock()
-		ch, ok := c.pending[event.CID]
-		c.mu.RUnlock()
-		if ok {
-			select {
-			case ch <- event:
-			default:
-			}
+		if ch := c.takePending(event.CID); ch != nil {
+			ch <- event
 			return
 		}
 	}
@@ -233,9 +431,60 @@ func (c *Client) routeEvent(event *MSEvent) {
 	seq, ok := c.seqs[seqID]
 	c.mu.RUnlock()
 
-	if ok {
-		seq.handleEvent(event)
+	if !ok {
+		c.handleOrphan(event)
+		return
+	}
+	seq.handleEvent(event)
+}
+
+// handleOrphan counts and reports an event for a sequence the client
+// doesn't know, e.g. one already closed locally, or one the server opened
+// for an Open that gave up.
+func (c *Client) handleOrphan(event *MSEvent) {
+	c.orphans.Add(1)
+	c.log(slog.LevelWarn, event.Event, "event for unknown sequence",
+		slog.String(logKeySeqID, event.SeqID),
+		slog.String(logKeyCID, event.CID),
+		slog.String("event", event.Event),
+	)
+	if fn := c.cfg.onOrphan; fn != nil {
+		fn(event)
+	}
+}
+
+// closeOrphan asks the server to close a sequence nobody opened it for. It
+// doesn't block, so it is safe to call from the read loop.
+func (c *Client) closeOrphan(seqID string) {
+	if seqID == "" {
+		return
 	}
+	go func() {
+		req := NewCloseRequest(c.newID(), seqID)
+		if err := c.send(c.ctx, req); err != nil {
+			c.log(slog.LevelWarn, "", "close failed",
+				slog.String(logKeySeqID, seqID),
+				slog.Any(logKeyError, err),
+			)
+		}
+	}()
+}
+
+// OrphanEvents returns the number of events received for sequences the
+// client doesn't know. See [WithOnOrphanEvent].
+func (c *Client) OrphanEvents() int64 {
+	return c.orphans.Load()
+}
+
+// takePending removes and returns the channel of the open waiting on cid,
+// or nil. Each channel is taken once, so the one send on its buffer never
+// blocks or drops the response.
+func (c *Client) takePending(cid string) chan *MSEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := c.pending[cid]
+	delete(c.pending, cid)
+	return ch
 }
 
 // send sends a request through the transport.
@@ -253,21 +502,79 @@ func (c *Client) send(ctx context.Context, req *MSRequest) error {
 		c.cfg.onSend(req)
 	}
 
-	// Log if logger configured
-	if c.cfg.logger != nil {
-		c.cfg.logger.Debug("sending request",
-			slog.String("request", req.Request),
-			slog.String("cid", req.CID),
-			slog.String("seq_id", req.SeqID),
+	if c.cfg.eventLog != nil {
+		if err := c.cfg.eventLog.logRequest(req); err != nil {
+			c.logEventLogError(err)
+		}
+	}
+
+	c.logRequest(req)
+
+	var err error
+	if c.sendQueue != nil {
+		err = c.sendQueued(ctx, req)
+	} else {
+		err = c.transport.Send(ctx, req)
+	}
+	if err != nil {
+		c.log(slog.LevelWarn, "", "send failed",
+			slog.String(logKeyRequest, req.Request),
+			slog.String(logKeyCID, req.CID),
+			slog.String(logKeySeqID, req.SeqID),
+			slog.Any(logKeyError, err),
 		)
+		return err
 	}
+	return nil
+}
+
+// logEventLogError reports a failed event log write. Logging failures never
+// interrupt the connection.
+func (c *Client) logEventLogError(err error) {
+	c.log(slog.LevelWarn, "", "event log write failed", slog.Any(logKeyError, err))
+}
+
+// registerSeq routes events for the sequence's ID to it. The server must
+// not reuse the ID of an open sequence; if it does, the sequence that holds
+// the ID keeps it and registerSeq fails with ErrDuplicateSeqID.
+func (c *Client) registerSeq(seq *Seq) error {
+	c.mu.Lock()
+	_, taken := c.seqs[seq.id]
+	if !taken {
+		c.seqs[seq.id] = seq
+		if label := seq.cfg.label; label != "" {
+			c.labels[label] = seq
+		}
+	}
+	c.mu.Unlock()
 
-	return c.transport.Send(ctx, req)
+	if taken {
+		c.log(slog.LevelError, "", "server reused an open sequence ID",
+			slog.String(logKeySeqID, seq.id),
+		)
+		return fmt.Errorf("%w: %s", ErrDuplicateSeqID, seq.id)
+	}
+	return nil
 }
 
-// removeSeq removes a sequence from the client.
-func (c *Client) removeSeq(seqID string) {
+// removeSeq removes a sequence from the client, unless its ID or label has
+// been taken by another.
+func (c *Client) removeSeq(seq *Seq) {
 	c.mu.Lock()
-	delete(c.seqs, seqID)
+	if c.seqs[seq.id] == seq {
+		delete(c.seqs, seq.id)
+	}
+	if label := seq.cfg.label; label != "" && c.labels[label] == seq {
+		delete(c.labels, label)
+	}
 	c.mu.Unlock()
 }
+
+// SeqByLabel returns the open sequence labelled with [WithSeqLabel]. If
+// several were opened with the label, it is the latest.
+func (c *Client) SeqByLabel(label string) (*Seq, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	seq, ok := c.labels[label]
+	return seq, ok
+}
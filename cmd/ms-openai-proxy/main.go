@@ -0,0 +1,98 @@
+// Command ms-openai-proxy serves an OpenAI-compatible chat completions API
+// backed by a ModelSocket server, so OpenAI SDKs can use a ModelSocket
+// deployment by pointing their base URL at it:
+//
+//	ms-openai-proxy -listen :8080 -models meta/llama3.1-8b-instruct-free
+//
+//	client = OpenAI(base_url="http://localhost:8080/v1", api_key="...")
+//
+// The upstream URL and API key default to $MODELSOCKET_URL and
+// $MODELSOCKET_API_KEY. The key clients must send defaults to
+// $OPENAI_PROXY_API_KEY; if it is empty, requests aren't authenticated.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/httpadapter"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	url := flag.String("url", envOr("MODELSOCKET_URL", "wss://models.mixlayer.ai/ws"), "upstream ModelSocket URL")
+	key := flag.String("key", os.Getenv("MODELSOCKET_API_KEY"), "upstream API key")
+	apiKey := flag.String("api-key", os.Getenv("OPENAI_PROXY_API_KEY"), "API key clients must send")
+	models := flag.String("models", "", "comma-separated models clients may use (default any)")
+	defaultModel := flag.String("default-model", "", "model for requests that don't name one (default the first of -models)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, err := modelsocket.Connect(ctx, *url, *key, modelsocket.WithLogger(logger))
+	if err != nil {
+		logger.Error("connect failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer client.Close(context.Background())
+
+	opts := httpadapter.OpenAIOptions{
+		DefaultModel: *defaultModel,
+		APIKey:       *apiKey,
+	}
+	if *models != "" {
+		opts.Models = strings.Split(*models, ",")
+		if opts.DefaultModel == "" {
+			opts.DefaultModel = opts.Models[0]
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           httpadapter.OpenAIHandler(client, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Without its connection the proxy can't serve anything; exit so a
+	// supervisor restarts it
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-client.Done():
+			logger.Error("upstream connection lost", slog.Any("error", client.Err()))
+			stop()
+		}
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	logger.Info("listening", slog.String("addr", *listen))
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("serve failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if client.Err() != nil && !errors.Is(client.Err(), modelsocket.ErrClosed) {
+		os.Exit(1)
+	}
+}
+
+// envOr returns the environment variable key, or def if it is unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// workload describes the load to generate.
+type workload struct {
+	Model string
+
+	// Prompt is appended as the user before each generation.
+	Prompt string
+
+	// Seqs is the number of sequences generating concurrently.
+	Seqs int
+
+	// Requests is the number of generations per sequence. When Duration is
+	// set, sequences stop after it instead.
+	Requests int
+	Duration time.Duration
+
+	GenOptions []modelsocket.GenOption
+}
+
+// sample is the outcome of one generation.
+type sample struct {
+	TTFT         time.Duration
+	Total        time.Duration
+	OutputTokens int
+	Err          error
+}
+
+// run runs w on client and returns a sample for each generation. Failing
+// to open a sequence counts as a failed generation.
+func run(ctx context.Context, client *modelsocket.Client, w workload) []sample {
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+	)
+	record := func(s sample) {
+		mu.Lock()
+		samples = append(samples, s)
+		mu.Unlock()
+	}
+
+	if w.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Duration)
+		defer cancel()
+	}
+
+	for range w.Seqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			seq, err := client.Open(ctx, w.Model)
+			if err != nil {
+				record(sample{Err: err})
+				return
+			}
+			defer seq.Close(context.WithoutCancel(ctx))
+
+			for i := 0; w.Duration > 0 || i < w.Requests; i++ {
+				if ctx.Err() != nil {
+					return
+				}
+				s := generate(ctx, seq, w)
+				if s.Err != nil && ctx.Err() != nil {
+					// Cut short by the end of the run
+					return
+				}
+				record(s)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return samples
+}
+
+// generate runs one generation on seq.
+func generate(ctx context.Context, seq *modelsocket.Seq, w workload) sample {
+	if err := seq.Append(ctx, w.Prompt, modelsocket.AsUser()); err != nil {
+		return sample{Err: err}
+	}
+
+	opts := append([]modelsocket.GenOption{modelsocket.GenerateAsAssistant()}, w.GenOptions...)
+	stream, err := seq.Generate(ctx, opts...)
+	if err != nil {
+		return sample{Err: err}
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		return sample{Err: err}
+	}
+
+	timings := stream.Timings()
+	return sample{
+		TTFT:         timings.FirstToken,
+		Total:        timings.Total,
+		OutputTokens: stream.OutputTokens(),
+	}
+}
+
+// report summarizes a run.
+type report struct {
+	Requests     int           `json:"requests"`
+	Errors       int           `json:"errors"`
+	ErrorRate    float64       `json:"error_rate"`
+	OutputTokens int           `json:"output_tokens"`
+	Elapsed      time.Duration `json:"elapsed_ns"`
+	TokensPerSec float64       `json:"tokens_per_sec"`
+	TTFT         percentiles   `json:"ttft_ns"`
+	Latency      percentiles   `json:"latency_ns"`
+
+	// Error messages by count, for the first few distinct errors
+	ErrorCounts map[string]int `json:"error_counts,omitempty"`
+}
+
+// percentiles summarizes latency samples.
+type percentiles struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// maxErrorKinds is the most distinct errors a report lists.
+const maxErrorKinds = 10
+
+// summarize builds the report for samples from a run that took elapsed.
+func summarize(samples []sample, elapsed time.Duration) report {
+	r := report{Requests: len(samples), Elapsed: elapsed}
+
+	var ttft, latency []time.Duration
+	for _, s := range samples {
+		if s.Err != nil {
+			r.Errors++
+			if r.ErrorCounts == nil {
+				r.ErrorCounts = make(map[string]int)
+			}
+			msg := s.Err.Error()
+			if _, ok := r.ErrorCounts[msg]; ok || len(r.ErrorCounts) < maxErrorKinds {
+				r.ErrorCounts[msg]++
+			}
+			continue
+		}
+		r.OutputTokens += s.OutputTokens
+		ttft = append(ttft, s.TTFT)
+		latency = append(latency, s.Total)
+	}
+
+	if r.Requests > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(r.Requests)
+	}
+	if elapsed > 0 {
+		r.TokensPerSec = float64(r.OutputTokens) / elapsed.Seconds()
+	}
+	r.TTFT = newPercentiles(ttft)
+	r.Latency = newPercentiles(latency)
+	return r
+}
+
+func newPercentiles(samples []time.Duration) percentiles {
+	if len(samples) == 0 {
+		return percentiles{}
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	return percentiles{
+		P50: percentile(sorted, 50),
+		P90: percentile(sorted, 90),
+		P99: percentile(sorted, 99),
+		Max: sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the p-th percentile of sorted samples using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// writeText writes the report for people.
+func (r report) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "requests\t%d\n", r.Requests)
+	fmt.Fprintf(tw, "errors\t%d (%.1f%%)\n", r.Errors, r.ErrorRate*100)
+	fmt.Fprintf(tw, "elapsed\t%v\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "output tokens\t%d\n", r.OutputTokens)
+	fmt.Fprintf(tw, "tokens/sec\t%.1f\n", r.TokensPerSec)
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "\tp50\tp90\tp99\tmax")
+	for _, row := range []struct {
+		name string
+		p    percentiles
+	}{{"ttft", r.TTFT}, {"latency", r.Latency}} {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%v\n", row.name,
+			row.p.P50.Round(time.Millisecond), row.p.P90.Round(time.Millisecond),
+			row.p.P99.Round(time.Millisecond), row.p.Max.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.ErrorCounts) > 0 {
+		fmt.Fprintln(w)
+		msgs := make([]string, 0, len(r.ErrorCounts))
+		for msg := range r.ErrorCounts {
+			msgs = append(msgs, msg)
+		}
+		slices.Sort(msgs)
+		for _, msg := range msgs {
+			if _, err := fmt.Fprintf(w, "%6d  %s\n", r.ErrorCounts[msg], msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeJSON writes the report as JSON.
+func (r report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
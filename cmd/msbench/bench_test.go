@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers each generation with two
+// tokens, failing every failEvery-th generation.
+func newServer(failEvery int) *mstest.Server {
+	var gens int
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		gens++
+		if failEvery > 0 && gens%failEvery == 0 {
+			return []*modelsocket.MSEvent{mstest.Error("overloaded")}
+		}
+		return []*modelsocket.MSEvent{mstest.Text("hello"), mstest.Text(" there"), mstest.Finish(0, 2)}
+	})
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, newServer(4))
+	defer client.Close(ctx)
+
+	samples := run(ctx, client, workload{Model: "test-model", Prompt: "hi", Seqs: 3, Requests: 4})
+	r := summarize(samples, time.Second)
+
+	if r.Requests != 12 || r.Errors != 3 {
+		t.Errorf("requests = %d, errors = %d, want 12 and 3", r.Requests, r.Errors)
+	}
+	if r.OutputTokens != 18 || r.TokensPerSec != 18 {
+		t.Errorf("output tokens = %d at %.1f/s, want 18 at 18/s", r.OutputTokens, r.TokensPerSec)
+	}
+	if r.ErrorRate != 0.25 {
+		t.Errorf("error rate = %v, want 0.25", r.ErrorRate)
+	}
+	if len(r.ErrorCounts) != 1 {
+		t.Errorf("error counts = %v, want one kind", r.ErrorCounts)
+	}
+}
+
+func TestRun_Duration(t *testing.T) {
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, newServer(0))
+	defer client.Close(ctx)
+
+	samples := run(ctx, client, workload{Model: "test-model", Prompt: "hi", Seqs: 2, Duration: 50 * time.Millisecond})
+	r := summarize(samples, 50*time.Millisecond)
+	if r.Requests == 0 || r.Errors != 0 {
+		t.Errorf("requests = %d, errors = %d, want some and none", r.Requests, r.Errors)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var samples []sample
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, sample{
+			TTFT:         time.Duration(i) * time.Millisecond,
+			Total:        time.Duration(i) * 10 * time.Millisecond,
+			OutputTokens: 1,
+		})
+	}
+
+	r := summarize(samples, 2*time.Second)
+	want := percentiles{P50: 50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}
+	if r.TTFT != want {
+		t.Errorf("TTFT = %+v, want %+v", r.TTFT, want)
+	}
+	if r.Latency.P50 != 500*time.Millisecond {
+		t.Errorf("latency p50 = %v, want 500ms", r.Latency.P50)
+	}
+	if r.TokensPerSec != 50 {
+		t.Errorf("tokens/sec = %v, want 50", r.TokensPerSec)
+	}
+
+	var buf bytes.Buffer
+	if err := r.writeText(&buf); err != nil {
+		t.Fatalf("writeText error: %v", err)
+	}
+	for _, want := range []string{"requests       100", "tokens/sec     50.0", "ttft     50ms   90ms   99ms   100ms"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Command msbench generates load against a ModelSocket server and reports
+// throughput, time to first token and error rates:
+//
+//	msbench -seqs 32 -requests 10 -max-tokens 128
+//	msbench -seqs 64 -duration 1m -json
+//
+// Each of -seqs sequences appends the prompt and generates a response,
+// -requests times or until -duration has passed, so the conversation grows
+// as a chat would. The server URL, API key and model default to
+// $MODELSOCKET_URL, $MODELSOCKET_API_KEY and $MODELSOCKET_MODEL.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+func main() {
+	url := flag.String("url", envOr("MODELSOCKET_URL", "wss://models.mixlayer.ai/ws"), "server URL")
+	key := flag.String("key", os.Getenv("MODELSOCKET_API_KEY"), "API key")
+	model := flag.String("model", envOr("MODELSOCKET_MODEL", "meta/llama3.1-8b-instruct-free"), "model")
+	prompt := flag.String("prompt", "Write a short paragraph about the sea.", "prompt appended before each generation")
+	seqs := flag.Int("seqs", 8, "concurrent sequences")
+	requests := flag.Int("requests", 5, "generations per sequence")
+	duration := flag.Duration("duration", 0, "run for this long instead of -requests")
+	maxTokens := flag.Int("max-tokens", 128, "maximum tokens per generation")
+	temperature := flag.Float64("temperature", -1, "sampling temperature (default the server's)")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if *seqs < 1 || (*duration <= 0 && *requests < 1) {
+		fmt.Fprintln(os.Stderr, "msbench: -seqs and -requests must be at least 1")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := modelsocket.Connect(ctx, *url, *key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "msbench: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close(context.Background())
+
+	w := workload{
+		Model:      *model,
+		Prompt:     *prompt,
+		Seqs:       *seqs,
+		Requests:   *requests,
+		Duration:   *duration,
+		GenOptions: []modelsocket.GenOption{modelsocket.WithMaxTokens(*maxTokens)},
+	}
+	if *temperature >= 0 {
+		w.GenOptions = append(w.GenOptions, modelsocket.WithTemperature(*temperature))
+	}
+
+	start := time.Now()
+	r := summarize(run(ctx, client, w), time.Since(start))
+
+	if *asJSON {
+		err = r.writeJSON(os.Stdout)
+	} else {
+		err = r.writeText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "msbench: %v\n", err)
+		os.Exit(1)
+	}
+	if r.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// envOr returns the environment variable key, or def if it is unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// runChat runs an interactive chat on stdin and stdout.
+func runChat(ctx context.Context, env *env, args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	var conn connFlags
+	conn.register(fs, true)
+	system := fs.String("system", "", "system prompt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := conn.connect(ctx, env)
+	if err != nil {
+		return err
+	}
+	defer client.Close(context.WithoutCancel(ctx))
+
+	seq, err := client.Open(ctx, conn.model)
+	if err != nil {
+		return err
+	}
+	defer seq.Close(context.WithoutCancel(ctx))
+
+	if *system != "" {
+		if err := seq.Append(ctx, *system, modelsocket.AsSystem()); err != nil {
+			return err
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			continue
+		}
+
+		if err := seq.Append(ctx, input, modelsocket.AsUser()); err != nil {
+			return err
+		}
+
+		stream, err := seq.Generate(ctx, modelsocket.GenerateAsAssistant())
+		if err != nil {
+			return err
+		}
+		for chunk, err := range stream.Chunks(ctx) {
+			if err != nil {
+				return err
+			}
+			if !chunk.Hidden {
+				fmt.Print(chunk.Text)
+			}
+		}
+		fmt.Print("\n\n")
+	}
+}
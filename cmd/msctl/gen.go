@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// genResult is the output of gen -json.
+type genResult struct {
+	Text         string `json:"text"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+}
+
+// runGen generates a single response to a prompt.
+func runGen(ctx context.Context, env *env, args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: msctl gen [flags] [prompt]\n\nThe prompt is read from stdin when not given as arguments.")
+		fs.PrintDefaults()
+	}
+
+	var conn connFlags
+	conn.register(fs, true)
+	system := fs.String("system", "", "system prompt")
+	asJSON := fs.Bool("json", false, "print the result and token counts as JSON")
+
+	var opts []modelsocket.GenOption
+	fs.Func("max-tokens", "maximum tokens to generate", func(s string) error {
+		n, err := strconv.Atoi(s)
+		opts = append(opts, modelsocket.WithMaxTokens(n))
+		return err
+	})
+	fs.Func("temperature", "sampling temperature", func(s string) error {
+		t, err := strconv.ParseFloat(s, 64)
+		opts = append(opts, modelsocket.WithTemperature(t))
+		return err
+	})
+	fs.Func("seed", "random seed", func(s string) error {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		opts = append(opts, modelsocket.WithSeed(seed))
+		return err
+	})
+	var stops []string
+	fs.Func("stop", "stop string (repeatable)", func(s string) error {
+		stops = append(stops, s)
+		return nil
+	})
+	fs.Func("regex", "constrain output to a regex", func(s string) error {
+		opts = append(opts, modelsocket.WithRegexMask(s))
+		return nil
+	})
+	fs.Func("json-schema", "constrain output to the JSON schema in `file`", func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		pattern, err := schemaRegex(data)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, modelsocket.WithRegexMask(pattern))
+		return nil
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(stops) > 0 {
+		opts = append(opts, modelsocket.WithStopStrings(stops...))
+	}
+
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		prompt = string(data)
+	}
+
+	client, err := conn.connect(ctx, env)
+	if err != nil {
+		return err
+	}
+	defer client.Close(context.WithoutCancel(ctx))
+
+	seq, err := client.Open(ctx, conn.model)
+	if err != nil {
+		return err
+	}
+	defer seq.Close(context.WithoutCancel(ctx))
+
+	if *system != "" {
+		if err := seq.Append(ctx, *system, modelsocket.AsSystem()); err != nil {
+			return err
+		}
+	}
+	if err := seq.Append(ctx, prompt, modelsocket.AsUser()); err != nil {
+		return err
+	}
+
+	stream, err := seq.Generate(ctx, append([]modelsocket.GenOption{modelsocket.GenerateAsAssistant()}, opts...)...)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		text, err := stream.Text(ctx)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(genResult{
+			Text:         text,
+			InputTokens:  stream.InputTokens(),
+			OutputTokens: stream.OutputTokens(),
+		})
+	}
+
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			return err
+		}
+		if !chunk.Hidden {
+			fmt.Print(chunk.Text)
+		}
+	}
+	fmt.Println()
+	return nil
+}
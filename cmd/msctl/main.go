@@ -0,0 +1,148 @@
+// Command msctl talks to ModelSocket servers from the command line, for
+// debugging servers and scripting without writing Go.
+//
+// Usage:
+//
+//	msctl chat [flags]                  interactive chat
+//	msctl gen [flags] [prompt]          generate a single response
+//	msctl models [flags] model...       check which models can be opened
+//	msctl record -o file command ...    run a command, recording its traffic
+//	msctl replay [flags] file           replay a recording against a server
+//
+// The server URL, API key and model default to $MODELSOCKET_URL,
+// $MODELSOCKET_API_KEY and $MODELSOCKET_MODEL.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+const (
+	defaultURL   = "wss://models.mixlayer.ai/ws"
+	defaultModel = "meta/llama3.1-8b-instruct-free"
+)
+
+const usage = `usage: msctl <command> [flags] [args]
+
+commands:
+  chat      interactive chat
+  gen       generate a single response
+  models    check which models can be opened
+  record    run a command, recording its traffic
+  replay    replay a recording against a server
+
+Run "msctl <command> -h" for a command's flags.
+`
+
+// env carries settings shared between commands.
+type env struct {
+	// record, if set, receives the event log of every connection.
+	record io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, &env{}, os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "msctl: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run dispatches to the command named by args[0].
+func run(ctx context.Context, env *env, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+
+	switch args[0] {
+	case "chat":
+		return runChat(ctx, env, args[1:])
+	case "gen":
+		return runGen(ctx, env, args[1:])
+	case "models":
+		return runModels(ctx, env, args[1:])
+	case "record":
+		return runRecord(ctx, env, args[1:])
+	case "replay":
+		return runReplay(ctx, env, args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return nil
+	}
+
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// connFlags are the flags for connecting to a server.
+type connFlags struct {
+	url   string
+	key   string
+	model string
+}
+
+// register adds the connection flags to fs. The model flag is only added
+// when withModel is set.
+func (c *connFlags) register(fs *flag.FlagSet, withModel bool) {
+	fs.StringVar(&c.url, "url", envOr("MODELSOCKET_URL", defaultURL), "server URL")
+	fs.StringVar(&c.key, "key", os.Getenv("MODELSOCKET_API_KEY"), "API key")
+	if withModel {
+		fs.StringVar(&c.model, "model", envOr("MODELSOCKET_MODEL", defaultModel), "model")
+	}
+}
+
+// connect connects to the server, recording traffic if requested.
+func (c *connFlags) connect(ctx context.Context, env *env) (*modelsocket.Client, error) {
+	var opts []modelsocket.ClientOption
+	if env.record != nil {
+		opts = append(opts, modelsocket.WithEventLog(env.record))
+	}
+	return modelsocket.Connect(ctx, c.url, c.key, opts...)
+}
+
+// envOr returns the environment variable key, or def if it is unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// runRecord runs a command with its traffic written to a file.
+func runRecord(ctx context.Context, env *env, args []string) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	out := fs.String("o", "", "file to write the recording to (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: msctl record -o file command [flags] [args]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	env.record = f
+	return run(ctx, env, fs.Args())
+}
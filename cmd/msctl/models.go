@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// runModels reports which of the given models can be opened. The protocol
+// has no way to list a server's models, so each one is checked by opening
+// and closing a sequence.
+func runModels(ctx context.Context, env *env, args []string) error {
+	fs := flag.NewFlagSet("models", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: msctl models [flags] model...")
+		fs.PrintDefaults()
+	}
+
+	var conn connFlags
+	conn.register(fs, false)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	client, err := conn.connect(ctx, env)
+	if err != nil {
+		return err
+	}
+	defer client.Close(context.WithoutCancel(ctx))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	unavailable := 0
+	for _, model := range fs.Args() {
+		seq, err := client.Open(ctx, model)
+		if err != nil {
+			unavailable++
+			fmt.Fprintf(w, "%s\tunavailable\t%v\n", model, err)
+			continue
+		}
+		seq.Close(ctx)
+		fmt.Fprintf(w, "%s\tavailable\t\n", model)
+	}
+
+	if unavailable > 0 {
+		w.Flush()
+		return fmt.Errorf("%d of %d models unavailable", unavailable, fs.NArg())
+	}
+	return nil
+}
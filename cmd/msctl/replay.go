@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// replayStep is a recorded request, sent once the server has produced the
+// event it waits for. The last step may only wait.
+type replayStep struct {
+	req  *modelsocket.MSRequest
+	wait string
+}
+
+// runReplay sends the requests in a recording to a server, printing the
+// traffic.
+func runReplay(ctx context.Context, env *env, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: msctl replay [flags] file\n\nRequests are sent in order, each once the server has answered the\nprevious one the way it did in the recording.")
+		fs.PrintDefaults()
+	}
+
+	var conn connFlags
+	conn.register(fs, false)
+	printOnly := fs.Bool("print", false, "print the recording without connecting")
+	timeout := fs.Duration("timeout", time.Minute, "how long to wait for each response")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	entries, err := modelsocket.ReadEventLog(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if *printOnly {
+		for _, entry := range entries {
+			if entry.Request != nil {
+				printFrame(os.Stdout, "->", entry.Request)
+			} else {
+				printFrame(os.Stdout, "<-", entry.Event)
+			}
+		}
+		return nil
+	}
+
+	transport, err := modelsocket.Dial(ctx, conn.url, conn.key, nil)
+	if err != nil {
+		return err
+	}
+	defer transport.Close()
+
+	r := newReplayer(transport, entries, os.Stdout)
+	return r.run(ctx, replaySteps(entries), *timeout)
+}
+
+// replaySteps splits a recording into steps. Before each request, the
+// replay waits for the last event other than text that preceded it, or for
+// text if nothing else did.
+func replaySteps(entries []modelsocket.EventLogEntry) []replayStep {
+	var steps []replayStep
+	var wait string
+
+	for _, entry := range entries {
+		switch {
+		case entry.Request != nil:
+			steps = append(steps, replayStep{req: entry.Request, wait: wait})
+			wait = ""
+		case entry.Event != nil:
+			if !entry.Event.IsSeqText() || wait == "" {
+				wait = entry.Event.Event
+			}
+		}
+	}
+
+	if wait != "" {
+		steps = append(steps, replayStep{wait: wait})
+	}
+	return steps
+}
+
+// replayer replays a recording over a transport, mapping recorded sequence
+// IDs to the ones the server assigns.
+type replayer struct {
+	transport modelsocket.Transport
+	out       io.Writer
+
+	recorded map[string]*modelsocket.MSEvent // seq_opened and seq_fork_finish by cid
+	seqIDs   map[string]string               // recorded sequence ID to replayed
+}
+
+func newReplayer(transport modelsocket.Transport, entries []modelsocket.EventLogEntry, out io.Writer) *replayer {
+	r := &replayer{
+		transport: transport,
+		out:       out,
+		recorded:  make(map[string]*modelsocket.MSEvent),
+		seqIDs:    make(map[string]string),
+	}
+	for _, entry := range entries {
+		if e := entry.Event; e != nil && (e.IsSeqOpened() || e.IsSeqForkFinish()) {
+			r.recorded[e.CID] = e
+		}
+	}
+	return r
+}
+
+// run replays steps, failing if an awaited event doesn't arrive within
+// timeout.
+func (r *replayer) run(ctx context.Context, steps []replayStep, timeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan *modelsocket.MSEvent, 64)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			event, err := r.transport.Receive(ctx)
+			if err != nil {
+				errc <- err
+				return
+			}
+			events <- event
+		}
+	}()
+
+	for _, step := range steps {
+		if step.wait != "" {
+			if err := r.await(ctx, step.wait, events, errc, timeout); err != nil {
+				return err
+			}
+		}
+		if step.req != nil {
+			if err := r.send(ctx, step.req); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// await prints events until one of type typ arrives.
+func (r *replayer) await(ctx context.Context, typ string, events <-chan *modelsocket.MSEvent, errc <-chan error, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case <-timer.C:
+			return fmt.Errorf("timed out waiting for %s", typ)
+		case event := <-events:
+			r.observe(event)
+			if event.Event == typ {
+				return nil
+			}
+		}
+	}
+}
+
+// observe prints an event and learns the sequence IDs it assigns.
+func (r *replayer) observe(event *modelsocket.MSEvent) {
+	printFrame(r.out, "<-", event)
+
+	recorded, ok := r.recorded[event.CID]
+	if !ok {
+		return
+	}
+	switch {
+	case event.IsSeqOpened():
+		r.seqIDs[recorded.SeqID] = event.SeqID
+	case event.IsSeqForkFinish():
+		r.seqIDs[recorded.ChildSeqID] = event.ChildSeqID
+	}
+}
+
+// send sends a recorded request with its sequence ID mapped.
+func (r *replayer) send(ctx context.Context, req *modelsocket.MSRequest) error {
+	replayed := *req
+	if id, ok := r.seqIDs[req.SeqID]; ok {
+		replayed.SeqID = id
+	}
+	printFrame(r.out, "->", &replayed)
+	return r.transport.Send(ctx, &replayed)
+}
+
+// printFrame prints a request or event as a line of JSON.
+func printFrame(w io.Writer, dir string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(w, "%s <%v>\n", dir, err)
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", dir, data)
+}
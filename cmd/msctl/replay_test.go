@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// recording is a session that opened a sequence, generated and closed it.
+const recording = `{"dir":"send","request":{"request":"seq_open","cid":"c1","data":{"model":"m"}}}
+{"dir":"recv","event":{"event":"seq_opened","cid":"c1","seq_id":"old"}}
+{"dir":"send","request":{"request":"seq_command","cid":"c2","seq_id":"old","data":{"command":"gen"}}}
+{"dir":"recv","event":{"event":"seq_text","seq_id":"old","text":"Hi"}}
+{"dir":"recv","event":{"event":"seq_text","seq_id":"old","text":"!"}}
+{"dir":"recv","event":{"event":"seq_gen_finish","cid":"c2","seq_id":"old"}}
+{"dir":"send","request":{"request":"seq_command","cid":"c3","seq_id":"old","data":{"command":"close"}}}
+{"dir":"recv","event":{"event":"seq_closed","cid":"c3","seq_id":"old"}}
+`
+
+func TestReplaySteps(t *testing.T) {
+	entries, err := modelsocket.ReadEventLog(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("ReadEventLog error: %v", err)
+	}
+
+	steps := replaySteps(entries)
+	want := []string{"", "seq_opened", "seq_gen_finish", "seq_closed"}
+	if len(steps) != len(want) {
+		t.Fatalf("len(steps) = %d, want %d", len(steps), len(want))
+	}
+	for i, step := range steps {
+		if step.wait != want[i] {
+			t.Errorf("steps[%d].wait = %q, want %q", i, step.wait, want[i])
+		}
+	}
+	if steps[3].req != nil {
+		t.Error("final step has a request, want wait only")
+	}
+}
+
+// fakeServer answers each request the way a server would, assigning its own
+// sequence IDs.
+type fakeServer struct {
+	mu     sync.Mutex
+	sent   []*modelsocket.MSRequest
+	events chan *modelsocket.MSEvent
+}
+
+func (f *fakeServer) Send(ctx context.Context, req *modelsocket.MSRequest) error {
+	f.mu.Lock()
+	f.sent = append(f.sent, req)
+	f.mu.Unlock()
+
+	command, _ := req.Data.(map[string]any)["command"].(string)
+	switch {
+	case req.Request == "seq_open":
+		f.events <- &modelsocket.MSEvent{Event: "seq_opened", CID: req.CID, SeqID: "new"}
+	case command == "gen":
+		f.events <- &modelsocket.MSEvent{Event: "seq_text", SeqID: req.SeqID, Text: "Hello"}
+		f.events <- &modelsocket.MSEvent{Event: "seq_gen_finish", CID: req.CID, SeqID: req.SeqID}
+	case command == "close":
+		f.events <- &modelsocket.MSEvent{Event: "seq_closed", CID: req.CID, SeqID: req.SeqID}
+	}
+	return nil
+}
+
+func (f *fakeServer) Receive(ctx context.Context) (*modelsocket.MSEvent, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case event := <-f.events:
+		return event, nil
+	}
+}
+
+func (f *fakeServer) Close() error { return nil }
+
+func TestReplayer(t *testing.T) {
+	entries, err := modelsocket.ReadEventLog(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("ReadEventLog error: %v", err)
+	}
+
+	server := &fakeServer{events: make(chan *modelsocket.MSEvent, 10)}
+	var out bytes.Buffer
+	r := newReplayer(server, entries, &out)
+	if err := r.run(context.Background(), replaySteps(entries), time.Second); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if len(server.sent) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(server.sent))
+	}
+	for _, req := range server.sent[1:] {
+		if req.SeqID != "new" {
+			t.Errorf("request %s seq_id = %q, want the replayed ID", req.CID, req.SeqID)
+		}
+	}
+	if !strings.Contains(out.String(), `<- {"event":"seq_closed"`) {
+		t.Errorf("output = %s, want the final event", out.String())
+	}
+}
+
+func TestReplayer_Timeout(t *testing.T) {
+	server := &fakeServer{events: make(chan *modelsocket.MSEvent, 10)}
+	r := newReplayer(server, nil, &bytes.Buffer{})
+
+	err := r.run(context.Background(), []replayStep{{wait: "seq_opened"}}, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want timeout", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// schemaNode is the subset of JSON Schema that can be turned into a regex.
+type schemaNode struct {
+	Type       json.RawMessage   `json:"type"`
+	Enum       []json.RawMessage `json:"enum"`
+	Const      json.RawMessage   `json:"const"`
+	Properties json.RawMessage   `json:"properties"`
+	Items      json.RawMessage   `json:"items"`
+	Ref        string            `json:"$ref"`
+}
+
+// Regex fragments for JSON values.
+const (
+	stringPattern  = `"(?:[^"\\]|\\.)*"`
+	integerPattern = `-?(?:0|[1-9][0-9]*)`
+	numberPattern  = integerPattern + `(?:\.[0-9]+)?(?:[eE][+-]?[0-9]+)?`
+)
+
+// schemaRegex converts a JSON schema into a regex matching compact JSON
+// documents it accepts. Objects are generated with every property, in schema
+// order; $ref and the composition keywords aren't supported.
+func schemaRegex(data []byte) (string, error) {
+	return nodeRegex(data)
+}
+
+// nodeRegex converts a single schema node.
+func nodeRegex(data json.RawMessage) (string, error) {
+	var node schemaNode
+	if err := json.Unmarshal(data, &node); err != nil {
+		return "", fmt.Errorf("json schema: %w", err)
+	}
+
+	if node.Ref != "" {
+		return "", errors.New("json schema: $ref is not supported")
+	}
+	if node.Const != nil {
+		return literalRegex(node.Const)
+	}
+	if node.Enum != nil {
+		alts := make([]string, len(node.Enum))
+		for i, value := range node.Enum {
+			alt, err := literalRegex(value)
+			if err != nil {
+				return "", err
+			}
+			alts[i] = alt
+		}
+		return "(?:" + strings.Join(alts, "|") + ")", nil
+	}
+
+	types, err := schemaTypes(node.Type)
+	if err != nil {
+		return "", err
+	}
+
+	alts := make([]string, len(types))
+	for i, typ := range types {
+		alt, err := typeRegex(typ, &node)
+		if err != nil {
+			return "", err
+		}
+		alts[i] = alt
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return "(?:" + strings.Join(alts, "|") + ")", nil
+}
+
+// schemaTypes decodes a type keyword, which is a string or a list of them.
+func schemaTypes(raw json.RawMessage) ([]string, error) {
+	if raw == nil {
+		return nil, errors.New("json schema: type is required")
+	}
+
+	var typ string
+	if err := json.Unmarshal(raw, &typ); err == nil {
+		return []string{typ}, nil
+	}
+
+	var types []string
+	if err := json.Unmarshal(raw, &types); err != nil || len(types) == 0 {
+		return nil, fmt.Errorf("json schema: invalid type %s", raw)
+	}
+	return types, nil
+}
+
+// typeRegex converts a node of a single type.
+func typeRegex(typ string, node *schemaNode) (string, error) {
+	switch typ {
+	case "string":
+		return stringPattern, nil
+	case "integer":
+		return integerPattern, nil
+	case "number":
+		return numberPattern, nil
+	case "boolean":
+		return "(?:true|false)", nil
+	case "null":
+		return "null", nil
+	case "array":
+		if node.Items == nil {
+			return "", errors.New("json schema: array without items")
+		}
+		item, err := nodeRegex(node.Items)
+		if err != nil {
+			return "", err
+		}
+		return `\[(?:` + item + `(?:,` + item + `)*)?\]`, nil
+	case "object":
+		return objectRegex(node.Properties)
+	}
+	return "", fmt.Errorf("json schema: unsupported type %q", typ)
+}
+
+// objectRegex converts an object's properties, keeping their order.
+func objectRegex(properties json.RawMessage) (string, error) {
+	if properties == nil {
+		return "", errors.New("json schema: object without properties")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(properties))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", errors.New("json schema: properties must be an object")
+	}
+
+	var fields []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", fmt.Errorf("json schema: %w", err)
+		}
+		name := tok.(string)
+
+		var prop json.RawMessage
+		if err := dec.Decode(&prop); err != nil {
+			return "", fmt.Errorf("json schema: %w", err)
+		}
+		value, err := nodeRegex(prop)
+		if err != nil {
+			return "", fmt.Errorf("%w (in %q)", err, name)
+		}
+
+		key, _ := json.Marshal(name)
+		fields = append(fields, regexp.QuoteMeta(string(key))+":"+value)
+	}
+
+	return `\{` + strings.Join(fields, ",") + `\}`, nil
+}
+
+// literalRegex matches a single JSON value exactly, in compact form.
+func literalRegex(value json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return "", fmt.Errorf("json schema: %w", err)
+	}
+	return regexp.QuoteMeta(buf.String()), nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSchemaRegex(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer"},
+			"mood": {"enum": ["happy", "sad"]},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"score": {"type": ["number", "null"]}
+		}
+	}`
+
+	pattern, err := schemaRegex([]byte(schema))
+	if err != nil {
+		t.Fatalf("schemaRegex error: %v", err)
+	}
+	re := regexp.MustCompile("^" + pattern + "$")
+
+	tests := []struct {
+		doc  string
+		want bool
+	}{
+		{`{"name":"Ann","age":30,"mood":"happy","tags":[],"score":1.5}`, true},
+		{`{"name":"A \"q\"","age":-2,"mood":"sad","tags":["a","b"],"score":null}`, true},
+		{`{"age":30,"name":"Ann","mood":"happy","tags":[],"score":1}`, false},
+		{`{"name":"Ann","age":3.5,"mood":"happy","tags":[],"score":1}`, false},
+		{`{"name":"Ann","age":30,"mood":"angry","tags":[],"score":1}`, false},
+	}
+
+	for _, tt := range tests {
+		if got := re.MatchString(tt.doc); got != tt.want {
+			t.Errorf("match(%s) = %v, want %v", tt.doc, got, tt.want)
+		}
+	}
+}
+
+func TestSchemaRegex_Unsupported(t *testing.T) {
+	tests := []string{
+		`{"$ref": "#/defs/x"}`,
+		`{"type": "object"}`,
+		`{"type": "array"}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"type": "object", "properties": {"x": {"type": "date"}}}`,
+	}
+
+	for _, schema := range tests {
+		if _, err := schemaRegex([]byte(schema)); err == nil {
+			t.Errorf("schemaRegex(%s) succeeded, want error", schema)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package modelsocket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// flight is a generation shared by identical concurrent Generate calls. The
+// leader's sequence runs it; chunks are kept so callers that join late see
+// the whole output.
+type flight struct {
+	mu      sync.Mutex
+	chunks  []*GenChunk
+	changed chan struct{} // closed and replaced when chunks or done change
+	done    bool
+	err     error
+
+	// Set once the generation is done
+	generated    Message
+	inputTokens  int
+	outputTokens int
+}
+
+func newFlight() *flight {
+	return &flight{changed: make(chan struct{})}
+}
+
+// add records a chunk.
+func (f *flight) add(chunk *GenChunk) {
+	f.mu.Lock()
+	f.chunks = append(f.chunks, chunk)
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+// finish marks the generation done.
+func (f *flight) finish(inner *GenStream, err error) {
+	f.mu.Lock()
+	f.done = true
+	f.err = err
+	f.generated = inner.generated()
+	f.inputTokens = inner.InputTokens()
+	f.outputTokens = inner.OutputTokens()
+	close(f.changed)
+	f.mu.Unlock()
+}
+
+// next returns chunk i once it is available. done is set when there are no
+// more chunks.
+func (f *flight) next(ctx context.Context, i int) (chunk *GenChunk, done bool, err error) {
+	for {
+		f.mu.Lock()
+		if i < len(f.chunks) {
+			chunk = f.chunks[i]
+			f.mu.Unlock()
+			return chunk, false, nil
+		}
+		if f.done {
+			err = f.err
+			f.mu.Unlock()
+			return nil, true, err
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// coalescable reports whether a generation on s with cfg may share its output
+// with other sequences. The output must not depend on sampling, and the
+// sequence must not have state that its history doesn't capture.
+func (s *Seq) coalescable(cfg genConfig) bool {
+	deterministic := cfg.seed != nil || (cfg.temperature != nil && *cfg.temperature == 0)
+	return deterministic && s.cfg.tools == nil && s.cfg.toolPrompt == nil && s.cfg.toolCallParser == nil
+}
+
+// coalesceKey identifies a generation by everything that determines its
+// output: the model, the conversation and the generation options.
+func (s *Seq) coalesceKey(cfg genConfig) string {
+	var history []Message
+	for _, msg := range s.History() {
+		if !msg.Hidden {
+			history = append(history, msg)
+		}
+	}
+
+	data, _ := json.Marshal(struct {
+		Model       string
+		SkipPrelude bool
+		History     []Message
+		Gen         SeqGenData
+	}{s.model, s.cfg.skipPrelude, history, cfg.toSeqGenData()})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// generateCoalesced joins an identical generation already running on the
+// client, or starts one that later identical calls can join.
+func (s *Seq) generateCoalesced(ctx context.Context, cfg genConfig) (*GenStream, error) {
+	client := s.client
+	key := s.coalesceKey(cfg)
+
+	client.flightMu.Lock()
+	f, joined := client.flights[key]
+	if !joined {
+		f = newFlight()
+		client.flights[key] = f
+	}
+	client.flightMu.Unlock()
+
+	if !joined {
+		// Other callers may join, so one caller giving up doesn't cancel
+		// the shared generation
+		inner, err := s.generate(context.WithoutCancel(ctx), cfg)
+		if err != nil {
+			client.endFlight(key, f)
+			f.finish(newGenStream(s, ""), err)
+			return nil, err
+		}
+		go client.lead(key, f, inner)
+
+		stream := newGenStream(s, inner.cid)
+		stream.ctx = inner.ctx
+		stream.markSent()
+		go stream.follow(f, nil)
+		return stream, nil
+	}
+
+	// Chunks were filtered by the leader's stream already
+	stream := newGenStream(s, s.client.newID())
+	stream.ctx = context.WithoutCancel(ctx)
+	stream.markSent()
+	go stream.follow(f, s)
+	return stream, nil
+}
+
+// lead runs a shared generation, recording its chunks in f.
+func (c *Client) lead(key string, f *flight, inner *GenStream) {
+	for {
+		chunk, err := inner.Next(c.ctx)
+		if chunk != nil {
+			f.add(chunk)
+			continue
+		}
+
+		// Calls from here on start a new generation
+		c.endFlight(key, f)
+		f.finish(inner, err)
+		return
+	}
+}
+
+// endFlight stops new calls from joining f.
+func (c *Client) endFlight(key string, f *flight) {
+	c.flightMu.Lock()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	c.flightMu.Unlock()
+}
+
+// follow forwards a shared generation's chunks to g. When follower is set,
+// the generated message is appended to it once the generation is done, so
+// the follower's sequence continues as if it had generated the message
+// itself.
+func (g *GenStream) follow(f *flight, follower *Seq) {
+	for i := 0; ; i++ {
+		chunk, done, err := f.next(g.ctx, i)
+		if !done {
+			// Chunks are shared between streams, so each gets its own copy
+			copied := *chunk
+			g.forward(&copied)
+			continue
+		}
+		if err != nil {
+			g.handleError(err)
+			return
+		}
+		break
+	}
+
+	f.mu.Lock()
+	msg := f.generated
+	event := &MSEvent{InputTokens: f.inputTokens, OutputTokens: f.outputTokens}
+	f.mu.Unlock()
+
+	if follower != nil && !msg.Hidden && msg.Text != "" {
+		if _, err := follower.append(g.ctx, msg.Text, appendConfig{role: msg.Role}); err != nil {
+			g.handleError(err)
+			return
+		}
+		follower.record(msg)
+		follower.auditMessage(AuditGeneration, g.cid, msg, event.InputTokens, event.OutputTokens)
+	}
+
+	g.handleFinish(event)
+}
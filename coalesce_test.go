@@ -0,0 +1,119 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// coalesceServer generates "shared" on any sequence once release is closed,
+// and completes appends.
+func coalesceServer(release <-chan struct{}) func(req *MSRequest) []*MSEvent {
+	return func(req *MSRequest) []*MSEvent {
+		switch req.Data.(type) {
+		case appendCommandData:
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			<-release
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "shared"},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, InputTokens: 3, OutputTokens: 1},
+			}
+		}
+		return nil
+	}
+}
+
+func TestSeq_GenerateCoalesced(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	leader := openTestSeq(t, client, transport, "seq-1")
+	follower := openTestSeq(t, client, transport, "seq-2")
+
+	release := make(chan struct{})
+	seen := serveCommands(t, transport, coalesceServer(release))
+
+	first, err := leader.Generate(ctx, WithSeed(1), WithCoalesce())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	second, err := follower.Generate(ctx, WithSeed(1), WithCoalesce())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	close(release)
+
+	for i, stream := range []*GenStream{first, second} {
+		text, err := stream.Text(ctx)
+		if err != nil {
+			t.Fatalf("stream %d: Text error: %v", i, err)
+		}
+		if text != "shared" {
+			t.Errorf("stream %d: text = %q, want shared", i, text)
+		}
+		if stream.InputTokens() != 3 || stream.OutputTokens() != 1 {
+			t.Errorf("stream %d: tokens = %d/%d, want 3/1", i, stream.InputTokens(), stream.OutputTokens())
+		}
+	}
+
+	// Only the leader generates; the output is appended to the follower
+	if got := commandsFor(seen, "seq-1", 100*time.Millisecond); len(got) != 1 || got[0] != "gen" {
+		t.Errorf("leader commands = %v, want [gen]", got)
+	}
+	reqs := transport.getRequests()
+	var appended *appendCommandData
+	for _, req := range reqs {
+		if data, ok := req.Data.(appendCommandData); ok && req.SeqID == "seq-2" {
+			appended = &data
+		}
+	}
+	if appended == nil || appended.Text != "shared" || appended.Role != string(RoleAssistant) {
+		t.Errorf("follower append = %+v, want assistant text shared", appended)
+	}
+
+	for _, seq := range []*Seq{leader, follower} {
+		history := seq.History()
+		if len(history) != 1 || history[0].Text != "shared" || history[0].Role != RoleAssistant {
+			t.Errorf("%s history = %+v, want the shared message", seq.ID(), history)
+		}
+	}
+}
+
+func TestSeq_GenerateCoalesced_NotDeterministic(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	first := openTestSeq(t, client, transport, "seq-1")
+	second := openTestSeq(t, client, transport, "seq-2")
+
+	release := make(chan struct{})
+	close(release)
+	serveCommands(t, transport, coalesceServer(release))
+
+	for _, seq := range []*Seq{first, second} {
+		stream, err := seq.Generate(ctx, WithTemperature(0.7), WithCoalesce())
+		if err != nil {
+			t.Fatalf("Generate error: %v", err)
+		}
+		if _, err := stream.Text(ctx); err != nil {
+			t.Fatalf("Text error: %v", err)
+		}
+	}
+
+	gens := 0
+	for _, req := range transport.getRequests() {
+		if _, ok := req.Data.(genCommandData); ok {
+			gens++
+		}
+	}
+	if gens != 2 {
+		t.Errorf("sent %d gen commands, want 2", gens)
+	}
+}
@@ -0,0 +1,124 @@
+package modelsocket
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// DefaultContextThresholds are the fractions of a model's context window at
+// which [WithContextWindows] warns unless given others.
+var DefaultContextThresholds = []float64{0.75, 0.9}
+
+// ContextWindows maps model names to their context window in tokens. Keys
+// match models as [Pricing] keys do, so a key ending in "*" matches models
+// with that prefix. The protocol doesn't report context windows, so they are
+// configured here.
+//
+//	windows := modelsocket.ContextWindows{
+//	    "llama-3.1-*": 128_000,
+//	}
+type ContextWindows map[string]int
+
+// Window returns the context window of model, and whether the table has one.
+func (w ContextWindows) Window(model string) (int, bool) {
+	return lookupModel(w, model)
+}
+
+// ContextWarning reports that a sequence's context crossed a threshold set
+// with [WithContextWindows], so the application can summarize or branch the
+// conversation before the server rejects it.
+type ContextWarning struct {
+	SeqID     string
+	Model     string
+	Tokens    int     // Size of the context
+	Window    int     // The model's context window
+	Threshold float64 // Fraction of the window crossed
+}
+
+// contextLimits is the configuration set with WithContextWindows.
+type contextLimits struct {
+	windows    ContextWindows
+	thresholds []float64 // Ascending
+}
+
+// ContextUsage returns the size of the sequence's context in tokens, as
+// reported by the server for its appends and generations, and its model's
+// context window from [WithContextWindows], or 0 if unknown.
+func (s *Seq) ContextUsage() (tokens, window int) {
+	s.mu.RLock()
+	tokens = s.contextTokens
+	s.mu.RUnlock()
+
+	if limits := s.client.cfg.contextLimits; limits != nil {
+		window, _ = limits.windows.Window(s.model)
+	}
+	return tokens, window
+}
+
+// trackContext updates the size of the context from an append or generation
+// finishing, and warns for each threshold crossed.
+func (s *Seq) trackContext(event *MSEvent) {
+	s.mu.Lock()
+	switch {
+	case event.IsSeqAppendFinish():
+		s.contextTokens += event.InputTokens
+	case event.IsSeqGenFinish():
+		s.contextTokens = event.InputTokens + event.OutputTokens
+	default:
+		s.mu.Unlock()
+		return
+	}
+	tokens := s.contextTokens
+
+	limits := s.client.cfg.contextLimits
+	if limits == nil {
+		s.mu.Unlock()
+		return
+	}
+	window, ok := limits.windows.Window(s.model)
+	if !ok || window <= 0 {
+		s.mu.Unlock()
+		return
+	}
+
+	// Each threshold warns once
+	var crossed []float64
+	for i := s.contextWarned; i < len(limits.thresholds); i++ {
+		if float64(tokens) < limits.thresholds[i]*float64(window) {
+			break
+		}
+		crossed = append(crossed, limits.thresholds[i])
+		s.contextWarned = i + 1
+	}
+	s.mu.Unlock()
+
+	for _, threshold := range crossed {
+		warning := ContextWarning{
+			SeqID:     s.id,
+			Model:     s.model,
+			Tokens:    tokens,
+			Window:    window,
+			Threshold: threshold,
+		}
+		s.client.log(slog.LevelWarn, "", "context window filling up",
+			slog.String(logKeySeqID, s.id),
+			slog.Int("tokens", tokens),
+			slog.Int("window", window),
+			slog.Float64("threshold", threshold),
+		)
+		if fn := s.client.cfg.onContextWarning; fn != nil {
+			fn(warning)
+		}
+	}
+}
+
+// newContextLimits sorts thresholds, defaulting to
+// DefaultContextThresholds.
+func newContextLimits(windows ContextWindows, thresholds []float64) *contextLimits {
+	if len(thresholds) == 0 {
+		thresholds = DefaultContextThresholds
+	}
+	thresholds = slices.Clone(thresholds)
+	slices.Sort(thresholds)
+	return &contextLimits{windows: windows, thresholds: thresholds}
+}
@@ -0,0 +1,79 @@
+package modelsocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestContextWindows_Window(t *testing.T) {
+	windows := ContextWindows{
+		"llama-3.1-8b": 8_000,
+		"llama-3.1-*":  128_000,
+	}
+	if got, ok := windows.Window("llama-3.1-8b"); got != 8_000 || !ok {
+		t.Errorf("Window(llama-3.1-8b) = %d, %v, want 8000", got, ok)
+	}
+	if got, ok := windows.Window("llama-3.1-70b"); got != 128_000 || !ok {
+		t.Errorf("Window(llama-3.1-70b) = %d, %v, want 128000", got, ok)
+	}
+	if _, ok := windows.Window("mistral-7b"); ok {
+		t.Error("Window(mistral-7b) should be unknown")
+	}
+}
+
+func TestSeq_ContextWarnings(t *testing.T) {
+	ctx := context.Background()
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectAppend().Respond(&MSEvent{Event: "seq_append_finish", InputTokens: 60})
+	sc.ExpectGenerate().StreamText("a").Respond(&MSEvent{Event: "seq_gen_finish", InputTokens: 60, OutputTokens: 20})
+	sc.ExpectAppend().Respond(&MSEvent{Event: "seq_append_finish", InputTokens: 15})
+
+	var mu sync.Mutex
+	var warnings []ContextWarning
+	client := NewWithTransport(ctx, sc.transport,
+		WithContextWindows(ContextWindows{"test-*": 100}),
+		WithOnContextWarning(func(w ContextWarning) {
+			mu.Lock()
+			warnings = append(warnings, w)
+			mu.Unlock()
+		}),
+	)
+	defer client.Close(ctx)
+
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Append(ctx, "Hello", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	mu.Lock()
+	if len(warnings) != 1 || warnings[0].Threshold != 0.75 || warnings[0].Tokens != 80 {
+		t.Errorf("warnings = %+v, want one at 0.75 with 80 tokens", warnings)
+	}
+	mu.Unlock()
+
+	// Crossing the next threshold warns once more
+	if err := seq.Append(ctx, "More", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	mu.Lock()
+	if len(warnings) != 2 || warnings[1].Threshold != 0.9 || warnings[1].SeqID != "seq-1" {
+		t.Errorf("warnings = %+v, want a second at 0.9", warnings)
+	}
+	mu.Unlock()
+
+	if tokens, window := seq.ContextUsage(); tokens != 95 || window != 100 {
+		t.Errorf("ContextUsage = %d, %d, want 95, 100", tokens, window)
+	}
+}
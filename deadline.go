@@ -0,0 +1,114 @@
+package modelsocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateSmoothing is the weight of the latest generation in a model's
+// observed token rate.
+const rateSmoothing = 0.3
+
+// deadlineSlack is the share of the time left before a deadline that
+// [WithDeadlineBudget] keeps in reserve, for delivery and rate variation.
+const deadlineSlack = 0.1
+
+// WithDeadlineBudget caps the generation's max tokens at what the model can
+// produce before ctx's deadline, judging by its speed in earlier
+// generations on the client. When the deadline is close, the generation
+// then finishes early with a partial answer instead of failing with
+// context.DeadlineExceeded. A tighter [WithMaxTokens] is kept. Without a
+// deadline, or before the client has seen the model generate, the option
+// does nothing.
+func WithDeadlineBudget() GenOption {
+	return func(c *genConfig) {
+		c.deadlineBudget = true
+	}
+}
+
+// TokenRate returns the model's output speed in tokens per second, as
+// observed in the client's finished generations. ok is false until a
+// generation with more than one output token has finished.
+func (c *Client) TokenRate(model string) (perSecond float64, ok bool) {
+	rate, ok := c.rates.get(model)
+	return rate.perSecond, ok
+}
+
+// Estimate predicts how long a generation of maxTokens output tokens will
+// take on model, from the time to first token and token rate observed in
+// the client's finished generations. Schedulers and UIs can use it to
+// predict completion times. It returns 0 until the client has seen the
+// model generate; see [Client.TokenRate].
+func (c *Client) Estimate(model string, maxTokens int) time.Duration {
+	rate, ok := c.rates.get(model)
+	if !ok || maxTokens <= 0 {
+		return 0
+	}
+	streaming := time.Duration(float64(maxTokens-1) / rate.perSecond * float64(time.Second))
+	return rate.firstToken + streaming
+}
+
+// capForDeadline lowers cfg's max tokens to what fits before ctx's
+// deadline.
+func (s *Seq) capForDeadline(ctx context.Context, cfg *genConfig) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	rate, ok := s.client.rates.get(s.model)
+	if !ok {
+		return
+	}
+
+	left := time.Until(deadline) - rate.firstToken
+	tokens := max(int(rate.perSecond*left.Seconds()*(1-deadlineSlack)), 1)
+	if cfg.maxTokens == nil || tokens < *cfg.maxTokens {
+		cfg.maxTokens = &tokens
+	}
+}
+
+// tokenRate is a model's smoothed generation speed.
+type tokenRate struct {
+	perSecond  float64
+	firstToken time.Duration
+}
+
+// tokenRates tracks each model's tokenRate from finished generations.
+type tokenRates struct {
+	mu      sync.Mutex
+	byModel map[string]tokenRate
+}
+
+// observe folds a finished generation into the model's rate. Generations
+// with a single token or no measurable streaming time are skipped.
+func (r *tokenRates) observe(model string, outputTokens int, timings GenTimings) {
+	streaming := timings.Total - timings.FirstToken
+	if outputTokens < 2 || streaming <= 0 || timings.FirstToken <= 0 {
+		return
+	}
+	latest := tokenRate{
+		perSecond:  float64(outputTokens-1) / streaming.Seconds(),
+		firstToken: timings.FirstToken,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.byModel == nil {
+		r.byModel = make(map[string]tokenRate)
+	}
+	if prev, ok := r.byModel[model]; ok {
+		latest.perSecond = prev.perSecond + rateSmoothing*(latest.perSecond-prev.perSecond)
+		latest.firstToken = prev.firstToken + time.Duration(rateSmoothing*float64(latest.firstToken-prev.firstToken))
+	}
+	r.byModel[model] = latest
+}
+
+func (r *tokenRates) get(model string) (tokenRate, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rate, ok := r.byModel[model]
+	return rate, ok
+}
@@ -0,0 +1,120 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenRates_Observe(t *testing.T) {
+	var rates tokenRates
+	rates.observe("m", 1, GenTimings{FirstToken: time.Second, Total: 2 * time.Second})
+	if _, ok := rates.get("m"); ok {
+		t.Fatal("a single token shouldn't give a rate")
+	}
+
+	// 100 tokens after the first in a second, then 200
+	rates.observe("m", 101, GenTimings{FirstToken: 100 * time.Millisecond, Total: 1100 * time.Millisecond})
+	if rate, _ := rates.get("m"); rate.perSecond != 100 || rate.firstToken != 100*time.Millisecond {
+		t.Errorf("rate = %+v, want 100/s after 100ms", rate)
+	}
+	rates.observe("m", 201, GenTimings{FirstToken: 100 * time.Millisecond, Total: 1100 * time.Millisecond})
+	if rate, _ := rates.get("m"); rate.perSecond != 130 {
+		t.Errorf("rate = %v/s, want 130 smoothed", rate.perSecond)
+	}
+}
+
+func TestClient_Estimate(t *testing.T) {
+	client := NewWithTransport(context.Background(), newMockTransport())
+	defer client.Close(context.Background())
+
+	if got := client.Estimate("m", 100); got != 0 {
+		t.Errorf("Estimate = %v for an unseen model, want 0", got)
+	}
+	client.rates.observe("m", 101, GenTimings{FirstToken: 200 * time.Millisecond, Total: 1200 * time.Millisecond})
+	if got := client.Estimate("m", 51); got != 700*time.Millisecond {
+		t.Errorf("Estimate = %v, want 200ms to the first token and 500ms for 50 more", got)
+	}
+}
+
+func TestWithDeadlineBudget(t *testing.T) {
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	unknown := sc.ExpectGenerate().StreamText("a").Finish()
+	capped := sc.ExpectGenerate().StreamText("b").Finish()
+	tighter := sc.ExpectGenerate().StreamText("c").Finish()
+	client := sc.Client()
+
+	seq, err := client.Open(context.Background(), "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	generate := func(ctx context.Context, opts ...GenOption) {
+		t.Helper()
+		stream, err := seq.Generate(ctx, append(opts, WithDeadlineBudget())...)
+		if err != nil {
+			t.Fatalf("Generate error: %v", err)
+		}
+		if _, err := stream.Text(ctx); err != nil {
+			t.Fatalf("Text error: %v", err)
+		}
+	}
+	maxTokens := func(e *expectation) *int {
+		return e.Request(t).Data.(genCommandData).MaxTokens
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// Nothing to go on before the model's speed is known
+	generate(ctx)
+	if got := maxTokens(unknown); got != nil {
+		t.Errorf("max tokens = %d with no observed rate, want unset", *got)
+	}
+
+	client.rates.mu.Lock()
+	client.rates.byModel = map[string]tokenRate{
+		"test-model": {perSecond: 100, firstToken: 100 * time.Millisecond},
+	}
+	client.rates.mu.Unlock()
+	generate(ctx)
+	if got := maxTokens(capped); got == nil || *got < 150 || *got > 171 {
+		t.Errorf("max tokens = %v, want what fits in the 1.9s left, less slack", got)
+	}
+	generate(ctx, WithMaxTokens(10))
+	if got := maxTokens(tighter); got == nil || *got != 10 {
+		t.Errorf("max tokens = %v, want the tighter 10 kept", got)
+	}
+}
+
+func TestTokenRate_Observed(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	req := transport.waitForRequest(t, time.Second)
+	transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "a"})
+	time.Sleep(20 * time.Millisecond)
+	transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: req.CID, OutputTokens: 10})
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	// The rate is recorded as the stream ends
+	deadline := time.Now().Add(time.Second)
+	rate, ok := client.TokenRate("test-model")
+	for !ok && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		rate, ok = client.TokenRate("test-model")
+	}
+	if !ok || rate <= 0 || rate > 450 {
+		t.Errorf("TokenRate = %v, %v, want about 9 tokens in 20ms", rate, ok)
+	}
+}
@@ -0,0 +1,132 @@
+package modelsocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxEventSize is the largest frame [DecodeEvent] accepts when
+// DecodeOptions.MaxSize is zero.
+const DefaultMaxEventSize = 32 * 1024 * 1024
+
+// knownEvents are the event types the client handles.
+var knownEvents = map[string]bool{
+	"seq_opened":        true,
+	"seq_text":          true,
+	"seq_tool_call":     true,
+	"seq_append_finish": true,
+	"seq_gen_finish":    true,
+	"seq_fork_finish":   true,
+	"seq_score_finish":  true,
+	"seq_state":         true,
+	"seq_closed":        true,
+	"error":             true,
+}
+
+// DecodeOptions configures [DecodeEvent].
+type DecodeOptions struct {
+	// Strict rejects frames that lenient decoding would accept: unknown
+	// fields, unknown event types, fields of the wrong type and frames
+	// without an event type.
+	Strict bool
+
+	// MaxSize is the largest frame accepted, in bytes. Defaults to
+	// [DefaultMaxEventSize].
+	MaxSize int
+}
+
+// DecodeError is returned for a frame that could not be decoded. The client
+// logs and skips such frames rather than dropping the connection.
+type DecodeError struct {
+	Size int // Frame size in bytes
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("modelsocket: decode event (%d bytes): %v", e.Size, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// errEventTooLarge is wrapped by a DecodeError for frames over MaxSize.
+var errEventTooLarge = errors.New("frame exceeds size limit")
+
+// DecodeEvent decodes a server frame. Lenient decoding, the default, keeps
+// every field it can: when some fields don't decode, the rest are set and
+// the frame is kept in MSEvent.Raw. Frames with unknown event types are also
+// kept in Raw, so they can be handled with [WithOnUnknownEvent].
+func DecodeEvent(data []byte, opts DecodeOptions) (*MSEvent, error) {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxEventSize
+	}
+	if len(data) > maxSize {
+		return nil, &DecodeError{Size: len(data), Err: errEventTooLarge}
+	}
+
+	if opts.Strict {
+		return decodeStrict(data)
+	}
+	return decodeLenient(data)
+}
+
+// decodeStrict decodes a frame that must match MSEvent exactly.
+func decodeStrict(data []byte) (*MSEvent, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var event MSEvent
+	if err := dec.Decode(&event); err != nil {
+		return nil, &DecodeError{Size: len(data), Err: err}
+	}
+	if dec.More() {
+		return nil, &DecodeError{Size: len(data), Err: errors.New("data after event")}
+	}
+	if event.Event == "" {
+		return nil, &DecodeError{Size: len(data), Err: errors.New("missing event type")}
+	}
+	if !knownEvents[event.Event] {
+		return nil, &DecodeError{Size: len(data), Err: fmt.Errorf("unknown event type %q", event.Event)}
+	}
+	return &event, nil
+}
+
+// decodeLenient decodes the fields of a frame that it can.
+func decodeLenient(data []byte) (*MSEvent, error) {
+	var event MSEvent
+	if err := json.Unmarshal(data, &event); err == nil {
+		if !knownEvents[event.Event] {
+			event.Raw = bytes.Clone(data)
+		}
+		return &event, nil
+	}
+
+	// Decode field by field, skipping those that fail
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, &DecodeError{Size: len(data), Err: err}
+	}
+
+	event = MSEvent{}
+	for name, value := range fields {
+		field, err := json.Marshal(map[string]json.RawMessage{name: value})
+		if err != nil {
+			continue
+		}
+		var partial MSEvent
+		if json.Unmarshal(field, &partial) == nil {
+			json.Unmarshal(field, &event)
+		}
+	}
+	event.Raw = bytes.Clone(data)
+	return &event, nil
+}
+
+// isKnown reports whether the client handles events of this type.
+func (e *MSEvent) isKnown() bool {
+	return knownEvents[e.Event]
+}
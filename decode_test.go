@@ -0,0 +1,227 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	event, err := DecodeEvent([]byte(`{"event":"seq_text","seq_id":"seq-1","text":"hi","tokens":[1,2]}`), DecodeOptions{})
+	if err != nil {
+		t.Fatalf("DecodeEvent error: %v", err)
+	}
+	if event.Event != "seq_text" || event.Text != "hi" || len(event.Tokens) != 2 || event.Raw != nil {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestDecodeEvent_Lenient(t *testing.T) {
+	// A field of the wrong type doesn't lose the rest of the frame
+	frame := `{"event":"seq_gen_finish","seq_id":"seq-1","cid":"c1","input_tokens":"many","output_tokens":4}`
+	event, err := DecodeEvent([]byte(frame), DecodeOptions{})
+	if err != nil {
+		t.Fatalf("DecodeEvent error: %v", err)
+	}
+	if event.Event != "seq_gen_finish" || event.CID != "c1" || event.OutputTokens != 4 || event.InputTokens != 0 {
+		t.Errorf("event = %+v", event)
+	}
+	if string(event.Raw) != frame {
+		t.Errorf("Raw = %s, want the frame", event.Raw)
+	}
+
+	// Unknown events are kept whole
+	event, err = DecodeEvent([]byte(`{"event":"seq_future","seq_id":"seq-1","extra":true}`), DecodeOptions{})
+	if err != nil {
+		t.Fatalf("DecodeEvent error: %v", err)
+	}
+	if event.Event != "seq_future" || event.Raw == nil {
+		t.Errorf("event = %+v, want unknown event with Raw", event)
+	}
+}
+
+func TestDecodeEvent_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		opts  DecodeOptions
+	}{
+		{"not json", `{"event":`, DecodeOptions{}},
+		{"not an object", `[1,2]`, DecodeOptions{}},
+		{"too large", `{"event":"seq_text","text":"` + strings.Repeat("x", 100) + `"}`, DecodeOptions{MaxSize: 64}},
+		{"strict unknown field", `{"event":"seq_text","extra":1}`, DecodeOptions{Strict: true}},
+		{"strict unknown event", `{"event":"seq_future"}`, DecodeOptions{Strict: true}},
+		{"strict missing event", `{"seq_id":"seq-1"}`, DecodeOptions{Strict: true}},
+		{"strict wrong type", `{"event":"seq_text","tokens":"abc"}`, DecodeOptions{Strict: true}},
+		{"strict trailing data", `{"event":"seq_text"}{}`, DecodeOptions{Strict: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeEvent([]byte(tt.frame), tt.opts)
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("error = %v, want DecodeError", err)
+			}
+			if decodeErr.Size != len(tt.frame) {
+				t.Errorf("Size = %d, want %d", decodeErr.Size, len(tt.frame))
+			}
+		})
+	}
+}
+
+// badFrameTransport reports an undecodable frame before its events.
+type badFrameTransport struct {
+	*mockTransport
+	once chan struct{}
+}
+
+func (b *badFrameTransport) Receive(ctx context.Context) (*MSEvent, error) {
+	select {
+	case <-b.once:
+		return b.mockTransport.Receive(ctx)
+	default:
+		close(b.once)
+		return nil, &DecodeError{Size: 3, Err: errors.New("bad frame")}
+	}
+}
+
+func TestClient_SkipsBadFramesAndUnknownEvents(t *testing.T) {
+	mock := newMockTransport()
+	transport := &badFrameTransport{mockTransport: mock, once: make(chan struct{})}
+	ctx := context.Background()
+
+	unknown := make(chan *MSEvent, 1)
+	client := NewWithTransport(ctx, transport, WithOnUnknownEvent(func(event *MSEvent) {
+		unknown <- event
+	}))
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, mock, "seq-1")
+
+	done := make(chan error, 1)
+	go func() { done <- seq.Append(ctx, "Hello") }()
+	req := mock.waitForRequest(t, time.Second)
+
+	// An unknown event with the command's CID doesn't complete it
+	mock.pushEvent(&MSEvent{Event: "seq_future", SeqID: "seq-1", CID: req.CID})
+	select {
+	case event := <-unknown:
+		if event.Event != "seq_future" {
+			t.Errorf("unknown event = %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unknown event hook not called")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Append completed by unknown event: %v", err)
+	default:
+	}
+
+	mock.pushEvent(&MSEvent{Event: "seq_append_finish", SeqID: "seq-1", CID: req.CID})
+	if err := <-done; err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	if !client.Healthy() {
+		t.Error("client unhealthy after undecodable frame")
+	}
+}
+
+func FuzzDecodeEvent(f *testing.F) {
+	f.Add([]byte(`{"event":"seq_text","seq_id":"seq-1","text":"hi","tokens":[1,2]}`), false)
+	f.Add([]byte(`{"event":"seq_gen_finish","input_tokens":"x","output_tokens":4}`), false)
+	f.Add([]byte(`{"event":"seq_tool_call","tool_calls":[{"name":"a","args":"{}"}]}`), true)
+	f.Add([]byte(`{"event":"seq_future","nested":{"deep":[1,[2,[3]]]}}`), false)
+	f.Add([]byte(`{"event":"error","message":null}`), true)
+	f.Add([]byte(`null`), false)
+
+	f.Fuzz(func(t *testing.T, data []byte, strict bool) {
+		event, err := DecodeEvent(data, DecodeOptions{Strict: strict})
+		if err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("error %v is not a DecodeError", err)
+			}
+			return
+		}
+		if event == nil {
+			t.Fatal("nil event without error")
+		}
+		if strict && !event.isKnown() {
+			t.Fatalf("strict decoding accepted unknown event %q", event.Event)
+		}
+		if _, err := json.Marshal(event); err != nil {
+			t.Fatalf("decoded event doesn't marshal: %v", err)
+		}
+	})
+}
+
+// FuzzClientEvents feeds decoded frames to a client with an open sequence
+// and a generation in progress, checking the read loop survives them.
+func FuzzClientEvents(f *testing.F) {
+	f.Add([]byte(`{"event":"seq_text","seq_id":"seq-1","text":"hi"}`))
+	f.Add([]byte(`{"event":"seq_gen_finish","seq_id":"seq-1","cid":"","output_tokens":-5}`))
+	f.Add([]byte(`{"event":"seq_tool_call","seq_id":"seq-1","tool_calls":null}`))
+	f.Add([]byte(`{"event":"seq_closed","seq_id":"seq-1","error":"boom"}`))
+	f.Add([]byte(`{"event":"seq_fork_finish","seq_id":"seq-1","child_seq_id":""}`))
+	f.Add([]byte(`{"event":"seq_opened","seq_id":"seq-1"}`))
+	f.Add([]byte(`{"event":"error","seq_id":"seq-1"}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		event, err := DecodeEvent(data, DecodeOptions{})
+		if err != nil {
+			return
+		}
+
+		transport := newMockTransport()
+		ctx := context.Background()
+		client := NewWithTransport(ctx, transport, WithOnUnknownEvent(func(*MSEvent) {}))
+		defer client.Close(ctx)
+
+		seq := openTestSeq(t, client, transport, "seq-1")
+		stream, err := seq.Generate(ctx)
+		if err != nil {
+			t.Fatalf("Generate error: %v", err)
+		}
+		go func() {
+			for {
+				if chunk, _ := stream.Next(ctx); chunk == nil {
+					return
+				}
+			}
+		}()
+
+		transport.pushEvent(event)
+
+		// The read loop is still running if it processes a later event
+		transport.pushEvent(&MSEvent{Event: "seq_closed", SeqID: "seq-1"})
+		select {
+		case <-stream.done:
+		case <-time.After(time.Second):
+			t.Fatal("read loop stopped")
+		}
+	})
+}
+
+var benchTextFrame = []byte(`{"event":"seq_text","seq_id":"seq-1","text":" token","tokens":[1234],"num_input_tokens":512,"num_output_tokens":48}`)
+
+func BenchmarkDecodeEvent(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeEvent(benchTextFrame, DecodeOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeEvent_Strict(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeEvent(benchTextFrame, DecodeOptions{Strict: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
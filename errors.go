@@ -3,6 +3,8 @@ package modelsocket
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Sentinel errors for common conditions.
@@ -14,8 +16,63 @@ var (
 	ErrToolNotFound    = errors.New("modelsocket: tool not found")
 	ErrUnexpectedEvent = errors.New("modelsocket: unexpected event")
 	ErrBufferFull      = errors.New("modelsocket: buffer full")
+	ErrInvalidToolArgs = errors.New("modelsocket: invalid tool arguments")
+	ErrNotSupported    = errors.New("modelsocket: not supported")
+	ErrConnectionLost  = errors.New("modelsocket: connection lost")
+	ErrSessionNotFound = errors.New("modelsocket: session not found")
+	ErrSessionConflict = errors.New("modelsocket: session modified concurrently")
+	ErrPromptNotFound  = errors.New("modelsocket: prompt not found")
+	ErrOptionConflict  = errors.New("modelsocket: conflicting options")
+	ErrToolLoop        = errors.New("modelsocket: too many tool call rounds")
+	ErrDuplicateSeqID  = errors.New("modelsocket: server reused an open sequence ID")
+	ErrAgentDepth      = errors.New("modelsocket: agent depth limit reached")
+	ErrExportFormat    = errors.New("modelsocket: unknown export format")
+
+	// ErrToolCallInProgress is returned by a [ToolCallStore] that won't
+	// wait for another caller's claim on a key
+	ErrToolCallInProgress = errors.New("modelsocket: tool call already in progress")
+
+	// Reasons the server closed the connection, matched by a [*CloseError]
+	ErrServerShutdown    = errors.New("modelsocket: server shutting down")
+	ErrAuthRevoked       = errors.New("modelsocket: authorization revoked")
+	ErrProtocolViolation = errors.New("modelsocket: protocol violation")
 )
 
+// CloseError reports that the server closed the connection, with the
+// WebSocket close code and reason it gave. It matches ErrServerShutdown,
+// ErrAuthRevoked or ErrProtocolViolation with errors.Is, depending on the
+// code:
+//
+//   - 1001 (going away), 1012 (service restart) and 1013 (try again later)
+//     are ErrServerShutdown
+//   - 1008 (policy violation), 4001 and 4003 (the conventional
+//     unauthorized and forbidden codes) are ErrAuthRevoked
+//   - 1002 (protocol error), 1003 (unsupported data), 1007 (invalid
+//     payload) and 1009 (message too big) are ErrProtocolViolation
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("modelsocket: closed by server with status %d: %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("modelsocket: closed by server with status %d", e.Code)
+}
+
+func (e *CloseError) Is(target error) bool {
+	switch e.Code {
+	case 1001, 1012, 1013:
+		return target == ErrServerShutdown
+	case 1008, 4001, 4003:
+		return target == ErrAuthRevoked
+	case 1002, 1003, 1007, 1009:
+		return target == ErrProtocolViolation
+	}
+	return false
+}
+
 // ConnectionError represents a connection-level error.
 type ConnectionError struct {
 	Op  string
@@ -63,6 +120,31 @@ func (e *ProtocolError) Error() string {
 	return fmt.Sprintf("modelsocket: protocol error: %s", e.Message)
 }
 
+// unknownCommandMarkers are substrings of server errors rejecting a command
+// the server doesn't implement.
+var unknownCommandMarkers = []string{
+	"unknown command",
+	"unsupported command",
+	"not supported",
+	"not implemented",
+}
+
+// isUnknownCommand reports whether err is a server error rejecting a command
+// it doesn't implement. Like [IsModelUnavailable], it matches on the message.
+func isUnknownCommand(err error) bool {
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) {
+		return false
+	}
+	msg := strings.ToLower(protoErr.Message)
+	for _, marker := range unknownCommandMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
 // SeqError represents a sequence-level error.
 type SeqError struct {
 	SeqID   string
@@ -72,3 +154,96 @@ type SeqError struct {
 func (e *SeqError) Error() string {
 	return fmt.Sprintf("modelsocket: sequence %s: %s", e.SeqID, e.Message)
 }
+
+// FrameTooLargeError is returned by the WebSocket transport for a frame
+// larger than DialOptions.ReadLimit. The frame is discarded and the
+// connection stays open; the client logs the error and reads on.
+type FrameTooLargeError struct {
+	Limit int64 // Read limit in bytes
+	Size  int64 // Frame size in bytes
+}
+
+func (e *FrameTooLargeError) Error() string {
+	return fmt.Sprintf("modelsocket: frame of %d bytes exceeds read limit of %d bytes", e.Size, e.Limit)
+}
+
+// WriteTimeoutError is returned, wrapped in a [*ConnectionError], when a
+// frame isn't written within DialOptions.WriteTimeout. It matches
+// ErrTimeout with errors.Is.
+type WriteTimeoutError struct {
+	Timeout time.Duration
+	Bytes   int // Frame size
+}
+
+func (e *WriteTimeoutError) Error() string {
+	return fmt.Sprintf("modelsocket: write of %d bytes timed out after %v", e.Bytes, e.Timeout)
+}
+
+func (e *WriteTimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// OpenTimeoutError is returned by [Client.Open] when the server doesn't open
+// the sequence within the client's open timeout. CID identifies the
+// seq_open request. It matches ErrTimeout with errors.Is.
+type OpenTimeoutError struct {
+	CID     string
+	Timeout time.Duration
+}
+
+func (e *OpenTimeoutError) Error() string {
+	return fmt.Sprintf("modelsocket: seq_open %s not answered within %v", e.CID, e.Timeout)
+}
+
+func (e *OpenTimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// OptionConflictError is returned by [Client.Open] when two options set the
+// same thing, so one of them would otherwise be ignored. It matches
+// ErrOptionConflict with errors.Is.
+type OptionConflictError struct {
+	First  string // Option names, e.g. "WithToolbox"
+	Second string
+	Reason string
+}
+
+func (e *OptionConflictError) Error() string {
+	return fmt.Sprintf("modelsocket: %s conflicts with %s: %s", e.Second, e.First, e.Reason)
+}
+
+func (e *OptionConflictError) Is(target error) bool {
+	return target == ErrOptionConflict
+}
+
+// BudgetExceededError is returned when a generation exceeds, or would start
+// beyond, a budget set with [WithClientBudget], [WithSeqBudget] or
+// [WithBudget]. The consumed amounts include the generation that exceeded
+// the budget.
+type BudgetExceededError struct {
+	Scope        string // BudgetScopeClient, BudgetScopeSequence or BudgetScopeCall
+	Budget       Budget
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("modelsocket: %s budget exceeded: %d input tokens, %d output tokens, cost %g",
+		e.Scope, e.InputTokens, e.OutputTokens, e.Cost)
+}
+
+// ToolArgsError represents tool call arguments that could not be parsed.
+type ToolArgsError struct {
+	Name string
+	Args string
+	Err  error
+}
+
+func (e *ToolArgsError) Error() string {
+	return fmt.Sprintf("modelsocket: tool %s: %v", e.Name, e.Err)
+}
+
+func (e *ToolArgsError) Unwrap() error {
+	return e.Err
+}
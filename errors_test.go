@@ -116,3 +116,38 @@ func TestErrorsIs(t *testing.T) {
 		t.Error("errors.As should extract ConnectionError")
 	}
 }
+
+func TestCloseError_Is(t *testing.T) {
+	tests := []struct {
+		code int
+		want error
+	}{
+		{1001, ErrServerShutdown},
+		{1012, ErrServerShutdown},
+		{1013, ErrServerShutdown},
+		{1008, ErrAuthRevoked},
+		{4001, ErrAuthRevoked},
+		{4003, ErrAuthRevoked},
+		{1002, ErrProtocolViolation},
+		{1009, ErrProtocolViolation},
+		{1000, nil},
+		{4500, nil},
+	}
+
+	kinds := []error{ErrServerShutdown, ErrAuthRevoked, ErrProtocolViolation}
+	for _, tt := range tests {
+		err := error(&ConnectionError{Op: "read", Err: &CloseError{Code: tt.code}})
+		for _, kind := range kinds {
+			if got := errors.Is(err, kind); got != (kind == tt.want) {
+				t.Errorf("code %d: errors.Is(err, %v) = %v", tt.code, kind, got)
+			}
+		}
+	}
+}
+
+func TestCloseError_Error(t *testing.T) {
+	err := &CloseError{Code: 1001, Reason: "restarting"}
+	if got, want := err.Error(), "modelsocket: closed by server with status 1001: restarting"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Example is one case in a dataset.
+type Example struct {
+	// ID names the example in reports. Defaults to its line number.
+	ID string `json:"id,omitempty"`
+
+	// Input is appended as the user message.
+	Input string `json:"input"`
+
+	// Expected is the reference answer graders compare against.
+	Expected string `json:"expected,omitempty"`
+
+	// Seed overrides Config.Seed for this example.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Metadata is carried through to the result.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// LoadJSONL reads a dataset with one JSON [Example] per line. Blank lines
+// are skipped.
+func LoadJSONL(r io.Reader) ([]Example, error) {
+	var examples []Example
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var ex Example
+		if err := json.Unmarshal(data, &ex); err != nil {
+			return nil, fmt.Errorf("eval: line %d: %w", line, err)
+		}
+		if ex.ID == "" {
+			ex.ID = fmt.Sprintf("%d", line)
+		}
+		examples = append(examples, ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("eval: read dataset: %w", err)
+	}
+	return examples, nil
+}
+
+// LoadFile reads a JSONL dataset from path.
+func LoadFile(path string) ([]Example, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadJSONL(f)
+}
@@ -0,0 +1,54 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadJSONL(t *testing.T) {
+	data := `{"id": "a", "input": "hi", "expected": "hello", "seed": 3}
+
+{"input": "bye", "metadata": {"lang": "en"}}
+`
+	examples, err := LoadJSONL(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("LoadJSONL error: %v", err)
+	}
+	if len(examples) != 2 {
+		t.Fatalf("examples = %+v, want 2", examples)
+	}
+	if ex := examples[0]; ex.ID != "a" || ex.Expected != "hello" || ex.Seed == nil || *ex.Seed != 3 {
+		t.Errorf("examples[0] = %+v", ex)
+	}
+	// Examples without IDs are named by line
+	if ex := examples[1]; ex.ID != "3" || ex.Metadata["lang"] != "en" {
+		t.Errorf("examples[1] = %+v, want ID 3", ex)
+	}
+}
+
+func TestLoadJSONL_Invalid(t *testing.T) {
+	_, err := LoadJSONL(strings.NewReader("{\"input\": \"ok\"}\nnot json\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("err = %v, want error on line 2", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.jsonl")
+	if err := os.WriteFile(path, []byte(`{"input": "hi"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	examples, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile error: %v", err)
+	}
+	if len(examples) != 1 || examples[0].Input != "hi" {
+		t.Errorf("examples = %+v", examples)
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,292 @@
+// Package eval regression-tests prompts against a ModelSocket backend. Each
+// example in a dataset is generated in its own sequence with a fixed seed,
+// graded by one or more graders, and summarized in a report:
+//
+//	examples, err := eval.LoadFile("testdata/support.jsonl")
+//	report, err := eval.Run(ctx, client, examples, eval.Config{
+//	    Model: "meta/llama3.1-8b-instruct-free",
+//	    Graders: map[string]eval.Grader{
+//	        "exact": eval.ExactMatch(),
+//	        "judge": eval.ModelJudge(client, judgeModel, "The answer is polite and correct."),
+//	    },
+//	})
+//	report.WriteText(os.Stdout)
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// DefaultConcurrency is how many examples run at once when
+// Config.Concurrency is zero.
+const DefaultConcurrency = 4
+
+// Config configures Run.
+type Config struct {
+	// Model is the model sequences are opened with.
+	Model string
+
+	// Prompt builds the user message for an example. Defaults to
+	// Example.Input.
+	Prompt func(Example) string
+
+	// Seed is the generation seed for examples without their own, so runs
+	// are repeatable.
+	Seed int64
+
+	// Graders grade each output, keyed by name in results and reports.
+	Graders map[string]Grader
+
+	// Concurrency is how many examples run at once. Defaults to
+	// DefaultConcurrency.
+	Concurrency int
+
+	// OpenOptions and GenOptions apply to every example.
+	OpenOptions []modelsocket.OpenOption
+	GenOptions  []modelsocket.GenOption
+
+	// OnResult, if set, is called as each example completes. Calls are
+	// serialized.
+	OnResult func(Result)
+}
+
+// Result is the outcome of one example.
+type Result struct {
+	Example      Example
+	Output       string
+	Grades       map[string]Grade
+	Err          error // Generation or grading failed
+	Duration     time.Duration
+	InputTokens  int
+	OutputTokens int
+}
+
+// Passed reports whether the example generated without error and passed
+// every grader.
+func (r Result) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, g := range r.Grades {
+		if !g.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+// Report summarizes a run.
+type Report struct {
+	Results []Result // In dataset order
+	Passed  int
+	Failed  int // Graded, but failed a grader
+	Errored int
+}
+
+// PassRate returns the fraction of examples that passed.
+func (r *Report) PassRate() float64 {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	return float64(r.Passed) / float64(len(r.Results))
+}
+
+// Graders returns the names of the graders in the report, sorted.
+func (r *Report) Graders() []string {
+	seen := make(map[string]bool)
+	for _, res := range r.Results {
+		for name := range res.Grades {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// MeanScore returns the mean score from the named grader over the examples
+// it graded.
+func (r *Report) MeanScore(grader string) float64 {
+	var sum float64
+	var n int
+	for _, res := range r.Results {
+		if g, ok := res.Grades[grader]; ok {
+			sum += g.Score
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// WriteText writes a summary and the failing examples to w.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "examples\t%d\n", len(r.Results))
+	fmt.Fprintf(tw, "passed\t%d (%.1f%%)\n", r.Passed, r.PassRate()*100)
+	fmt.Fprintf(tw, "failed\t%d\n", r.Failed)
+	fmt.Fprintf(tw, "errored\t%d\n", r.Errored)
+	for _, name := range r.Graders() {
+		fmt.Fprintf(tw, "score %s\t%.3f\n", name, r.MeanScore(name))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, res := range r.Results {
+		if res.Passed() {
+			continue
+		}
+		if res.Err != nil {
+			if _, err := fmt.Fprintf(w, "\nERROR %s: %v\n", res.Example.ID, res.Err); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\nFAIL %s\n", res.Example.ID); err != nil {
+			return err
+		}
+		for _, name := range slices.Sorted(maps.Keys(res.Grades)) {
+			if g := res.Grades[name]; !g.Pass {
+				if _, err := fmt.Fprintf(w, "  %s: %s\n", name, g.Reason); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Run generates and grades every example. Failures of individual examples
+// are recorded in their results; Run itself fails only if ctx is done.
+func Run(ctx context.Context, client *modelsocket.Client, examples []Example, cfg Config) (*Report, error) {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	if cfg.Prompt == nil {
+		cfg.Prompt = func(ex Example) string { return ex.Input }
+	}
+
+	results := make([]Result, len(examples))
+	sem := make(chan struct{}, cfg.Concurrency)
+
+	var wg sync.WaitGroup
+	var resultMu sync.Mutex
+	for i, ex := range examples {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = runExample(ctx, client, ex, cfg)
+			if cfg.OnResult != nil {
+				resultMu.Lock()
+				cfg.OnResult(results[i])
+				resultMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Results: results}
+	for _, res := range results {
+		switch {
+		case res.Err != nil:
+			report.Errored++
+		case res.Passed():
+			report.Passed++
+		default:
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// runExample generates ex in a new sequence and grades the output.
+func runExample(ctx context.Context, client *modelsocket.Client, ex Example, cfg Config) Result {
+	res := Result{Example: ex}
+	start := time.Now()
+
+	seed := cfg.Seed
+	if ex.Seed != nil {
+		seed = *ex.Seed
+	}
+
+	output, stream, err := generate(ctx, client, cfg, cfg.Prompt(ex), seed)
+	if stream != nil {
+		res.InputTokens = stream.InputTokens()
+		res.OutputTokens = stream.OutputTokens()
+	}
+	if err != nil {
+		res.Err = err
+		res.Duration = time.Since(start)
+		return res
+	}
+	res.Output = output
+
+	res.Grades = make(map[string]Grade, len(cfg.Graders))
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(cfg.Graders)) {
+		grade, err := cfg.Graders[name].Grade(ctx, ex, output)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("grader %s: %w", name, err))
+			continue
+		}
+		res.Grades[name] = grade
+	}
+	res.Err = errors.Join(errs...)
+	res.Duration = time.Since(start)
+	return res
+}
+
+// generate returns the reply to prompt in a new sequence.
+func generate(ctx context.Context, client *modelsocket.Client, cfg Config, prompt string, seed int64) (string, *modelsocket.GenStream, error) {
+	seq, err := client.Open(ctx, cfg.Model, cfg.OpenOptions...)
+	if err != nil {
+		return "", nil, err
+	}
+	defer seq.Close(context.WithoutCancel(ctx))
+
+	if err := seq.Append(ctx, prompt, modelsocket.AsUser()); err != nil {
+		return "", nil, err
+	}
+
+	opts := append([]modelsocket.GenOption{
+		modelsocket.GenerateAsAssistant(),
+		modelsocket.WithSeed(seed),
+	}, cfg.GenOptions...)
+	stream, err := seq.Generate(ctx, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	text, err := stream.Text(ctx)
+	return strings.TrimSpace(text), stream, err
+}
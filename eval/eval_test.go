@@ -0,0 +1,147 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers each generation with reply
+// applied to the sequence's last appended text.
+func newServer(reply func(prompt string) (string, error)) *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		text, err := reply(g.Prompt())
+		if err != nil {
+			return []*modelsocket.MSEvent{mstest.Error(err.Error())}
+		}
+		return []*modelsocket.MSEvent{mstest.Text(text), mstest.Finish(10, 2)}
+	})
+}
+
+func newClient(t *testing.T, transport *mstest.Server) *modelsocket.Client {
+	t.Helper()
+
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, transport)
+	t.Cleanup(func() { client.Close(ctx) })
+	return client
+}
+
+// capitals answers "capital of X?" prompts.
+func capitals(prompt string) (string, error) {
+	switch prompt {
+	case "capital of France?":
+		return "Paris", nil
+	case "capital of Spain?":
+		return "Barcelona", nil
+	}
+	return "", errors.New("unknown country")
+}
+
+func TestRun(t *testing.T) {
+	transport := newServer(capitals)
+	client := newClient(t, transport)
+
+	seed := int64(7)
+	examples := []Example{
+		{ID: "fr", Input: "capital of France?", Expected: "Paris"},
+		{ID: "es", Input: "capital of Spain?", Expected: "Madrid", Seed: &seed},
+		{ID: "xx", Input: "capital of Atlantis?"},
+	}
+
+	var completed int
+	report, err := Run(context.Background(), client, examples, Config{
+		Model:       "test-model",
+		Seed:        42,
+		Concurrency: 2,
+		Graders:     map[string]Grader{"exact": ExactMatch()},
+		OnResult:    func(Result) { completed++ },
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	if report.Passed != 1 || report.Failed != 1 || report.Errored != 1 {
+		t.Errorf("report = %d passed, %d failed, %d errored, want 1 of each",
+			report.Passed, report.Failed, report.Errored)
+	}
+	if completed != 3 {
+		t.Errorf("OnResult called %d times, want 3", completed)
+	}
+
+	// Results are in dataset order
+	fr, es, xx := report.Results[0], report.Results[1], report.Results[2]
+	if fr.Example.ID != "fr" || !fr.Passed() || fr.Output != "Paris" || fr.OutputTokens != 2 {
+		t.Errorf("fr result = %+v, want passed with 2 output tokens", fr)
+	}
+	if es.Passed() || es.Grades["exact"].Reason == "" {
+		t.Errorf("es result = %+v, want failed with a reason", es)
+	}
+	if xx.Err == nil {
+		t.Errorf("xx result = %+v, want error", xx)
+	}
+	if got := report.MeanScore("exact"); got != 0.5 {
+		t.Errorf("MeanScore = %v, want 0.5", got)
+	}
+
+	var seeds []string
+	for _, gen := range transport.Gens() {
+		if gen.Seed != nil {
+			seeds = append(seeds, fmt.Sprint(*gen.Seed))
+		}
+	}
+	for _, want := range []string{"42", "7"} {
+		if !slices.Contains(seeds, want) {
+			t.Errorf("seeds = %v, want %s among them", seeds, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText error: %v", err)
+	}
+	text := buf.String()
+	for _, want := range []string{"1 (33.3%)", "score exact  0.500", "FAIL es\n  exact: got \"Barcelona\"", "ERROR xx: "} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, " fr") {
+		t.Errorf("report lists passing example:\n%s", text)
+	}
+}
+
+func TestRun_Prompt(t *testing.T) {
+	transport := newServer(capitals)
+	client := newClient(t, transport)
+
+	report, err := Run(context.Background(), client, []Example{{Input: "France", Expected: "Paris"}}, Config{
+		Model:   "test-model",
+		Prompt:  func(ex Example) string { return "capital of " + ex.Input + "?" },
+		Graders: map[string]Grader{"exact": ExactMatch()},
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if report.Passed != 1 {
+		t.Errorf("results = %+v, want passed", report.Results)
+	}
+}
+
+func TestRun_Canceled(t *testing.T) {
+	transport := newServer(capitals)
+	client := newClient(t, transport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, client, []Example{{Input: "capital of France?"}}, Config{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// Grade is a grader's verdict on one output.
+type Grade struct {
+	Pass   bool
+	Score  float64 // Between 0 and 1
+	Reason string
+}
+
+// Grader grades a generated output against its example.
+type Grader interface {
+	Grade(ctx context.Context, ex Example, output string) (Grade, error)
+}
+
+// GraderFunc adapts a function to a [Grader].
+type GraderFunc func(ctx context.Context, ex Example, output string) (Grade, error)
+
+func (f GraderFunc) Grade(ctx context.Context, ex Example, output string) (Grade, error) {
+	return f(ctx, ex, output)
+}
+
+// passFail returns a Grade scored 1 or 0.
+func passFail(pass bool, reason string) Grade {
+	if pass {
+		return Grade{Pass: true, Score: 1}
+	}
+	return Grade{Score: 0, Reason: reason}
+}
+
+// ExactMatch passes outputs equal to Example.Expected, ignoring surrounding
+// whitespace.
+func ExactMatch() Grader {
+	return GraderFunc(func(ctx context.Context, ex Example, output string) (Grade, error) {
+		got, want := strings.TrimSpace(output), strings.TrimSpace(ex.Expected)
+		return passFail(got == want, fmt.Sprintf("got %q, want %q", got, want)), nil
+	})
+}
+
+// Regex passes outputs that re matches.
+func Regex(re *regexp.Regexp) Grader {
+	return GraderFunc(func(ctx context.Context, ex Example, output string) (Grade, error) {
+		return passFail(re.MatchString(output), fmt.Sprintf("output does not match %s", re)), nil
+	})
+}
+
+// judgePrompt asks the judge to grade an output. It is followed by the
+// rubric, the input, the reference answer and the output.
+const judgePrompt = "You are grading an answer against a rubric. Reply PASS if the answer meets the rubric and FAIL if it does not.\n\nRubric:\n%s\n\nQuestion:\n%s\n\nReference answer:\n%s\n\nAnswer:\n%s"
+
+// ModelJudge grades outputs with a judge model, opened in a separate
+// sequence for each output so the judge never sees other examples. The
+// judge answers PASS or FAIL against rubric, constrained with
+// [modelsocket.Seq.Choose].
+func ModelJudge(client *modelsocket.Client, model, rubric string, opts ...modelsocket.OpenOption) Grader {
+	return GraderFunc(func(ctx context.Context, ex Example, output string) (Grade, error) {
+		seq, err := client.Open(ctx, model, opts...)
+		if err != nil {
+			return Grade{}, err
+		}
+		defer seq.Close(context.WithoutCancel(ctx))
+
+		prompt := fmt.Sprintf(judgePrompt, rubric, ex.Input, ex.Expected, output)
+		if err := seq.Append(ctx, prompt, modelsocket.AsUser()); err != nil {
+			return Grade{}, err
+		}
+		idx, err := seq.Choose(ctx, []string{"PASS", "FAIL"}, modelsocket.GenerateAsAssistant())
+		if err != nil {
+			return Grade{}, err
+		}
+		return passFail(idx == 0, "judge answered FAIL"), nil
+	})
+}
+
+// Pairwise grades outputs by comparing them with Example.Expected using
+// [modelsocket.Judge]. Outputs at least as good as the reference pass. The
+// score is the judge's confidence that the output is better, with a tie
+// scoring 0.5.
+func Pairwise(client *modelsocket.Client, model, rubric string) Grader {
+	return GraderFunc(func(ctx context.Context, ex Example, output string) (Grade, error) {
+		v, err := modelsocket.Judge(ctx, client, model, rubric, output, ex.Expected)
+		if err != nil {
+			return Grade{}, err
+		}
+
+		grade := Grade{Reason: v.Rationale}
+		switch v.Winner {
+		case modelsocket.WinnerA:
+			grade.Pass = true
+			grade.Score = 0.5 + v.Score/2
+		case modelsocket.WinnerB:
+			grade.Score = 0.5 - v.Score/2
+		default:
+			grade.Pass = true
+			grade.Score = 0.5
+		}
+		return grade, nil
+	})
+}
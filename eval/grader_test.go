@@ -0,0 +1,111 @@
+package eval
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExactMatch(t *testing.T) {
+	ex := Example{Expected: "Paris"}
+	for _, tt := range []struct {
+		output string
+		pass   bool
+	}{
+		{"Paris", true},
+		{"  Paris\n", true},
+		{"paris", false},
+	} {
+		grade, err := ExactMatch().Grade(context.Background(), ex, tt.output)
+		if err != nil {
+			t.Fatalf("Grade error: %v", err)
+		}
+		if grade.Pass != tt.pass {
+			t.Errorf("Grade(%q) = %+v, want pass %v", tt.output, grade, tt.pass)
+		}
+	}
+}
+
+func TestRegex(t *testing.T) {
+	g := Regex(regexp.MustCompile(`^\d+$`))
+
+	if grade, _ := g.Grade(context.Background(), Example{}, "42"); !grade.Pass || grade.Score != 1 {
+		t.Errorf("Grade(42) = %+v, want pass", grade)
+	}
+	if grade, _ := g.Grade(context.Background(), Example{}, "forty"); grade.Pass || grade.Reason == "" {
+		t.Errorf("Grade(forty) = %+v, want fail with reason", grade)
+	}
+}
+
+func TestModelJudge(t *testing.T) {
+	transport := newServer(capitals)
+	// The judge prefers PASS when the answer matches the reference
+	transport.Score = func(prompt, text string) float64 {
+		_, answer, _ := strings.Cut(prompt, "Answer:\n")
+		_, rest, _ := strings.Cut(prompt, "Reference answer:\n")
+		reference, _, _ := strings.Cut(rest, "\n")
+		if (answer == reference) == (text == "PASS") {
+			return -0.1
+		}
+		return -3
+	}
+	client := newClient(t, transport)
+
+	judge := ModelJudge(client, "judge-model", "The answer names the right city.")
+	ex := Example{Input: "capital of France?", Expected: "Paris"}
+
+	grade, err := judge.Grade(context.Background(), ex, "Paris")
+	if err != nil {
+		t.Fatalf("Grade error: %v", err)
+	}
+	if !grade.Pass {
+		t.Errorf("Grade(Paris) = %+v, want pass", grade)
+	}
+
+	grade, err = judge.Grade(context.Background(), ex, "Lyon")
+	if err != nil {
+		t.Fatalf("Grade error: %v", err)
+	}
+	if grade.Pass {
+		t.Errorf("Grade(Lyon) = %+v, want fail", grade)
+	}
+
+	// Each grade uses its own sequence
+	if opened := transport.Opened(); opened != 2 {
+		t.Errorf("opened %d sequences, want 2", opened)
+	}
+}
+
+func TestPairwise(t *testing.T) {
+	transport := newServer(func(prompt string) (string, error) {
+		// The judge prefers candidate A, the output, when it is shorter
+		_, rest, _ := strings.Cut(prompt, "Candidate A:\n")
+		a, rest, _ := strings.Cut(rest, "\n\nCandidate B:\n")
+		b, _, _ := strings.Cut(rest, "\n\n")
+		if len(a) < len(b) {
+			return `{"winner": "A", "score": 0.8, "rationale": "shorter"}`, nil
+		}
+		return `{"winner": "B", "score": 1, "rationale": "reference is shorter"}`, nil
+	})
+	client := newClient(t, transport)
+
+	judge := Pairwise(client, "judge-model", "Be concise.")
+	ex := Example{Input: "capital of France?", Expected: "It is Paris."}
+
+	grade, err := judge.Grade(context.Background(), ex, "Paris")
+	if err != nil {
+		t.Fatalf("Grade error: %v", err)
+	}
+	if !grade.Pass || grade.Score != 0.9 || grade.Reason != "shorter" {
+		t.Errorf("Grade(Paris) = %+v, want pass scoring 0.9", grade)
+	}
+
+	grade, err = judge.Grade(context.Background(), ex, "The capital of France is Paris.")
+	if err != nil {
+		t.Fatalf("Grade error: %v", err)
+	}
+	if grade.Pass || grade.Score != 0 {
+		t.Errorf("Grade(long) = %+v, want fail scoring 0", grade)
+	}
+}
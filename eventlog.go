@@ -0,0 +1,66 @@
+package modelsocket
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event log directions.
+const (
+	DirectionSend    = "send"
+	DirectionReceive = "recv"
+)
+
+// EventLogEntry is a single line of the JSONL transcript written by
+// [WithEventLog]. Exactly one of Request or Event is set.
+type EventLogEntry struct {
+	Time      time.Time  `json:"time"`
+	Direction string     `json:"dir"`
+	Request   *MSRequest `json:"request,omitempty"`
+	Event     *MSEvent   `json:"event,omitempty"`
+}
+
+// eventLog serializes entries to a writer.
+type eventLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventLog(w io.Writer) *eventLog {
+	return &eventLog{enc: json.NewEncoder(w)}
+}
+
+// logRequest records an outgoing request.
+func (l *eventLog) logRequest(req *MSRequest) error {
+	return l.write(EventLogEntry{Time: time.Now(), Direction: DirectionSend, Request: req})
+}
+
+// logEvent records an incoming event.
+func (l *eventLog) logEvent(event *MSEvent) error {
+	return l.write(EventLogEntry{Time: time.Now(), Direction: DirectionReceive, Event: event})
+}
+
+func (l *eventLog) write(entry EventLogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(entry)
+}
+
+// ReadEventLog decodes a transcript written by [WithEventLog]. Request data
+// is decoded into generic JSON values.
+func ReadEventLog(r io.Reader) ([]EventLogEntry, error) {
+	dec := json.NewDecoder(r)
+
+	var entries []EventLogEntry
+	for {
+		var entry EventLogEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
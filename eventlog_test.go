@@ -0,0 +1,42 @@
+package modelsocket
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithEventLog(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	client := NewWithTransport(ctx, transport, WithEventLog(&buf))
+
+	openTestSeq(t, client, transport, "seq-123")
+	client.Close(ctx)
+
+	entries, err := ReadEventLog(&buf)
+	if err != nil {
+		t.Fatalf("ReadEventLog error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %d, want 2", len(entries))
+	}
+
+	sent, received := entries[0], entries[1]
+	if sent.Direction != DirectionSend || sent.Request == nil || sent.Request.Request != "seq_open" {
+		t.Errorf("entries[0] = %+v, want seq_open request", sent)
+	}
+	data, ok := sent.Request.Data.(map[string]interface{})
+	if !ok || data["model"] != "test-model" {
+		t.Errorf("Request.Data = %v, want model test-model", sent.Request.Data)
+	}
+	if received.Direction != DirectionReceive || received.Event == nil || received.Event.SeqID != "seq-123" {
+		t.Errorf("entries[1] = %+v, want seq_opened event", received)
+	}
+	if time.Since(sent.Time) > time.Minute {
+		t.Errorf("Time = %v, want recent timestamp", sent.Time)
+	}
+}
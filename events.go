@@ -0,0 +1,229 @@
+package modelsocket
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event is a typed server event, returned by [MSEvent.Decode]. Use a type
+// switch to handle the variants:
+//
+//	switch e := ev.(type) {
+//	case *modelsocket.SeqTextEvent:
+//	    fmt.Print(e.Text)
+//	case *modelsocket.SeqGenFinishEvent:
+//	    fmt.Println("\ntokens:", e.OutputTokens)
+//	}
+type Event interface {
+	// EventType returns the wire event type, e.g. "seq_text".
+	EventType() string
+}
+
+// SeqOpenedEvent reports a sequence opened by seq_open.
+type SeqOpenedEvent struct {
+	CID   string
+	SeqID string
+}
+
+// SeqTextEvent carries generated text.
+type SeqTextEvent struct {
+	SeqID           string
+	CID             string
+	Text            string
+	Hidden          bool
+	Tokens          []int
+	NumInputTokens  int
+	NumOutputTokens int
+	Safety          []SafetyAnnotation
+	Citations       []Citation
+}
+
+// SeqToolCallEvent carries tool calls made by the model.
+type SeqToolCallEvent struct {
+	SeqID     string
+	CID       string
+	ToolCalls []ToolCall
+}
+
+// SeqAppendFinishEvent reports a completed append and the tokens it added
+// to the sequence's context.
+type SeqAppendFinishEvent struct {
+	SeqID       string
+	CID         string
+	InputTokens int
+}
+
+// SeqGenFinishEvent reports a completed generation.
+type SeqGenFinishEvent struct {
+	SeqID        string
+	CID          string
+	InputTokens  int
+	OutputTokens int
+	Safety       []SafetyAnnotation
+	Citations    []Citation
+}
+
+// SeqForkFinishEvent reports a completed fork.
+type SeqForkFinishEvent struct {
+	SeqID      string
+	CID        string
+	ChildSeqID string
+}
+
+// SeqScoreFinishEvent reports a completed score command.
+type SeqScoreFinishEvent struct {
+	SeqID         string
+	CID           string
+	LogProb       float64
+	TokenLogProbs []float64
+}
+
+// SeqStateEvent reports a sequence state change.
+type SeqStateEvent struct {
+	SeqID string
+	State SeqState
+}
+
+// SeqClosedEvent reports a closed sequence and its totals. Error is set if
+// the sequence closed because of a failure.
+type SeqClosedEvent struct {
+	SeqID        string
+	CID          string
+	InputTokens  int
+	OutputTokens int
+	DurationMs   int64
+	Error        string
+}
+
+// ErrorEvent reports a failed request or command.
+type ErrorEvent struct {
+	SeqID   string
+	CID     string
+	Message string
+}
+
+// UnknownEvent is an event type the client doesn't know. Raw holds the
+// frame, if it was decoded by [DecodeEvent].
+type UnknownEvent struct {
+	Type  string
+	SeqID string
+	CID   string
+	Raw   json.RawMessage
+}
+
+func (*SeqOpenedEvent) EventType() string       { return "seq_opened" }
+func (*SeqTextEvent) EventType() string         { return "seq_text" }
+func (*SeqToolCallEvent) EventType() string     { return "seq_tool_call" }
+func (*SeqAppendFinishEvent) EventType() string { return "seq_append_finish" }
+func (*SeqGenFinishEvent) EventType() string    { return "seq_gen_finish" }
+func (*SeqForkFinishEvent) EventType() string   { return "seq_fork_finish" }
+func (*SeqScoreFinishEvent) EventType() string  { return "seq_score_finish" }
+func (*SeqStateEvent) EventType() string        { return "seq_state" }
+func (*SeqClosedEvent) EventType() string       { return "seq_closed" }
+func (*ErrorEvent) EventType() string           { return "error" }
+func (e *UnknownEvent) EventType() string       { return e.Type }
+
+// Decode returns the typed variant of the event. It fails with
+// ErrUnexpectedEvent if a field the event type requires is missing.
+func (e *MSEvent) Decode() (Event, error) {
+	switch e.Event {
+	case "seq_opened":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		return &SeqOpenedEvent{CID: e.CID, SeqID: e.SeqID}, nil
+
+	case "seq_text":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		return &SeqTextEvent{
+			SeqID:           e.SeqID,
+			CID:             e.CID,
+			Text:            e.Text,
+			Hidden:          e.Hidden,
+			Tokens:          e.Tokens,
+			NumInputTokens:  e.NumInputTokens,
+			NumOutputTokens: e.NumOutputTokens,
+			Safety:          e.Safety,
+			Citations:       e.Citations,
+		}, nil
+
+	case "seq_tool_call":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		return &SeqToolCallEvent{SeqID: e.SeqID, CID: e.CID, ToolCalls: toToolCalls(e.ToolCalls)}, nil
+
+	case "seq_append_finish":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		return &SeqAppendFinishEvent{SeqID: e.SeqID, CID: e.CID, InputTokens: e.InputTokens}, nil
+
+	case "seq_gen_finish":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		return &SeqGenFinishEvent{
+			SeqID:        e.SeqID,
+			CID:          e.CID,
+			InputTokens:  e.InputTokens,
+			OutputTokens: e.OutputTokens,
+			Safety:       e.Safety,
+			Citations:    e.Citations,
+		}, nil
+
+	case "seq_fork_finish":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		if e.ChildSeqID == "" {
+			return nil, e.missing("child_seq_id")
+		}
+		return &SeqForkFinishEvent{SeqID: e.SeqID, CID: e.CID, ChildSeqID: e.ChildSeqID}, nil
+
+	case "seq_score_finish":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		return &SeqScoreFinishEvent{
+			SeqID:         e.SeqID,
+			CID:           e.CID,
+			LogProb:       e.LogProb,
+			TokenLogProbs: e.TokenLogProbs,
+		}, nil
+
+	case "seq_state":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		if e.State == "" {
+			return nil, e.missing("state")
+		}
+		return &SeqStateEvent{SeqID: e.SeqID, State: e.State}, nil
+
+	case "seq_closed":
+		if e.SeqID == "" {
+			return nil, e.missing("seq_id")
+		}
+		return &SeqClosedEvent{
+			SeqID:        e.SeqID,
+			CID:          e.CID,
+			InputTokens:  e.InputTokens,
+			OutputTokens: e.OutputTokens,
+			DurationMs:   e.DurationMs,
+			Error:        e.ErrorMsg,
+		}, nil
+
+	case "error":
+		return &ErrorEvent{SeqID: e.SeqID, CID: e.CID, Message: e.Message}, nil
+	}
+
+	return &UnknownEvent{Type: e.Event, SeqID: e.SeqID, CID: e.CID, Raw: e.Raw}, nil
+}
+
+// missing returns the error for an event without a required field.
+func (e *MSEvent) missing(field string) error {
+	return fmt.Errorf("%w: %s without %s", ErrUnexpectedEvent, e.Event, field)
+}
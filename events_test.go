@@ -0,0 +1,98 @@
+package modelsocket
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMSEvent_Decode(t *testing.T) {
+	tests := []struct {
+		event *MSEvent
+		want  Event
+	}{
+		{
+			&MSEvent{Event: "seq_opened", CID: "c1", SeqID: "seq-1"},
+			&SeqOpenedEvent{CID: "c1", SeqID: "seq-1"},
+		},
+		{
+			&MSEvent{Event: "seq_text", SeqID: "seq-1", CID: "c1", Text: "hi", Hidden: true, Tokens: []int{1}},
+			&SeqTextEvent{SeqID: "seq-1", CID: "c1", Text: "hi", Hidden: true, Tokens: []int{1}},
+		},
+		{
+			&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "x", Safety: []SafetyAnnotation{{Category: "violence"}}},
+			&SeqTextEvent{SeqID: "seq-1", Text: "x", Safety: []SafetyAnnotation{{Category: "violence"}}},
+		},
+		{
+			&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "y", Citations: []Citation{{SourceID: "doc-1", Start: 0, End: 1}}},
+			&SeqTextEvent{SeqID: "seq-1", Text: "y", Citations: []Citation{{SourceID: "doc-1", Start: 0, End: 1}}},
+		},
+		{
+			&MSEvent{Event: "seq_tool_call", SeqID: "seq-1", ToolCalls: []SeqToolCall{{Name: "f", Args: "{}"}}},
+			&SeqToolCallEvent{SeqID: "seq-1", ToolCalls: []ToolCall{{Name: "f", Args: "{}"}}},
+		},
+		{
+			&MSEvent{Event: "seq_append_finish", SeqID: "seq-1", CID: "c1", InputTokens: 7},
+			&SeqAppendFinishEvent{SeqID: "seq-1", CID: "c1", InputTokens: 7},
+		},
+		{
+			&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: "c1", InputTokens: 5, OutputTokens: 2},
+			&SeqGenFinishEvent{SeqID: "seq-1", CID: "c1", InputTokens: 5, OutputTokens: 2},
+		},
+		{
+			&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: "c1", Safety: []SafetyAnnotation{{Category: "self_harm", Score: 0.9}}},
+			&SeqGenFinishEvent{SeqID: "seq-1", CID: "c1", Safety: []SafetyAnnotation{{Category: "self_harm", Score: 0.9}}},
+		},
+		{
+			&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: "c1", Citations: []Citation{{SourceID: "doc-2", Start: 3, End: 9}}},
+			&SeqGenFinishEvent{SeqID: "seq-1", CID: "c1", Citations: []Citation{{SourceID: "doc-2", Start: 3, End: 9}}},
+		},
+		{
+			&MSEvent{Event: "seq_fork_finish", SeqID: "seq-1", CID: "c1", ChildSeqID: "seq-2"},
+			&SeqForkFinishEvent{SeqID: "seq-1", CID: "c1", ChildSeqID: "seq-2"},
+		},
+		{
+			&MSEvent{Event: "seq_state", SeqID: "seq-1", State: StateGenerating},
+			&SeqStateEvent{SeqID: "seq-1", State: StateGenerating},
+		},
+		{
+			&MSEvent{Event: "seq_closed", SeqID: "seq-1", DurationMs: 10, ErrorMsg: "boom"},
+			&SeqClosedEvent{SeqID: "seq-1", DurationMs: 10, Error: "boom"},
+		},
+		{
+			&MSEvent{Event: "error", CID: "c1", Message: "bad"},
+			&ErrorEvent{CID: "c1", Message: "bad"},
+		},
+		{
+			&MSEvent{Event: "seq_future", SeqID: "seq-1", Raw: []byte(`{"event":"seq_future"}`)},
+			&UnknownEvent{Type: "seq_future", SeqID: "seq-1", Raw: []byte(`{"event":"seq_future"}`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.event.Event, func(t *testing.T) {
+			got, err := tt.event.Decode()
+			if err != nil {
+				t.Fatalf("Decode error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+			if got.EventType() != tt.event.Event {
+				t.Errorf("EventType() = %q, want %q", got.EventType(), tt.event.Event)
+			}
+		})
+	}
+}
+
+func TestMSEvent_Decode_MissingField(t *testing.T) {
+	for _, event := range []*MSEvent{
+		{Event: "seq_text"},
+		{Event: "seq_fork_finish", SeqID: "seq-1"},
+		{Event: "seq_state", SeqID: "seq-1"},
+	} {
+		if _, err := event.Decode(); !errors.Is(err, ErrUnexpectedEvent) {
+			t.Errorf("%s: Decode error = %v, want ErrUnexpectedEvent", event.Event, err)
+		}
+	}
+}
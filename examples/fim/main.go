@@ -0,0 +1,110 @@
+// Example editor-style code completion using fill-in-the-middle generation.
+//
+// The source file is read from the first argument (or a built-in snippet is
+// used), and the completion is generated at the <CURSOR> marker.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+const cursor = "<CURSOR>"
+
+const snippet = `package main
+
+import "fmt"
+
+// fib returns the nth Fibonacci number.
+func fib(n int) int {
+	<CURSOR>
+}
+
+func main() {
+	fmt.Println(fib(10))
+}
+`
+
+func main() {
+	url := os.Getenv("MODELSOCKET_URL")
+	if url == "" {
+		url = "wss://models.mixlayer.ai/ws"
+	}
+
+	apiKey := os.Getenv("MODELSOCKET_API_KEY")
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "MODELSOCKET_API_KEY environment variable required")
+		os.Exit(1)
+	}
+
+	// Infilling needs a code model trained for it
+	model := os.Getenv("MODELSOCKET_MODEL")
+	if model == "" {
+		model = "qwen/qwen2.5-coder-7b"
+	}
+
+	source := snippet
+	if len(os.Args) > 1 {
+		b, err := os.ReadFile(os.Args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		source = string(b)
+	}
+
+	prefix, suffix, ok := strings.Cut(source, cursor)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "No %s marker in source\n", cursor)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	client, err := modelsocket.Connect(ctx, url, apiKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close(ctx)
+
+	// Completion works on raw text, so skip the chat prelude
+	seq, err := client.Open(ctx, model, modelsocket.WithSkipPrelude())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open sequence: %v\n", err)
+		os.Exit(1)
+	}
+	defer seq.Close(ctx)
+
+	// The sequence holds the text before the cursor; the suffix is what
+	// follows it
+	if err := seq.Append(ctx, prefix); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to append: %v\n", err)
+		os.Exit(1)
+	}
+
+	stream, err := seq.Generate(ctx,
+		modelsocket.WithSuffix(suffix),
+		modelsocket.WithMaxTokens(128),
+		modelsocket.WithTemperature(0.2),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate: %v\n", err)
+		os.Exit(1)
+	}
+
+	completion, err := stream.Text(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Generation failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Show the completion in place
+	fmt.Print(prefix)
+	fmt.Print("\033[32m" + completion + "\033[0m")
+	fmt.Print(suffix)
+}
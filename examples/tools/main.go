@@ -172,22 +172,16 @@ func main() {
 			})
 		}
 
-		// Return tool results to the model
+		// Return tool results to the model, which resumes generation
 		fmt.Println("\n--- Returning results to model ---")
-		err = seq.ToolReturn(ctx, results)
+		stream, err = seq.ToolReturn(ctx, results, modelsocket.GenerateAsAssistant())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to return tool results: %v\n", err)
 			os.Exit(1)
 		}
 
-		// Generate the final response
+		// Stream the final response
 		fmt.Print("\nAssistant (final): ")
-		stream, err = seq.Generate(ctx, modelsocket.GenerateAsAssistant())
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to generate: %v\n", err)
-			os.Exit(1)
-		}
-
 		text, err := stream.Text(ctx)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -0,0 +1,134 @@
+// Package experiments routes sequences between variants of a model or its
+// generation options for A/B tests. Assignment is deterministic: the same
+// key, such as a user or conversation ID, always gets the same arm, so a
+// user sees consistent behaviour across requests and processes.
+//
+//	exp := experiments.New("bigger-model",
+//	    experiments.Arm{Name: "control", Weight: 0.9},
+//	    experiments.Arm{Name: "70b", Weight: 0.1, Model: "meta/llama3.1-70b-instruct"},
+//	)
+//	seq, arm, err := exp.Open(ctx, client, userID, "meta/llama3.1-8b-instruct-free")
+//
+// Sequences are tagged with the arm, so [modelsocket.Usage] and
+// [modelsocket.GenStats] records can be grouped by arm to compare quality
+// and cost.
+package experiments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// TagPrefix prefixes the tag naming an experiment. Its value is the arm.
+const TagPrefix = "experiment."
+
+// Arm is one variant in an experiment.
+type Arm struct {
+	// Name identifies the arm in tags.
+	Name string
+
+	// Weight is the arm's share of traffic, relative to the other arms.
+	Weight float64
+
+	// Model replaces the model passed to Open. Empty keeps it.
+	Model string
+
+	// OpenOptions are applied after those passed to Open.
+	OpenOptions []modelsocket.OpenOption
+
+	// GenOptions are applied to every generation on the arm's sequences,
+	// before the options passed to Generate.
+	GenOptions []modelsocket.GenOption
+}
+
+// Experiment splits traffic between arms.
+type Experiment struct {
+	name  string
+	arms  []Arm
+	total float64
+}
+
+// New creates an experiment. Arms without a positive weight get no traffic.
+// The name is hashed with each key, so concurrent experiments assign keys
+// independently.
+func New(name string, arms ...Arm) *Experiment {
+	e := &Experiment{name: name, arms: arms}
+	for _, arm := range arms {
+		if arm.Weight > 0 {
+			e.total += arm.Weight
+		}
+	}
+	return e
+}
+
+// Name returns the experiment's name.
+func (e *Experiment) Name() string {
+	return e.name
+}
+
+// Tag returns the tag key sequences in the experiment are tagged with.
+func (e *Experiment) Tag() string {
+	return TagPrefix + e.name
+}
+
+// Assign returns the arm for key. It returns the zero Arm if no arm has a
+// positive weight.
+func (e *Experiment) Assign(key string) Arm {
+	if e.total <= 0 {
+		return Arm{}
+	}
+
+	point := bucket(e.name, key) * e.total
+	var last Arm
+	for _, arm := range e.arms {
+		if arm.Weight <= 0 {
+			continue
+		}
+		if point < arm.Weight {
+			return arm
+		}
+		point -= arm.Weight
+		last = arm
+	}
+	// Rounding left the point past the last arm
+	return last
+}
+
+// Open opens a sequence on the arm assigned to key. The arm's model, open
+// options and generation options are applied, and the sequence is tagged
+// with the arm's name.
+func (e *Experiment) Open(ctx context.Context, client *modelsocket.Client, key, model string, opts ...modelsocket.OpenOption) (*modelsocket.Seq, Arm, error) {
+	arm := e.Assign(key)
+	if arm.Model != "" {
+		model = arm.Model
+	}
+
+	openOpts := append([]modelsocket.OpenOption{}, opts...)
+	openOpts = append(openOpts, arm.OpenOptions...)
+	openOpts = append(openOpts,
+		modelsocket.WithGenDefaults(arm.GenOptions...),
+		modelsocket.WithSeqTag(e.Tag(), arm.Name),
+	)
+
+	seq, err := client.Open(ctx, model, openOpts...)
+	if err != nil {
+		return nil, arm, err
+	}
+	return seq, arm, nil
+}
+
+// ArmOf returns the arm of experiment recorded in tags, such as those of a
+// sequence, a [modelsocket.Usage] or a [modelsocket.GenStats].
+func ArmOf(tags map[string]string, experiment string) (string, bool) {
+	arm, ok := tags[TagPrefix+experiment]
+	return arm, ok
+}
+
+// bucket maps an experiment and key to a point in [0, 1).
+func bucket(name, key string) float64 {
+	sum := sha256.Sum256([]byte(name + "\x00" + key))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
@@ -0,0 +1,122 @@
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers every generation with "ok".
+func newServer() *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		return []*modelsocket.MSEvent{mstest.Text("ok"), mstest.Finish(5, 1)}
+	})
+}
+
+func TestExperiment_Assign(t *testing.T) {
+	exp := New("test",
+		Arm{Name: "control", Weight: 3},
+		Arm{Name: "off", Weight: 0},
+		Arm{Name: "treatment", Weight: 1},
+	)
+
+	counts := make(map[string]int)
+	for i := range 10000 {
+		key := fmt.Sprintf("user-%d", i)
+		arm := exp.Assign(key)
+		counts[arm.Name]++
+
+		if again := exp.Assign(key); again.Name != arm.Name {
+			t.Fatalf("Assign(%s) = %s then %s, want stable", key, arm.Name, again.Name)
+		}
+	}
+
+	if counts["off"] != 0 {
+		t.Errorf("arm without weight got %d keys", counts["off"])
+	}
+	if share := float64(counts["treatment"]) / 10000; math.Abs(share-0.25) > 0.02 {
+		t.Errorf("treatment share = %.3f, want about 0.25", share)
+	}
+}
+
+func TestExperiment_AssignIndependent(t *testing.T) {
+	a := New("a", Arm{Name: "x", Weight: 1}, Arm{Name: "y", Weight: 1})
+	b := New("b", Arm{Name: "x", Weight: 1}, Arm{Name: "y", Weight: 1})
+
+	same := 0
+	for i := range 1000 {
+		key := fmt.Sprint(i)
+		if a.Assign(key).Name == b.Assign(key).Name {
+			same++
+		}
+	}
+	// Independent experiments agree about half the time
+	if same < 400 || same > 600 {
+		t.Errorf("experiments agree on %d of 1000 keys, want about 500", same)
+	}
+}
+
+func TestExperiment_AssignNoArms(t *testing.T) {
+	if arm := New("empty").Assign("key"); arm.Name != "" {
+		t.Errorf("Assign = %+v, want zero Arm", arm)
+	}
+}
+
+func TestExperiment_Open(t *testing.T) {
+	transport := newServer()
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	// Every key goes to the treatment arm
+	exp := New("bigger",
+		Arm{Name: "control"},
+		Arm{
+			Name:       "70b",
+			Weight:     1,
+			Model:      "big-model",
+			GenOptions: []modelsocket.GenOption{modelsocket.WithTemperature(0.2), modelsocket.WithMaxTokens(50)},
+		},
+	)
+
+	seq, arm, err := exp.Open(ctx, client, "user-1", "small-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if arm.Name != "70b" {
+		t.Errorf("arm = %s, want 70b", arm.Name)
+	}
+	if got, _ := ArmOf(seq.Tags(), "bigger"); got != "70b" {
+		t.Errorf("sequence arm = %q, want 70b", got)
+	}
+
+	stream, err := seq.Generate(ctx, modelsocket.WithMaxTokens(10))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	usage := stream.Usage()
+	if got, _ := ArmOf(usage.Tags, "bigger"); got != "70b" || usage.Model != "big-model" {
+		t.Errorf("usage = %+v, want big-model tagged 70b", usage)
+	}
+
+	if models := transport.Models(); len(models) != 1 || models[0] != "big-model" {
+		t.Errorf("models = %v, want [big-model]", models)
+	}
+
+	// Arm options apply, and call options override them
+	gen := transport.Gens()[0]
+	if gen.Temperature == nil || *gen.Temperature != 0.2 {
+		t.Errorf("Temperature = %v, want arm's 0.2", gen.Temperature)
+	}
+	if gen.MaxTokens == nil || *gen.MaxTokens != 10 {
+		t.Errorf("MaxTokens = %v, want call's 10", gen.MaxTokens)
+	}
+}
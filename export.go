@@ -0,0 +1,243 @@
+package modelsocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExportFormat is a transcript format for [Seq.Export].
+type ExportFormat string
+
+// Transcript formats.
+const (
+	// ExportOpenAI is a JSON array of OpenAI chat completion messages.
+	// Tool calls get IDs of the form "call_1", matched to their results
+	// in order.
+	ExportOpenAI ExportFormat = "openai"
+
+	// ExportAnthropic is a JSON object with Anthropic Messages API
+	// "system" and "messages" fields. Consecutive messages from the same
+	// side are merged, as the API requires turns to alternate, and tool
+	// results are sent by the user.
+	ExportAnthropic ExportFormat = "anthropic"
+
+	// ExportMarkdown is a readable document with a heading per message.
+	ExportMarkdown ExportFormat = "markdown"
+
+	// ExportJSONL is one [Message] per line, as JSON. It keeps everything
+	// the history records, for dataset building.
+	ExportJSONL ExportFormat = "jsonl"
+)
+
+// Export returns the sequence's history in format. See [ExportMessages].
+func (s *Seq) Export(format ExportFormat) ([]byte, error) {
+	return ExportMessages(s.History(), format)
+}
+
+// ExportMessages returns history in format. Hidden messages aren't part of
+// the model's context and are left out, except from ExportJSONL.
+// Unknown formats fail with [ErrExportFormat].
+func ExportMessages(history []Message, format ExportFormat) ([]byte, error) {
+	switch format {
+	case ExportOpenAI:
+		return json.Marshal(openAIMessages(visible(history)))
+	case ExportAnthropic:
+		return json.Marshal(anthropicTranscript(visible(history)))
+	case ExportMarkdown:
+		return markdownTranscript(visible(history)), nil
+	case ExportJSONL:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, msg := range history {
+			if err := enc.Encode(msg); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrExportFormat, format)
+}
+
+func visible(history []Message) []Message {
+	out := make([]Message, 0, len(history))
+	for _, msg := range history {
+		if !msg.Hidden {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// callIDs numbers tool calls and matches results to them by tool name, in
+// order.
+type callIDs struct {
+	next    int
+	pending map[string][]string
+}
+
+func (c *callIDs) call(name string) string {
+	c.next++
+	id := fmt.Sprintf("call_%d", c.next)
+	if c.pending == nil {
+		c.pending = make(map[string][]string)
+	}
+	c.pending[name] = append(c.pending[name], id)
+	return id
+}
+
+// result returns the ID of the oldest unanswered call to name, or a new ID
+// for results without a recorded call.
+func (c *callIDs) result(name string) string {
+	if ids := c.pending[name]; len(ids) > 0 {
+		c.pending[name] = ids[1:]
+		return ids[0]
+	}
+	c.next++
+	return fmt.Sprintf("call_%d", c.next)
+}
+
+type openAIMessage struct {
+	Role       Role             `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func openAIMessages(history []Message) []openAIMessage {
+	var ids callIDs
+	out := make([]openAIMessage, 0, len(history))
+	for _, msg := range history {
+		if msg.Role == RoleTool && len(msg.ToolResults) > 0 {
+			for _, result := range msg.ToolResults {
+				out = append(out, openAIMessage{Role: RoleTool, Content: &result.Result, ToolCallID: ids.result(result.Name)})
+			}
+			continue
+		}
+
+		m := openAIMessage{Role: exportRole(msg.Role)}
+		if msg.Text != "" || len(msg.ToolCalls) == 0 {
+			m.Content = &msg.Text
+		}
+		for _, call := range msg.ToolCalls {
+			tc := openAIToolCall{ID: ids.call(call.Name), Type: "function"}
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = call.Args
+			m.ToolCalls = append(m.ToolCalls, tc)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+type anthropicExport struct {
+	System   string             `json:"system,omitempty"`
+	Messages []anthropicMessage `json:"messages"`
+}
+
+type anthropicMessage struct {
+	Role    Role             `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+func anthropicTranscript(history []Message) anthropicExport {
+	var ids callIDs
+	var system []string
+	out := anthropicExport{Messages: []anthropicMessage{}}
+	for _, msg := range history {
+		role := RoleUser
+		var blocks []anthropicBlock
+		switch {
+		case msg.Role == RoleSystem:
+			system = append(system, msg.Text)
+			continue
+		case msg.Role == RoleTool && len(msg.ToolResults) > 0:
+			for _, result := range msg.ToolResults {
+				blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: ids.result(result.Name), Content: result.Result})
+			}
+		default:
+			if msg.Role == RoleAssistant {
+				role = RoleAssistant
+			}
+			if msg.Text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Text})
+			}
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: ids.call(call.Name), Name: call.Name, Input: toolInput(call.Args)})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+		} else {
+			out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: blocks})
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+	return out
+}
+
+// toolInput returns a call's arguments as a JSON object, wrapping
+// arguments that aren't one.
+func toolInput(args string) json.RawMessage {
+	trimmed := strings.TrimSpace(args)
+	if trimmed == "" {
+		return json.RawMessage("{}")
+	}
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"arguments": args})
+	return wrapped
+}
+
+func markdownTranscript(history []Message) []byte {
+	sections := make([]string, 0, len(history))
+	for _, msg := range history {
+		role := string(exportRole(msg.Role))
+		parts := []string{"## " + strings.ToUpper(role[:1]) + role[1:]}
+
+		if msg.Text != "" && len(msg.ToolResults) == 0 {
+			parts = append(parts, strings.TrimRight(msg.Text, "\n"))
+		}
+		for _, call := range msg.ToolCalls {
+			parts = append(parts, fmt.Sprintf("Tool call `%s`:\n\n```json\n%s\n```", call.Name, call.Args))
+		}
+		for _, result := range msg.ToolResults {
+			parts = append(parts, fmt.Sprintf("Tool result `%s`:\n\n```\n%s\n```", result.Name, result.Result))
+		}
+		sections = append(sections, strings.Join(parts, "\n\n")+"\n")
+	}
+	return []byte(strings.Join(sections, "\n"))
+}
+
+// exportRole returns the role messages without one are exported with.
+func exportRole(role Role) Role {
+	if role == "" {
+		return RoleUser
+	}
+	return role
+}
@@ -0,0 +1,102 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var exportHistory = []Message{
+	{Role: RoleSystem, Text: "Be brief."},
+	{Role: RoleUser, Text: "Weather in Paris?"},
+	{Role: RoleSystem, Text: "scratch", Hidden: true},
+	{Role: RoleAssistant, Text: "Checking.", ToolCalls: []ToolCall{{Name: "get_weather", Args: `{"city":"Paris"}`}}},
+	{Role: RoleTool, Text: "sunny", ToolResults: []ToolResult{{Name: "get_weather", Result: "sunny"}}},
+	{Role: RoleAssistant, Text: "Sunny."},
+}
+
+func TestExportMessages_OpenAI(t *testing.T) {
+	got, err := ExportMessages(exportHistory, ExportOpenAI)
+	if err != nil {
+		t.Fatalf("ExportMessages error: %v", err)
+	}
+	want := `[{"role":"system","content":"Be brief."},` +
+		`{"role":"user","content":"Weather in Paris?"},` +
+		`{"role":"assistant","content":"Checking.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},` +
+		`{"role":"tool","content":"sunny","tool_call_id":"call_1"},` +
+		`{"role":"assistant","content":"Sunny."}]`
+	if string(got) != want {
+		t.Errorf("export =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportMessages_Anthropic(t *testing.T) {
+	got, err := ExportMessages(exportHistory, ExportAnthropic)
+	if err != nil {
+		t.Fatalf("ExportMessages error: %v", err)
+	}
+	want := `{"system":"Be brief.","messages":[` +
+		`{"role":"user","content":[{"type":"text","text":"Weather in Paris?"}]},` +
+		`{"role":"assistant","content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"call_1","content":"sunny"}]},` +
+		`{"role":"assistant","content":[{"type":"text","text":"Sunny."}]}]}`
+	if string(got) != want {
+		t.Errorf("export =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportMessages_Markdown(t *testing.T) {
+	got, err := ExportMessages(exportHistory, ExportMarkdown)
+	if err != nil {
+		t.Fatalf("ExportMessages error: %v", err)
+	}
+	want := "## System\n\nBe brief.\n\n" +
+		"## User\n\nWeather in Paris?\n\n" +
+		"## Assistant\n\nChecking.\n\nTool call `get_weather`:\n\n```json\n{\"city\":\"Paris\"}\n```\n\n" +
+		"## Tool\n\nTool result `get_weather`:\n\n```\nsunny\n```\n\n" +
+		"## Assistant\n\nSunny.\n"
+	if string(got) != want {
+		t.Errorf("export =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportMessages_JSONL(t *testing.T) {
+	got, err := ExportMessages(exportHistory, ExportJSONL)
+	if err != nil {
+		t.Fatalf("ExportMessages error: %v", err)
+	}
+
+	// Every message is kept, hidden ones included
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	if len(lines) != len(exportHistory) {
+		t.Fatalf("%d lines, want %d", len(lines), len(exportHistory))
+	}
+	var msg Message
+	if err := json.Unmarshal([]byte(lines[3]), &msg); err != nil || msg.ToolCalls[0].Name != "get_weather" {
+		t.Errorf("line 4 = %s, %v, want the tool call message", lines[3], err)
+	}
+}
+
+func TestSeq_Export(t *testing.T) {
+	ctx := context.Background()
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectAppend().Finish()
+	seq, err := sc.Client().Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Append(ctx, "Hi", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+
+	if got, err := seq.Export(ExportMarkdown); err != nil || string(got) != "## User\n\nHi\n" {
+		t.Errorf("Export = %q, %v", got, err)
+	}
+	if _, err := seq.Export("yaml"); !errors.Is(err, ErrExportFormat) {
+		t.Errorf("Export error = %v, want ErrExportFormat", err)
+	}
+}
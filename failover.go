@@ -0,0 +1,282 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Endpoint is a ModelSocket server and the credentials to use with it.
+type Endpoint struct {
+	URL    string
+	APIKey string
+}
+
+// EndpointHealth describes an endpoint's recent behaviour.
+type EndpointHealth struct {
+	Endpoint Endpoint
+
+	// Healthy is false while the endpoint is cooling down after a failure.
+	Healthy bool
+
+	// Connected reports whether there is an open connection to it.
+	Connected bool
+
+	// Failures counts consecutive failed connections or opens.
+	Failures int
+
+	// LastErr is the most recent failure, if any.
+	LastErr error
+}
+
+// FailoverOption configures a [Failover].
+type FailoverOption func(*failoverConfig)
+
+type failoverConfig struct {
+	clientOpts []ClientOption
+	cooldown   time.Duration
+}
+
+// WithFailoverClientOptions sets the options used to connect to each
+// endpoint.
+func WithFailoverClientOptions(opts ...ClientOption) FailoverOption {
+	return func(c *failoverConfig) {
+		c.clientOpts = opts
+	}
+}
+
+// WithFailoverCooldown sets how long an endpoint is avoided after it fails.
+// The default is 30 seconds. Endpoints that are cooling down are still tried
+// once every other endpoint has failed.
+func WithFailoverCooldown(d time.Duration) FailoverOption {
+	return func(c *failoverConfig) {
+		c.cooldown = d
+	}
+}
+
+// endpointState tracks the connection to, and health of, one endpoint.
+type endpointState struct {
+	endpoint  Endpoint
+	client    *Client
+	failures  int
+	lastErr   error
+	downUntil time.Time
+}
+
+// Failover opens sequences on one of several ModelSocket endpoints, moving
+// to the next when an endpoint can't be reached or reports it is out of
+// capacity. Endpoints are preferred in the order given.
+//
+// A sequence stays on the endpoint it was opened on; use [Failover.Endpoint]
+// to find it. Failover is safe for concurrent use.
+type Failover struct {
+	ctx    context.Context
+	cfg    failoverConfig
+	logger *slog.Logger
+	dial   func(ctx context.Context, e Endpoint, opts *DialOptions) (Transport, error)
+
+	mu        sync.Mutex
+	endpoints []*endpointState
+}
+
+// NewFailover creates a Failover over endpoints. Connections are made lazily,
+// within the context of the call that needs them, and live until ctx is done
+// or [Failover.Close] is called.
+func NewFailover(ctx context.Context, endpoints []Endpoint, opts ...FailoverOption) *Failover {
+	cfg := failoverConfig{cooldown: 30 * time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	f := &Failover{ctx: ctx, cfg: cfg, logger: newClientConfig(cfg.clientOpts).logger}
+	f.dial = func(ctx context.Context, e Endpoint, opts *DialOptions) (Transport, error) {
+		return Dial(ctx, e.URL, e.APIKey, opts)
+	}
+	for _, e := range endpoints {
+		f.endpoints = append(f.endpoints, &endpointState{endpoint: e})
+	}
+	return f
+}
+
+// Open creates a sequence on the first endpoint that can serve it. Failures
+// to connect and model unavailable errors (see [IsModelUnavailable]) move on
+// to the next endpoint; other errors are returned immediately.
+func (f *Failover) Open(ctx context.Context, model string, opts ...OpenOption) (*Seq, error) {
+	var errs []error
+	for _, state := range f.candidates() {
+		client, err := f.client(ctx, state)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", state.endpoint.URL, err))
+			continue
+		}
+
+		seq, err := client.Open(ctx, model, opts...)
+		if err == nil {
+			f.markSuccess(state)
+			return seq, nil
+		}
+		if !IsModelUnavailable(err) && !errors.Is(err, ErrClosed) {
+			return nil, err
+		}
+
+		f.markFailure(state, err)
+		errs = append(errs, fmt.Errorf("%s: %w", state.endpoint.URL, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("modelsocket: no endpoints configured")
+	}
+	return nil, fmt.Errorf("modelsocket: all endpoints failed: %w", errors.Join(errs...))
+}
+
+// Client returns a connected client for the first healthy endpoint. It has
+// the signature of [RetryPolicy.Reconnect], so generations can be retried
+// on another endpoint.
+func (f *Failover) Client(ctx context.Context) (*Client, error) {
+	var errs []error
+	for _, state := range f.candidates() {
+		client, err := f.client(ctx, state)
+		if err == nil {
+			return client, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", state.endpoint.URL, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("modelsocket: no endpoints configured")
+	}
+	return nil, fmt.Errorf("modelsocket: all endpoints failed: %w", errors.Join(errs...))
+}
+
+// Endpoint returns the endpoint seq was opened on.
+func (f *Failover) Endpoint(seq *Seq) (Endpoint, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, state := range f.endpoints {
+		if state.client != nil && state.client == seq.client {
+			return state.endpoint, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+// Health returns the state of each endpoint, in preference order.
+func (f *Failover) Health() []EndpointHealth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	health := make([]EndpointHealth, len(f.endpoints))
+	for i, state := range f.endpoints {
+		health[i] = EndpointHealth{
+			Endpoint:  state.endpoint,
+			Healthy:   !now.Before(state.downUntil),
+			Connected: state.client != nil && state.client.Healthy(),
+			Failures:  state.failures,
+			LastErr:   state.lastErr,
+		}
+	}
+	return health
+}
+
+// Close closes every connection.
+func (f *Failover) Close(ctx context.Context) error {
+	f.mu.Lock()
+	var clients []*Client
+	for _, state := range f.endpoints {
+		if state.client != nil {
+			clients = append(clients, state.client)
+			state.client = nil
+		}
+	}
+	f.mu.Unlock()
+
+	var errs []error
+	for _, client := range clients {
+		if err := client.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// candidates returns endpoints in the order they should be tried: healthy
+// endpoints in preference order, then those cooling down.
+func (f *Failover) candidates() []*endpointState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	var healthy, down []*endpointState
+	for _, state := range f.endpoints {
+		if now.Before(state.downUntil) {
+			down = append(down, state)
+		} else {
+			healthy = append(healthy, state)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// client returns the endpoint's connection, connecting within ctx if there
+// is none or the previous one was lost. The connection outlives ctx.
+func (f *Failover) client(ctx context.Context, state *endpointState) (*Client, error) {
+	f.mu.Lock()
+	client := state.client
+	f.mu.Unlock()
+	if client != nil && client.Healthy() {
+		return client, nil
+	}
+
+	cfg := newClientConfig(f.cfg.clientOpts)
+	transport, err := f.dial(ctx, state.endpoint, cfg.dialOptions())
+	if err != nil {
+		// The caller giving up says nothing about the endpoint
+		if ctx.Err() == nil {
+			f.markFailure(state, err)
+		}
+		return nil, err
+	}
+	client = newClient(f.ctx, transport, cfg)
+
+	f.mu.Lock()
+	if state.client != nil && state.client.Healthy() {
+		// Another caller connected first
+		existing := state.client
+		f.mu.Unlock()
+		client.Close(f.ctx)
+		return existing, nil
+	}
+	state.client = client
+	f.mu.Unlock()
+	return client, nil
+}
+
+// markFailure records a failure and starts the endpoint's cooldown.
+func (f *Failover) markFailure(state *endpointState, err error) {
+	f.mu.Lock()
+	state.failures++
+	state.lastErr = err
+	state.downUntil = time.Now().Add(f.cfg.cooldown)
+	f.mu.Unlock()
+
+	if f.logger != nil {
+		f.logger.LogAttrs(context.Background(), slog.LevelWarn, "endpoint failed",
+			slog.String(logKeyEndpoint, state.endpoint.URL),
+			slog.Any(logKeyError, err),
+		)
+	}
+}
+
+// markSuccess clears an endpoint's failures.
+func (f *Failover) markSuccess(state *endpointState) {
+	f.mu.Lock()
+	state.failures = 0
+	state.lastErr = nil
+	state.downUntil = time.Time{}
+	f.mu.Unlock()
+}
@@ -0,0 +1,155 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestFailover returns a Failover whose endpoints connect to the given
+// mock transports, keyed by URL. A nil transport fails to connect.
+func newTestFailover(ctx context.Context, transports map[string]*mockTransport, urls ...string) *Failover {
+	var endpoints []Endpoint
+	for _, url := range urls {
+		endpoints = append(endpoints, Endpoint{URL: url})
+	}
+
+	f := NewFailover(ctx, endpoints)
+	f.dial = func(ctx context.Context, e Endpoint, _ *DialOptions) (Transport, error) {
+		transport := transports[e.URL]
+		if transport == nil {
+			return nil, &ConnectionError{Op: "dial", URL: e.URL, Err: errors.New("refused")}
+		}
+		return transport, nil
+	}
+	return f
+}
+
+func TestFailover_Open(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newMockTransport()
+	backup := newMockTransport()
+	f := newTestFailover(ctx, map[string]*mockTransport{"a": primary, "b": backup}, "a", "b")
+	defer f.Close(ctx)
+
+	respondOpens(t, primary, &MSEvent{Event: "error", Message: "server at capacity"})
+	respondOpens(t, backup, &MSEvent{Event: "seq_opened", SeqID: "seq-123"})
+
+	seq, err := f.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if e, ok := f.Endpoint(seq); !ok || e.URL != "b" {
+		t.Errorf("Endpoint = %v, %v, want b", e, ok)
+	}
+
+	health := f.Health()
+	if health[0].Healthy || health[0].Failures != 1 {
+		t.Errorf("primary health = %+v, want unhealthy with 1 failure", health[0])
+	}
+	if !health[1].Healthy || !health[1].Connected {
+		t.Errorf("backup health = %+v, want healthy and connected", health[1])
+	}
+
+	// The primary is cooling down, so the backup is tried first
+	respondOpens(t, backup, &MSEvent{Event: "seq_opened", SeqID: "seq-456"})
+	seq, err = f.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if seq.ID() != "seq-456" {
+		t.Errorf("ID = %s, want seq-456", seq.ID())
+	}
+}
+
+func TestFailover_Open_ConnectError(t *testing.T) {
+	ctx := context.Background()
+
+	backup := newMockTransport()
+	f := newTestFailover(ctx, map[string]*mockTransport{"b": backup}, "a", "b")
+	defer f.Close(ctx)
+
+	respondOpens(t, backup, &MSEvent{Event: "seq_opened", SeqID: "seq-123"})
+
+	seq, err := f.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if e, _ := f.Endpoint(seq); e.URL != "b" {
+		t.Errorf("Endpoint = %s, want b", e.URL)
+	}
+
+	var connErr *ConnectionError
+	if health := f.Health(); !errors.As(health[0].LastErr, &connErr) {
+		t.Errorf("primary LastErr = %v, want a ConnectionError", health[0].LastErr)
+	}
+}
+
+func TestFailover_Open_OtherError(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newMockTransport()
+	backup := newMockTransport()
+	f := newTestFailover(ctx, map[string]*mockTransport{"a": primary, "b": backup}, "a", "b")
+	defer f.Close(ctx)
+
+	respondOpens(t, primary, &MSEvent{Event: "error", Message: "invalid request"})
+
+	_, err := f.Open(ctx, "test-model")
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) {
+		t.Fatalf("err = %v, want ProtocolError", err)
+	}
+
+	select {
+	case <-backup.onSend:
+		t.Error("backup was tried after a non-failover error")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFailover_Client_Reconnects(t *testing.T) {
+	ctx := context.Background()
+
+	first := newMockTransport()
+	transports := map[string]*mockTransport{"a": first}
+	f := newTestFailover(ctx, transports, "a")
+	defer f.Close(ctx)
+
+	client, err := f.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client error: %v", err)
+	}
+
+	// Losing the connection makes the next call dial again
+	transports["a"] = newMockTransport()
+	first.Close()
+	<-client.Done()
+
+	next, err := f.Client(ctx)
+	if err != nil {
+		t.Fatalf("Client error: %v", err)
+	}
+	if next == client {
+		t.Error("Client returned the lost connection")
+	}
+}
+
+func TestFailover_Open_DialsWithCallerContext(t *testing.T) {
+	f := NewFailover(context.Background(), []Endpoint{{URL: "ws://slow"}})
+	f.dial = func(ctx context.Context, e Endpoint, _ *DialOptions) (Transport, error) {
+		<-ctx.Done()
+		return nil, &ConnectionError{Op: "dial", URL: e.URL, Err: ctx.Err()}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := f.Open(ctx, "test-model"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Open error = %v, want the caller's deadline", err)
+	}
+	if health := f.Health(); !health[0].Healthy || health[0].Failures != 0 {
+		t.Errorf("Health = %+v, want the endpoint not blamed for the caller giving up", health[0])
+	}
+}
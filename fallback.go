@@ -0,0 +1,67 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// unavailableMarkers are fragments of server error messages that mean a
+// model can't take the request right now, or isn't served at all.
+var unavailableMarkers = []string{
+	"unavailable",
+	"capacity",
+	"overloaded",
+	"busy",
+	"not found",
+	"unknown model",
+	"no such model",
+}
+
+// IsModelUnavailable reports whether err is a server error saying the
+// requested model is unknown, unavailable or out of capacity. The server
+// doesn't send error codes, so this matches on the error message.
+func IsModelUnavailable(err error) bool {
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) {
+		return false
+	}
+	msg := strings.ToLower(protoErr.Message)
+	for _, marker := range unavailableMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenWithFallback opens a sequence with the first of models that is
+// available. Models are tried in order; the next one is only tried when the
+// server reports the previous one unavailable (see [IsModelUnavailable]), and
+// any other error is returned immediately. [Seq.Model] reports which model
+// was used.
+func (c *Client) OpenWithFallback(ctx context.Context, models []string, opts ...OpenOption) (*Seq, error) {
+	if len(models) == 0 {
+		return nil, errors.New("modelsocket: no models to open")
+	}
+
+	var errs []error
+	for _, model := range models {
+		seq, err := c.Open(ctx, model, opts...)
+		if err == nil {
+			return seq, nil
+		}
+		if !IsModelUnavailable(err) {
+			return nil, err
+		}
+
+		c.log(slog.LevelWarn, "", "model unavailable",
+			slog.String(logKeyModel, model),
+			slog.Any(logKeyError, err),
+		)
+		errs = append(errs, fmt.Errorf("%s: %w", model, err))
+	}
+	return nil, fmt.Errorf("modelsocket: no model available: %w", errors.Join(errs...))
+}
@@ -0,0 +1,89 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// respondOpens answers seq_open requests in order with the given events,
+// filling in the request's CID.
+func respondOpens(t *testing.T, transport *mockTransport, events ...*MSEvent) <-chan string {
+	t.Helper()
+
+	models := make(chan string, len(events))
+	go func() {
+		for _, event := range events {
+			req := transport.waitForRequest(t, time.Second)
+			models <- req.Data.(SeqOpenData).Model
+			event.CID = req.CID
+			transport.pushEvent(event)
+		}
+		close(models)
+	}()
+	return models
+}
+
+func TestClient_OpenWithFallback(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	models := respondOpens(t, transport,
+		&MSEvent{Event: "error", Message: "model primary is at capacity"},
+		&MSEvent{Event: "seq_opened", SeqID: "seq-123"},
+	)
+
+	seq, err := client.OpenWithFallback(ctx, []string{"primary", "backup"})
+	if err != nil {
+		t.Fatalf("OpenWithFallback error: %v", err)
+	}
+	if seq.Model() != "backup" {
+		t.Errorf("Model() = %s, want backup", seq.Model())
+	}
+
+	var tried []string
+	for m := range models {
+		tried = append(tried, m)
+	}
+	if len(tried) != 2 || tried[0] != "primary" || tried[1] != "backup" {
+		t.Errorf("tried = %v, want [primary backup]", tried)
+	}
+}
+
+func TestClient_OpenWithFallback_OtherError(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	respondOpens(t, transport, &MSEvent{Event: "error", Message: "invalid api key"})
+
+	_, err := client.OpenWithFallback(ctx, []string{"primary", "backup"})
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.Message != "invalid api key" {
+		t.Errorf("err = %v, want the primary's error", err)
+	}
+}
+
+func TestClient_OpenWithFallback_AllUnavailable(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	respondOpens(t, transport,
+		&MSEvent{Event: "error", Message: "model overloaded"},
+		&MSEvent{Event: "error", Message: "model not found"},
+	)
+
+	_, err := client.OpenWithFallback(ctx, []string{"primary", "backup"})
+	if !IsModelUnavailable(err) {
+		t.Errorf("err = %v, want a model unavailable error", err)
+	}
+}
@@ -0,0 +1,217 @@
+package modelsocket
+
+// genState is where a generation stream is in its exchange with the server.
+type genState int
+
+const (
+	// genStreaming streams are waiting for the server's output.
+	genStreaming genState = iota
+
+	// genAwaitingTools streams have had tool calls, and the server waits
+	// for ToolReturn before continuing.
+	genAwaitingTools
+)
+
+// How the server continues a generation after a tool return, as last seen
+// by the client. See genStreams.handOver.
+const (
+	resumeUnknown int32 = iota
+	resumeNewCID
+	resumeOriginalCID
+)
+
+// noteResume records which CID the server continued a generation under,
+// from an event for stream carrying cid.
+func (c *Client) noteResume(stream *GenStream, cid string) {
+	if stream.resumes == "" || cid == "" {
+		return
+	}
+	mode := resumeNewCID
+	if cid != stream.cid {
+		mode = resumeOriginalCID
+	}
+	c.resumeCID.Store(mode)
+}
+
+// wireCID returns the CID the server knows the stream's generation by:
+// continuations after a tool return keep the original generation's CID on
+// servers seen to use it.
+func (g *GenStream) wireCID(seq *Seq) string {
+	if g.resumes != "" && seq.client.resumeCID.Load() == resumeOriginalCID {
+		return g.resumes
+	}
+	return g.cid
+}
+
+// genEntry is a stream in a genStreams table.
+type genEntry struct {
+	stream *GenStream
+	state  genState
+
+	// Other CIDs the server may use for the stream; see handOver
+	aliases []string
+
+	// Cancel commands sent for the stream and not yet answered; see
+	// cancelRejected
+	cancels int
+}
+
+// genStreams tracks a sequence's generation and echoed append streams by
+// CID, in the order their requests were sent. Events that carry a CID go to
+// its stream. The server handles a sequence's commands in order, so events
+// without one, such as text, go to the oldest stream still streaming: a
+// chunk arriving late for a stream that was cancelled or superseded isn't
+// delivered to the one after it. A stream leaves the table when the server
+// finishes it, fails it or resumes it with a tool return, even if it was
+// cancelled here first. Guarded by Seq.mu.
+type genStreams struct {
+	byCID map[string]*genEntry
+	order []string
+}
+
+// add registers a stream whose request is about to be sent.
+func (t *genStreams) add(stream *GenStream) {
+	if t.byCID == nil {
+		t.byCID = make(map[string]*genEntry)
+	}
+	t.byCID[stream.cid] = &genEntry{stream: stream, state: genStreaming}
+	t.order = append(t.order, stream.cid)
+}
+
+// remove takes the stream for cid, or for which cid is an alias, out of the
+// table, returning nil if there is none.
+func (t *genStreams) remove(cid string) *GenStream {
+	entry := t.take(cid)
+	if entry == nil {
+		return nil
+	}
+	return entry.stream
+}
+
+// take removes and returns the entry for cid, or nil.
+func (t *genStreams) take(cid string) *genEntry {
+	entry, ok := t.byCID[cid]
+	if !ok {
+		return nil
+	}
+	primary := entry.stream.cid
+	delete(t.byCID, primary)
+	for _, alias := range entry.aliases {
+		delete(t.byCID, alias)
+	}
+	for i, queued := range t.order {
+		if queued == primary {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	return entry
+}
+
+// restore puts back an entry removed with take or handOver, as the latest.
+func (t *genStreams) restore(entry *genEntry) {
+	if t.byCID == nil {
+		t.byCID = make(map[string]*genEntry)
+	}
+	t.byCID[entry.stream.cid] = entry
+	for _, alias := range entry.aliases {
+		t.byCID[alias] = entry
+	}
+	t.order = append(t.order, entry.stream.cid)
+}
+
+// handOver takes the stream for from out of the table and makes its CIDs
+// aliases of the stream for to, returning from's entry. After a tool return,
+// depending on their version, servers continue the generation under the tool
+// return's CID or under the original generation's, so the continuation
+// answers to both.
+func (t *genStreams) handOver(from, to string) *genEntry {
+	entry := t.take(from)
+	target, ok := t.byCID[to]
+	if entry == nil || !ok {
+		return entry
+	}
+	for _, alias := range append([]string{entry.stream.cid}, entry.aliases...) {
+		target.aliases = append(target.aliases, alias)
+		t.byCID[alias] = target
+	}
+	return entry
+}
+
+// cancelSent notes a cancel command sent for the stream for cid.
+func (t *genStreams) cancelSent(cid string) {
+	if entry, ok := t.byCID[cid]; ok {
+		entry.cancels++
+	}
+}
+
+// cancelRejected reports whether an error event for cid is a server's
+// rejection of a cancel command rather than the generation failing. Cancels
+// are sent under the generation's CID, and servers without cancellation
+// answer with an error while the generation carries on, so the stream stays
+// in the table to take its remaining events until the server finishes it.
+func (t *genStreams) cancelRejected(cid string) bool {
+	entry, ok := t.byCID[cid]
+	if !ok || entry.cancels == 0 {
+		return false
+	}
+	entry.cancels--
+	return true
+}
+
+// get returns the stream for cid, or for which cid is an alias, or nil.
+func (t *genStreams) get(cid string) *GenStream {
+	if entry, ok := t.byCID[cid]; ok {
+		return entry.stream
+	}
+	return nil
+}
+
+// route returns the stream an event belongs to: the one for its CID if it
+// has one, else the oldest stream still streaming. If every stream has had
+// tool calls, further tool calls go to the latest.
+func (t *genStreams) route(event *MSEvent) *genEntry {
+	if entry, ok := t.byCID[event.CID]; ok {
+		return entry
+	}
+	for _, cid := range t.order {
+		if entry := t.byCID[cid]; entry.state == genStreaming {
+			return entry
+		}
+	}
+	if event.IsSeqToolCall() && len(t.order) > 0 {
+		return t.byCID[t.order[len(t.order)-1]]
+	}
+	return nil
+}
+
+// resumable returns the stream a tool return resumes: the latest that had
+// tool calls, else the latest stream. awaiting reports whether it had tool
+// calls.
+func (t *genStreams) resumable() (stream *GenStream, awaiting bool) {
+	for i := len(t.order) - 1; i >= 0; i-- {
+		if entry := t.byCID[t.order[i]]; entry.state == genAwaitingTools {
+			return entry.stream, true
+		}
+	}
+	if len(t.order) > 0 {
+		return t.byCID[t.order[len(t.order)-1]].stream, false
+	}
+	return nil, false
+}
+
+// busy reports whether any stream is in the table.
+func (t *genStreams) busy() bool {
+	return len(t.order) > 0
+}
+
+// drain empties the table, returning its streams in order.
+func (t *genStreams) drain() []*GenStream {
+	streams := make([]*GenStream, 0, len(t.order))
+	for _, cid := range t.order {
+		streams = append(streams, t.byCID[cid].stream)
+	}
+	t.byCID = nil
+	t.order = nil
+	return streams
+}
@@ -0,0 +1,263 @@
+package modelsocket
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenStreams_Route(t *testing.T) {
+	var gens genStreams
+	a := newGenStream(nil, "a")
+	b := newGenStream(nil, "b")
+	gens.add(a)
+	gens.add(b)
+
+	if got := gens.route(&MSEvent{Event: "seq_text"}); got.stream != a {
+		t.Errorf("text without CID routed to %s, want a", got.stream.cid)
+	}
+	if got := gens.route(&MSEvent{Event: "seq_text", CID: "b"}); got.stream != b {
+		t.Errorf("text for b routed to %s", got.stream.cid)
+	}
+
+	// a waits for tool results; text after its tool call belongs to b
+	gens.route(&MSEvent{Event: "seq_tool_call"}).state = genAwaitingTools
+	if got := gens.route(&MSEvent{Event: "seq_text"}); got.stream != b {
+		t.Errorf("text after tool call routed to %s, want b", got.stream.cid)
+	}
+	if got, awaiting := gens.resumable(); got != a || !awaiting {
+		t.Errorf("resumable = %s, want a", got.cid)
+	}
+
+	if gens.remove("a") != a || gens.remove("a") != nil {
+		t.Error("remove should return a once")
+	}
+	if streams := gens.drain(); len(streams) != 1 || streams[0] != b || gens.busy() {
+		t.Errorf("drain = %v, want [b] and an empty table", streams)
+	}
+}
+
+func TestSeq_Generate_LateChunks(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	// The first generation is abandoned, but the server still finishes it
+	// before starting the second
+	first, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	firstReq := transport.waitForRequest(t, time.Second)
+
+	second, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	secondReq := transport.waitForRequest(t, time.Second)
+
+	transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "late"})
+	transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: firstReq.CID})
+	transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "fresh"})
+	transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: secondReq.CID})
+
+	if text, err := second.Text(ctx); err != nil || text != "fresh" {
+		t.Errorf("second Text = %q, %v, want fresh", text, err)
+	}
+	if text, err := first.Text(ctx); err != nil || text != "late" {
+		t.Errorf("first Text = %q, %v, want late", text, err)
+	}
+}
+
+func TestSeq_ToolReturn_FinishedMeanwhile(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	req := transport.waitForRequest(t, time.Second)
+	transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "Hi"})
+	transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: req.CID})
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	// The finished generation isn't recorded a second time
+	if _, err := seq.ToolReturn(ctx, []ToolResult{{Name: "f", Result: "r"}}); err != nil {
+		t.Fatalf("ToolReturn error: %v", err)
+	}
+	var generated int
+	for _, msg := range seq.History() {
+		if msg.Text == "Hi" {
+			generated++
+		}
+	}
+	if generated != 1 {
+		t.Errorf("generation recorded %d times, want 1", generated)
+	}
+}
+
+func TestSeq_ToolReturn_MultiRound(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		original bool // The server continues under the gen request's CID
+		want     int32
+	}{
+		{"new CID", false, resumeNewCID},
+		{"original CID", true, resumeOriginalCID},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			sc := newScenario(t)
+			sc.ExpectOpen().Opened("seq-1")
+			gen := sc.ExpectGenerate().StreamText("a").ThenToolCall("f", "{}")
+			first := sc.ExpectToolReturn().StreamText("b").ThenToolCall("f", "{}")
+			second := sc.ExpectToolReturn().StreamText("c").Finish()
+			if tc.original {
+				first.UnderCIDOf(gen)
+				second.UnderCIDOf(gen)
+			}
+			client := sc.Client()
+
+			seq, err := client.Open(ctx, "test-model")
+			if err != nil {
+				t.Fatalf("Open error: %v", err)
+			}
+			stream, err := seq.Generate(ctx)
+			if err != nil {
+				t.Fatalf("Generate error: %v", err)
+			}
+
+			var texts []string
+			for round := 0; ; round++ {
+				var text string
+				var calls bool
+				for chunk, err := range stream.Chunks(ctx) {
+					if err != nil {
+						t.Fatalf("round %d: Chunks error: %v", round, err)
+					}
+					text += chunk.Text
+					if len(chunk.ToolCalls) > 0 {
+						calls = true
+						break
+					}
+				}
+				texts = append(texts, text)
+				if !calls {
+					break
+				}
+				if stream, err = seq.ToolReturn(ctx, []ToolResult{{Name: "f", Result: "ok"}}); err != nil {
+					t.Fatalf("round %d: ToolReturn error: %v", round, err)
+				}
+			}
+
+			if got := strings.Join(texts, ","); got != "a,b,c" {
+				t.Errorf("rounds = %q, want a,b,c", got)
+			}
+			waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			if err := seq.Wait(waitCtx); err != nil {
+				t.Errorf("Wait error: %v; the last round never finished", err)
+			}
+			if got := client.resumeCID.Load(); got != tc.want {
+				t.Errorf("resumeCID = %d, want %d", got, tc.want)
+			}
+
+			// Cancellations name the generation as the server knows it
+			want := stream.cid
+			if tc.original {
+				want = gen.Request(t).CID
+			}
+			if got := stream.wireCID(seq); got != want {
+				t.Errorf("wireCID = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestSeq_GenStreams_Race overlaps generations and tool returns with server
+// events and Close. Every stream must end, with its own output, and the race
+// detector must stay quiet.
+func TestSeq_GenStreams_Race(t *testing.T) {
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		transport := newMockTransport()
+		client := NewWithTransport(ctx, transport)
+		seq := openTestSeq(t, client, transport, "seq-1")
+
+		// Answer every generation and tool return with its own CID
+		serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+			switch req.Data.(type) {
+			case genCommandData:
+				return []*MSEvent{
+					{Event: "seq_text", SeqID: "seq-1", Text: req.CID},
+					{Event: "seq_tool_call", SeqID: "seq-1", ToolCalls: []SeqToolCall{{Name: "f"}}},
+				}
+			case toolReturnCommandData:
+				return []*MSEvent{
+					{Event: "seq_text", SeqID: "seq-1", Text: req.CID},
+					{Event: "seq_gen_finish", SeqID: "seq-1", CID: req.CID},
+				}
+			}
+			return nil
+		})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+
+			for {
+				stream, err := seq.Generate(ctx)
+				if err != nil {
+					return
+				}
+				chunk, err := stream.Next(waitCtx)
+				if err != nil {
+					if err == context.DeadlineExceeded {
+						t.Errorf("stream %s never ended", stream.cid)
+					}
+					return
+				}
+				if chunk != nil && chunk.Text != stream.cid {
+					t.Errorf("stream %s got text for %s", stream.cid, chunk.Text)
+				}
+
+				resumed, err := seq.ToolReturn(ctx, []ToolResult{{Name: "f"}})
+				if err != nil {
+					return
+				}
+				text, err := resumed.Text(waitCtx)
+				if err == context.DeadlineExceeded {
+					t.Errorf("stream %s never ended", resumed.cid)
+				}
+				if err != nil {
+					return
+				}
+				if text != resumed.cid {
+					t.Errorf("stream %s got text for %s", resumed.cid, text)
+				}
+			}
+		}()
+
+		time.Sleep(time.Duration(i) * 100 * time.Microsecond)
+		seq.closeWith(nil, ErrClosed)
+		<-done
+		client.Close(ctx)
+	}
+}
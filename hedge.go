@@ -0,0 +1,109 @@
+package modelsocket
+
+import (
+	"context"
+	"time"
+)
+
+// generateHedged forks the sequence before generating, so the generation can
+// be repeated on the fork if the original is slow to produce its first chunk.
+func (s *Seq) generateHedged(ctx context.Context, cfg genConfig) (*GenStream, error) {
+	fork, err := s.Fork(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := s.generate(ctx, cfg)
+	if err != nil {
+		go fork.Close(fork.client.ctx)
+		return nil, err
+	}
+
+	stream := newGenStream(s, primary.cid)
+	stream.ctx = primary.ctx
+	stream.markSent()
+
+	go stream.hedge(ctx, primary, fork, cfg, *cfg.hedge)
+
+	return stream, nil
+}
+
+// hedgeResult is the first thing a hedged attempt produced.
+type hedgeResult struct {
+	attempt *GenStream
+	chunk   *GenChunk
+	err     error
+}
+
+// hedge waits for primary's first chunk, starting the same generation on
+// fork with ctx if none arrives within delay. The first attempt to produce a
+// chunk is forwarded to g; the other is cancelled and its sequence closed.
+func (g *GenStream) hedge(ctx context.Context, primary *GenStream, fork *Seq, cfg genConfig, delay time.Duration) {
+	results := make(chan hedgeResult, 2)
+	first := func(attempt *GenStream) {
+		chunk, err := attempt.Next(g.ctx)
+		results <- hedgeResult{attempt: attempt, chunk: chunk, err: err}
+	}
+
+	go first(primary)
+	running := 1
+
+	var backup *GenStream
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	timeout := timer.C
+
+	var winner hedgeResult
+	for {
+		select {
+		case <-timeout:
+			timeout = nil
+			if attempt, err := fork.generate(ctx, cfg); err == nil {
+				backup = attempt
+				running++
+				go first(backup)
+			}
+			continue
+		case winner = <-results:
+			running--
+		}
+
+		// A failure only decides the race once no attempt is left running
+		if winner.err == nil || running == 0 {
+			break
+		}
+	}
+
+	// Discard the losing attempt and its sequence
+	loser, loserSeq := backup, fork
+	if winner.attempt == backup {
+		loser, loserSeq = primary, primary.seq
+		g.mu.Lock()
+		g.seq = fork
+		g.mu.Unlock()
+	}
+	if loser != nil {
+		loser.handleAbort(nil)
+	}
+	go loserSeq.Close(loserSeq.client.ctx)
+
+	if winner.err != nil {
+		g.handleError(winner.err)
+		return
+	}
+
+	attempt, chunk := winner.attempt, winner.chunk
+	for chunk != nil {
+		g.forward(chunk)
+
+		var err error
+		if chunk, err = attempt.Next(g.ctx); err != nil {
+			g.handleError(err)
+			return
+		}
+	}
+	g.handleFinish(&MSEvent{
+		InputTokens:  attempt.InputTokens(),
+		OutputTokens: attempt.OutputTokens(),
+	})
+}
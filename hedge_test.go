@@ -0,0 +1,167 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// serveCommands answers seq_command requests with the events returned by fn
+// until the transport is closed. Requests are also copied to the returned
+// channel.
+func serveCommands(t *testing.T, transport *mockTransport, fn func(req *MSRequest) []*MSEvent) <-chan *MSRequest {
+	t.Helper()
+
+	seen := make(chan *MSRequest, 100)
+	go func() {
+		for req := range transport.onSend {
+			seen <- req
+			for _, event := range fn(req) {
+				transport.mu.Lock()
+				closed := transport.closed
+				transport.mu.Unlock()
+				if closed {
+					return
+				}
+				transport.pushEvent(event)
+			}
+		}
+	}()
+	return seen
+}
+
+// textServer generates texts on any sequence.
+func textServer(texts ...string) func(req *MSRequest) []*MSEvent {
+	return func(req *MSRequest) []*MSEvent {
+		if _, ok := req.Data.(genCommandData); !ok {
+			return nil
+		}
+		var events []*MSEvent
+		for _, text := range texts {
+			events = append(events, &MSEvent{Event: "seq_text", SeqID: req.SeqID, Text: text})
+		}
+		return append(events, &MSEvent{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID})
+	}
+}
+
+// hedgeServer forks seq-1 into seq-2 and generates text on the sequences
+// in responses; sequences without a response never produce output.
+func hedgeServer(responses map[string]string) func(req *MSRequest) []*MSEvent {
+	return func(req *MSRequest) []*MSEvent {
+		switch req.Data.(type) {
+		case forkCommandData:
+			return []*MSEvent{{Event: "seq_fork_finish", SeqID: req.SeqID, CID: req.CID, ChildSeqID: "seq-2"}}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			text, ok := responses[req.SeqID]
+			if !ok {
+				return nil
+			}
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: text},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, OutputTokens: 1},
+			}
+		}
+		return nil
+	}
+}
+
+// commandsFor returns the commands sent to seqID within the timeout.
+func commandsFor(seen <-chan *MSRequest, seqID string, timeout time.Duration) []string {
+	var commands []string
+	deadline := time.After(timeout)
+	for {
+		select {
+		case req := <-seen:
+			if req.SeqID != seqID {
+				continue
+			}
+			switch req.Data.(type) {
+			case genCommandData:
+				commands = append(commands, "gen")
+			case cancelCommandData:
+				commands = append(commands, "cancel")
+			case closeCommandData:
+				commands = append(commands, "close")
+			}
+		case <-deadline:
+			return commands
+		}
+	}
+}
+
+func TestSeq_GenerateHedged_PrimaryWins(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	seen := serveCommands(t, transport, hedgeServer(map[string]string{"seq-1": "fast", "seq-2": "hedged"}))
+
+	stream, err := seq.Generate(ctx, WithHedge(time.Second))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "fast" {
+		t.Errorf("text = %q, want fast", text)
+	}
+	if stream.Seq() != seq {
+		t.Error("Seq() is not the original sequence")
+	}
+
+	// The unused fork is closed without generating
+	if got := commandsFor(seen, "seq-2", 100*time.Millisecond); len(got) != 1 || got[0] != "close" {
+		t.Errorf("fork commands = %v, want [close]", got)
+	}
+}
+
+func TestSeq_GenerateHedged_HedgeWins(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	seen := serveCommands(t, transport, hedgeServer(map[string]string{"seq-2": "hedged"}))
+
+	stream, err := seq.Generate(ctx, WithHedge(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "hedged" {
+		t.Errorf("text = %q, want hedged", text)
+	}
+	if id := stream.Seq().ID(); id != "seq-2" {
+		t.Errorf("Seq().ID() = %s, want seq-2", id)
+	}
+
+	// The slow original is cancelled and closed
+	got := commandsFor(seen, "seq-1", 100*time.Millisecond)
+	want := []string{"gen", "cancel", "close"}
+	if len(got) != len(want) {
+		t.Fatalf("original commands = %v, want %v", got, want)
+	}
+	for _, c := range want {
+		found := false
+		for _, g := range got {
+			found = found || g == c
+		}
+		if !found {
+			t.Errorf("original commands = %v, missing %s", got, c)
+		}
+	}
+}
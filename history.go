@@ -0,0 +1,172 @@
+package modelsocket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Message is an entry in a sequence's conversation history.
+type Message struct {
+	Role Role   `json:"role,omitempty"`
+	Text string `json:"text"`
+
+	// Hidden messages are not part of the model's context.
+	Hidden bool `json:"hidden,omitempty"`
+
+	// ToolCalls are the calls made by a generated message.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// ToolResults are the results returned by [Seq.ToolReturn], for
+	// messages with RoleTool.
+	ToolResults []ToolResult `json:"tool_results,omitempty"`
+
+	// Prompt is the reference of the registered prompt the message was
+	// rendered from by [Seq.AppendPrompt].
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// History returns the conversation so far: appended text, completed
+// generations and returned tool results, in order. A generation still in
+// progress is not included. The tool definition prompt sent by [WithToolbox]
+// is not part of the history.
+func (s *Seq) History() []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Message(nil), s.history...)
+}
+
+// TranscriptHash returns a hash of the conversation, as [TranscriptHash]
+// of its history.
+func (s *Seq) TranscriptHash() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return TranscriptHash(s.history)
+}
+
+// transcriptHashVersion is hashed first, so a change to the encoding
+// changes every hash rather than colliding with old ones.
+const transcriptHashVersion = "modelsocket-transcript-v1"
+
+// TranscriptHash returns a stable hex-encoded SHA-256 hash of messages:
+// their roles, text, tool calls and tool results, in order. Hidden messages
+// aren't part of the model's context and are skipped, as is metadata such
+// as [Message.Prompt]. Equal conversations hash equally across processes and
+// versions of this package, so the hash suits cache keys, deduplication and
+// audit trails.
+func TranscriptHash(messages []Message) string {
+	h := sha256.New()
+
+	// Fields are length-prefixed so no two transcripts encode the same
+	write := func(field string) {
+		var n [binary.MaxVarintLen64]byte
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(field)))])
+		io.WriteString(h, field)
+	}
+
+	write(transcriptHashVersion)
+	for _, msg := range messages {
+		if msg.Hidden {
+			continue
+		}
+		write("m")
+		write(string(msg.Role))
+		write(msg.Text)
+		for _, call := range msg.ToolCalls {
+			write("c")
+			write(call.Name)
+			write(call.Args)
+		}
+		for _, result := range msg.ToolResults {
+			write("r")
+			write(result.Name)
+			write(result.Result)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// record adds a message to the sequence's history.
+func (s *Seq) record(msg Message) {
+	if msg.Text == "" && len(msg.ToolCalls) == 0 && len(msg.ToolResults) == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.history = append(s.history, msg)
+	s.mu.Unlock()
+}
+
+// toolResultsMessage returns the history entry for returned tool results.
+func toolResultsMessage(results []ToolResult) Message {
+	text, _ := json.Marshal(results)
+	return Message{
+		Role:        RoleTool,
+		Text:        string(text),
+		ToolResults: append([]ToolResult(nil), results...),
+	}
+}
+
+// Replay opens a sequence and appends history to it, recreating a
+// conversation on a new sequence or connection. Hidden messages are skipped.
+// Tool calls are written as <tool_call> tags and tool results as tool
+// messages, so a replayed conversation is close to, but not necessarily
+// token-for-token identical with, the original.
+func (c *Client) Replay(ctx context.Context, model string, history []Message, opts ...OpenOption) (*Seq, error) {
+	cfg := openConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return c.replay(ctx, model, history, cfg)
+}
+
+// replay opens a sequence with cfg and appends history to it.
+func (c *Client) replay(ctx context.Context, model string, history []Message, cfg openConfig) (*Seq, error) {
+	seq, err := c.open(ctx, model, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range history {
+		if msg.Hidden {
+			continue
+		}
+		if _, err := seq.append(ctx, replayText(msg), appendConfig{role: msg.Role}); err != nil {
+			go seq.Close(c.ctx)
+			return nil, err
+		}
+		seq.record(msg)
+	}
+	return seq, nil
+}
+
+// replayText renders a message as appended text.
+func replayText(msg Message) string {
+	if len(msg.ToolCalls) == 0 {
+		return msg.Text
+	}
+
+	var sb strings.Builder
+	sb.WriteString(msg.Text)
+	for _, call := range msg.ToolCalls {
+		args := json.RawMessage(call.Args)
+		if !json.Valid(args) {
+			args, _ = json.Marshal(call.Args)
+		}
+		body, _ := json.Marshal(struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}{call.Name, args})
+
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(toolCallOpenTag)
+		sb.Write(body)
+		sb.WriteString(toolCallCloseTag)
+	}
+	return sb.String()
+}
@@ -0,0 +1,226 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSeq_History(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-123")
+
+	go func() {
+		req := transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_append_finish", SeqID: "seq-123", CID: req.CID})
+	}()
+	if err := seq.Append(ctx, "Weather?", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+
+	// Generation that stops on a tool call
+	go func() {
+		transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-123", Text: "Checking."})
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-123", Text: "(thinking)", Hidden: true})
+		transport.pushEvent(&MSEvent{
+			Event:     "seq_tool_call",
+			SeqID:     "seq-123",
+			ToolCalls: []SeqToolCall{{Name: "get_weather", Args: `{}`}},
+		})
+	}()
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		if len(chunk.ToolCalls) > 0 {
+			break
+		}
+	}
+
+	if n := len(seq.History()); n != 1 {
+		t.Fatalf("len(History) during generation = %d, want 1", n)
+	}
+
+	go func() {
+		req := transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-123", Text: "Sunny."})
+		transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-123", CID: req.CID})
+	}()
+	resumed, err := seq.ToolReturn(ctx, []ToolResult{{Name: "get_weather", Result: "sunny"}})
+	if err != nil {
+		t.Fatalf("ToolReturn error: %v", err)
+	}
+	if _, err := resumed.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	history := seq.History()
+	if len(history) != 4 {
+		t.Fatalf("len(History) = %d, want 4: %+v", len(history), history)
+	}
+
+	want := []struct {
+		role Role
+		text string
+	}{
+		{RoleUser, "Weather?"},
+		{RoleAssistant, "Checking."},
+		{RoleTool, `[{"name":"get_weather","result":"sunny"}]`},
+		{RoleAssistant, "Sunny."},
+	}
+	for i, w := range want {
+		if history[i].Role != w.role || history[i].Text != w.text {
+			t.Errorf("History[%d] = %s %q, want %s %q", i, history[i].Role, history[i].Text, w.role, w.text)
+		}
+	}
+	if len(history[1].ToolCalls) != 1 || history[1].ToolCalls[0].Name != "get_weather" {
+		t.Errorf("History[1].ToolCalls = %+v, want one call to get_weather", history[1].ToolCalls)
+	}
+	if len(history[2].ToolResults) != 1 {
+		t.Errorf("len(History[2].ToolResults) = %d, want 1", len(history[2].ToolResults))
+	}
+}
+
+func TestClient_Replay(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	history := []Message{
+		{Role: RoleUser, Text: "Hi"},
+		{Role: RoleAssistant, Text: "draft", Hidden: true},
+		{Role: RoleAssistant, Text: "Hello!"},
+	}
+
+	appended := make(chan appendCommandData, len(history))
+	go func() {
+		req := transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_opened", CID: req.CID, SeqID: "seq-2"})
+		for range 2 {
+			req := transport.waitForRequest(t, time.Second)
+			appended <- req.Data.(appendCommandData)
+			transport.pushEvent(&MSEvent{Event: "seq_append_finish", SeqID: "seq-2", CID: req.CID})
+		}
+	}()
+
+	seq, err := client.Replay(ctx, "test-model", history)
+	if err != nil {
+		t.Fatalf("Replay error: %v", err)
+	}
+	close(appended)
+
+	var texts []string
+	for data := range appended {
+		texts = append(texts, data.Role+":"+data.Text)
+	}
+	if len(texts) != 2 || texts[0] != "user:Hi" || texts[1] != "assistant:Hello!" {
+		t.Errorf("appended = %q, want [user:Hi assistant:Hello!]", texts)
+	}
+
+	if n := len(seq.History()); n != 2 {
+		t.Errorf("len(History) = %d, want 2", n)
+	}
+}
+
+func TestReplayText(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"text", Message{Text: "Hello"}, "Hello"},
+		{
+			"tool call",
+			Message{Text: "Checking.", ToolCalls: []ToolCall{{Name: "a", Args: `{"x": 1}`}}},
+			"Checking.\n<tool_call>{\"name\":\"a\",\"arguments\":{\"x\":1}}</tool_call>",
+		},
+		{
+			"invalid args",
+			Message{ToolCalls: []ToolCall{{Name: "a", Args: `x`}}},
+			`<tool_call>{"name":"a","arguments":"x"}</tool_call>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replayText(tt.msg); got != tt.want {
+				t.Errorf("replayText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscriptHash(t *testing.T) {
+	base := []Message{
+		{Role: RoleUser, Text: "What's the weather?"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{Name: "weather", Args: `{"city":"Paris"}`}}},
+		{Role: RoleTool, Text: `[{"name":"weather","result":"sunny"}]`, ToolResults: []ToolResult{{Name: "weather", Result: "sunny"}}},
+		{Role: RoleAssistant, Text: "Sunny."},
+	}
+	hash := TranscriptHash(base)
+
+	// Pinned so the encoding can't change unnoticed
+	const want = "0e6d54aec63ef573be8daa08c4c5b2c8703efb206cad5fbcc7e496a79f32a641"
+	if hash != want {
+		t.Errorf("TranscriptHash = %s, want %s", hash, want)
+	}
+
+	// Hidden messages and metadata don't count
+	withHidden := append([]Message{{Role: RoleUser, Text: "scratch", Hidden: true}}, base...)
+	withHidden[1].Prompt = "weather@v1"
+	if got := TranscriptHash(withHidden); got != hash {
+		t.Errorf("hash with hidden message = %s, want %s", got, hash)
+	}
+
+	// Any change to roles, text, calls or results does
+	for name, change := range map[string]func(m []Message){
+		"role":   func(m []Message) { m[0].Role = RoleSystem },
+		"text":   func(m []Message) { m[3].Text = "Sunny!" },
+		"args":   func(m []Message) { m[1].ToolCalls[0].Args = `{"city":"Rome"}` },
+		"result": func(m []Message) { m[2].ToolResults[0].Result = "rainy" },
+		"split": func(m []Message) {
+			m[0].Text = "What's the"
+			m[3].Text = "weather? Sunny."
+		},
+	} {
+		changed := make([]Message, len(base))
+		for i, msg := range base {
+			msg.ToolCalls = append([]ToolCall(nil), msg.ToolCalls...)
+			msg.ToolResults = append([]ToolResult(nil), msg.ToolResults...)
+			changed[i] = msg
+		}
+		change(changed)
+		if TranscriptHash(changed) == hash {
+			t.Errorf("%s change didn't change the hash", name)
+		}
+	}
+
+	// Field boundaries matter
+	a := TranscriptHash([]Message{{Role: RoleUser, Text: "ab"}, {Role: RoleUser, Text: "c"}})
+	b := TranscriptHash([]Message{{Role: RoleUser, Text: "a"}, {Role: RoleUser, Text: "bc"}})
+	if a == b {
+		t.Error("messages split differently hash equally")
+	}
+}
+
+func TestSeq_TranscriptHash(t *testing.T) {
+	seq := &Seq{}
+	empty := seq.TranscriptHash()
+
+	seq.record(Message{Role: RoleUser, Text: "Hello"})
+	if got := seq.TranscriptHash(); got == empty || got != TranscriptHash(seq.History()) {
+		t.Errorf("TranscriptHash = %s, want hash of history", got)
+	}
+}
@@ -0,0 +1,231 @@
+// Package httpadapter exposes ModelSocket conversations over plain HTTP, as
+// a backend for web frontends.
+package httpadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/google/uuid"
+)
+
+// Options configures a chat handler.
+type Options struct {
+	// Model is the model new conversations are opened with.
+	Model string
+
+	// Store keeps conversations between requests. Defaults to an
+	// in-memory store, which only works with a single instance.
+	Store modelsocket.SessionStore
+
+	// SystemPrompt, if set, is appended as a system message when a
+	// conversation starts.
+	SystemPrompt string
+
+	// OpenOptions configure each sequence, both new and resumed.
+	OpenOptions []modelsocket.OpenOption
+
+	// GenOptions configure each generation.
+	GenOptions []modelsocket.GenOption
+
+	// MaxMessageBytes limits the size of a user message. Defaults to 32KB.
+	MaxMessageBytes int
+}
+
+// ChatRequest is the body accepted by the chat handler.
+type ChatRequest struct {
+	// ConversationID continues an existing conversation. Leave it empty
+	// to start a new one.
+	ConversationID string `json:"conversation_id,omitempty"`
+
+	// Message is the user's message.
+	Message string `json:"message"`
+}
+
+// ChatEvent is a streamed response event. Type is "chunk" for generated
+// text, "done" when the response is complete, or "error".
+type ChatEvent struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Text           string `json:"text,omitempty"`
+	InputTokens    int    `json:"input_tokens,omitempty"`
+	OutputTokens   int    `json:"output_tokens,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// chatHandler serves chat requests.
+type chatHandler struct {
+	client *modelsocket.Client
+	opts   Options
+}
+
+// ChatHandler returns a handler that answers POSTed [ChatRequest] bodies.
+// Each request resumes the conversation from the session store, appends the
+// user message and streams the response, then parks the conversation again.
+//
+// Responses are streamed as server-sent events when the request accepts
+// text/event-stream, and as newline-delimited JSON otherwise. Both carry
+// [ChatEvent] values; with SSE the event name is the event's Type. The
+// conversation ID is also returned in the X-Conversation-ID header.
+func ChatHandler(client *modelsocket.Client, opts Options) http.Handler {
+	if opts.Store == nil {
+		opts.Store = modelsocket.NewMemorySessionStore()
+	}
+	if opts.MaxMessageBytes == 0 {
+		opts.MaxMessageBytes = 32 << 10
+	}
+	return &chatHandler{client: client, opts: opts}
+}
+
+// ServeHTTP handles a chat request.
+func (h *chatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ChatRequest
+	body := http.MaxBytesReader(w, r.Body, int64(h.opts.MaxMessageBytes)+1024)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		http.Error(w, "message is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Message) > h.opts.MaxMessageBytes {
+		http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctx := r.Context()
+	seq, id, err := h.conversation(r, req.ConversationID)
+	if errors.Is(err, modelsocket.ErrSessionNotFound) {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to open conversation", http.StatusBadGateway)
+		return
+	}
+	// Release the sequence if the request fails before it is parked
+	defer func() { go seq.Close(context.WithoutCancel(ctx)) }()
+
+	if err := seq.Append(ctx, req.Message, modelsocket.AsUser()); err != nil {
+		http.Error(w, "failed to send message", http.StatusBadGateway)
+		return
+	}
+
+	stream, err := seq.Generate(ctx, h.opts.GenOptions...)
+	if err != nil {
+		http.Error(w, "failed to generate", http.StatusBadGateway)
+		return
+	}
+
+	enc := newEventWriter(w, r)
+	w.Header().Set("X-Conversation-ID", id)
+	w.WriteHeader(http.StatusOK)
+
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			enc.write(ChatEvent{Type: "error", ConversationID: id, Error: err.Error()})
+			return
+		}
+		if chunk.Hidden || chunk.Text == "" {
+			continue
+		}
+		if err := enc.write(ChatEvent{Type: "chunk", Text: chunk.Text}); err != nil {
+			// The client went away
+			return
+		}
+	}
+
+	// Park the conversation before reporting completion, so a follow-up
+	// request finds it
+	seq = stream.Seq()
+	if err := seq.Park(ctx, h.opts.Store, id); err != nil {
+		enc.write(ChatEvent{Type: "error", ConversationID: id, Error: err.Error()})
+		return
+	}
+
+	enc.write(ChatEvent{
+		Type:           "done",
+		ConversationID: id,
+		InputTokens:    stream.InputTokens(),
+		OutputTokens:   stream.OutputTokens(),
+	})
+}
+
+// conversation resumes the conversation with id, or starts a new one if id
+// is empty.
+func (h *chatHandler) conversation(r *http.Request, id string) (*modelsocket.Seq, string, error) {
+	ctx := r.Context()
+
+	if id != "" {
+		seq, err := h.client.Resume(ctx, h.opts.Store, id, h.opts.OpenOptions...)
+		return seq, id, err
+	}
+
+	seq, err := h.client.Open(ctx, h.opts.Model, h.opts.OpenOptions...)
+	if err != nil {
+		return nil, "", err
+	}
+	if h.opts.SystemPrompt != "" {
+		if err := seq.Append(ctx, h.opts.SystemPrompt, modelsocket.AsSystem()); err != nil {
+			seq.Close(ctx)
+			return nil, "", err
+		}
+	}
+	return seq, uuid.New().String(), nil
+}
+
+// eventWriter writes ChatEvents as SSE or NDJSON, flushing after each.
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+}
+
+// newEventWriter picks the response format from the request's Accept header
+// and sets the content type.
+func newEventWriter(w http.ResponseWriter, r *http.Request) *eventWriter {
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	flusher, _ := w.(http.Flusher)
+	return &eventWriter{w: w, flusher: flusher, sse: sse}
+}
+
+// write sends one event.
+func (e *eventWriter) write(event ChatEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if e.sse {
+		_, err = fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event.Type, data)
+	} else {
+		_, err = fmt.Fprintf(e.w, "%s\n", data)
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return nil
+}
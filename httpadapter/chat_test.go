@@ -0,0 +1,143 @@
+package httpadapter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers every generation with "Hello
+// there", or with a weather tool call on sequences with tools.
+func newServer() *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		if g.Tools {
+			return []*modelsocket.MSEvent{mstest.ToolCall("weather", `{"city":"Paris"}`), mstest.Finish(5, 2)}
+		}
+		return []*modelsocket.MSEvent{mstest.Text("Hello"), mstest.Text(" there"), mstest.Finish(5, 2)}
+	})
+}
+
+func newTestHandler(t *testing.T, opts Options) (http.Handler, *mstest.Server) {
+	t.Helper()
+
+	transport := newServer()
+	client := modelsocket.NewWithTransport(context.Background(), transport)
+	t.Cleanup(func() { client.Close(context.Background()) })
+
+	opts.Model = "test-model"
+	return ChatHandler(client, opts), transport
+}
+
+// post sends a chat request and decodes the NDJSON response.
+func post(t *testing.T, h http.Handler, body string) (*httptest.ResponseRecorder, []ChatEvent) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var events []ChatEvent
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var event ChatEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return rec, events
+		}
+		events = append(events, event)
+	}
+	return rec, events
+}
+
+func TestChatHandler_Conversation(t *testing.T) {
+	h, transport := newTestHandler(t, Options{SystemPrompt: "Be brief."})
+
+	rec, events := post(t, h, `{"message": "Hi"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %s, want application/x-ndjson", ct)
+	}
+	if len(events) != 3 {
+		t.Fatalf("len(events) = %d, want 3: %+v", len(events), events)
+	}
+	if events[0].Text+events[1].Text != "Hello there" {
+		t.Errorf("text = %q, want %q", events[0].Text+events[1].Text, "Hello there")
+	}
+
+	done := events[2]
+	if done.Type != "done" || done.ConversationID == "" || done.OutputTokens != 2 {
+		t.Errorf("done = %+v", done)
+	}
+	if got := rec.Header().Get("X-Conversation-ID"); got != done.ConversationID {
+		t.Errorf("X-Conversation-ID = %s, want %s", got, done.ConversationID)
+	}
+
+	// The follow-up replays the conversation into a new sequence
+	rec, _ = post(t, h, fmt.Sprintf(`{"conversation_id": %q, "message": "Again"}`, done.ConversationID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	got := transport.Texts("seq-2")
+	want := []string{"Be brief.", "Hi", "Hello there", "Again"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("seq-2 appends = %q, want %q", got, want)
+	}
+}
+
+func TestChatHandler_SSE(t *testing.T) {
+	h, _ := newTestHandler(t, Options{})
+
+	req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(`{"message": "Hi"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s, want text/event-stream", ct)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "event: chunk\ndata: {\"type\":\"chunk\",\"text\":\"Hello\"}\n\n") {
+		t.Errorf("body = %q, want a chunk event first", body)
+	}
+	if !strings.Contains(body, "event: done\n") {
+		t.Errorf("body = %q, want a done event", body)
+	}
+}
+
+func TestChatHandler_Errors(t *testing.T) {
+	h, _ := newTestHandler(t, Options{MaxMessageBytes: 10})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid json", http.MethodPost, "{", http.StatusBadRequest},
+		{"empty message", http.MethodPost, `{"message": " "}`, http.StatusBadRequest},
+		{"too large", http.MethodPost, `{"message": "01234567890"}`, http.StatusRequestEntityTooLarge},
+		{"unknown conversation", http.MethodPost, `{"conversation_id": "nope", "message": "Hi"}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/chat", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,559 @@
+package httpadapter
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/google/uuid"
+)
+
+// OpenAIOptions configures an OpenAI-compatible handler.
+type OpenAIOptions struct {
+	// Models lists the models clients may request, and is returned by
+	// /v1/models. If empty, any model is passed through.
+	Models []string
+
+	// DefaultModel is used when a request doesn't name a model.
+	DefaultModel string
+
+	// APIKey, if set, must be sent by clients as a bearer token.
+	APIKey string
+
+	// OpenOptions configure each sequence.
+	OpenOptions []modelsocket.OpenOption
+
+	// MaxRequestBytes limits the size of a request body. Defaults to 1MB.
+	MaxRequestBytes int64
+}
+
+// openAIHandler serves the OpenAI API.
+type openAIHandler struct {
+	client *modelsocket.Client
+	opts   OpenAIOptions
+	mux    *http.ServeMux
+}
+
+// OpenAIHandler returns a handler for the chat completions subset of the
+// OpenAI API, so OpenAI SDKs can use a ModelSocket deployment by changing
+// their base URL. It serves POST /v1/chat/completions, streaming when the
+// request sets "stream", and GET /v1/models.
+//
+// The API is stateless: each request carries the whole conversation, which is
+// replayed into a new sequence and closed once the response is complete.
+// Tools in the request are described to the model and its calls returned as
+// tool_calls, for the client to run.
+func OpenAIHandler(client *modelsocket.Client, opts OpenAIOptions) http.Handler {
+	if opts.MaxRequestBytes == 0 {
+		opts.MaxRequestBytes = 1 << 20
+	}
+
+	h := &openAIHandler{client: client, opts: opts, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /v1/chat/completions", h.serveCompletions)
+	h.mux.HandleFunc("GET /v1/models", h.serveModels)
+	return h
+}
+
+// ServeHTTP authenticates the request and routes it.
+func (h *openAIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.APIKey != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.APIKey)) != 1 {
+			writeOpenAIError(w, http.StatusUnauthorized, "invalid_api_key", "Invalid API key.")
+			return
+		}
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// OpenAIMessage is a chat message in the OpenAI API. Content is a string, or
+// an array of parts of which only text parts are supported.
+type OpenAIMessage struct {
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// OpenAIToolCall is a function call made by the model.
+type OpenAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// OpenAITool is a tool offered to the model.
+type OpenAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// OpenAIRequest is a chat completions request.
+type OpenAIRequest struct {
+	Model               string          `json:"model"`
+	Messages            []OpenAIMessage `json:"messages"`
+	Stream              bool            `json:"stream,omitempty"`
+	MaxTokens           *int            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64        `json:"temperature,omitempty"`
+	TopP                *float64        `json:"top_p,omitempty"`
+	Seed                *int64          `json:"seed,omitempty"`
+	Stop                json.RawMessage `json:"stop,omitempty"`
+	Tools               []OpenAITool    `json:"tools,omitempty"`
+	StreamOptions       *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+// openAIUsage reports token counts.
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// openAIChoice is a choice in a response or a streamed chunk.
+type openAIChoice struct {
+	Index        int            `json:"index"`
+	Message      *OpenAIMessage `json:"message,omitempty"`
+	Delta        *openAIDelta   `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+// openAIDelta is the change carried by a streamed chunk.
+type openAIDelta struct {
+	Role      string           `json:"role,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+}
+
+// openAIResponse is a completion or a streamed chunk of one.
+type openAIResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+// serveModels lists the allowed models.
+func (h *openAIHandler) serveModels(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		OwnedBy string `json:"owned_by"`
+	}
+
+	models := make([]model, len(h.opts.Models))
+	for i, id := range h.opts.Models {
+		models[i] = model{ID: id, Object: "model", OwnedBy: "modelsocket"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": models})
+}
+
+// serveCompletions answers a chat completions request.
+func (h *openAIHandler) serveCompletions(w http.ResponseWriter, r *http.Request) {
+	var req OpenAIRequest
+	body := http.MaxBytesReader(w, r.Body, h.opts.MaxRequestBytes)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body.")
+		return
+	}
+
+	model := req.Model
+	if model == "" {
+		model = h.opts.DefaultModel
+	}
+	if model == "" || (len(h.opts.Models) > 0 && !slices.Contains(h.opts.Models, model)) {
+		writeOpenAIError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("The model %q does not exist.", model))
+		return
+	}
+
+	history, err := openAIHistory(req.Messages)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	genOpts, err := openAIGenOptions(&req)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	openOpts := h.opts.OpenOptions
+	if len(req.Tools) > 0 {
+		toolbox, err := openAIToolbox(req.Tools)
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		openOpts = append(openOpts[:len(openOpts):len(openOpts)], modelsocket.WithToolbox(toolbox))
+	}
+
+	ctx := r.Context()
+	seq, err := h.client.Replay(ctx, model, history, openOpts...)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "upstream_error", err.Error())
+		return
+	}
+	defer func() { go seq.Close(context.WithoutCancel(ctx)) }()
+
+	stream, err := seq.Generate(ctx, genOpts...)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "upstream_error", err.Error())
+		return
+	}
+
+	c := &completion{
+		id:        "chatcmpl-" + uuid.New().String(),
+		created:   time.Now().Unix(),
+		model:     model,
+		maxTokens: req.maxTokens(),
+	}
+	if req.Stream {
+		c.stream(w, r, stream, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+	} else {
+		c.respond(w, r, stream)
+	}
+}
+
+// maxTokens returns the requested token limit, or zero.
+func (req *OpenAIRequest) maxTokens() int {
+	switch {
+	case req.MaxCompletionTokens != nil:
+		return *req.MaxCompletionTokens
+	case req.MaxTokens != nil:
+		return *req.MaxTokens
+	}
+	return 0
+}
+
+// completion builds the response to a single request.
+type completion struct {
+	id        string
+	created   int64
+	model     string
+	maxTokens int
+	calls     int
+}
+
+// respond waits for the generation and writes a chat.completion.
+func (c *completion) respond(w http.ResponseWriter, r *http.Request, stream *modelsocket.GenStream) {
+	var text strings.Builder
+	var calls []OpenAIToolCall
+	for chunk, err := range stream.Chunks(r.Context()) {
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadGateway, "upstream_error", err.Error())
+			return
+		}
+		calls = append(calls, c.toolCalls(chunk.ToolCalls, false)...)
+		if !chunk.Hidden {
+			text.WriteString(chunk.Text)
+		}
+	}
+
+	content, _ := json.Marshal(text.String())
+	if text.Len() == 0 && len(calls) > 0 {
+		content = json.RawMessage("null")
+	}
+	msg := &OpenAIMessage{Role: "assistant", Content: content, ToolCalls: calls}
+	reason := c.finishReason(stream, len(calls) > 0)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openAIResponse{
+		ID:      c.id,
+		Object:  "chat.completion",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []openAIChoice{{Message: msg, FinishReason: &reason}},
+		Usage:   c.usage(stream),
+	})
+}
+
+// stream writes the generation as chat.completion.chunk server-sent events.
+func (c *completion) stream(w http.ResponseWriter, r *http.Request, stream *modelsocket.GenStream, includeUsage bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	write := func(v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	chunk := func(delta *openAIDelta, reason *string) openAIResponse {
+		return openAIResponse{
+			ID:      c.id,
+			Object:  "chat.completion.chunk",
+			Created: c.created,
+			Model:   c.model,
+			Choices: []openAIChoice{{Delta: delta, FinishReason: reason}},
+		}
+	}
+
+	if err := write(chunk(&openAIDelta{Role: "assistant"}, nil)); err != nil {
+		return
+	}
+
+	called := false
+	for gen, err := range stream.Chunks(r.Context()) {
+		if err != nil {
+			// Headers are sent, so the error goes in the stream
+			write(openAIError("upstream_error", err.Error()))
+			return
+		}
+
+		delta := &openAIDelta{ToolCalls: c.toolCalls(gen.ToolCalls, true)}
+		if !gen.Hidden {
+			delta.Content = gen.Text
+		}
+		if delta.Content == "" && len(delta.ToolCalls) == 0 {
+			continue
+		}
+		called = called || len(delta.ToolCalls) > 0
+		if err := write(chunk(delta, nil)); err != nil {
+			return
+		}
+	}
+
+	reason := c.finishReason(stream, called)
+	if err := write(chunk(&openAIDelta{}, &reason)); err != nil {
+		return
+	}
+	if includeUsage {
+		resp := chunk(nil, nil)
+		resp.Choices = []openAIChoice{}
+		resp.Usage = c.usage(stream)
+		if err := write(resp); err != nil {
+			return
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// toolCalls converts tool calls, giving each an ID. Streamed calls carry
+// their index in the completion.
+func (c *completion) toolCalls(calls []modelsocket.ToolCall, indexed bool) []OpenAIToolCall {
+	var out []OpenAIToolCall
+	for _, call := range calls {
+		tc := OpenAIToolCall{
+			ID:   "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24],
+			Type: "function",
+		}
+		if indexed {
+			index := c.calls
+			tc.Index = &index
+		}
+		tc.Function.Name = call.Name
+		tc.Function.Arguments = call.Args
+		out = append(out, tc)
+		c.calls++
+	}
+	return out
+}
+
+// finishReason reports why the generation stopped.
+func (c *completion) finishReason(stream *modelsocket.GenStream, called bool) string {
+	switch {
+	case called:
+		return "tool_calls"
+	case c.maxTokens > 0 && stream.OutputTokens() >= c.maxTokens:
+		return "length"
+	}
+	return "stop"
+}
+
+// usage reports the generation's token counts.
+func (c *completion) usage(stream *modelsocket.GenStream) *openAIUsage {
+	return &openAIUsage{
+		PromptTokens:     stream.InputTokens(),
+		CompletionTokens: stream.OutputTokens(),
+		TotalTokens:      stream.InputTokens() + stream.OutputTokens(),
+	}
+}
+
+// openAIRoles maps OpenAI roles to roles.
+var openAIRoles = map[string]modelsocket.Role{
+	"system":    modelsocket.RoleSystem,
+	"developer": modelsocket.RoleSystem,
+	"user":      modelsocket.RoleUser,
+	"assistant": modelsocket.RoleAssistant,
+	"tool":      modelsocket.RoleTool,
+}
+
+// openAIHistory converts request messages into a history to replay.
+func openAIHistory(messages []OpenAIMessage) ([]modelsocket.Message, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	// Tool results name their call by ID; the name comes from the call
+	names := make(map[string]string)
+
+	history := make([]modelsocket.Message, 0, len(messages))
+	for i, m := range messages {
+		role, ok := openAIRoles[m.Role]
+		if !ok {
+			return nil, fmt.Errorf("messages[%d]: unsupported role %q", i, m.Role)
+		}
+		text, err := openAIContent(m.Content)
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+
+		msg := modelsocket.Message{Role: role, Text: text}
+		for _, call := range m.ToolCalls {
+			names[call.ID] = call.Function.Name
+			msg.ToolCalls = append(msg.ToolCalls, modelsocket.ToolCall{
+				Name: call.Function.Name,
+				Args: call.Function.Arguments,
+			})
+		}
+		if role == modelsocket.RoleTool {
+			name := names[m.ToolCallID]
+			if name == "" {
+				name = m.Name
+			}
+			msg.ToolResults = []modelsocket.ToolResult{{Name: name, Result: text}}
+			// Tool results are appended as JSON, as after Seq.ToolReturn
+			data, _ := json.Marshal(msg.ToolResults)
+			msg.Text = string(data)
+		}
+		history = append(history, msg)
+	}
+	return history, nil
+}
+
+// openAIContent reads message content, which is a string or an array of
+// text parts.
+func openAIContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("invalid content")
+	}
+
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("unsupported content part %q", part.Type)
+		}
+		sb.WriteString(part.Text)
+	}
+	return sb.String(), nil
+}
+
+// openAIGenOptions converts request parameters to generation options.
+func openAIGenOptions(req *OpenAIRequest) ([]modelsocket.GenOption, error) {
+	opts := []modelsocket.GenOption{modelsocket.GenerateAsAssistant()}
+	if n := req.maxTokens(); n > 0 {
+		opts = append(opts, modelsocket.WithMaxTokens(n))
+	}
+	if req.Temperature != nil {
+		opts = append(opts, modelsocket.WithTemperature(*req.Temperature))
+	}
+	if req.TopP != nil {
+		opts = append(opts, modelsocket.WithTopP(*req.TopP))
+	}
+	if req.Seed != nil {
+		opts = append(opts, modelsocket.WithSeed(*req.Seed))
+	}
+
+	if len(req.Stop) > 0 && string(req.Stop) != "null" {
+		var stops []string
+		var stop string
+		if err := json.Unmarshal(req.Stop, &stop); err == nil {
+			stops = []string{stop}
+		} else if err := json.Unmarshal(req.Stop, &stops); err != nil {
+			return nil, errors.New("stop must be a string or an array of strings")
+		}
+		opts = append(opts, modelsocket.WithStopStrings(stops...))
+	}
+	return opts, nil
+}
+
+// openAIToolbox describes request tools to the model. The tools are run by
+// the client, so the toolbox is only used for its definitions.
+func openAIToolbox(tools []OpenAITool) (*modelsocket.Toolbox, error) {
+	toolbox := modelsocket.NewToolbox()
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool type %q", tool.Type)
+		}
+
+		def := modelsocket.ToolDefinition{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+		}
+		if len(tool.Function.Parameters) > 0 {
+			if err := json.Unmarshal(tool.Function.Parameters, &def.Parameters); err != nil {
+				return nil, fmt.Errorf("tool %s: invalid parameters", def.Name)
+			}
+		}
+
+		toolbox.Add(modelsocket.NewFuncTool(def, func(ctx context.Context, args string) (string, error) {
+			return "", fmt.Errorf("tool %s is run by the client", def.Name)
+		}))
+	}
+	return toolbox, nil
+}
+
+// openAIError returns an error body in the OpenAI format.
+func openAIError(code, message string) any {
+	return map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    code,
+			"code":    code,
+		},
+	}
+}
+
+// writeOpenAIError writes an error response in the OpenAI format.
+func writeOpenAIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(openAIError(code, message))
+}
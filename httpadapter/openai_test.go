@@ -0,0 +1,216 @@
+package httpadapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+func newTestOpenAIHandler(t *testing.T, opts OpenAIOptions) (http.Handler, *mstest.Server) {
+	t.Helper()
+
+	transport := newServer()
+	client := modelsocket.NewWithTransport(context.Background(), transport)
+	t.Cleanup(func() { client.Close(context.Background()) })
+
+	return OpenAIHandler(client, opts), transport
+}
+
+func postCompletion(h http.Handler, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOpenAIHandler_Completion(t *testing.T) {
+	h, transport := newTestOpenAIHandler(t, OpenAIOptions{Models: []string{"m1"}})
+
+	rec := postCompletion(h, `{
+		"model": "m1",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "Hi"}]}
+		],
+		"max_tokens": 2,
+		"stop": "\n"
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp openAIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if resp.Object != "chat.completion" || resp.Model != "m1" || !strings.HasPrefix(resp.ID, "chatcmpl-") {
+		t.Errorf("resp = %+v", resp)
+	}
+
+	choice := resp.Choices[0]
+	if string(choice.Message.Content) != `"Hello there"` || choice.Message.Role != "assistant" {
+		t.Errorf("message = %+v", choice.Message)
+	}
+	// The fake server reports 2 output tokens, reaching max_tokens
+	if *choice.FinishReason != "length" {
+		t.Errorf("finish_reason = %s, want length", *choice.FinishReason)
+	}
+	if resp.Usage.PromptTokens != 5 || resp.Usage.CompletionTokens != 2 || resp.Usage.TotalTokens != 7 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+
+	if got := transport.Texts("seq-1"); strings.Join(got, "|") != "Be brief.|Hi" {
+		t.Errorf("appended = %q", got)
+	}
+	gen := transport.Gens()[0]
+	if *gen.MaxTokens != 2 || len(gen.StopStrings) != 1 || gen.StopStrings[0] != "\n" {
+		t.Errorf("gen = %+v", gen)
+	}
+}
+
+func TestOpenAIHandler_Stream(t *testing.T) {
+	h, _ := newTestOpenAIHandler(t, OpenAIOptions{DefaultModel: "m1"})
+
+	rec := postCompletion(h, `{
+		"messages": [{"role": "user", "content": "Hi"}],
+		"stream": true,
+		"stream_options": {"include_usage": true}
+	}`)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %s: %s", ct, rec.Body)
+	}
+
+	var chunks []openAIResponse
+	var done bool
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("decode %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if !done {
+		t.Error("stream not terminated with [DONE]")
+	}
+	if len(chunks) != 5 {
+		t.Fatalf("len(chunks) = %d, want role, 2 content, finish and usage", len(chunks))
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("first delta = %+v, want role", chunks[0].Choices[0].Delta)
+	}
+	if text := chunks[1].Choices[0].Delta.Content + chunks[2].Choices[0].Delta.Content; text != "Hello there" {
+		t.Errorf("content = %q", text)
+	}
+	if reason := chunks[3].Choices[0].FinishReason; reason == nil || *reason != "stop" {
+		t.Errorf("finish_reason = %v, want stop", reason)
+	}
+	if usage := chunks[4].Usage; usage == nil || usage.CompletionTokens != 2 || len(chunks[4].Choices) != 0 {
+		t.Errorf("usage chunk = %+v", chunks[4])
+	}
+}
+
+func TestOpenAIHandler_Tools(t *testing.T) {
+	h, transport := newTestOpenAIHandler(t, OpenAIOptions{DefaultModel: "m1"})
+
+	tools := `"tools": [{"type": "function", "function": {"name": "weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}}]`
+	rec := postCompletion(h, `{"messages": [{"role": "user", "content": "Weather in Paris?"}], `+tools+`}`)
+
+	var resp openAIResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	choice := resp.Choices[0]
+	if *choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 || string(choice.Message.Content) != "null" {
+		t.Fatalf("choice = %+v: %s", choice, rec.Body)
+	}
+	call := choice.Message.ToolCalls[0]
+	if call.Function.Name != "weather" || call.Function.Arguments != `{"city":"Paris"}` || call.ID == "" {
+		t.Errorf("call = %+v", call)
+	}
+
+	// The client runs the tool and sends the result back
+	callJSON, _ := json.Marshal(call)
+	postCompletion(h, `{"messages": [
+		{"role": "user", "content": "Weather in Paris?"},
+		{"role": "assistant", "content": null, "tool_calls": [`+string(callJSON)+`]},
+		{"role": "tool", "tool_call_id": "`+call.ID+`", "content": "sunny"}
+	], `+tools+`}`)
+
+	appended := strings.Join(transport.Texts("seq-2"), "\n")
+	if !strings.Contains(appended, `<tool_call>{"name":"weather","arguments":{"city":"Paris"}}</tool_call>`) {
+		t.Errorf("appended = %q, want the replayed call", appended)
+	}
+	if !strings.Contains(appended, `[{"name":"weather","result":"sunny"}]`) {
+		t.Errorf("appended = %q, want the named tool result", appended)
+	}
+}
+
+func TestOpenAIHandler_Errors(t *testing.T) {
+	h, _ := newTestOpenAIHandler(t, OpenAIOptions{Models: []string{"m1"}, APIKey: "secret"})
+	auth := []string{"Authorization", "Bearer secret"}
+
+	tests := []struct {
+		name   string
+		body   string
+		header []string
+		want   int
+		code   string
+	}{
+		{"auth", `{"model": "m1", "messages": [{"role": "user", "content": "Hi"}]}`, nil, http.StatusUnauthorized, "invalid_api_key"},
+		{"model", `{"model": "m2", "messages": [{"role": "user", "content": "Hi"}]}`, auth, http.StatusNotFound, "model_not_found"},
+		{"no messages", `{"model": "m1", "messages": []}`, auth, http.StatusBadRequest, "invalid_request_error"},
+		{"role", `{"model": "m1", "messages": [{"role": "robot", "content": "Hi"}]}`, auth, http.StatusBadRequest, "invalid_request_error"},
+		{"image", `{"model": "m1", "messages": [{"role": "user", "content": [{"type": "image_url"}]}]}`, auth, http.StatusBadRequest, "invalid_request_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postCompletion(h, tt.body, tt.header...)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			var body struct {
+				Error struct {
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Error.Code != tt.code {
+				t.Errorf("code = %q, want %q", body.Error.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestOpenAIHandler_Models(t *testing.T) {
+	h, _ := newTestOpenAIHandler(t, OpenAIOptions{Models: []string{"m1", "m2"}})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if len(body.Data) != 2 || body.Data[1].ID != "m2" {
+		t.Errorf("models = %s", rec.Body)
+	}
+}
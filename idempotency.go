@@ -0,0 +1,199 @@
+package modelsocket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SideEffectingTool is a [Tool] whose calls change something outside the
+// conversation, such as sending an email or charging a card. When the
+// toolbox has a [ToolCallStore], each such call runs at most once per key:
+// a call replayed after crash recovery returns the recorded result instead
+// of running again. Mark a tool with [SideEffecting].
+type SideEffectingTool interface {
+	Tool
+	SideEffecting() bool
+}
+
+// SideEffecting marks tool as side-effecting.
+func SideEffecting(tool Tool) Tool {
+	return sideEffectingTool{tool}
+}
+
+type sideEffectingTool struct{ Tool }
+
+func (sideEffectingTool) SideEffecting() bool { return true }
+
+// isSideEffecting reports whether tool is marked as side-effecting.
+func isSideEffecting(tool Tool) bool {
+	marked, ok := tool.(SideEffectingTool)
+	return ok && marked.SideEffecting()
+}
+
+// ToolCallStore records the results of completed side-effecting tool calls
+// by idempotency key. Implementations backed by shared storage let a
+// process that takes over a crashed one's work skip the calls it already
+// made.
+//
+// Claim reserves key for a call about to run, or reports the result
+// recorded under it with done set. Checking for a result and claiming the
+// key must be one atomic step, and a key claimed by another caller must not
+// be claimed again until that claim ends: Claim either waits for it or
+// fails with [ErrToolCallInProgress]. Put records the result of a claimed
+// call, ending the claim. Release ends a claim without a result, after the
+// call failed or its result couldn't be recorded. Claims in shared storage
+// should expire, so a process that crashed mid-call doesn't hold its key
+// forever.
+type ToolCallStore interface {
+	Claim(ctx context.Context, key string) (result string, done bool, err error)
+	Put(ctx context.Context, key string, result string) error
+	Release(ctx context.Context, key string) error
+}
+
+// DefaultToolCallKey derives a call's idempotency key from the run ID in
+// ctx, the tool's name and its arguments, so a run that is resumed and
+// makes the same call again gets the recorded result. Calls made outside a
+// run get no key and aren't guarded.
+func DefaultToolCallKey(ctx context.Context, call ToolCall) string {
+	runID := RunIDFromContext(ctx)
+	if runID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(call.Args))
+	return runID + ":" + call.Name + ":" + hex.EncodeToString(sum[:])
+}
+
+// SetToolCallStore records the results of side-effecting tool calls in
+// store and answers repeated calls from it. A call claims its key in the
+// store before running, so concurrent calls with the same key run the tool
+// once. Only successful calls are recorded, so a failed call runs again
+// when retried. A call whose result can't be recorded fails with the
+// store's error and releases its key, so calls waiting on it aren't stuck;
+// a retried call then runs the tool again.
+func (t *Toolbox) SetToolCallStore(store ToolCallStore) {
+	t.mu.Lock()
+	t.callStore = store
+	t.mu.Unlock()
+}
+
+// SetToolCallKey replaces [DefaultToolCallKey] as the function deriving
+// idempotency keys for side-effecting calls. Calls for which it returns ""
+// aren't guarded.
+func (t *Toolbox) SetToolCallKey(fn func(ctx context.Context, call ToolCall) string) {
+	t.mu.Lock()
+	t.callKey = fn
+	t.mu.Unlock()
+}
+
+// callOnce runs a side-effecting call unless the store has its result.
+func (s ToolSet) callOnce(ctx context.Context, tool Tool, call ToolCall) (string, error) {
+	keyFn := s.callKey
+	if keyFn == nil {
+		keyFn = DefaultToolCallKey
+	}
+	key := keyFn(ctx, call)
+	if key == "" {
+		return tool.Call(ctx, call.Args)
+	}
+
+	recorded, done, err := s.callStore.Claim(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("modelsocket: claiming call to %s: %w", call.Name, err)
+	}
+	if done {
+		return recorded, nil
+	}
+
+	result, err := tool.Call(ctx, call.Args)
+	if err != nil {
+		if releaseErr := s.callStore.Release(context.WithoutCancel(ctx), key); releaseErr != nil {
+			return "", errors.Join(err, fmt.Errorf("modelsocket: releasing call to %s: %w", call.Name, releaseErr))
+		}
+		return "", err
+	}
+	// The call has happened, so record it even if ctx ends meanwhile. If it
+	// can't be recorded, end the claim anyway rather than leave other calls
+	// waiting on it
+	if err := s.callStore.Put(context.WithoutCancel(ctx), key, result); err != nil {
+		err = fmt.Errorf("modelsocket: recording call to %s: %w", call.Name, err)
+		if releaseErr := s.callStore.Release(context.WithoutCancel(ctx), key); releaseErr != nil {
+			err = errors.Join(err, fmt.Errorf("modelsocket: releasing call to %s: %w", call.Name, releaseErr))
+		}
+		return "", err
+	}
+	return result, nil
+}
+
+// MemoryToolCallStore is a ToolCallStore that keeps results in memory. It
+// guards against repeated calls within a process; recovering from a crash
+// needs a store that outlives it. Claim waits for a call already running
+// with the same key.
+type MemoryToolCallStore struct {
+	mu      sync.Mutex
+	results map[string]string
+	claims  map[string]chan struct{} // Closed when the claim ends
+}
+
+// NewMemoryToolCallStore creates an empty in-memory tool call store.
+func NewMemoryToolCallStore() *MemoryToolCallStore {
+	return &MemoryToolCallStore{
+		results: make(map[string]string),
+		claims:  make(map[string]chan struct{}),
+	}
+}
+
+// Claim returns the result recorded under key, or claims it. If key is
+// claimed already, it waits for that claim to end.
+func (m *MemoryToolCallStore) Claim(ctx context.Context, key string) (string, bool, error) {
+	for {
+		m.mu.Lock()
+		if result, ok := m.results[key]; ok {
+			m.mu.Unlock()
+			return result, true, nil
+		}
+		held, ok := m.claims[key]
+		if !ok {
+			m.claims[key] = make(chan struct{})
+			m.mu.Unlock()
+			return "", false, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return "", false, context.Cause(ctx)
+		}
+	}
+}
+
+// Put records result under key and ends its claim.
+func (m *MemoryToolCallStore) Put(ctx context.Context, key string, result string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.results[key] = result
+	m.release(key)
+	return nil
+}
+
+// Release ends the claim on key.
+func (m *MemoryToolCallStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.release(key)
+	return nil
+}
+
+// release ends the claim on key, if any. m.mu must be held.
+func (m *MemoryToolCallStore) release(key string) {
+	if held, ok := m.claims[key]; ok {
+		close(held)
+		delete(m.claims, key)
+	}
+}
@@ -0,0 +1,183 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTool returns a tool that counts its calls and reports the count.
+func countingTool(name string, calls *int) Tool {
+	return NewFuncTool(ToolDefinition{Name: name}, func(ctx context.Context, args string) (string, error) {
+		*calls++
+		return fmt.Sprintf("%s #%d", name, *calls), nil
+	})
+}
+
+func TestToolbox_SideEffecting(t *testing.T) {
+	var charges, lookups int
+	toolbox := NewToolbox()
+	toolbox.Add(SideEffecting(countingTool("charge", &charges)))
+	toolbox.Add(countingTool("lookup", &lookups))
+	toolbox.SetToolCallStore(NewMemoryToolCallStore())
+
+	ctx := ContextWithRunID(context.Background(), "run-1")
+	calls := []ToolCall{{Name: "charge", Args: `{"cents":100}`}, {Name: "lookup", Args: `{}`}}
+
+	first, _ := toolbox.CallTools(ctx, calls)
+	replayed, _ := toolbox.CallTools(ctx, calls)
+	if charges != 1 || replayed[0].Result != first[0].Result {
+		t.Errorf("charge ran %d times and replayed %q, want once and %q", charges, replayed[0].Result, first[0].Result)
+	}
+	if lookups != 2 {
+		t.Errorf("lookup ran %d times, want 2: it isn't side-effecting", lookups)
+	}
+
+	// Other arguments and other runs are other calls
+	toolbox.CallTools(ctx, []ToolCall{{Name: "charge", Args: `{"cents":200}`}})
+	toolbox.CallTools(ContextWithRunID(context.Background(), "run-2"), calls[:1])
+	if charges != 3 {
+		t.Errorf("charge ran %d times, want 3", charges)
+	}
+
+	// Outside a run, calls aren't guarded
+	toolbox.CallTools(context.Background(), calls[:1])
+	toolbox.CallTools(context.Background(), calls[:1])
+	if charges != 5 {
+		t.Errorf("charge ran %d times, want 5", charges)
+	}
+}
+
+func TestToolbox_SideEffecting_Failures(t *testing.T) {
+	var attempts int
+	toolbox := NewToolbox()
+	toolbox.Add(SideEffecting(NewFuncTool(ToolDefinition{Name: "send"}, func(ctx context.Context, args string) (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "", errors.New("smtp down")
+		}
+		return "sent", nil
+	})))
+	store := &failingCallStore{MemoryToolCallStore: NewMemoryToolCallStore()}
+	toolbox.SetToolCallStore(store)
+	toolbox.SetToolCallKey(func(ctx context.Context, call ToolCall) string { return call.Name })
+	ctx := context.Background()
+
+	// A failed call isn't recorded, so it runs again
+	if _, err := toolbox.Call(ctx, "send", "{}"); err == nil {
+		t.Fatal("first Call succeeded, want the tool's error")
+	}
+	if result, err := toolbox.Call(ctx, "send", "{}"); err != nil || result != "sent" {
+		t.Fatalf("Call = %q, %v, want sent", result, err)
+	}
+	if result, _ := toolbox.Call(ctx, "send", "{}"); result != "sent" || attempts != 2 {
+		t.Errorf("replay = %q after %d attempts, want the recorded result", result, attempts)
+	}
+
+	store.err = errors.New("store offline")
+	results, _ := toolbox.CallTools(ctx, []ToolCall{{Name: "send", Args: "{}"}})
+	if !strings.Contains(results[0].Result, "store offline") || attempts != 2 {
+		t.Errorf("result = %q, want the store's error without calling the tool", results[0].Result)
+	}
+}
+
+func TestToolbox_SideEffecting_PutFails(t *testing.T) {
+	var attempts int
+	toolbox := NewToolbox()
+	toolbox.Add(SideEffecting(NewFuncTool(ToolDefinition{Name: "send"}, func(ctx context.Context, args string) (string, error) {
+		attempts++
+		return "sent", nil
+	})))
+	store := &failingCallStore{MemoryToolCallStore: NewMemoryToolCallStore(), putErr: errors.New("store offline")}
+	toolbox.SetToolCallStore(store)
+	toolbox.SetToolCallKey(func(ctx context.Context, call ToolCall) string { return call.Name })
+
+	if _, err := toolbox.Call(context.Background(), "send", "{}"); err == nil || !strings.Contains(err.Error(), "store offline") {
+		t.Fatalf("Call error = %v, want the store's error", err)
+	}
+
+	// The claim was released, so the next call isn't left waiting on it
+	store.putErr = nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if result, err := toolbox.Call(ctx, "send", "{}"); err != nil || result != "sent" || attempts != 2 {
+		t.Errorf("Call = %q, %v after %d attempts, want the tool run again", result, err, attempts)
+	}
+}
+
+func TestToolbox_SideEffecting_Concurrent(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	toolbox := NewToolbox()
+	toolbox.Add(SideEffecting(NewFuncTool(ToolDefinition{Name: "charge"}, func(ctx context.Context, args string) (string, error) {
+		n := calls.Add(1)
+		<-release
+		return fmt.Sprintf("charge #%d", n), nil
+	})))
+	toolbox.SetToolCallStore(NewMemoryToolCallStore())
+	ctx := ContextWithRunID(context.Background(), "run-1")
+
+	results := make(chan string, 2)
+	for range 2 {
+		go func() {
+			result, _ := toolbox.Call(ctx, "charge", `{"cents":100}`)
+			results <- result
+		}()
+	}
+
+	// The second call waits for the first instead of charging again
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for range 2 {
+		if result := <-results; result != "charge #1" {
+			t.Errorf("result = %q, want the first call's", result)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("charge ran %d times, want once", n)
+	}
+}
+
+func TestMemoryToolCallStore_ClaimWaitCanceled(t *testing.T) {
+	store := NewMemoryToolCallStore()
+	ctx := context.Background()
+	if _, done, err := store.Claim(ctx, "k"); done || err != nil {
+		t.Fatalf("Claim = %v, %v, want the claim", done, err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := store.Claim(waitCtx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Claim error = %v, want the deadline while the key is claimed", err)
+	}
+
+	// A released key can be claimed again
+	store.Release(ctx, "k")
+	if _, done, err := store.Claim(ctx, "k"); done || err != nil {
+		t.Errorf("Claim after Release = %v, %v, want the claim", done, err)
+	}
+}
+
+type failingCallStore struct {
+	*MemoryToolCallStore
+	err    error
+	putErr error
+}
+
+func (s *failingCallStore) Put(ctx context.Context, key, result string) error {
+	if s.putErr != nil {
+		return s.putErr
+	}
+	return s.MemoryToolCallStore.Put(ctx, key, result)
+}
+
+func (s *failingCallStore) Claim(ctx context.Context, key string) (string, bool, error) {
+	if s.err != nil {
+		return "", false, s.err
+	}
+	return s.MemoryToolCallStore.Claim(ctx, key)
+}
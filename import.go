@@ -0,0 +1,243 @@
+package modelsocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ImportMessages parses a conversation stored by another SDK into history
+// that [Client.Replay] can recreate, so existing conversations can move to
+// ModelSocket. It reads the JSON formats [ExportMessages] writes:
+//
+//   - ExportOpenAI: an array of chat completion messages, or a request
+//     body with a "messages" field. "developer" messages count as system
+//     messages.
+//   - ExportAnthropic: a Messages API object with "system" and
+//     "messages", or an array of messages.
+//   - ExportJSONL: one [Message] per line.
+//
+// Consecutive tool results are merged into one tool message, as
+// [Seq.ToolReturn] records them, and named after the calls they answer.
+// Content other than text, tool calls and tool results, such as images, is
+// skipped. Markdown can't be imported and fails with [ErrNotSupported].
+func ImportMessages(format ExportFormat, data []byte) ([]Message, error) {
+	switch format {
+	case ExportOpenAI:
+		return importOpenAI(data)
+	case ExportAnthropic:
+		return importAnthropic(data)
+	case ExportJSONL:
+		return importJSONL(data)
+	case ExportMarkdown:
+		return nil, fmt.Errorf("%w: importing %s", ErrNotSupported, format)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrExportFormat, format)
+}
+
+// importedHistory builds imported history, merging consecutive tool results
+// and naming them after their calls.
+type importedHistory struct {
+	messages  []Message
+	callNames map[string]string // Tool call ID to tool name
+}
+
+func (h *importedHistory) add(msg Message) {
+	if msg.Text == "" && len(msg.ToolCalls) == 0 {
+		return
+	}
+	h.messages = append(h.messages, msg)
+}
+
+func (h *importedHistory) call(id string, call ToolCall) ToolCall {
+	if h.callNames == nil {
+		h.callNames = make(map[string]string)
+	}
+	h.callNames[id] = call.Name
+	return call
+}
+
+func (h *importedHistory) result(callID, result string) {
+	tr := ToolResult{Name: h.callNames[callID], Result: result}
+	if n := len(h.messages); n > 0 && len(h.messages[n-1].ToolResults) > 0 {
+		h.messages[n-1] = toolResultsMessage(append(h.messages[n-1].ToolResults, tr))
+		return
+	}
+	h.messages = append(h.messages, toolResultsMessage([]ToolResult{tr}))
+}
+
+func importOpenAI(data []byte) ([]Message, error) {
+	type openAIImport struct {
+		Role       string          `json:"role"`
+		Content    json.RawMessage `json:"content"`
+		ToolCallID string          `json:"tool_call_id"`
+		ToolCalls  []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	}
+
+	var msgs []openAIImport
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var body struct {
+			Messages []openAIImport `json:"messages"`
+		}
+		if err := json.Unmarshal(trimmed, &body); err != nil {
+			return nil, fmt.Errorf("modelsocket: importing %s: %w", ExportOpenAI, err)
+		}
+		msgs = body.Messages
+	} else if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, fmt.Errorf("modelsocket: importing %s: %w", ExportOpenAI, err)
+	}
+
+	var h importedHistory
+	for i, m := range msgs {
+		text, err := contentText(m.Content)
+		if err != nil {
+			return nil, fmt.Errorf("modelsocket: importing %s message %d: %w", ExportOpenAI, i, err)
+		}
+
+		switch m.Role {
+		case "tool", "function":
+			h.result(m.ToolCallID, text)
+		case "system", "developer":
+			h.add(Message{Role: RoleSystem, Text: text})
+		case "assistant":
+			msg := Message{Role: RoleAssistant, Text: text}
+			for _, tc := range m.ToolCalls {
+				msg.ToolCalls = append(msg.ToolCalls, h.call(tc.ID, ToolCall{Name: tc.Function.Name, Args: tc.Function.Arguments}))
+			}
+			h.add(msg)
+		default:
+			h.add(Message{Role: RoleUser, Text: text})
+		}
+	}
+	return h.messages, nil
+}
+
+func importAnthropic(data []byte) ([]Message, error) {
+	type anthropicImport struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	var body struct {
+		System   json.RawMessage   `json:"system"`
+		Messages []anthropicImport `json:"messages"`
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &body.Messages); err != nil {
+			return nil, fmt.Errorf("modelsocket: importing %s: %w", ExportAnthropic, err)
+		}
+	} else if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("modelsocket: importing %s: %w", ExportAnthropic, err)
+	}
+
+	var h importedHistory
+	system, err := contentText(body.System)
+	if err != nil {
+		return nil, fmt.Errorf("modelsocket: importing %s system: %w", ExportAnthropic, err)
+	}
+	h.add(Message{Role: RoleSystem, Text: system})
+
+	for i, m := range body.Messages {
+		blocks, err := contentBlocks(m.Content)
+		if err != nil {
+			return nil, fmt.Errorf("modelsocket: importing %s message %d: %w", ExportAnthropic, i, err)
+		}
+
+		role := RoleUser
+		if m.Role == "assistant" {
+			role = RoleAssistant
+		}
+		msg := Message{Role: role}
+		var texts []string
+		for _, b := range blocks {
+			switch b.Type {
+			case "text":
+				texts = append(texts, b.Text)
+			case "tool_use":
+				args := string(b.Input)
+				if args == "" {
+					args = "{}"
+				}
+				msg.ToolCalls = append(msg.ToolCalls, h.call(b.ID, ToolCall{Name: b.Name, Args: args}))
+			case "tool_result":
+				result, err := contentText(b.Content)
+				if err != nil {
+					return nil, fmt.Errorf("modelsocket: importing %s message %d: %w", ExportAnthropic, i, err)
+				}
+				h.result(b.ToolUseID, result)
+			}
+		}
+		msg.Text = strings.Join(texts, "\n")
+		h.add(msg)
+	}
+	return h.messages, nil
+}
+
+func importJSONL(data []byte) ([]Message, error) {
+	var msgs []Message
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("modelsocket: importing %s line %d: %w", ExportJSONL, line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, scanner.Err()
+}
+
+// importBlock is a content block of an imported message.
+type importBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+}
+
+// contentBlocks parses message content that is either a string or an array
+// of blocks. A string becomes one text block.
+func contentBlocks(raw json.RawMessage) ([]importBlock, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []importBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []importBlock
+	err := json.Unmarshal(raw, &blocks)
+	return blocks, err
+}
+
+// contentText returns the text of message content, joining its text blocks.
+func contentText(raw json.RawMessage) (string, error) {
+	blocks, err := contentBlocks(raw)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, b := range blocks {
+		if b.Type == "text" {
+			texts = append(texts, b.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
@@ -0,0 +1,100 @@
+package modelsocket
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestImportMessages_RoundTrip(t *testing.T) {
+	want := []Message{
+		{Role: RoleSystem, Text: "Be brief."},
+		{Role: RoleUser, Text: "Weather in Paris?"},
+		{Role: RoleAssistant, Text: "Checking.", ToolCalls: []ToolCall{{Name: "get_weather", Args: `{"city":"Paris"}`}}},
+		toolResultsMessage([]ToolResult{{Name: "get_weather", Result: "sunny"}}),
+		{Role: RoleAssistant, Text: "Sunny."},
+	}
+
+	for _, format := range []ExportFormat{ExportOpenAI, ExportAnthropic, ExportJSONL} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := ExportMessages(want, format)
+			if err != nil {
+				t.Fatalf("ExportMessages error: %v", err)
+			}
+			got, err := ImportMessages(format, data)
+			if err != nil {
+				t.Fatalf("ImportMessages error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("imported %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestImportMessages_OpenAI(t *testing.T) {
+	data := []byte(`{"model": "gpt-4o", "messages": [
+		{"role": "developer", "content": "Be brief."},
+		{"role": "user", "content": [{"type": "text", "text": "Compare"}, {"type": "image_url", "image_url": {"url": "x"}}]},
+		{"role": "assistant", "content": null, "tool_calls": [
+			{"id": "a", "type": "function", "function": {"name": "f", "arguments": "{}"}},
+			{"id": "b", "type": "function", "function": {"name": "g", "arguments": "{}"}}
+		]},
+		{"role": "tool", "tool_call_id": "b", "content": "from g"},
+		{"role": "tool", "tool_call_id": "a", "content": "from f"}
+	]}`)
+
+	got, err := ImportMessages(ExportOpenAI, data)
+	if err != nil {
+		t.Fatalf("ImportMessages error: %v", err)
+	}
+	if len(got) != 4 || got[0].Role != RoleSystem || got[1].Text != "Compare" || len(got[2].ToolCalls) != 2 {
+		t.Fatalf("imported %+v", got)
+	}
+	// The tool messages are one tool return, named after their calls
+	results := []ToolResult{{Name: "g", Result: "from g"}, {Name: "f", Result: "from f"}}
+	if !reflect.DeepEqual(got[3].ToolResults, results) {
+		t.Errorf("results = %+v, want %+v", got[3].ToolResults, results)
+	}
+}
+
+func TestImportMessages_Anthropic(t *testing.T) {
+	data := []byte(`{
+		"system": [{"type": "text", "text": "Be brief."}],
+		"messages": [
+			{"role": "user", "content": "Weather?"},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "t1", "name": "get_weather", "input": {"city": "Paris"}}]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "t1", "content": [{"type": "text", "text": "sunny"}]},
+				{"type": "text", "text": "And tomorrow?"}
+			]}
+		]
+	}`)
+
+	got, err := ImportMessages(ExportAnthropic, data)
+	if err != nil {
+		t.Fatalf("ImportMessages error: %v", err)
+	}
+	want := []Message{
+		{Role: RoleSystem, Text: "Be brief."},
+		{Role: RoleUser, Text: "Weather?"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{Name: "get_weather", Args: `{"city": "Paris"}`}}},
+		toolResultsMessage([]ToolResult{{Name: "get_weather", Result: "sunny"}}),
+		{Role: RoleUser, Text: "And tomorrow?"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %+v, want %+v", got, want)
+	}
+}
+
+func TestImportMessages_Errors(t *testing.T) {
+	if _, err := ImportMessages(ExportMarkdown, []byte("## User")); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("markdown error = %v, want ErrNotSupported", err)
+	}
+	if _, err := ImportMessages("yaml", nil); !errors.Is(err, ErrExportFormat) {
+		t.Errorf("unknown format error = %v, want ErrExportFormat", err)
+	}
+	if _, err := ImportMessages(ExportOpenAI, []byte(`[{"role": "user", "content": 7}]`)); err == nil {
+		t.Error("invalid content imported without error")
+	}
+}
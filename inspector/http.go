@@ -0,0 +1,58 @@
+package inspector
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+//go:embed ui.html
+var uiHTML []byte
+
+// ServeHTTP serves the web UI at / and its data under /api/.
+func (ins *Inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ins.mux.ServeHTTP(w, r)
+}
+
+// serveUI serves the web UI.
+func (ins *Inspector) serveUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiHTML)
+}
+
+// serveSequences serves the recorded sequences as JSON.
+func (ins *Inspector) serveSequences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ins.Sequences())
+}
+
+// serveUpdates sends a server-sent event whenever the recorded sequences
+// change. Bursts of changes, such as streamed tokens, are coalesced.
+func (ins *Inspector) serveUpdates(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := ins.subscribe()
+	defer ins.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			if _, err := fmt.Fprint(w, "event: update\ndata: {}\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
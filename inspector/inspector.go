@@ -0,0 +1,346 @@
+// Package inspector is a small devtools for ModelSocket clients. An
+// Inspector watches a live client's traffic through its hooks and serves a
+// local web UI showing its sequences, streaming generations, tool calls and
+// timings.
+//
+//	ins := inspector.New()
+//	client, err := modelsocket.Connect(ctx, url, apiKey, ins.ClientOptions()...)
+//	go http.ListenAndServe("localhost:7070", ins)
+package inspector
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// Option configures an Inspector.
+type Option func(*config)
+
+type config struct {
+	history int
+}
+
+// WithHistory sets how many closed sequences are kept. Defaults to 100.
+func WithHistory(n int) Option {
+	return func(c *config) {
+		c.history = n
+	}
+}
+
+// Sequence is a sequence as seen by the inspector.
+type Sequence struct {
+	ID       string                `json:"id"`
+	Model    string                `json:"model"`
+	State    modelsocket.SeqState  `json:"state"`
+	Opened   time.Time             `json:"opened"`
+	Closed   *time.Time            `json:"closed,omitempty"`
+	Error    string                `json:"error,omitempty"`
+	Messages []modelsocket.Message `json:"messages"`
+	Gens     []*Generation         `json:"generations"`
+
+	// Totals reported when the sequence closed
+	InputTokens  int   `json:"input_tokens,omitempty"`
+	OutputTokens int   `json:"output_tokens,omitempty"`
+	DurationMs   int64 `json:"duration_ms,omitempty"`
+}
+
+// Generation is a generation or tool return as seen by the inspector.
+type Generation struct {
+	CID          string                 `json:"cid"`
+	Command      string                 `json:"command"`
+	Text         string                 `json:"text"`
+	ToolCalls    []modelsocket.ToolCall `json:"tool_calls,omitempty"`
+	Started      time.Time              `json:"started"`
+	FirstToken   *time.Time             `json:"first_token,omitempty"`
+	Finished     *time.Time             `json:"finished,omitempty"`
+	InputTokens  int                    `json:"input_tokens,omitempty"`
+	OutputTokens int                    `json:"output_tokens,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// Inspector records a client's sequences and serves them over HTTP. It is
+// safe for concurrent use.
+type Inspector struct {
+	cfg config
+	mux *http.ServeMux
+
+	mu     sync.Mutex
+	opens  map[string]string // model by pending seq_open cid
+	seqs   map[string]*Sequence
+	order  []string // sequence IDs, oldest first
+	closed int
+
+	subsMu sync.Mutex
+	subs   map[chan struct{}]struct{}
+}
+
+// New creates an Inspector.
+func New(opts ...Option) *Inspector {
+	cfg := config{history: 100}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ins := &Inspector{
+		cfg:   cfg,
+		mux:   http.NewServeMux(),
+		opens: make(map[string]string),
+		seqs:  make(map[string]*Sequence),
+		subs:  make(map[chan struct{}]struct{}),
+	}
+	ins.mux.HandleFunc("GET /{$}", ins.serveUI)
+	ins.mux.HandleFunc("GET /api/sequences", ins.serveSequences)
+	ins.mux.HandleFunc("GET /api/updates", ins.serveUpdates)
+	return ins
+}
+
+// ClientOptions returns the options that attach the inspector to a client.
+// They set the client's send and receive hooks; to keep hooks of your own,
+// call [Inspector.OnSend] and [Inspector.OnReceive] from them instead.
+func (ins *Inspector) ClientOptions() []modelsocket.ClientOption {
+	return []modelsocket.ClientOption{
+		modelsocket.WithOnSend(ins.OnSend),
+		modelsocket.WithOnReceive(ins.OnReceive),
+	}
+}
+
+// Sequences returns a copy of the recorded sequences, oldest first.
+func (ins *Inspector) Sequences() []*Sequence {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+
+	seqs := make([]*Sequence, 0, len(ins.order))
+	for _, id := range ins.order {
+		seqs = append(seqs, ins.seqs[id].clone())
+	}
+	return seqs
+}
+
+// OnSend records a request sent by the client.
+func (ins *Inspector) OnSend(req *modelsocket.MSRequest) {
+	cmd := decodeCommand(req)
+
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+
+	if req.Request == "seq_open" {
+		ins.opens[req.CID] = cmd.Model
+		return
+	}
+
+	seq, ok := ins.seqs[req.SeqID]
+	if !ok {
+		return
+	}
+
+	switch cmd.Command {
+	case "append":
+		seq.Messages = append(seq.Messages, modelsocket.Message{Role: modelsocket.Role(cmd.Role), Text: cmd.Text})
+	case "gen", "tool_return":
+		if cmd.Command == "tool_return" {
+			seq.Messages = append(seq.Messages, modelsocket.Message{Role: modelsocket.RoleTool, Text: string(cmd.Results)})
+		}
+		seq.Gens = append(seq.Gens, &Generation{
+			CID:     req.CID,
+			Command: cmd.Command,
+			Started: time.Now(),
+		})
+	default:
+		return
+	}
+	ins.notify()
+}
+
+// OnReceive records an event received by the client.
+func (ins *Inspector) OnReceive(event *modelsocket.MSEvent) {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+
+	if event.IsSeqOpened() {
+		ins.opened(event)
+		ins.notify()
+		return
+	}
+
+	seq, ok := ins.seqs[event.SeqID]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case event.IsSeqState():
+		seq.State = event.State
+
+	case event.IsSeqText():
+		if gen := seq.running(); gen != nil {
+			if gen.FirstToken == nil {
+				gen.FirstToken = &now
+			}
+			gen.Text += event.Text
+		}
+
+	case event.IsSeqToolCall():
+		if gen := seq.running(); gen != nil {
+			for _, call := range event.ToolCalls {
+				gen.ToolCalls = append(gen.ToolCalls, modelsocket.ToolCall{Name: call.Name, Args: call.Args})
+			}
+		}
+
+	case event.IsSeqGenFinish():
+		if gen := seq.generation(event.CID); gen != nil {
+			gen.Finished = &now
+			gen.InputTokens = event.InputTokens
+			gen.OutputTokens = event.OutputTokens
+		}
+
+	case event.IsSeqForkFinish():
+		ins.forked(seq, event.ChildSeqID)
+
+	case event.IsError():
+		if gen := seq.generation(event.CID); gen != nil && gen.Finished == nil {
+			gen.Finished = &now
+			gen.Error = event.Message
+		}
+
+	case event.IsSeqClosed():
+		seq.State = modelsocket.StateClosed
+		seq.Closed = &now
+		seq.Error = event.ErrorMsg
+		seq.InputTokens = event.InputTokens
+		seq.OutputTokens = event.OutputTokens
+		seq.DurationMs = event.DurationMs
+		ins.closed++
+		ins.prune()
+
+	default:
+		return
+	}
+	ins.notify()
+}
+
+// opened records a newly opened sequence.
+func (ins *Inspector) opened(event *modelsocket.MSEvent) {
+	model := ins.opens[event.CID]
+	delete(ins.opens, event.CID)
+	ins.add(&Sequence{
+		ID:     event.SeqID,
+		Model:  model,
+		State:  modelsocket.StateReady,
+		Opened: time.Now(),
+	})
+}
+
+// forked records a fork of seq, which starts with its messages.
+func (ins *Inspector) forked(seq *Sequence, childID string) {
+	ins.add(&Sequence{
+		ID:       childID,
+		Model:    seq.Model,
+		State:    modelsocket.StateReady,
+		Opened:   time.Now(),
+		Messages: slices.Clone(seq.Messages),
+	})
+}
+
+func (ins *Inspector) add(seq *Sequence) {
+	ins.seqs[seq.ID] = seq
+	ins.order = append(ins.order, seq.ID)
+}
+
+// prune drops the oldest closed sequences beyond the history limit.
+func (ins *Inspector) prune() {
+	for i := 0; ins.closed > ins.cfg.history && i < len(ins.order); {
+		id := ins.order[i]
+		if ins.seqs[id].Closed == nil {
+			i++
+			continue
+		}
+		delete(ins.seqs, id)
+		ins.order = slices.Delete(ins.order, i, i+1)
+		ins.closed--
+	}
+}
+
+// notify wakes subscribers to updates without blocking.
+func (ins *Inspector) notify() {
+	ins.subsMu.Lock()
+	defer ins.subsMu.Unlock()
+	for ch := range ins.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (ins *Inspector) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	ins.subsMu.Lock()
+	ins.subs[ch] = struct{}{}
+	ins.subsMu.Unlock()
+	return ch
+}
+
+func (ins *Inspector) unsubscribe(ch chan struct{}) {
+	ins.subsMu.Lock()
+	delete(ins.subs, ch)
+	ins.subsMu.Unlock()
+}
+
+// running returns the generation still in progress, if any.
+func (s *Sequence) running() *Generation {
+	for i := len(s.Gens) - 1; i >= 0; i-- {
+		if s.Gens[i].Finished == nil {
+			return s.Gens[i]
+		}
+	}
+	return nil
+}
+
+// generation returns the generation started with cid.
+func (s *Sequence) generation(cid string) *Generation {
+	for _, gen := range s.Gens {
+		if gen.CID == cid {
+			return gen
+		}
+	}
+	return nil
+}
+
+// clone copies the sequence deeply enough to be read without the lock.
+func (s *Sequence) clone() *Sequence {
+	c := *s
+	c.Messages = slices.Clone(s.Messages)
+	c.Gens = make([]*Generation, len(s.Gens))
+	for i, gen := range s.Gens {
+		g := *gen
+		g.ToolCalls = slices.Clone(gen.ToolCalls)
+		c.Gens[i] = &g
+	}
+	return &c
+}
+
+// command is the part of a request the inspector reads.
+type command struct {
+	Model   string          `json:"model"`
+	Command string          `json:"command"`
+	Role    string          `json:"role"`
+	Text    string          `json:"text"`
+	Results json.RawMessage `json:"results"`
+}
+
+// decodeCommand reads a request's data. Data built by the client is a
+// typed value, so it goes through JSON.
+func decodeCommand(req *modelsocket.MSRequest) command {
+	var cmd command
+	data, err := json.Marshal(req.Data)
+	if err == nil {
+		json.Unmarshal(data, &cmd)
+	}
+	return cmd
+}
@@ -0,0 +1,149 @@
+package inspector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// session feeds ins the traffic of a sequence that is opened, prompted,
+// generates a tool call and is closed.
+func session(ins *Inspector, seqID string) {
+	ins.OnSend(modelsocket.NewSeqOpenRequest("open-"+seqID, modelsocket.SeqOpenData{Model: "m1"}))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_opened", CID: "open-" + seqID, SeqID: seqID})
+
+	ins.OnSend(modelsocket.NewAppendRequest("a1", seqID, modelsocket.SeqAppendData{Text: "Weather?", Role: "user"}))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_append_finish", CID: "a1", SeqID: seqID})
+
+	ins.OnSend(modelsocket.NewGenRequest("g1", seqID, modelsocket.SeqGenData{}))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_state", SeqID: seqID, State: modelsocket.StateGenerating})
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_text", SeqID: seqID, Text: "Let me "})
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_text", SeqID: seqID, Text: "check."})
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_tool_call", SeqID: seqID, ToolCalls: []modelsocket.SeqToolCall{{Name: "weather", Args: "{}"}}})
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_gen_finish", CID: "g1", SeqID: seqID, InputTokens: 10, OutputTokens: 4})
+
+	ins.OnSend(modelsocket.NewCloseRequest("c1", seqID))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_closed", CID: "c1", SeqID: seqID, InputTokens: 14, OutputTokens: 4, DurationMs: 50})
+}
+
+func TestInspector_Records(t *testing.T) {
+	ins := New()
+	session(ins, "s1")
+
+	seqs := ins.Sequences()
+	if len(seqs) != 1 {
+		t.Fatalf("len(Sequences) = %d, want 1", len(seqs))
+	}
+
+	seq := seqs[0]
+	if seq.ID != "s1" || seq.Model != "m1" || seq.State != modelsocket.StateClosed || seq.Closed == nil {
+		t.Errorf("seq = %+v", seq)
+	}
+	if seq.OutputTokens != 4 || seq.DurationMs != 50 {
+		t.Errorf("totals = %d tokens, %dms", seq.OutputTokens, seq.DurationMs)
+	}
+	if len(seq.Messages) != 1 || seq.Messages[0].Text != "Weather?" || seq.Messages[0].Role != modelsocket.RoleUser {
+		t.Errorf("messages = %+v", seq.Messages)
+	}
+
+	if len(seq.Gens) != 1 {
+		t.Fatalf("len(Gens) = %d, want 1", len(seq.Gens))
+	}
+	gen := seq.Gens[0]
+	if gen.Text != "Let me check." || gen.FirstToken == nil || gen.Finished == nil || gen.OutputTokens != 4 {
+		t.Errorf("gen = %+v", gen)
+	}
+	if len(gen.ToolCalls) != 1 || gen.ToolCalls[0].Name != "weather" {
+		t.Errorf("tool calls = %+v", gen.ToolCalls)
+	}
+}
+
+func TestInspector_GenerationError(t *testing.T) {
+	ins := New()
+	ins.OnSend(modelsocket.NewSeqOpenRequest("o1", modelsocket.SeqOpenData{Model: "m1"}))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_opened", CID: "o1", SeqID: "s1"})
+	ins.OnSend(modelsocket.NewGenRequest("g1", "s1", modelsocket.SeqGenData{}))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "error", CID: "g1", SeqID: "s1", Message: "overloaded"})
+
+	gen := ins.Sequences()[0].Gens[0]
+	if gen.Error != "overloaded" || gen.Finished == nil {
+		t.Errorf("gen = %+v, want error", gen)
+	}
+}
+
+func TestInspector_Fork(t *testing.T) {
+	ins := New()
+	ins.OnSend(modelsocket.NewSeqOpenRequest("o1", modelsocket.SeqOpenData{Model: "m1"}))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_opened", CID: "o1", SeqID: "s1"})
+	ins.OnSend(modelsocket.NewAppendRequest("a1", "s1", modelsocket.SeqAppendData{Text: "Hi"}))
+	ins.OnReceive(&modelsocket.MSEvent{Event: "seq_fork_finish", CID: "f1", SeqID: "s1", ChildSeqID: "s2"})
+
+	seqs := ins.Sequences()
+	if len(seqs) != 2 || seqs[1].ID != "s2" || seqs[1].Model != "m1" || len(seqs[1].Messages) != 1 {
+		t.Errorf("seqs = %+v, want the fork with the parent's messages", seqs)
+	}
+}
+
+func TestInspector_History(t *testing.T) {
+	ins := New(WithHistory(2))
+	for _, id := range []string{"s1", "s2", "s3"} {
+		session(ins, id)
+	}
+
+	seqs := ins.Sequences()
+	if len(seqs) != 2 || seqs[0].ID != "s2" || seqs[1].ID != "s3" {
+		t.Errorf("seqs = %d, want the 2 most recent", len(seqs))
+	}
+}
+
+func TestInspector_HTTP(t *testing.T) {
+	ins := New()
+	srv := httptest.NewServer(ins)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / error: %v", err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("Content-Type = %s, want text/html", resp.Header.Get("Content-Type"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/updates", nil)
+	updates, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/updates error: %v", err)
+	}
+	defer updates.Body.Close()
+
+	session(ins, "s1")
+
+	line, err := bufio.NewReader(updates.Body).ReadString('\n')
+	if err != nil || line != "event: update\n" {
+		t.Errorf("update = %q, %v", line, err)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/sequences")
+	if err != nil {
+		t.Fatalf("GET /api/sequences error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var seqs []Sequence
+	if err := json.NewDecoder(resp.Body).Decode(&seqs); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(seqs) != 1 || seqs[0].Gens[0].Text != "Let me check." {
+		t.Errorf("seqs = %+v", seqs)
+	}
+}
@@ -0,0 +1,334 @@
+// Package mstest provides an in-process ModelSocket server for testing
+// packages built on the client.
+//
+// Unlike the scripted scenarios the client's own tests use, a [Server]
+// answers whatever it is sent, so it suits tests that run many sequences
+// concurrently. It keeps each sequence's appended text, answers forks with a
+// copy of it, and hands generations to a handler:
+//
+//	srv := mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+//		return mstest.Reply("echo: " + g.Prompt())
+//	})
+//	client := modelsocket.NewWithTransport(ctx, srv)
+package mstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// Gen is a generation the server has been asked for: a gen command, or a
+// tool_return continuing one.
+type Gen struct {
+	SeqID string
+	CID   string
+
+	// Model and Tools are what the sequence was opened with.
+	Model string
+	Tools bool
+
+	// Appended holds the text appended to the sequence, including any
+	// appended before it was forked.
+	Appended []modelsocket.SeqAppendData
+
+	// Data holds the gen command's options, or the options a tool_return
+	// continues with.
+	Data modelsocket.SeqGenData
+
+	// Results are the tool results of a tool_return, and nil for a gen
+	// command.
+	Results []modelsocket.ToolResult
+}
+
+// Texts returns the text appended to the sequence.
+func (g *Gen) Texts() []string {
+	texts := make([]string, len(g.Appended))
+	for i, a := range g.Appended {
+		texts[i] = a.Text
+	}
+	return texts
+}
+
+// Prompt returns the text appended to the sequence last, or "" if there
+// is none.
+func (g *Gen) Prompt() string {
+	return lastText(g.Appended)
+}
+
+// Handler answers a generation with the events to send back. The server
+// fills in the CID and SeqID of events that leave them empty. A handler that
+// returns nil can answer later with [Server.Reply].
+type Handler func(g *Gen) []*modelsocket.MSEvent
+
+// Server is an in-process ModelSocket server. It implements
+// [modelsocket.Transport], so a client is connected to it with
+// [modelsocket.NewWithTransport]. Sequences are named "seq-1", "seq-2" and
+// so on, in the order they are opened or forked.
+type Server struct {
+	// Score answers score commands with the log probability of text
+	// following the sequence's prompt. If nil, every text scores 0.
+	Score func(prompt, text string) float64
+
+	handler Handler
+	events  chan *modelsocket.MSEvent
+
+	mu       sync.Mutex
+	seqs     map[string]*seqState
+	next     int
+	opened   int
+	open     int
+	maxOpen  int
+	forks    int
+	closed   int
+	models   []string
+	appended []modelsocket.SeqAppendData
+	gens     []modelsocket.SeqGenData
+}
+
+// seqState is what the server keeps for a sequence.
+type seqState struct {
+	model    string
+	tools    bool
+	appended []modelsocket.SeqAppendData
+}
+
+// NewServer returns a server that answers generations with handler. Handlers
+// are called one at a time.
+func NewServer(handler Handler) *Server {
+	return &Server{
+		handler: handler,
+		events:  make(chan *modelsocket.MSEvent, 1000),
+		seqs:    make(map[string]*seqState),
+	}
+}
+
+// command is the union of the fields of the commands the server answers.
+type command struct {
+	Command      string                   `json:"command"`
+	Text         string                   `json:"text"`
+	Model        string                   `json:"model"`
+	ToolsEnabled bool                     `json:"tools_enabled"`
+	Results      []modelsocket.ToolResult `json:"results"`
+	GenOpts      modelsocket.SeqGenData   `json:"gen_opts"`
+}
+
+// Send answers a request. Commands the server doesn't know, such as cancel,
+// go unanswered.
+func (s *Server) Send(ctx context.Context, req *modelsocket.MSRequest) error {
+	raw, err := json.Marshal(req.Data)
+	if err != nil {
+		return err
+	}
+	var cmd command
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.seqs[req.SeqID]
+	switch {
+	case req.Request == "seq_open":
+		seqID := s.newSeq(&seqState{model: cmd.Model, tools: cmd.ToolsEnabled})
+		s.opened++
+		s.models = append(s.models, cmd.Model)
+		s.push(req, &modelsocket.MSEvent{Event: "seq_opened", SeqID: seqID})
+	case seq == nil:
+		s.push(req, Error(fmt.Sprintf("unknown sequence %q", req.SeqID)))
+	case cmd.Command == "append":
+		var data modelsocket.SeqAppendData
+		json.Unmarshal(raw, &data)
+		seq.appended = append(seq.appended, data)
+		s.appended = append(s.appended, data)
+		s.push(req, &modelsocket.MSEvent{Event: "seq_append_finish"})
+	case cmd.Command == "gen":
+		var data modelsocket.SeqGenData
+		json.Unmarshal(raw, &data)
+		s.gens = append(s.gens, data)
+		s.generate(req, seq, data, nil)
+	case cmd.Command == "tool_return":
+		s.generate(req, seq, cmd.GenOpts, cmd.Results)
+	case cmd.Command == "score":
+		var logprob float64
+		if s.Score != nil {
+			logprob = s.Score(lastText(seq.appended), cmd.Text)
+		}
+		s.push(req, &modelsocket.MSEvent{Event: "seq_score_finish", LogProb: logprob})
+	case cmd.Command == "fork":
+		child := s.newSeq(&seqState{model: seq.model, tools: seq.tools, appended: slices.Clone(seq.appended)})
+		s.forks++
+		s.push(req, &modelsocket.MSEvent{Event: "seq_fork_finish", ChildSeqID: child})
+	case cmd.Command == "close":
+		s.open--
+		s.closed++
+		s.push(req, &modelsocket.MSEvent{Event: "seq_closed"})
+	}
+	return nil
+}
+
+// newSeq adds a sequence and returns its ID. Called with s.mu held.
+func (s *Server) newSeq(seq *seqState) string {
+	s.next++
+	seqID := fmt.Sprintf("seq-%d", s.next)
+	s.seqs[seqID] = seq
+	s.open++
+	s.maxOpen = max(s.maxOpen, s.open)
+	return seqID
+}
+
+// generate hands a generation to the handler and sends its answer. Called
+// with s.mu held.
+func (s *Server) generate(req *modelsocket.MSRequest, seq *seqState, data modelsocket.SeqGenData, results []modelsocket.ToolResult) {
+	g := &Gen{
+		SeqID:    req.SeqID,
+		CID:      req.CID,
+		Model:    seq.model,
+		Tools:    seq.tools,
+		Appended: slices.Clone(seq.appended),
+		Data:     data,
+		Results:  results,
+	}
+	s.push(req, s.handler(g)...)
+}
+
+// Reply answers g with events, for handlers that answer later.
+func (s *Server) Reply(g *Gen, events ...*modelsocket.MSEvent) {
+	s.push(&modelsocket.MSRequest{CID: g.CID, SeqID: g.SeqID}, events...)
+}
+
+// push sends events in answer to req, filling in its CID and SeqID where
+// they are empty.
+func (s *Server) push(req *modelsocket.MSRequest, events ...*modelsocket.MSEvent) {
+	for _, event := range events {
+		reply := *event
+		if reply.CID == "" {
+			reply.CID = req.CID
+		}
+		if reply.SeqID == "" {
+			reply.SeqID = req.SeqID
+		}
+		s.events <- &reply
+	}
+}
+
+// Receive returns the next event the server sends.
+func (s *Server) Receive(ctx context.Context) (*modelsocket.MSEvent, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case event := <-s.events:
+		return event, nil
+	}
+}
+
+// Close does nothing; the server has no connection to close.
+func (s *Server) Close() error { return nil }
+
+// Opened returns how many sequences have been opened, not counting forks.
+func (s *Server) Opened() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opened
+}
+
+// Forks returns how many sequences have been forked.
+func (s *Server) Forks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.forks
+}
+
+// Closed returns how many sequences have been closed.
+func (s *Server) Closed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// MaxOpen returns the most sequences that were open at once.
+func (s *Server) MaxOpen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxOpen
+}
+
+// Models returns the models sequences were opened with, in order.
+func (s *Server) Models() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.models)
+}
+
+// Appended returns the append commands the server has been sent, across
+// all sequences, in order.
+func (s *Server) Appended() []modelsocket.SeqAppendData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.appended)
+}
+
+// Texts returns the text appended to a sequence.
+func (s *Server) Texts(seqID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var texts []string
+	if seq := s.seqs[seqID]; seq != nil {
+		for _, a := range seq.appended {
+			texts = append(texts, a.Text)
+		}
+	}
+	return texts
+}
+
+// Gens returns the options of the gen commands the server has been sent,
+// in order.
+func (s *Server) Gens() []modelsocket.SeqGenData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.gens)
+}
+
+func lastText(appended []modelsocket.SeqAppendData) string {
+	if len(appended) == 0 {
+		return ""
+	}
+	return appended[len(appended)-1].Text
+}
+
+// Reply returns the events that stream texts and then finish the
+// generation.
+func Reply(texts ...string) []*modelsocket.MSEvent {
+	events := make([]*modelsocket.MSEvent, 0, len(texts)+1)
+	for _, text := range texts {
+		events = append(events, Text(text))
+	}
+	return append(events, Finish(0, 0))
+}
+
+// Text returns a seq_text event.
+func Text(text string) *modelsocket.MSEvent {
+	return &modelsocket.MSEvent{Event: "seq_text", Text: text}
+}
+
+// ToolCall returns a seq_tool_call event, after which the client is
+// expected to send a tool_return.
+func ToolCall(name, args string) *modelsocket.MSEvent {
+	return &modelsocket.MSEvent{Event: "seq_tool_call", ToolCalls: []modelsocket.SeqToolCall{{Name: name, Args: args}}}
+}
+
+// Finish returns the seq_gen_finish event that ends a generation, reporting
+// its token usage.
+func Finish(inputTokens, outputTokens int) *modelsocket.MSEvent {
+	return &modelsocket.MSEvent{Event: "seq_gen_finish", InputTokens: inputTokens, OutputTokens: outputTokens}
+}
+
+// Error returns an error event, which fails the command it answers.
+func Error(message string) *modelsocket.MSEvent {
+	return &modelsocket.MSEvent{Event: "error", Message: message}
+}
@@ -0,0 +1,71 @@
+package mstest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(func(g *Gen) []*modelsocket.MSEvent {
+		if g.Prompt() == "fail" {
+			return []*modelsocket.MSEvent{Error("overloaded")}
+		}
+		return Reply(g.Model+": ", strings.Join(g.Texts(), "|"))
+	})
+	client := modelsocket.NewWithTransport(ctx, srv)
+	defer client.Close(ctx)
+
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Append(ctx, "a", modelsocket.AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+
+	// Forks continue the parent's conversation
+	fork, err := seq.Fork(ctx)
+	if err != nil {
+		t.Fatalf("Fork error: %v", err)
+	}
+	if err := fork.Append(ctx, "b", modelsocket.AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	stream, err := fork.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if text, err := stream.Text(ctx); err != nil || text != "test-model: a|b" {
+		t.Errorf("Text = %q, %v, want the fork's conversation", text, err)
+	}
+	if err := fork.Close(ctx); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	if err := seq.Append(ctx, "fail", modelsocket.AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	stream, err = seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	var protoErr *modelsocket.ProtocolError
+	if _, err := stream.Text(ctx); !errors.As(err, &protoErr) || protoErr.Message != "overloaded" {
+		t.Errorf("Text error = %v, want the handler's error", err)
+	}
+
+	if got := strings.Join(srv.Texts("seq-1"), "|"); got != "a|fail" {
+		t.Errorf("Texts = %q, want the parent's appends only", got)
+	}
+	if srv.Opened() != 1 || srv.Forks() != 1 || srv.Closed() != 1 || srv.MaxOpen() != 2 {
+		t.Errorf("opened %d, forked %d, closed %d, max open %d, want 1, 1, 1, 2", srv.Opened(), srv.Forks(), srv.Closed(), srv.MaxOpen())
+	}
+	if len(srv.Gens()) != 2 || len(srv.Appended()) != 3 {
+		t.Errorf("%d gens and %d appends, want 2 and 3", len(srv.Gens()), len(srv.Appended()))
+	}
+}
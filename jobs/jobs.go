@@ -0,0 +1,468 @@
+// Package jobs runs generations in the background, for batch work that
+// shouldn't hold a caller's request open. Submit returns a job ID at once.
+// Worker goroutines run queued jobs over a pool of clients, and callers poll
+// for the result with Get or wait for it with Wait or Subscribe.
+//
+//	q, err := jobs.New([]*modelsocket.Client{client}, jobs.Options{Workers: 8})
+//	id, err := q.Submit(ctx, jobs.Job{Model: model, Prompt: "Summarize ..."})
+//	...
+//	info, err := q.Wait(ctx, id)
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/google/uuid"
+)
+
+// Defaults for Options.
+const (
+	DefaultWorkers   = 4
+	DefaultQueueSize = 1000
+	DefaultRetention = time.Hour
+)
+
+var (
+	// ErrNoClients is returned by New without clients.
+	ErrNoClients = errors.New("jobs: no clients")
+
+	// ErrNoModel is returned by Submit for a job without a model.
+	ErrNoModel = errors.New("jobs: job has no model")
+
+	// ErrQueueFull is returned by Submit when QueueSize jobs are waiting.
+	ErrQueueFull = errors.New("jobs: queue full")
+
+	// ErrClosed is returned by Submit after Close.
+	ErrClosed = errors.New("jobs: queue closed")
+
+	// ErrUnknownJob is returned for IDs that were never submitted or whose
+	// jobs were forgotten after Retention.
+	ErrUnknownJob = errors.New("jobs: unknown job")
+
+	// ErrCanceled is the error of a canceled job.
+	ErrCanceled = errors.New("jobs: job canceled")
+)
+
+// Job is a generation to run in the background.
+type Job struct {
+	// Model is the model the job's sequence is opened with.
+	Model string
+
+	// History, if set, is replayed onto the sequence first.
+	History []modelsocket.Message
+
+	// Prompt, if set, is appended as a user message before generating.
+	Prompt string
+
+	// CallbackURL, if set, receives the job's Payload when it finishes;
+	// see Options.Webhook.
+	CallbackURL string
+
+	OpenOptions []modelsocket.OpenOption
+	GenOptions  []modelsocket.GenOption
+}
+
+// Status is where a job is in the queue.
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+// Finished reports whether a job with the status has ended.
+func (s Status) Finished() bool {
+	return s == StatusDone || s == StatusFailed || s == StatusCanceled
+}
+
+// Info reports a job's status and, once it has finished, its outcome.
+type Info struct {
+	ID     string
+	Status Status
+
+	// Text is the generated text of a done job.
+	Text         string
+	InputTokens  int
+	OutputTokens int
+
+	// Err is why a job failed, or ErrCanceled.
+	Err error
+
+	Submitted time.Time
+	Started   time.Time
+	Finished  time.Time
+}
+
+// Options configures a Queue.
+type Options struct {
+	// Workers is how many jobs run at once, spread over the clients.
+	// Defaults to DefaultWorkers.
+	Workers int
+
+	// QueueSize is how many jobs can wait for a worker. Defaults to
+	// DefaultQueueSize.
+	QueueSize int
+
+	// Retention is how long finished jobs can be looked up. Defaults to
+	// DefaultRetention.
+	Retention time.Duration
+
+	// OnFinish, if set, is called with each job's final Info.
+	OnFinish func(Info)
+
+	// Webhook configures callback delivery for jobs with a CallbackURL.
+	// Without it, callbacks are unsigned and retried with the defaults.
+	Webhook *Webhook
+}
+
+// Queue runs submitted jobs on a pool of worker goroutines. It is safe for
+// concurrent use.
+type Queue struct {
+	clients []*modelsocket.Client
+	opts    Options
+	queue   chan *entry
+	next    atomic.Uint64 // Round-robin over clients
+
+	stop       context.Context // Canceled to abandon running jobs
+	halt       context.CancelFunc
+	wg         sync.WaitGroup
+	deliveries sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	closed  bool
+	drained bool // Set once Close has seen the workers stop
+}
+
+// entry is a submitted job. info is guarded by Queue.mu.
+type entry struct {
+	job    Job
+	ctx    context.Context
+	info   Info
+	cancel context.CancelFunc // Set while running
+	done   chan struct{}
+}
+
+// New starts a queue whose workers run jobs on clients, each job on the
+// next client in turn. Close it to stop the workers.
+func New(clients []*modelsocket.Client, opts Options) (*Queue, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoClients
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+
+	q := &Queue{
+		clients: clients,
+		opts:    opts,
+		queue:   make(chan *entry, opts.QueueSize),
+		jobs:    make(map[string]*entry),
+	}
+	q.stop, q.halt = context.WithCancel(context.Background())
+
+	q.wg.Add(opts.Workers)
+	for range opts.Workers {
+		go q.work()
+	}
+	return q, nil
+}
+
+// Submit queues job and returns its ID without waiting for it to run. The
+// job runs with ctx's values, such as a run ID, but isn't canceled with it;
+// use Cancel. Jobs without a run ID run under their job ID.
+func (q *Queue) Submit(ctx context.Context, job Job) (string, error) {
+	if job.Model == "" {
+		return "", ErrNoModel
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return "", ErrClosed
+	}
+	q.prune(time.Now())
+
+	id := uuid.NewString()
+	ctx = context.WithoutCancel(ctx)
+	if modelsocket.RunIDFromContext(ctx) == "" {
+		ctx = modelsocket.ContextWithRunID(ctx, id)
+	}
+	e := &entry{
+		job:  job,
+		ctx:  ctx,
+		info: Info{ID: id, Status: StatusQueued, Submitted: time.Now()},
+		done: make(chan struct{}),
+	}
+
+	select {
+	case q.queue <- e:
+	default:
+		return "", ErrQueueFull
+	}
+	q.jobs[id] = e
+	return id, nil
+}
+
+// Get returns the job's current Info.
+func (q *Queue) Get(id string) (Info, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.jobs[id]
+	if !ok {
+		return Info{}, ErrUnknownJob
+	}
+	return e.info, nil
+}
+
+// Wait waits for the job to finish and returns its final Info. The job's
+// own failure is reported in Info.Err; Wait's error is for unknown jobs and
+// ctx.
+func (q *Queue) Wait(ctx context.Context, id string) (Info, error) {
+	e, err := q.entry(id)
+	if err != nil {
+		return Info{}, err
+	}
+
+	select {
+	case <-e.done:
+		return q.Get(id)
+	case <-ctx.Done():
+		return Info{}, ctx.Err()
+	}
+}
+
+// Subscribe returns a channel that receives the job's final Info when it
+// finishes and is then closed.
+func (q *Queue) Subscribe(id string) (<-chan Info, error) {
+	e, err := q.entry(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Info, 1)
+	go func() {
+		<-e.done
+		q.mu.Lock()
+		ch <- e.info
+		q.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// Cancel cancels a queued or running job. Canceling a finished job does
+// nothing.
+func (q *Queue) Cancel(id string) error {
+	q.mu.Lock()
+	e, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return ErrUnknownJob
+	}
+
+	status := e.info.Status
+	if !status.Finished() {
+		e.info.Status = StatusCanceled
+	}
+	q.mu.Unlock()
+
+	switch status {
+	case StatusQueued:
+		// The worker that takes it finishes it too, whichever comes first
+		q.finish(e, StatusCanceled, ErrCanceled, nil)
+	case StatusRunning:
+		// The worker finishes it once it has stopped
+		e.cancel()
+	}
+	return nil
+}
+
+// Close stops accepting jobs and waits for the queued and running ones to
+// finish and their callbacks to be delivered. If ctx ends first, the rest
+// are canceled and Close returns ctx.Err() once they have stopped.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+
+		// Deliveries can't start once Close is waiting for them
+		q.mu.Lock()
+		q.drained = true
+		q.mu.Unlock()
+		q.deliveries.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.halt()
+		return nil
+	case <-ctx.Done():
+		q.halt()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) entry(id string) (*entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	return e, nil
+}
+
+// prune forgets jobs that finished more than Retention ago. Called with
+// q.mu held.
+func (q *Queue) prune(now time.Time) {
+	for id, e := range q.jobs {
+		if !e.info.Finished.IsZero() && now.Sub(e.info.Finished) > q.opts.Retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for e := range q.queue {
+		q.run(e)
+	}
+}
+
+// run runs a job taken from the queue, unless it was canceled meanwhile.
+func (q *Queue) run(e *entry) {
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	stop := context.AfterFunc(q.stop, cancel)
+	defer stop()
+
+	q.mu.Lock()
+	if e.info.Status == StatusCanceled {
+		// Finish it here rather than leave it to Cancel, so its callback
+		// starts before the worker is done and Close waits for it
+		q.mu.Unlock()
+		q.finish(e, StatusCanceled, ErrCanceled, nil)
+		return
+	}
+	if e.info.Status != StatusQueued {
+		q.mu.Unlock()
+		return
+	}
+	if q.stop.Err() != nil {
+		q.mu.Unlock()
+		q.finish(e, StatusCanceled, ErrCanceled, nil)
+		return
+	}
+	e.info.Status = StatusRunning
+	e.info.Started = time.Now()
+	e.cancel = cancel
+	q.mu.Unlock()
+
+	stream, text, err := q.generate(ctx, e.job)
+
+	q.mu.Lock()
+	canceled := e.info.Status == StatusCanceled || q.stop.Err() != nil
+	q.mu.Unlock()
+	switch {
+	case canceled:
+		q.finish(e, StatusCanceled, ErrCanceled, nil)
+	case err != nil:
+		q.finish(e, StatusFailed, err, nil)
+	default:
+		q.finish(e, StatusDone, nil, func(info *Info) {
+			info.Text = text
+			info.InputTokens = stream.InputTokens()
+			info.OutputTokens = stream.OutputTokens()
+		})
+	}
+}
+
+// generate opens a sequence on the next client and generates the job's
+// reply.
+func (q *Queue) generate(ctx context.Context, job Job) (*modelsocket.GenStream, string, error) {
+	client := q.clients[(q.next.Add(1)-1)%uint64(len(q.clients))]
+
+	var seq *modelsocket.Seq
+	var err error
+	if len(job.History) > 0 {
+		seq, err = client.Replay(ctx, job.Model, job.History, job.OpenOptions...)
+	} else {
+		seq, err = client.Open(ctx, job.Model, job.OpenOptions...)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer seq.Close(context.WithoutCancel(ctx))
+
+	if job.Prompt != "" {
+		if err := seq.Append(ctx, job.Prompt, modelsocket.AsUser()); err != nil {
+			return nil, "", err
+		}
+	}
+	stream, err := seq.Generate(ctx, job.GenOptions...)
+	if err != nil {
+		return nil, "", err
+	}
+	text, err := stream.Text(ctx)
+
+	// A retried or hedged generation can finish on another sequence, which
+	// needs closing too
+	if next := stream.Seq(); next != seq {
+		next.Close(context.WithoutCancel(ctx))
+	}
+	return stream, text, err
+}
+
+// finish records a job's outcome, wakes its waiters, starts delivering its
+// callback and calls OnFinish.
+func (q *Queue) finish(e *entry, status Status, err error, fill func(*Info)) {
+	q.mu.Lock()
+	if !e.info.Finished.IsZero() {
+		q.mu.Unlock()
+		return
+	}
+	e.info.Status = status
+	e.info.Err = err
+	e.info.Finished = time.Now()
+	if fill != nil {
+		fill(&e.info)
+	}
+	info := e.info
+	close(e.done)
+	if e.job.CallbackURL != "" && !q.drained {
+		q.deliveries.Add(1)
+		go q.deliver(e.job.CallbackURL, info)
+	}
+	q.mu.Unlock()
+
+	if q.opts.OnFinish != nil {
+		q.opts.OnFinish(info)
+	}
+}
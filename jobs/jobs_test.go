@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers each generation with the
+// sequence's appended texts, joined by "|". Generations of sequences holding
+// "hold" wait until release is closed.
+func newServer(release <-chan struct{}) *mstest.Server {
+	var srv *mstest.Server
+	srv = mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		text := strings.Join(g.Texts(), "|")
+		if strings.Contains(text, "hold") {
+			go func() {
+				<-release
+				srv.Reply(g, mstest.Reply(text)...)
+			}()
+			return nil
+		}
+		return mstest.Reply(text)
+	})
+	return srv
+}
+
+func newClient(t *testing.T, transport *mstest.Server) *modelsocket.Client {
+	t.Helper()
+
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, transport, modelsocket.WithIDGenerator(modelsocket.SequentialIDs("id-")))
+	t.Cleanup(func() { client.Close(ctx) })
+	return client
+}
+
+func newQueue(t *testing.T, clients []*modelsocket.Client, opts Options) *Queue {
+	t.Helper()
+
+	q, err := New(clients, opts)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	t.Cleanup(func() { q.Close(context.Background()) })
+	return q
+}
+
+func waitFor(t *testing.T, q *Queue, id string) Info {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	info, err := q.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("Wait(%s) error: %v", id, err)
+	}
+	return info
+}
+
+func TestQueue(t *testing.T) {
+	a, b := newServer(nil), newServer(nil)
+	var finished []Info
+	var mu sync.Mutex
+	q := newQueue(t, []*modelsocket.Client{newClient(t, a), newClient(t, b)}, Options{
+		Workers: 2,
+		OnFinish: func(info Info) {
+			mu.Lock()
+			finished = append(finished, info)
+			mu.Unlock()
+		},
+	})
+	ctx := context.Background()
+
+	var ids []string
+	for i := range 4 {
+		id, err := q.Submit(ctx, Job{Model: "test-model", Prompt: fmt.Sprintf("job %d", i)})
+		if err != nil {
+			t.Fatalf("Submit error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	replayed, err := q.Submit(ctx, Job{
+		Model:   "test-model",
+		History: []modelsocket.Message{{Role: "user", Text: "earlier"}},
+		Prompt:  "now",
+	})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+
+	for i, id := range ids {
+		info := waitFor(t, q, id)
+		if info.Status != StatusDone || info.Text != fmt.Sprintf("job %d", i) || info.Err != nil {
+			t.Errorf("job %d = %+v, want done with its prompt", i, info)
+		}
+		if info.Started.Before(info.Submitted) || info.Finished.Before(info.Started) {
+			t.Errorf("job %d times out of order: %+v", i, info)
+		}
+	}
+	if info := waitFor(t, q, replayed); !strings.HasSuffix(info.Text, "earlier|now") {
+		t.Errorf("replayed job text = %q, want the history and prompt", info.Text)
+	}
+
+	// Jobs were spread over both clients
+	if gensA, gensB := len(a.Gens()), len(b.Gens()); gensA == 0 || gensB == 0 || gensA+gensB != 5 {
+		t.Errorf("generations = %d and %d, want 5 spread over both", gensA, gensB)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(finished) != 5 {
+		t.Errorf("OnFinish called %d times, want 5", len(finished))
+	}
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	q := newQueue(t, []*modelsocket.Client{newClient(t, newServer(release))}, Options{Workers: 1, QueueSize: 1})
+	ctx := context.Background()
+
+	running, _ := q.Submit(ctx, Job{Model: "test-model", Prompt: "hold"})
+	deadline := time.Now().Add(time.Second)
+	for info, _ := q.Get(running); info.Status != StatusRunning; info, _ = q.Get(running) {
+		if time.Now().After(deadline) {
+			t.Fatalf("job never started: %+v", info)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	queued, err := q.Submit(ctx, Job{Model: "test-model", Prompt: "later"})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+	if _, err := q.Submit(ctx, Job{Model: "test-model", Prompt: "more"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit to a full queue error = %v, want ErrQueueFull", err)
+	}
+
+	updates, err := q.Subscribe(queued)
+	if err != nil {
+		t.Fatalf("Subscribe error: %v", err)
+	}
+	for _, id := range []string{queued, running} {
+		if err := q.Cancel(id); err != nil {
+			t.Fatalf("Cancel error: %v", err)
+		}
+	}
+	for _, id := range []string{queued, running} {
+		if info := waitFor(t, q, id); info.Status != StatusCanceled || !errors.Is(info.Err, ErrCanceled) {
+			t.Errorf("canceled job = %+v, want StatusCanceled", info)
+		}
+	}
+	if info := <-updates; info.ID != queued || info.Status != StatusCanceled {
+		t.Errorf("subscription got %+v, want the canceled job", info)
+	}
+	close(release)
+}
+
+func TestQueue_Close(t *testing.T) {
+	release := make(chan struct{})
+	q := newQueue(t, []*modelsocket.Client{newClient(t, newServer(release))}, Options{Workers: 1})
+	ctx := context.Background()
+
+	held, _ := q.Submit(ctx, Job{Model: "test-model", Prompt: "hold"})
+	queued, _ := q.Submit(ctx, Job{Model: "test-model", Prompt: "queued"})
+
+	closeCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := q.Close(closeCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close error = %v, want the deadline", err)
+	}
+	for _, id := range []string{held, queued} {
+		if info, _ := q.Get(id); info.Status != StatusCanceled {
+			t.Errorf("job %s = %s after Close, want canceled", id, info.Status)
+		}
+	}
+	if _, err := q.Submit(ctx, Job{Model: "test-model"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit after Close error = %v, want ErrClosed", err)
+	}
+	if _, err := q.Get("nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Get error = %v, want ErrUnknownJob", err)
+	}
+	close(release)
+}
+
+func TestQueue_Retry(t *testing.T) {
+	// The first generation fails, so it is retried on a replacement
+	var gens atomic.Int32
+	srv := mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		if gens.Add(1) == 1 {
+			return []*modelsocket.MSEvent{{Event: "seq_closed", ErrorMsg: "worker crashed"}}
+		}
+		return mstest.Reply("done")
+	})
+	q := newQueue(t, []*modelsocket.Client{newClient(t, srv)}, Options{Workers: 1})
+
+	id, err := q.Submit(context.Background(), Job{
+		Model:      "test-model",
+		Prompt:     "hi",
+		GenOptions: []modelsocket.GenOption{modelsocket.WithGenerateRetry(modelsocket.RetryPolicy{MaxAttempts: 2})},
+	})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+	if info := waitFor(t, q, id); info.Status != StatusDone || info.Text != "done" {
+		t.Errorf("job = %+v, want done with the retried reply", info)
+	}
+
+	// The replacement is closed with the job
+	if srv.Opened() != 2 || srv.Closed() != 1 {
+		t.Errorf("opened %d, closed %d, want the replacement opened and closed", srv.Opened(), srv.Closed())
+	}
+}
+
+func TestQueue_Hedge(t *testing.T) {
+	// The first sequence never answers, so the hedge on its fork wins
+	srv := mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		if g.SeqID == "seq-1" {
+			return nil
+		}
+		return mstest.Reply("done")
+	})
+	q := newQueue(t, []*modelsocket.Client{newClient(t, srv)}, Options{Workers: 1})
+
+	id, err := q.Submit(context.Background(), Job{
+		Model:      "test-model",
+		Prompt:     "hi",
+		GenOptions: []modelsocket.GenOption{modelsocket.WithHedge(10 * time.Millisecond)},
+	})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+	if info := waitFor(t, q, id); info.Status != StatusDone || info.Text != "done" {
+		t.Errorf("job = %+v, want done with the hedge's reply", info)
+	}
+
+	// The winner is closed with the job, and the loser by the hedge
+	deadline := time.Now().Add(time.Second)
+	for srv.Closed() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if srv.Opened()+srv.Forks() != 2 || srv.Closed() != 2 {
+		t.Errorf("%d sequences, %d closed, want both closed", srv.Opened()+srv.Forks(), srv.Closed())
+	}
+}
+
+func TestNew_NoClients(t *testing.T) {
+	if _, err := New(nil, Options{}); !errors.Is(err, ErrNoClients) {
+		t.Errorf("New error = %v, want ErrNoClients", err)
+	}
+}
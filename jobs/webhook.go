@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults for Webhook and Verify.
+const (
+	DefaultWebhookAttempts = 5
+	DefaultWebhookBackoff  = time.Second
+	DefaultSignatureMaxAge = 5 * time.Minute
+)
+
+// SignatureHeader carries a callback's signature: "sha256=" followed by the
+// hex HMAC-SHA256, under Webhook.Secret, of the TimestampHeader value, a
+// dot and the body. Check it with Verify.
+const SignatureHeader = "X-ModelSocket-Signature"
+
+// TimestampHeader carries the Unix time, in seconds, at which a callback was
+// signed. It is covered by the signature, so a receiver that rejects old
+// timestamps can't be sent a captured callback again later.
+const TimestampHeader = "X-ModelSocket-Timestamp"
+
+// Webhook configures how finished jobs with a CallbackURL are delivered.
+type Webhook struct {
+	// Secret, if set, signs each payload in the SignatureHeader.
+	Secret []byte
+
+	// Client sends the callbacks. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// MaxAttempts is the total number of attempts per callback, including
+	// the first. Defaults to DefaultWebhookAttempts.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles for each
+	// retry after that. Defaults to DefaultWebhookBackoff.
+	Backoff time.Duration
+
+	// OnFailure, if set, is called when a callback can't be delivered.
+	OnFailure func(info Info, err *DeliveryError)
+}
+
+// Payload is the JSON body POSTed to a job's CallbackURL when it finishes.
+type Payload struct {
+	ID           string    `json:"id"`
+	Status       Status    `json:"status"`
+	Text         string    `json:"text,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Error        string    `json:"error,omitempty"`
+	Submitted    time.Time `json:"submitted_at"`
+	Started      time.Time `json:"started_at"`
+	Finished     time.Time `json:"finished_at"`
+}
+
+// NewPayload returns the callback payload for a finished job.
+func NewPayload(info Info) Payload {
+	p := Payload{
+		ID:           info.ID,
+		Status:       info.Status,
+		Text:         info.Text,
+		InputTokens:  info.InputTokens,
+		OutputTokens: info.OutputTokens,
+		Submitted:    info.Submitted,
+		Started:      info.Started,
+		Finished:     info.Finished,
+	}
+	if info.Err != nil {
+		p.Error = info.Err.Error()
+	}
+	return p
+}
+
+// DeliveryError reports a callback that couldn't be delivered.
+type DeliveryError struct {
+	JobID      string
+	URL        string
+	Attempts   int
+	StatusCode int // Of the last response, or 0 if there was none
+	Err        error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("jobs: delivering %s to %s after %d attempts: %v", e.JobID, e.URL, e.Attempts, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp, in
+// Unix seconds, under secret.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature and timestamp, taken from a callback's
+// SignatureHeader and TimestampHeader, sign body under secret, and the
+// timestamp is within maxAge of now. A maxAge of 0 means
+// DefaultSignatureMaxAge. Rejecting old timestamps keeps a captured
+// callback from being replayed; receivers that must not act on one twice
+// should also deduplicate by Payload.ID.
+func Verify(secret, body []byte, timestamp, signature string, maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		maxAge = DefaultSignatureMaxAge
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > maxAge || age < -maxAge {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// deliver POSTs a finished job's payload to url, retrying with backoff
+// until a 2xx response. Client errors other than 408 and 429 aren't
+// retried. Close waits for deliveries, so retries only stop early if its
+// context ends first and the queue gives up on them.
+func (q *Queue) deliver(url string, info Info) {
+	defer q.deliveries.Done()
+
+	var hook Webhook
+	if q.opts.Webhook != nil {
+		hook = *q.opts.Webhook
+	}
+	if hook.Client == nil {
+		hook.Client = http.DefaultClient
+	}
+	if hook.MaxAttempts <= 0 {
+		hook.MaxAttempts = DefaultWebhookAttempts
+	}
+	if hook.Backoff <= 0 {
+		hook.Backoff = DefaultWebhookBackoff
+	}
+
+	body, _ := json.Marshal(NewPayload(info))
+	failure := &DeliveryError{JobID: info.ID, URL: url}
+	backoff := hook.Backoff
+	for failure.Attempts < hook.MaxAttempts {
+		if failure.Attempts > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-q.stop.Done():
+				failure.Err = q.stop.Err()
+				q.deliveryFailed(hook, info, failure)
+				return
+			}
+		}
+		failure.Attempts++
+
+		status, err := post(q.stop, hook, url, body)
+		failure.StatusCode = status
+		if err == nil {
+			return
+		}
+		failure.Err = err
+		if status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+			break
+		}
+	}
+	q.deliveryFailed(hook, info, failure)
+}
+
+// post sends one callback, returning the response status.
+func post(ctx context.Context, hook Webhook, url string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(hook.Secret) > 0 {
+		// Each attempt is signed afresh, so retries don't go stale
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+	}
+
+	resp, err := hook.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (q *Queue) deliveryFailed(hook Webhook, info Info, err *DeliveryError) {
+	if hook.OnFailure != nil {
+		hook.OnFailure(info, err)
+	}
+}
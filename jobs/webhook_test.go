@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+func TestQueue_Webhook(t *testing.T) {
+	secret := []byte("s3cret")
+
+	var mu sync.Mutex
+	var attempts int
+	delivered := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(secret, body, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), 0) {
+			t.Errorf("bad signature %q", r.Header.Get(SignatureHeader))
+		}
+
+		mu.Lock()
+		attempts++
+		failing := attempts < 3
+		mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("payload: %v", err)
+		}
+		delivered <- p
+	}))
+	defer server.Close()
+
+	q := newQueue(t, []*modelsocket.Client{newClient(t, newServer(nil))}, Options{
+		Webhook: &Webhook{Secret: secret, Backoff: time.Millisecond},
+	})
+	id, err := q.Submit(context.Background(), Job{Model: "test-model", Prompt: "hello", CallbackURL: server.URL})
+	if err != nil {
+		t.Fatalf("Submit error: %v", err)
+	}
+
+	select {
+	case p := <-delivered:
+		if p.ID != id || p.Status != StatusDone || p.Text != "hello" || p.Error != "" {
+			t.Errorf("payload = %+v, want the done job", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback never delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 3 {
+		t.Errorf("%d attempts, want 3", attempts)
+	}
+}
+
+func TestQueue_Webhook_Failure(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	failures := make(chan *DeliveryError, 1)
+	q := newQueue(t, []*modelsocket.Client{newClient(t, newServer(nil))}, Options{
+		Webhook: &Webhook{
+			Backoff: time.Millisecond,
+			OnFailure: func(info Info, err *DeliveryError) {
+				failures <- err
+			},
+		},
+	})
+	id, _ := q.Submit(context.Background(), Job{Model: "test-model", Prompt: "hello", CallbackURL: server.URL})
+
+	select {
+	case err := <-failures:
+		// Client errors aren't retried
+		if err.JobID != id || err.Attempts != 1 || err.StatusCode != http.StatusBadRequest {
+			t.Errorf("DeliveryError = %+v, want one rejected attempt", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnFailure never called")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 1 {
+		t.Errorf("%d attempts, want 1", attempts)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"job-1"}`)
+	now := time.Now().Unix()
+	timestamp := strconv.FormatInt(now, 10)
+	signature := Sign([]byte("key"), now, body)
+
+	if !Verify([]byte("key"), body, timestamp, signature, 0) {
+		t.Error("Verify rejected a valid signature")
+	}
+	if Verify([]byte("other"), body, timestamp, signature, 0) || Verify([]byte("key"), []byte(`{"id":"job-2"}`), timestamp, signature, 0) {
+		t.Error("Verify accepted a signature for another key or body")
+	}
+	if Verify([]byte("key"), body, strconv.FormatInt(now+1, 10), signature, 0) {
+		t.Error("Verify accepted a signature for another timestamp")
+	}
+
+	// A captured callback can't be replayed once it is old
+	old := time.Now().Add(-time.Hour).Unix()
+	if Verify([]byte("key"), body, strconv.FormatInt(old, 10), Sign([]byte("key"), old, body), 0) {
+		t.Error("Verify accepted a stale timestamp")
+	}
+	if !Verify([]byte("key"), body, strconv.FormatInt(old, 10), Sign([]byte("key"), old, body), 2*time.Hour) {
+		t.Error("Verify rejected a timestamp within maxAge")
+	}
+}
+
+func TestQueue_Webhook_CancelDuringClose(t *testing.T) {
+	delivered := make(chan Payload, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		json.NewDecoder(r.Body).Decode(&p)
+		delivered <- p
+	}))
+	defer server.Close()
+
+	release := make(chan struct{})
+	q := newQueue(t, []*modelsocket.Client{newClient(t, newServer(release))}, Options{Workers: 1})
+	ctx := context.Background()
+
+	held, _ := q.Submit(ctx, Job{Model: "test-model", Prompt: "hold", CallbackURL: server.URL})
+	queued, _ := q.Submit(ctx, Job{Model: "test-model", Prompt: "later", CallbackURL: server.URL})
+
+	closed := make(chan error, 1)
+	go func() { closed <- q.Close(ctx) }()
+	if err := q.Cancel(queued); err != nil {
+		t.Fatalf("Cancel error: %v", err)
+	}
+	close(release)
+
+	if err := <-closed; err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	// Close waited for both callbacks
+	got := map[string]Status{}
+	for range 2 {
+		select {
+		case p := <-delivered:
+			got[p.ID] = p.Status
+		default:
+			t.Fatalf("callbacks = %v, want both delivered before Close returned", got)
+		}
+	}
+	if got[held] != StatusDone || got[queued] != StatusCanceled {
+		t.Errorf("callbacks = %v, want the held job done and the queued one canceled", got)
+	}
+}
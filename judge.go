@@ -0,0 +1,142 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Judge winners reported in [Verdict].
+const (
+	WinnerA   = "A"
+	WinnerB   = "B"
+	WinnerTie = "tie"
+)
+
+// Verdict is a judge model's comparison of two candidates.
+type Verdict struct {
+	Winner    string  `json:"winner"`    // WinnerA, WinnerB or WinnerTie
+	Score     float64 `json:"score"`     // The judge's confidence, between 0 and 1
+	Rationale string  `json:"rationale"` // Why the winner was chosen
+}
+
+// judgeComparePrompt asks the judge to compare two candidates. It is followed
+// by the rubric and the candidates.
+const judgeComparePrompt = `Compare two candidate responses against the rubric and decide which is better.
+
+Rubric:
+%s
+
+Candidate A:
+%s
+
+Candidate B:
+%s
+
+Reply with JSON: {"winner": "A", "B" or "tie", "score": your confidence from 0 to 1, "rationale": a short explanation}.`
+
+// verdictMask constrains the judge's reply to a Verdict as JSON.
+const verdictMask = `\{"winner": "(?:A|B|tie)", "score": (?:0(?:\.[0-9]{1,2})?|1(?:\.0)?), "rationale": "(?:[^"\\\n]|\\.)*"\}`
+
+// Judge asks judgeModel which of two candidates better meets rubric. The
+// judge runs in its own sequence, which is closed afterwards, and its reply
+// is constrained to JSON with a regex mask. Generation defaults to
+// temperature 0; opts are applied after the defaults.
+//
+//	v, err := modelsocket.Judge(ctx, client, "meta/llama3.1-70b-instruct",
+//	    "Which answer is more accurate and concise?", answerA, answerB)
+//	if v.Winner == modelsocket.WinnerA { ... }
+func Judge(ctx context.Context, client *Client, judgeModel, rubric, candidateA, candidateB string, opts ...GenOption) (Verdict, error) {
+	seq, err := client.Open(ctx, judgeModel)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer func() { go seq.Close(client.ctx) }()
+
+	prompt := fmt.Sprintf(judgeComparePrompt, rubric, candidateA, candidateB)
+	if err := seq.Append(ctx, prompt, AsUser()); err != nil {
+		return Verdict{}, err
+	}
+
+	genOpts := append([]GenOption{
+		GenerateAsAssistant(),
+		WithTemperature(0),
+		WithRegexMask(verdictMask),
+	}, opts...)
+	stream, err := seq.Generate(ctx, genOpts...)
+	if err != nil {
+		return Verdict{}, err
+	}
+	text, err := stream.Text(ctx)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return parseVerdict(text)
+}
+
+// parseVerdict decodes a judge's reply, repairing JSON the server didn't
+// constrain.
+func parseVerdict(text string) (Verdict, error) {
+	var v Verdict
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		repaired, rerr := RepairJSON(text)
+		if rerr != nil {
+			return Verdict{}, fmt.Errorf("modelsocket: judge verdict %q: %w", text, err)
+		}
+		if err := json.Unmarshal([]byte(repaired), &v); err != nil {
+			return Verdict{}, fmt.Errorf("modelsocket: judge verdict %q: %w", text, err)
+		}
+	}
+
+	switch v.Winner {
+	case WinnerA, WinnerB, WinnerTie:
+	default:
+		return Verdict{}, fmt.Errorf("modelsocket: judge verdict %q: unknown winner %q", text, v.Winner)
+	}
+	v.Score = min(max(v.Score, 0), 1)
+	return v, nil
+}
+
+// Rank orders candidates best first by judging every pair with [Judge]. A
+// win scores a point and a tie half a point; candidates with equal points
+// keep their order. It returns the candidates' indices, so it can rank the
+// outputs of forked sequences:
+//
+//	order, err := modelsocket.Rank(ctx, client, judgeModel, rubric, outputs)
+//	best := outputs[order[0]]
+func Rank(ctx context.Context, client *Client, judgeModel, rubric string, candidates []string, opts ...GenOption) ([]int, error) {
+	points := make([]float64, len(candidates))
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			v, err := Judge(ctx, client, judgeModel, rubric, candidates[i], candidates[j], opts...)
+			if err != nil {
+				return nil, err
+			}
+			switch v.Winner {
+			case WinnerA:
+				points[i]++
+			case WinnerB:
+				points[j]++
+			default:
+				points[i] += 0.5
+				points[j] += 0.5
+			}
+		}
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case points[a] > points[b]:
+			return -1
+		case points[a] < points[b]:
+			return 1
+		}
+		return 0
+	})
+	return order, nil
+}
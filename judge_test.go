@@ -0,0 +1,138 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// judgeServer opens judge sequences and answers each comparison with reply,
+// given the two candidates.
+func judgeServer(t *testing.T, transport *mockTransport, reply func(a, b string) string) <-chan genCommandData {
+	t.Helper()
+
+	gens := make(chan genCommandData, 100)
+	prompts := make(map[string]string)
+	seqs := 0
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		if req.Request == "seq_open" {
+			seqs++
+			return []*MSEvent{{Event: "seq_opened", CID: req.CID, SeqID: fmt.Sprintf("judge-%d", seqs)}}
+		}
+		switch data := req.Data.(type) {
+		case appendCommandData:
+			prompts[req.SeqID] = data.Text
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			gens <- data
+			_, rest, _ := strings.Cut(prompts[req.SeqID], "Candidate A:\n")
+			a, rest, _ := strings.Cut(rest, "\n\nCandidate B:\n")
+			b, _, _ := strings.Cut(rest, "\n\nReply with JSON")
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: reply(a, b)},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID},
+			}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		}
+		return nil
+	})
+	return gens
+}
+
+func TestJudge(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	gens := judgeServer(t, transport, func(a, b string) string {
+		return `{"winner": "B", "score": 0.8, "rationale": "B is ` + b + `"}`
+	})
+
+	v, err := Judge(ctx, client, "judge-model", "Be concise.", "long answer", "short")
+	if err != nil {
+		t.Fatalf("Judge error: %v", err)
+	}
+	want := Verdict{Winner: WinnerB, Score: 0.8, Rationale: "B is short"}
+	if v != want {
+		t.Errorf("verdict = %+v, want %+v", v, want)
+	}
+
+	data := <-gens
+	if data.RegexMask == nil || *data.RegexMask != verdictMask {
+		t.Errorf("RegexMask = %v, want verdict mask", data.RegexMask)
+	}
+	if data.Temperature == nil || *data.Temperature != 0 {
+		t.Errorf("Temperature = %v, want 0", data.Temperature)
+	}
+}
+
+func TestRank(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	// Shorter candidates win; equal lengths tie
+	judgeServer(t, transport, func(a, b string) string {
+		switch {
+		case len(a) < len(b):
+			return `{"winner": "A", "score": 1, "rationale": ""}`
+		case len(b) < len(a):
+			return `{"winner": "B", "score": 1, "rationale": ""}`
+		}
+		return `{"winner": "tie", "score": 0.5, "rationale": ""}`
+	})
+
+	order, err := Rank(ctx, client, "judge-model", "Be concise.", []string{"medium", "longest one", "tiny", "sized"})
+	if err != nil {
+		t.Fatalf("Rank error: %v", err)
+	}
+	if fmt.Sprint(order) != "[2 3 0 1]" {
+		t.Errorf("order = %v, want [2 3 0 1]", order)
+	}
+}
+
+func TestParseVerdict(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Verdict
+		wantErr bool
+	}{
+		{`{"winner": "A", "score": 0.9, "rationale": "clearer"}`, Verdict{WinnerA, 0.9, "clearer"}, false},
+		{`Sure! {"winner": "tie", "score": 0.5, "rationale": "same",}`, Verdict{WinnerTie, 0.5, "same"}, false},
+		{`{"winner": "B", "score": 7, "rationale": ""}`, Verdict{WinnerB, 1, ""}, false},
+		{`{"winner": "C", "score": 1, "rationale": ""}`, Verdict{}, true},
+		{`no verdict`, Verdict{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseVerdict(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseVerdict(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseVerdict(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestVerdictMask(t *testing.T) {
+	re := regexp.MustCompile("^" + verdictMask + "$")
+	for _, text := range []string{
+		`{"winner": "A", "score": 0.75, "rationale": "it says \"hi\""}`,
+		`{"winner": "tie", "score": 1, "rationale": ""}`,
+	} {
+		if !re.MatchString(text) {
+			t.Errorf("mask rejects %s", text)
+		}
+	}
+	if re.MatchString(`{"winner": "A", "score": 2, "rationale": ""}`) {
+		t.Error("mask accepts score 2")
+	}
+}
@@ -0,0 +1,20 @@
+module github.com/chrisboulton/modelsocket-go/langchain
+
+go 1.23
+
+require (
+	github.com/chrisboulton/modelsocket-go v0.0.0
+	github.com/tmc/langchaingo v0.1.13
+)
+
+require (
+	github.com/coder/websocket v1.8.14 // indirect
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/pkoukk/tiktoken-go v0.1.6 // indirect
+)
+
+// The root module has no tagged release yet, so v0.0.0 above is a
+// placeholder and this module builds against the working tree it ships in.
+// Require the first tagged release and drop the replace once there is one.
+replace github.com/chrisboulton/modelsocket-go => ../
@@ -0,0 +1,258 @@
+// Package langchain adapts ModelSocket to langchaingo's llms.Model, so
+// applications built on langchaingo chains and agents can switch their
+// backend to ModelSocket without changing orchestration code.
+//
+//	llm := langchain.New(client, "meta/llama3.1-8b-instruct-free")
+//	text, err := llms.GenerateFromSinglePrompt(ctx, llm, "Hello!")
+package langchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrUnsupportedContent is returned for message parts other than text, tool
+// calls and tool responses, such as images.
+var ErrUnsupportedContent = errors.New("langchain: unsupported content part")
+
+// Option configures an LLM.
+type Option func(*LLM)
+
+// WithOpenOptions sets options for the sequence opened by each call.
+func WithOpenOptions(opts ...modelsocket.OpenOption) Option {
+	return func(l *LLM) {
+		l.openOpts = opts
+	}
+}
+
+// LLM implements llms.Model on a ModelSocket client.
+//
+// langchaingo passes the whole conversation on every call, so each call
+// replays it into a new sequence, generates, and closes the sequence. Tools
+// passed with llms.WithTools are described to the model; its calls are
+// returned in the choice's ToolCalls for the caller to run, as with other
+// langchaingo models.
+type LLM struct {
+	client   *modelsocket.Client
+	model    string
+	openOpts []modelsocket.OpenOption
+}
+
+var _ llms.Model = (*LLM)(nil)
+
+// New creates an LLM that opens sequences with model. llms.WithModel
+// overrides the model for a single call.
+func New(client *modelsocket.Client, model string, opts ...Option) *LLM {
+	l := &LLM{client: client, model: model}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Call generates a response to a single prompt.
+func (l *LLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, l, prompt, options...)
+}
+
+// GenerateContent generates the next message of a conversation.
+func (l *LLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	opts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	history, err := toHistory(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	model := l.model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+
+	openOpts := l.openOpts
+	if len(opts.Tools) > 0 {
+		toolbox, err := toToolbox(opts.Tools)
+		if err != nil {
+			return nil, err
+		}
+		openOpts = append(openOpts[:len(openOpts):len(openOpts)], modelsocket.WithToolbox(toolbox))
+	}
+
+	seq, err := l.client.Replay(ctx, model, history, openOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer seq.Close(context.WithoutCancel(ctx))
+
+	stream, err := seq.Generate(ctx, genOptions(&opts)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	var calls []llms.ToolCall
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		for _, call := range chunk.ToolCalls {
+			calls = append(calls, llms.ToolCall{
+				ID:   fmt.Sprintf("call_%d", len(calls)),
+				Type: "function",
+				FunctionCall: &llms.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Args,
+				},
+			})
+		}
+		if chunk.Hidden || chunk.Text == "" {
+			continue
+		}
+		text.WriteString(chunk.Text)
+		if opts.StreamingFunc != nil {
+			if err := opts.StreamingFunc(ctx, []byte(chunk.Text)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	choice := &llms.ContentChoice{
+		Content:    text.String(),
+		StopReason: "stop",
+		ToolCalls:  calls,
+		GenerationInfo: map[string]any{
+			"InputTokens":  stream.InputTokens(),
+			"OutputTokens": stream.OutputTokens(),
+			"TotalTokens":  stream.InputTokens() + stream.OutputTokens(),
+		},
+	}
+	if len(calls) > 0 {
+		choice.StopReason = "tool_calls"
+		choice.FuncCall = calls[0].FunctionCall
+	}
+
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{choice}}, nil
+}
+
+// roles maps langchaingo message types to roles.
+var roles = map[llms.ChatMessageType]modelsocket.Role{
+	llms.ChatMessageTypeSystem:   modelsocket.RoleSystem,
+	llms.ChatMessageTypeHuman:    modelsocket.RoleUser,
+	llms.ChatMessageTypeGeneric:  modelsocket.RoleUser,
+	llms.ChatMessageTypeAI:       modelsocket.RoleAssistant,
+	llms.ChatMessageTypeTool:     modelsocket.RoleTool,
+	llms.ChatMessageTypeFunction: modelsocket.RoleTool,
+}
+
+// toHistory converts langchaingo messages into a history to replay.
+func toHistory(messages []llms.MessageContent) ([]modelsocket.Message, error) {
+	history := make([]modelsocket.Message, 0, len(messages))
+	for _, mc := range messages {
+		role, ok := roles[mc.Role]
+		if !ok {
+			return nil, fmt.Errorf("langchain: unsupported message type %q", mc.Role)
+		}
+
+		msg := modelsocket.Message{Role: role}
+		var text strings.Builder
+		for _, part := range mc.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				text.WriteString(p.Text)
+			case llms.ToolCall:
+				if p.FunctionCall != nil {
+					msg.ToolCalls = append(msg.ToolCalls, modelsocket.ToolCall{
+						Name: p.FunctionCall.Name,
+						Args: p.FunctionCall.Arguments,
+					})
+				}
+			case llms.ToolCallResponse:
+				msg.ToolResults = append(msg.ToolResults, modelsocket.ToolResult{
+					Name:   p.Name,
+					Result: p.Content,
+				})
+			default:
+				return nil, fmt.Errorf("%w: %T", ErrUnsupportedContent, part)
+			}
+		}
+
+		msg.Text = text.String()
+		if len(msg.ToolResults) > 0 && msg.Text == "" {
+			// Tool results are appended as JSON, as after Seq.ToolReturn
+			data, _ := json.Marshal(msg.ToolResults)
+			msg.Text = string(data)
+		}
+		history = append(history, msg)
+	}
+	return history, nil
+}
+
+// toToolbox describes langchaingo tools to the model. The tools are run by
+// the caller, so the toolbox is only used for its definitions.
+func toToolbox(tools []llms.Tool) (*modelsocket.Toolbox, error) {
+	toolbox := modelsocket.NewToolbox()
+	for _, tool := range tools {
+		if tool.Function == nil {
+			return nil, fmt.Errorf("langchain: unsupported tool type %q", tool.Type)
+		}
+
+		def := modelsocket.ToolDefinition{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+		}
+		if tool.Function.Parameters != nil {
+			data, err := json.Marshal(tool.Function.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("langchain: tool %s: %w", def.Name, err)
+			}
+			if err := json.Unmarshal(data, &def.Parameters); err != nil {
+				return nil, fmt.Errorf("langchain: tool %s: %w", def.Name, err)
+			}
+		}
+
+		toolbox.Add(modelsocket.NewFuncTool(def, func(ctx context.Context, args string) (string, error) {
+			return "", fmt.Errorf("langchain: tool %s is run by the caller", def.Name)
+		}))
+	}
+	return toolbox, nil
+}
+
+// genOptions converts call options to generation options. Zero values are
+// treated as unset, as langchaingo does.
+func genOptions(opts *llms.CallOptions) []modelsocket.GenOption {
+	gen := []modelsocket.GenOption{modelsocket.GenerateAsAssistant()}
+	if opts.MaxTokens > 0 {
+		gen = append(gen, modelsocket.WithMaxTokens(opts.MaxTokens))
+	}
+	if opts.MaxLength > 0 {
+		gen = append(gen, modelsocket.WithMaxLength(opts.MaxLength))
+	}
+	if opts.Temperature > 0 {
+		gen = append(gen, modelsocket.WithTemperature(opts.Temperature))
+	}
+	if opts.TopP > 0 {
+		gen = append(gen, modelsocket.WithTopP(opts.TopP))
+	}
+	if opts.TopK > 0 {
+		gen = append(gen, modelsocket.WithTopK(opts.TopK))
+	}
+	if opts.RepetitionPenalty > 0 {
+		gen = append(gen, modelsocket.WithRepeatPenalty(opts.RepetitionPenalty))
+	}
+	if opts.Seed != 0 {
+		gen = append(gen, modelsocket.WithSeed(int64(opts.Seed)))
+	}
+	if len(opts.StopWords) > 0 {
+		gen = append(gen, modelsocket.WithStopStrings(opts.StopWords...))
+	}
+	return gen
+}
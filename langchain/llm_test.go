@@ -0,0 +1,148 @@
+package langchain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// newServer returns a server that answers each generation with "Bonjour!",
+// or with a weather tool call when tools are enabled.
+func newServer() *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		if g.Tools {
+			return []*modelsocket.MSEvent{mstest.ToolCall("weather", `{"city":"Paris"}`), mstest.Finish(12, 2)}
+		}
+		return []*modelsocket.MSEvent{mstest.Text("Bonjour"), mstest.Text("!"), mstest.Finish(12, 2)}
+	})
+}
+
+func newTestLLM(t *testing.T) (*LLM, *mstest.Server) {
+	t.Helper()
+
+	transport := newServer()
+	client := modelsocket.NewWithTransport(context.Background(), transport)
+	t.Cleanup(func() { client.Close(context.Background()) })
+
+	return New(client, "m1"), transport
+}
+
+func TestLLM_GenerateContent(t *testing.T) {
+	llm, transport := newTestLLM(t)
+
+	var streamed strings.Builder
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "Answer in French."),
+		llms.TextParts(llms.ChatMessageTypeHuman, "Hello"),
+	},
+		llms.WithMaxTokens(50),
+		llms.WithStopWords([]string{"\n"}),
+		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			streamed.Write(chunk)
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("GenerateContent error: %v", err)
+	}
+
+	choice := resp.Choices[0]
+	if choice.Content != "Bonjour!" || streamed.String() != "Bonjour!" {
+		t.Errorf("content = %q, streamed = %q, want %q", choice.Content, streamed.String(), "Bonjour!")
+	}
+	if choice.GenerationInfo["OutputTokens"] != 2 {
+		t.Errorf("OutputTokens = %v, want 2", choice.GenerationInfo["OutputTokens"])
+	}
+
+	appended := transport.Appended()
+	if len(appended) != 2 || appended[0].Role != "system" || appended[1].Text != "Hello" {
+		t.Errorf("appended = %+v", appended)
+	}
+	gen := transport.Gens()[0]
+	if gen.MaxTokens == nil || *gen.MaxTokens != 50 || len(gen.StopStrings) != 1 || gen.Role != "assistant" {
+		t.Errorf("gen = %+v", gen)
+	}
+}
+
+func TestLLM_Call(t *testing.T) {
+	llm, _ := newTestLLM(t)
+
+	text, err := llm.Call(context.Background(), "Hello")
+	if err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if text != "Bonjour!" {
+		t.Errorf("text = %q, want %q", text, "Bonjour!")
+	}
+}
+
+func TestLLM_Tools(t *testing.T) {
+	llm, transport := newTestLLM(t)
+
+	tools := []llms.Tool{{
+		Type: "function",
+		Function: &llms.FunctionDefinition{
+			Name:        "weather",
+			Description: "Get the weather",
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+		},
+	}}
+
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "Weather in Paris?"),
+	}, llms.WithTools(tools))
+	if err != nil {
+		t.Fatalf("GenerateContent error: %v", err)
+	}
+
+	choice := resp.Choices[0]
+	if len(choice.ToolCalls) != 1 || choice.ToolCalls[0].FunctionCall.Name != "weather" || choice.StopReason != "tool_calls" {
+		t.Fatalf("choice = %+v, want a weather call", choice)
+	}
+
+	// The agent runs the tool and sends the conversation back
+	_, err = llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "Weather in Paris?"),
+		{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{choice.ToolCalls[0]}},
+		{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{
+			ToolCallID: choice.ToolCalls[0].ID,
+			Name:       "weather",
+			Content:    "sunny",
+		}}},
+	}, llms.WithTools(tools))
+	if err != nil {
+		t.Fatalf("GenerateContent error: %v", err)
+	}
+
+	var texts []string
+	for _, a := range transport.Appended() {
+		texts = append(texts, a.Text)
+	}
+	joined := strings.Join(texts, "\n")
+	if !strings.Contains(joined, `<tool_call>{"name":"weather","arguments":{"city":"Paris"}}</tool_call>`) {
+		t.Errorf("appended = %q, want the replayed tool call", texts)
+	}
+	if !strings.Contains(joined, `"result":"sunny"`) {
+		t.Errorf("appended = %q, want the tool result", texts)
+	}
+}
+
+func TestLLM_UnsupportedContent(t *testing.T) {
+	llm, _ := newTestLLM(t)
+
+	_, err := llm.GenerateContent(context.Background(), []llms.MessageContent{{
+		Role:  llms.ChatMessageTypeHuman,
+		Parts: []llms.ContentPart{llms.ImageURLContent{URL: "https://example.com/cat.png"}},
+	}})
+	if !errors.Is(err, ErrUnsupportedContent) {
+		t.Errorf("err = %v, want ErrUnsupportedContent", err)
+	}
+}
@@ -0,0 +1,107 @@
+package modelsocket
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Log attribute keys used across the client.
+const (
+	logKeyEvent        = "event"
+	logKeyRequest      = "request"
+	logKeySeqID        = "seq_id"
+	logKeyRunID        = "run_id"
+	logKeyCID          = "cid"
+	logKeyError        = "error"
+	logKeyInputTokens  = "input_tokens"
+	logKeyOutputTokens = "output_tokens"
+	logKeyDuration     = "duration"
+	logKeyFirstToken   = "ttft"
+	logKeyBytes        = "bytes"
+	logKeyAttempt      = "attempt"
+	logKeyModel        = "model"
+	logKeyEndpoint     = "endpoint"
+)
+
+// log writes a record if a logger is configured and kind passes the filter.
+// kind is an event or request type, or "" for records that are always kept.
+func (c *Client) log(level slog.Level, kind, msg string, attrs ...slog.Attr) {
+	logger := c.cfg.logger
+	if logger == nil {
+		return
+	}
+	if kind != "" && c.cfg.logFilter != nil && !c.cfg.logFilter(kind) {
+		return
+	}
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// logEvent logs a received event at a level matching its significance:
+// protocol errors at error, sequences closed with an error at warn, and
+// everything else at debug. Generation finishes are logged by the sequence,
+// which can attach timings.
+func (c *Client) logEvent(event *MSEvent) {
+	if c.cfg.logger == nil || event.IsSeqGenFinish() {
+		return
+	}
+
+	level := slog.LevelDebug
+	msg := "received event"
+	attrs := []slog.Attr{
+		slog.String(logKeyEvent, event.Event),
+		slog.String(logKeySeqID, event.SeqID),
+		slog.String(logKeyCID, event.CID),
+	}
+
+	switch {
+	case event.IsError():
+		level = slog.LevelError
+		msg = "protocol error"
+		attrs = append(attrs, slog.String(logKeyError, event.Message))
+	case event.IsSeqText():
+		attrs = append(attrs, slog.Int(logKeyBytes, len(event.Text)))
+	case event.IsSeqClosed():
+		attrs = append(attrs,
+			slog.Int(logKeyInputTokens, event.InputTokens),
+			slog.Int(logKeyOutputTokens, event.OutputTokens),
+			slog.Duration(logKeyDuration, time.Duration(event.DurationMs)*time.Millisecond),
+		)
+		if event.ErrorMsg != "" {
+			level = slog.LevelWarn
+			msg = "sequence closed with error"
+			attrs = append(attrs, slog.String(logKeyError, event.ErrorMsg))
+		}
+	}
+
+	c.log(level, event.Event, msg, attrs...)
+}
+
+// logRequest logs an outgoing request at debug level.
+func (c *Client) logRequest(req *MSRequest) {
+	attrs := []slog.Attr{
+		slog.String(logKeyRequest, req.Request),
+		slog.String(logKeyCID, req.CID),
+		slog.String(logKeySeqID, req.SeqID),
+	}
+	if req.runID != "" {
+		attrs = append(attrs, slog.String(logKeyRunID, req.runID))
+	}
+	c.log(slog.LevelDebug, req.Request, "sending request", attrs...)
+}
+
+// logGenFinish logs a finished generation with its token counts and timings.
+func (c *Client) logGenFinish(seqID string, stats GenStats) {
+	attrs := []slog.Attr{
+		slog.String(logKeySeqID, seqID),
+		slog.String(logKeyCID, stats.CID),
+		slog.Int(logKeyInputTokens, stats.InputTokens),
+		slog.Int(logKeyOutputTokens, stats.OutputTokens),
+		slog.Duration(logKeyFirstToken, stats.Timings.FirstToken),
+		slog.Duration(logKeyDuration, stats.Timings.Total),
+	}
+	if runID := stats.Tags[RunIDTag]; runID != "" {
+		attrs = append(attrs, slog.String(logKeyRunID, runID))
+	}
+	c.log(slog.LevelDebug, "seq_gen_finish", "generation finished", attrs...)
+}
@@ -0,0 +1,114 @@
+package modelsocket
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordHandler collects log records for inspection.
+type recordHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	h.records = append(h.records, r)
+	h.mu.Unlock()
+	return nil
+}
+
+// find returns the first record with msg.
+func (h *recordHandler) find(msg string) (slog.Record, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Message == msg {
+			return r, true
+		}
+	}
+	return slog.Record{}, false
+}
+
+// attrs returns a record's attributes keyed by name.
+func attrs(r slog.Record) map[string]slog.Value {
+	m := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value
+		return true
+	})
+	return m
+}
+
+func TestClient_Logging(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	h := &recordHandler{}
+	client := NewWithTransport(ctx, transport,
+		WithLogger(slog.New(h)),
+		WithLogFilter(func(kind string) bool { return kind != "seq_text" }),
+	)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-123")
+
+	go func() {
+		req := transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-123", Text: "Hi"})
+		transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-123", CID: req.CID, InputTokens: 4, OutputTokens: 2})
+		transport.pushEvent(&MSEvent{Event: "error", Message: "boom"})
+	}()
+
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	// Wait for the trailing error event to be logged
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := h.find("protocol error"); ok || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	finish, ok := h.find("generation finished")
+	if !ok {
+		t.Fatal("generation finished not logged")
+	}
+	a := attrs(finish)
+	if a[logKeyInputTokens].Int64() != 4 || a[logKeyOutputTokens].Int64() != 2 {
+		t.Errorf("finish attrs = %v, want token counts", a)
+	}
+	if _, ok := a[logKeyFirstToken]; !ok {
+		t.Error("finish attrs missing ttft")
+	}
+
+	protoErr, ok := h.find("protocol error")
+	if !ok {
+		t.Fatal("protocol error not logged")
+	}
+	if protoErr.Level != slog.LevelError {
+		t.Errorf("protocol error level = %v, want ERROR", protoErr.Level)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if v, ok := attrs(r)[logKeyEvent]; ok && v.String() == "seq_text" {
+			t.Error("seq_text logged despite filter")
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Package mapreduce summarizes documents too large for one prompt. The
+// document is split into chunks, a map prompt runs on each chunk in its own
+// sequence, and a reduce prompt combines the results. When the map outputs
+// are themselves too large, they are reduced in groups until one remains.
+//
+//	summary, err := mapreduce.Run(ctx, client, doc, mapreduce.Options{
+//	    Model:        "meta/llama3.1-8b-instruct-free",
+//	    MapPrompt:    "Summarize this section:\n\n%s",
+//	    ReducePrompt: "Combine these section summaries into one summary:\n\n%s",
+//	})
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// Defaults for Options.
+const (
+	DefaultChunkSize   = 8000
+	DefaultConcurrency = 4
+)
+
+// Separator joins map outputs in the reduce prompt.
+const Separator = "\n\n---\n\n"
+
+// Phases reported in Progress.
+const (
+	PhaseMap    = "map"
+	PhaseReduce = "reduce"
+)
+
+// Options configures Run.
+type Options struct {
+	// Model is the model sequences are opened with.
+	Model string
+
+	// MapPrompt is a format string with one %s verb for a chunk.
+	MapPrompt string
+
+	// ReducePrompt is a format string with one %s verb for the map outputs,
+	// joined with Separator.
+	ReducePrompt string
+
+	// ChunkSize is the largest chunk, in bytes. Defaults to
+	// DefaultChunkSize. It also bounds the map outputs reduced at once.
+	ChunkSize int
+
+	// Concurrency is how many sequences run at once. Defaults to
+	// DefaultConcurrency.
+	Concurrency int
+
+	// OpenOptions and GenOptions apply to every sequence and generation.
+	OpenOptions []modelsocket.OpenOption
+	GenOptions  []modelsocket.GenOption
+
+	// OnProgress, if set, is called each time a prompt completes. Calls
+	// are serialized.
+	OnProgress func(Progress)
+}
+
+// Progress reports how far a run has got.
+type Progress struct {
+	Phase string // PhaseMap or PhaseReduce
+	Level int    // Reduce level, from 1; 0 while mapping
+	Done  int    // Prompts completed in this phase and level
+	Total int    // Prompts in this phase and level
+}
+
+// ChunkError reports the prompt that failed.
+type ChunkError struct {
+	Phase string
+	Index int // Chunk or group index
+	Err   error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("mapreduce: %s %d: %v", e.Phase, e.Index, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNoPrompt is returned when MapPrompt or ReducePrompt is missing.
+var ErrNoPrompt = errors.New("mapreduce: MapPrompt and ReducePrompt are required")
+
+// Run maps doc's chunks and reduces the outputs to one text. It stops at the
+// first failed prompt with a [*ChunkError].
+func Run(ctx context.Context, client *modelsocket.Client, doc string, opts Options) (string, error) {
+	if opts.MapPrompt == "" || opts.ReducePrompt == "" {
+		return "", ErrNoPrompt
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	r := &runner{client: client, opts: opts}
+
+	chunks := Split(doc, opts.ChunkSize)
+	prompts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		prompts[i] = fmt.Sprintf(opts.MapPrompt, chunk)
+	}
+	outputs, err := r.runAll(ctx, PhaseMap, 0, prompts)
+	if err != nil {
+		return "", err
+	}
+
+	// Reduce in groups that fit a chunk until one output remains
+	for level := 1; ; level++ {
+		groups := group(outputs, opts.ChunkSize)
+		prompts := make([]string, len(groups))
+		for i, g := range groups {
+			prompts[i] = fmt.Sprintf(opts.ReducePrompt, strings.Join(g, Separator))
+		}
+		outputs, err = r.runAll(ctx, PhaseReduce, level, prompts)
+		if err != nil {
+			return "", err
+		}
+		if len(outputs) == 1 {
+			return outputs[0], nil
+		}
+	}
+}
+
+// runner runs prompts for one call to Run.
+type runner struct {
+	client *modelsocket.Client
+	opts   Options
+
+	progressMu sync.Mutex
+}
+
+// runAll runs prompts concurrently, each in its own sequence, and returns
+// their outputs in order.
+func (r *runner) runAll(ctx context.Context, phase string, level int, prompts []string) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outputs := make([]string, len(prompts))
+	sem := make(chan struct{}, r.opts.Concurrency)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	done := 0
+
+	for i, prompt := range prompts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			output, err := r.run(ctx, prompt)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = &ChunkError{Phase: phase, Index: i, Err: err}
+					cancel()
+				})
+				return
+			}
+			outputs[i] = output
+
+			if r.opts.OnProgress != nil {
+				r.progressMu.Lock()
+				done++
+				r.opts.OnProgress(Progress{Phase: phase, Level: level, Done: done, Total: len(prompts)})
+				r.progressMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// run generates a reply to prompt in a new sequence.
+func (r *runner) run(ctx context.Context, prompt string) (string, error) {
+	seq, err := r.client.Open(ctx, r.opts.Model, r.opts.OpenOptions...)
+	if err != nil {
+		return "", err
+	}
+	defer seq.Close(context.WithoutCancel(ctx))
+
+	if err := seq.Append(ctx, prompt, modelsocket.AsUser()); err != nil {
+		return "", err
+	}
+
+	opts := append([]modelsocket.GenOption{modelsocket.GenerateAsAssistant()}, r.opts.GenOptions...)
+	stream, err := seq.Generate(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	text, err := stream.Text(ctx)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// Split divides doc into chunks of at most size bytes. It breaks between
+// paragraphs where it can, then between words, and only splits a word
+// longer than size.
+func Split(doc string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			chunks = append(chunks, text)
+		}
+		current.Reset()
+	}
+
+	for _, para := range strings.Split(doc, "\n\n") {
+		if current.Len() > 0 && current.Len()+2+len(para) > size {
+			flush()
+		}
+		if len(para) <= size {
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(para)
+			continue
+		}
+
+		// The paragraph alone is too large
+		flush()
+		for _, part := range splitWords(para, size) {
+			chunks = append(chunks, part)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitWords divides text into parts of at most size bytes at whitespace.
+func splitWords(text string, size int) []string {
+	var parts []string
+	for len(text) > size {
+		cut := strings.LastIndexFunc(text[:size+1], unicode.IsSpace)
+		if cut <= 0 {
+			// No break in range; split the word, keeping runes whole
+			cut = size
+			for cut > 0 && !utf8RuneStart(text[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = size
+			}
+		}
+		if part := strings.TrimSpace(text[:cut]); part != "" {
+			parts = append(parts, part)
+		}
+		text = strings.TrimLeftFunc(text[cut:], unicode.IsSpace)
+	}
+	if text = strings.TrimSpace(text); text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+// utf8RuneStart reports whether b can start a UTF-8 encoded rune.
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// group packs outputs into groups whose joined length fits size, keeping at
+// least two outputs per group so each level of reduction makes progress.
+func group(outputs []string, size int) [][]string {
+	var groups [][]string
+	var current []string
+	length := 0
+
+	for _, output := range outputs {
+		if len(current) >= 2 && length+len(Separator)+len(output) > size {
+			groups = append(groups, current)
+			current, length = nil, 0
+		}
+		if len(current) > 0 {
+			length += len(Separator)
+		}
+		current = append(current, output)
+		length += len(output)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
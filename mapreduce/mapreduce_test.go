@@ -0,0 +1,178 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers each generation with reply
+// applied to the sequence's last appended text.
+func newServer(reply func(prompt string) (string, error)) *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		text, err := reply(g.Prompt())
+		if err != nil {
+			return []*modelsocket.MSEvent{mstest.Error(err.Error())}
+		}
+		return mstest.Reply(text)
+	})
+}
+
+func newClient(t *testing.T, transport *mstest.Server) *modelsocket.Client {
+	t.Helper()
+
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, transport)
+	t.Cleanup(func() { client.Close(ctx) })
+	return client
+}
+
+// summarize answers map prompts with the first word of each paragraph and
+// reduce prompts with the outputs, both joined by "+".
+func summarize(prompt string) (string, error) {
+	if chunk, ok := strings.CutPrefix(prompt, "map: "); ok {
+		var words []string
+		for _, para := range strings.Split(chunk, "\n\n") {
+			words = append(words, strings.Fields(para)[0])
+		}
+		return strings.Join(words, "+"), nil
+	}
+	if outputs, ok := strings.CutPrefix(prompt, "reduce: "); ok {
+		return strings.Join(strings.Split(outputs, Separator), "+"), nil
+	}
+	return "", fmt.Errorf("unexpected prompt %q", prompt)
+}
+
+func TestRun(t *testing.T) {
+	transport := newServer(summarize)
+	client := newClient(t, transport)
+
+	doc := "alpha one\n\nbeta two\n\ngamma three"
+
+	var progress []Progress
+	out, err := Run(context.Background(), client, doc, Options{
+		Model:        "test-model",
+		MapPrompt:    "map: %s",
+		ReducePrompt: "reduce: %s",
+		ChunkSize:    12,
+		Concurrency:  2,
+		OnProgress:   func(p Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if out != "alpha+beta+gamma" {
+		t.Errorf("output = %q, want alpha+beta+gamma", out)
+	}
+
+	if opened, closed := transport.Opened(), transport.Closed(); opened != 6 || closed != 6 {
+		t.Errorf("opened %d and closed %d sequences, want 6 of each", opened, closed)
+	}
+	if maxOpen := transport.MaxOpen(); maxOpen > 2 {
+		t.Errorf("max open sequences = %d, want at most 2", maxOpen)
+	}
+
+	// The three outputs don't fit one reduce prompt, so two are reduced
+	// first
+	want := []Progress{
+		{Phase: PhaseMap, Done: 1, Total: 3},
+		{Phase: PhaseMap, Done: 2, Total: 3},
+		{Phase: PhaseMap, Done: 3, Total: 3},
+		{Phase: PhaseReduce, Level: 1, Done: 1, Total: 2},
+		{Phase: PhaseReduce, Level: 1, Done: 2, Total: 2},
+		{Phase: PhaseReduce, Level: 2, Done: 1, Total: 1},
+	}
+	if fmt.Sprint(progress) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+}
+
+func TestRun_ReducesInLevels(t *testing.T) {
+	transport := newServer(summarize)
+	client := newClient(t, transport)
+
+	var words []string
+	for i := range 8 {
+		words = append(words, fmt.Sprintf("w%d", i))
+	}
+
+	// Three words fit a chunk, and two map outputs don't fit a reduce
+	// prompt, so the outputs are reduced twice
+	out, err := Run(context.Background(), client, strings.Join(words, "\n\n"), Options{
+		Model:        "test-model",
+		MapPrompt:    "map: %s",
+		ReducePrompt: "reduce: %s",
+		ChunkSize:    11,
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if out != strings.Join(words, "+") {
+		t.Errorf("output = %q, want all words in order", out)
+	}
+}
+
+func TestRun_ChunkError(t *testing.T) {
+	transport := newServer(func(prompt string) (string, error) {
+		if strings.Contains(prompt, "bad") {
+			return "", errors.New("model failed")
+		}
+		return summarize(prompt)
+	})
+	client := newClient(t, transport)
+
+	_, err := Run(context.Background(), client, "good\n\nbad", Options{
+		Model:        "test-model",
+		MapPrompt:    "map: %s",
+		ReducePrompt: "reduce: %s",
+		ChunkSize:    5,
+		Concurrency:  1,
+	})
+
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("err = %v, want *ChunkError", err)
+	}
+	if chunkErr.Phase != PhaseMap || chunkErr.Index != 1 {
+		t.Errorf("ChunkError = %+v, want map chunk 1", chunkErr)
+	}
+	var protoErr *modelsocket.ProtocolError
+	if !errors.As(err, &protoErr) {
+		t.Errorf("err = %v, want wrapped *ProtocolError", err)
+	}
+}
+
+func TestRun_NoPrompt(t *testing.T) {
+	if _, err := Run(context.Background(), nil, "doc", Options{MapPrompt: "%s"}); !errors.Is(err, ErrNoPrompt) {
+		t.Errorf("err = %v, want ErrNoPrompt", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		size int
+		want []string
+	}{
+		{"packs paragraphs", "aa\n\nbb\n\ncc", 6, []string{"aa\n\nbb", "cc"}},
+		{"splits long paragraph at words", "one two three", 8, []string{"one two", "three"}},
+		{"splits long word", "abcdefgh", 3, []string{"abc", "def", "gh"}},
+		{"keeps runes whole", "ééé", 3, []string{"é", "é", "é"}},
+		{"skips blank paragraphs", "a\n\n\n\n\n\nb", 100, []string{"a\n\n\n\n\n\nb"}},
+		{"empty", "  ", 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.doc, tt.size)
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("Split = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,14 @@
 package modelsocket
 
-import "log/slog"
+import (
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
 
 // --- Client Options ---
 
@@ -8,9 +16,67 @@ import "log/slog"
 type ClientOption func(*clientConfig)
 
 type clientConfig struct {
-	logger    *slog.Logger
-	onSend    func(*MSRequest)
-	onReceive func(*MSEvent)
+	logger       *slog.Logger
+	logFilter    func(kind string) bool
+	onSend       func(*MSRequest)
+	onReceive    func(*MSEvent)
+	outputFilter func(*GenChunk) (*GenChunk, error)
+	inputFilter  func(text string, role Role) (string, error)
+	eventLog     *eventLog
+	wireLogger   *slog.Logger
+	wireRedact   bool
+	strictDecode bool
+	readLimit    int64
+	writeTimeout time.Duration
+	openTimeout  time.Duration
+	onSlowWrite  func(WriteStats)
+	slowWrite    time.Duration
+
+	priorityScheduling bool
+
+	onTextChunk  func(seqID string, chunk *GenChunk)
+	onToolCall   func(seqID string, calls []ToolCall)
+	onGenFinish  func(seqID string, stats GenStats)
+	onSeqClosed  func(seqID string, stats SeqStats)
+	onDisconnect func(err error)
+	onUnknown    func(*MSEvent)
+	onOrphan     func(*MSEvent)
+
+	budget      *budget // Created from budgetLimit by newClient
+	budgetLimit *Budget
+	costFunc    func(model string, inputTokens, outputTokens int) float64
+
+	contextLimits    *contextLimits
+	onContextWarning func(ContextWarning)
+
+	idGenerator func() string
+
+	prompts  *PromptRegistry
+	audit    *audit
+	training *training
+}
+
+// newClientConfig applies options to an empty config.
+func newClientConfig(opts []ClientOption) clientConfig {
+	cfg := clientConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// dialOptions returns the transport settings derived from the config.
+func (c *clientConfig) dialOptions() *DialOptions {
+	return &DialOptions{
+		WireLogger:     c.wireLogger,
+		RedactWireText: c.wireRedact,
+		StrictDecoding: c.strictDecode,
+		ReadLimit:      c.readLimit,
+
+		WriteTimeout:       c.writeTimeout,
+		OnSlowWrite:        c.onSlowWrite,
+		SlowWriteThreshold: c.slowWrite,
+	}
 }
 
 // WithLogger sets a structured logger for the client.
@@ -20,6 +86,20 @@ func WithLogger(logger *slog.Logger) ClientOption {
 	}
 }
 
+// WithLogFilter limits which events and requests are logged by the logger
+// set with [WithLogger]. fn receives the event type (e.g. "seq_text") or
+// request type (e.g. "seq_command") and returns false to skip it. Warnings
+// and errors about the connection itself are always logged.
+//
+//	modelsocket.WithLogFilter(func(kind string) bool {
+//	    return kind != "seq_text"
+//	})
+func WithLogFilter(fn func(kind string) bool) ClientOption {
+	return func(c *clientConfig) {
+		c.logFilter = fn
+	}
+}
+
 // WithOnSend sets a callback invoked before each request is sent.
 func WithOnSend(fn func(*MSRequest)) ClientOption {
 	return func(c *clientConfig) {
@@ -34,14 +114,286 @@ func WithOnReceive(fn func(*MSEvent)) ClientOption {
 	}
 }
 
+// WithOnTextChunk sets a callback invoked for every seq_text event, before
+// any tool call parsing or output filtering. Like all hooks it runs on the
+// read loop and must not block.
+func WithOnTextChunk(fn func(seqID string, chunk *GenChunk)) ClientOption {
+	return func(c *clientConfig) {
+		c.onTextChunk = fn
+	}
+}
+
+// WithOnToolCall sets a callback invoked for every seq_tool_call event.
+func WithOnToolCall(fn func(seqID string, calls []ToolCall)) ClientOption {
+	return func(c *clientConfig) {
+		c.onToolCall = fn
+	}
+}
+
+// WithOnGenFinish sets a callback invoked when a generation finishes.
+func WithOnGenFinish(fn func(seqID string, stats GenStats)) ClientOption {
+	return func(c *clientConfig) {
+		c.onGenFinish = fn
+	}
+}
+
+// WithOnSeqClosed sets a callback invoked when a sequence closes, whether by
+// the server, [Seq.Close] or [Client.Close].
+func WithOnSeqClosed(fn func(seqID string, stats SeqStats)) ClientOption {
+	return func(c *clientConfig) {
+		c.onSeqClosed = fn
+	}
+}
+
+// WithOnDisconnect sets a callback invoked when the connection is lost, with
+// the error that terminated it (also available from [Client.Err]). It is not
+// called when the connection is closed with [Client.Close].
+func WithOnDisconnect(fn func(err error)) ClientOption {
+	return func(c *clientConfig) {
+		c.onDisconnect = fn
+	}
+}
+
+// WithOnUnknownEvent registers a hook called with events of types the client
+// doesn't handle, e.g. from a newer server. The frame is in MSEvent.Raw.
+// Such events are otherwise only logged.
+func WithOnUnknownEvent(fn func(*MSEvent)) ClientOption {
+	return func(c *clientConfig) {
+		c.onUnknown = fn
+	}
+}
+
+// WithOnOrphanEvent registers a hook called with events for sequences the
+// client doesn't know, such as events arriving after a sequence was closed
+// locally, or a sequence opened for an Open that timed out. Such events are
+// otherwise only logged and counted by [Client.OrphanEvents].
+func WithOnOrphanEvent(fn func(*MSEvent)) ClientOption {
+	return func(c *clientConfig) {
+		c.onOrphan = fn
+	}
+}
+
+// WithStrictDecoding rejects malformed frames and unknown events instead of
+// decoding what it can (see [DecodeOptions]). Rejected frames are logged and
+// skipped. It has no effect with [NewWithTransport].
+func WithStrictDecoding() ClientOption {
+	return func(c *clientConfig) {
+		c.strictDecode = true
+	}
+}
+
+// WithReadLimit sets the largest frame the client accepts, in bytes, as
+// DialOptions.ReadLimit. Larger frames are discarded and logged without
+// closing the connection. It has no effect with [NewWithTransport].
+func WithReadLimit(n int64) ClientOption {
+	return func(c *clientConfig) {
+		c.readLimit = n
+	}
+}
+
+// WithWriteTimeout bounds each frame write, as DialOptions.WriteTimeout. A
+// write that times out fails with a [*WriteTimeoutError] and the connection
+// is lost. It has no effect with [NewWithTransport].
+func WithWriteTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.writeTimeout = d
+	}
+}
+
+// WithOpenTimeout bounds the wait for the server to open a sequence when the
+// context passed to [Client.Open] has no deadline. Defaults to
+// [DefaultOpenTimeout]; negative disables it, so Open waits as long as its
+// context allows.
+func WithOpenTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.openTimeout = d
+	}
+}
+
+// WithOnSlowWrite calls fn for sends that take longer than threshold,
+// including time waiting behind other sends. It has no effect with
+// [NewWithTransport].
+func WithOnSlowWrite(threshold time.Duration, fn func(WriteStats)) ClientOption {
+	return func(c *clientConfig) {
+		c.slowWrite = threshold
+		c.onSlowWrite = fn
+	}
+}
+
+// WithPriorityScheduling queues outbound requests and sends them one at a
+// time, highest [Priority] first, so bulk work such as replaying history
+// doesn't hold up interactive generations on the same connection. Requests
+// on the same sequence are still sent in the order they were made. Without
+// it, requests are sent as soon as they are made and priorities are ignored.
+func WithPriorityScheduling() ClientOption {
+	return func(c *clientConfig) {
+		c.priorityScheduling = true
+	}
+}
+
+// WithWireDebug logs every raw JSON frame sent and received by the WebSocket
+// transport at debug level, with frame sizes and encode/decode timings. It is
+// intended for diagnosing server interop issues that the typed hooks can't
+// show, and only applies to clients created with [Connect].
+func WithWireDebug(logger *slog.Logger) ClientOption {
+	return func(c *clientConfig) {
+		c.wireLogger = logger
+	}
+}
+
+// WithWireRedaction replaces text fields (generated and appended text, tool
+// results) in frames logged by [WithWireDebug] with their length.
+func WithWireRedaction() ClientOption {
+	return func(c *clientConfig) {
+		c.wireRedact = true
+	}
+}
+
+// WithEventLog writes a JSONL transcript of every request sent and event
+// received, with timestamps and direction, to w. Each line is an
+// [EventLogEntry]; use [ReadEventLog] to load a transcript for offline
+// debugging or replay. Writes are serialized, so w need not be safe for
+// concurrent use.
+func WithEventLog(w io.Writer) ClientOption {
+	return func(c *clientConfig) {
+		c.eventLog = newEventLog(w)
+	}
+}
+
+// WithAudit records every append, generation, tool call and tool result to
+// sink as an [AuditRecord], with fields redacted by policy. Records are
+// written as they complete; a failed write is logged and doesn't affect the
+// sequence.
+func WithAudit(sink AuditSink, policy AuditPolicy) ClientOption {
+	return func(c *clientConfig) {
+		c.audit = &audit{sink: sink, policy: policy}
+	}
+}
+
+// WithTrainingCapture collects generations as [TrainingRecord]s for
+// fine-tuning, in a sample of sequences chosen by policy. A sequence's
+// records, with any ratings from [Seq.Rate], are redacted by policy and
+// written to sink when it closes; a failed write is logged and doesn't
+// affect the client.
+func WithTrainingCapture(sink TrainingSink, policy TrainingPolicy) ClientOption {
+	return func(c *clientConfig) {
+		c.training = &training{sink: sink, policy: policy}
+	}
+}
+
+// WithOutputFilter sets a guardrail applied to every generated chunk before it
+// reaches the consumer. The filter may return the chunk unchanged, a
+// rewritten chunk (e.g. with text redacted), or nil to drop it. Returning an
+// error aborts the generation: the stream ends with that error and a cancel
+// command is sent to the server.
+func WithOutputFilter(fn func(chunk *GenChunk) (*GenChunk, error)) ClientOption {
+	return func(c *clientConfig) {
+		c.outputFilter = fn
+	}
+}
+
+// WithInputFilter sets a guardrail applied to text before it is appended to a
+// sequence, e.g. for PII scrubbing or prompt-injection scanning. The filter
+// returns the text to append, which may be rewritten; returning an error
+// rejects the append and the error is returned from [Seq.Append].
+func WithInputFilter(fn func(text string, role Role) (string, error)) ClientOption {
+	return func(c *clientConfig) {
+		c.inputFilter = fn
+	}
+}
+
+// WithClientBudget caps the tokens and cost of all generations on the
+// client. Zero values are unlimited. A generation that would exceed the
+// budget is cancelled and its stream ends with a [*BudgetExceededError];
+// once the budget is used up, new generations fail with one.
+func WithClientBudget(maxInputTokens, maxOutputTokens int, maxCost float64) ClientOption {
+	limit := Budget{MaxInputTokens: maxInputTokens, MaxOutputTokens: maxOutputTokens, MaxCost: maxCost}
+	return func(c *clientConfig) {
+		c.budgetLimit = &limit
+	}
+}
+
+// WithPricing prices generations from a per-model table, for
+// [GenStream.Cost], [GenStats] and budgets with a cost cap. It replaces any
+// [WithCostFunc].
+func WithPricing(pricing Pricing) ClientOption {
+	return func(c *clientConfig) {
+		c.costFunc = pricing.Cost
+	}
+}
+
+// WithCostFunc sets how the cost of a generation is computed from its model
+// and token counts, for [GenStream.Cost], [GenStats] and budgets with a cost
+// cap. It replaces any [WithPricing].
+func WithCostFunc(fn func(model string, inputTokens, outputTokens int) float64) ClientOption {
+	return func(c *clientConfig) {
+		c.costFunc = fn
+	}
+}
+
+// WithContextWindows sets the context windows of models, and warns when a
+// sequence's context crosses each of thresholds, fractions of its model's
+// window: the warning is logged and passed to [WithOnContextWarning]. Each
+// threshold warns once per sequence. Thresholds default to
+// [DefaultContextThresholds].
+func WithContextWindows(windows ContextWindows, thresholds ...float64) ClientOption {
+	return func(c *clientConfig) {
+		c.contextLimits = newContextLimits(windows, thresholds)
+	}
+}
+
+// WithOnContextWarning registers a hook called when a sequence's context
+// crosses a threshold set with [WithContextWindows].
+func WithOnContextWarning(fn func(ContextWarning)) ClientOption {
+	return func(c *clientConfig) {
+		c.onContextWarning = fn
+	}
+}
+
+// WithIDGenerator replaces the random UUIDs used as command IDs (CIDs), so
+// tests and recorded sessions can use stable IDs. fn must return unique IDs
+// and be safe for concurrent use; [SequentialIDs] is one such generator.
+func WithIDGenerator(fn func() string) ClientOption {
+	return func(c *clientConfig) {
+		c.idGenerator = fn
+	}
+}
+
+// SequentialIDs returns an ID generator for [WithIDGenerator] that numbers
+// IDs from 1 after prefix: "cid-1", "cid-2", and so on for prefix "cid-".
+func SequentialIDs(prefix string) func() string {
+	var n atomic.Int64
+	return func() string {
+		return prefix + strconv.FormatInt(n.Add(1), 10)
+	}
+}
+
+// WithPromptRegistry sets the registry [Seq.AppendPrompt] renders prompts
+// from.
+func WithPromptRegistry(r *PromptRegistry) ClientOption {
+	return func(c *clientConfig) {
+		c.prompts = r
+	}
+}
+
 // --- Open Options ---
 
 // OpenOption configures sequence opening.
 type OpenOption func(*openConfig)
 
 type openConfig struct {
-	skipPrelude bool
-	toolbox     *Toolbox
+	skipPrelude    bool
+	tools          *ToolSet
+	toolSources    []string // Options that set tools, for conflict errors
+	toolPrompt     *string
+	toolCallParser func() ToolCallParser
+	budget         *budget // Created from budgetLimit on open, or shared
+	budgetLimit    *Budget
+	tags           map[string]string
+	genDefaults    []GenOption
+	priority       *Priority
+	label          string
+	runID          string
 }
 
 // WithSkipPrelude skips the model's default prelude/system prompt.
@@ -51,10 +403,117 @@ func WithSkipPrelude() OpenOption {
 	}
 }
 
-// WithToolbox registers a toolbox for tool calling.
+// WithSeqPriority sets the priority of the sequence's requests, including
+// opening it, with [WithPriorityScheduling]. [WithGenPriority] and
+// [WithAppendPriority] override it for a single request.
+func WithSeqPriority(p Priority) OpenOption {
+	return func(c *openConfig) {
+		c.priority = &p
+	}
+}
+
+// WithToolbox registers a toolbox for tool calling. The sequence uses a
+// snapshot taken by [Toolbox.Freeze] when it opens, so later changes to the
+// toolbox only apply to sequences opened after them. [Seq.Tools] returns the
+// snapshot.
 func WithToolbox(tb *Toolbox) OpenOption {
 	return func(c *openConfig) {
-		c.toolbox = tb
+		set := tb.Freeze()
+		c.tools = &set
+		c.toolSources = append(slices.Clip(c.toolSources), "WithToolbox")
+	}
+}
+
+// WithToolSet registers a frozen toolbox for tool calling.
+func WithToolSet(set ToolSet) OpenOption {
+	return func(c *openConfig) {
+		c.tools = &set
+		c.toolSources = append(slices.Clip(c.toolSources), "WithToolSet")
+	}
+}
+
+// WithToolPrompt sets the tool prompt sent to the server when the sequence
+// opens. It fills in the instructions of a toolbox that has none; if the
+// toolbox has instructions set with [Toolbox.SetToolInstructions], Open
+// fails with an [*OptionConflictError].
+func WithToolPrompt(prompt string) OpenOption {
+	return func(c *openConfig) {
+		c.toolPrompt = &prompt
+	}
+}
+
+// conflict returns an error if options in c set the same thing.
+func (c openConfig) conflict() error {
+	if len(c.toolSources) > 1 {
+		return &OptionConflictError{
+			First:  c.toolSources[0],
+			Second: c.toolSources[1],
+			Reason: "both register the sequence's tools",
+		}
+	}
+	if c.toolPrompt != nil && c.tools != nil && c.tools.ToolInstructions() != "" {
+		return &OptionConflictError{
+			First:  c.toolSources[0],
+			Second: "WithToolPrompt",
+			Reason: "both set the tool prompt",
+		}
+	}
+	return nil
+}
+
+// WithToolCallParser enables client-side detection of tool calls written into
+// generated text, for models or servers that don't emit seq_tool_call events.
+// newParser is called once per generation; detected calls are delivered as
+// GenChunk.ToolCalls and removed from the chunk text.
+//
+//	seq, err := client.Open(ctx, model,
+//	    modelsocket.WithToolCallParser(modelsocket.NewTextToolCallParser),
+//	)
+func WithToolCallParser(newParser func() ToolCallParser) OpenOption {
+	return func(c *openConfig) {
+		c.toolCallParser = newParser
+	}
+}
+
+// WithSeqBudget caps the tokens and cost of the sequence's generations, as
+// [WithClientBudget] does for a client. Forks of the sequence share its
+// budget.
+func WithSeqBudget(maxInputTokens, maxOutputTokens int, maxCost float64) OpenOption {
+	limit := Budget{MaxInputTokens: maxInputTokens, MaxOutputTokens: maxOutputTokens, MaxCost: maxCost}
+	return func(c *openConfig) {
+		c.budgetLimit = &limit
+	}
+}
+
+// WithSeqTag attaches a key/value tag to the sequence. Tags are reported in
+// [GenStats] and [Usage], so usage can be attributed to an experiment arm,
+// prompt version or customer. Forks inherit their parent's tags.
+func WithSeqTag(key, value string) OpenOption {
+	return func(c *openConfig) {
+		tags := make(map[string]string, len(c.tags)+1)
+		maps.Copy(tags, c.tags)
+		tags[key] = value
+		c.tags = tags
+	}
+}
+
+// WithSeqLabel names the sequence, so orchestration code can look it up
+// with [Client.SeqByLabel] instead of passing it around. A sequence opened
+// with the label of an open one takes the label over, so sequences that
+// replace another by replaying its history, such as after
+// [Seq.RollbackTo], keep its name. Forks aren't labelled.
+func WithSeqLabel(label string) OpenOption {
+	return func(c *openConfig) {
+		c.label = label
+	}
+}
+
+// WithGenDefaults sets options applied to every generation on the sequence,
+// before the options passed to [Seq.Generate] or [Seq.ToolReturn], which
+// override them.
+func WithGenDefaults(opts ...GenOption) OpenOption {
+	return func(c *openConfig) {
+		c.genDefaults = append(slices.Clip(c.genDefaults), opts...)
 	}
 }
 
@@ -64,8 +523,11 @@ func WithToolbox(tb *Toolbox) OpenOption {
 type AppendOption func(*appendConfig)
 
 type appendConfig struct {
-	role Role
-	echo bool
+	role     Role
+	echo     bool
+	hidden   bool
+	prompt   string // Reference of a registered prompt
+	priority *Priority
 }
 
 // AsUser marks the message as from the user.
@@ -89,13 +551,40 @@ func AsSystem() AppendOption {
 	}
 }
 
-// WithEcho echoes the appended text back in events.
+// AsRole marks the message as from role. Use it for roles other than the
+// predefined ones, such as "critic" or "function", that the server's chat
+// template supports.
+func AsRole(role Role) AppendOption {
+	return func(c *appendConfig) {
+		c.role = role
+	}
+}
+
+// WithEcho echoes the appended text back in events. Use [Seq.AppendStream]
+// to receive them.
 func WithEcho() AppendOption {
 	return func(c *appendConfig) {
 		c.echo = true
 	}
 }
 
+// AppendHidden hides the appended text from the conversation history, as
+// [WithHidden] does for generated text.
+func AppendHidden() AppendOption {
+	return func(c *appendConfig) {
+		c.hidden = true
+	}
+}
+
+// WithAppendPriority sets the append's priority with
+// [WithPriorityScheduling]. Appends default to the sequence's priority, or
+// [PriorityNormal].
+func WithAppendPriority(p Priority) AppendOption {
+	return func(c *appendConfig) {
+		c.priority = &p
+	}
+}
+
 // --- Generate Options ---
 
 // GenOption configures text generation.
@@ -113,6 +602,20 @@ type genConfig struct {
 	stopStrings   []string
 	regexMask     *string
 	hidden        bool
+	suffix        *string
+	retry         *RetryPolicy
+	hedge         *time.Duration
+	coalesce      bool
+	zeroCopy      bool
+	budget        *budget // Created from budgetLimit by Generate
+	budgetLimit   *Budget
+	priority      *Priority
+
+	deadlineBudget bool
+	safety         *SafetyPolicy
+
+	onProgress       func(tokensSoFar int, elapsed time.Duration)
+	progressInterval time.Duration
 }
 
 // GenerateAsUser generates text as the user role.
@@ -136,6 +639,14 @@ func GenerateAsSystem() GenOption {
 	}
 }
 
+// GenerateAsRole generates text as role, which may be one the server's chat
+// template supports beyond the predefined ones.
+func GenerateAsRole(role Role) GenOption {
+	return func(c *genConfig) {
+		c.role = role
+	}
+}
+
 // WithMaxTokens sets the maximum number of tokens to generate.
 func WithMaxTokens(n int) GenOption {
 	return func(c *genConfig) {
@@ -206,6 +717,113 @@ func WithHidden() GenOption {
 	}
 }
 
+// WithSuffix sets the text that follows the generation, for fill-in-the-middle
+// completion: the sequence holds the text before the insertion point and the
+// model generates what goes between it and suffix. Only models trained for
+// infilling, typically code models, support it.
+func WithSuffix(suffix string) GenOption {
+	return func(c *genConfig) {
+		c.suffix = &suffix
+	}
+}
+
+// WithGenerateRetry retries generations that fail transiently, by replaying
+// the conversation into a new sequence and generating again. The stream hides
+// the switch; [GenStream.Seq] returns the sequence the generation finished
+// on, which replaces the original for later calls.
+//
+//	stream, err := seq.Generate(ctx, modelsocket.WithGenerateRetry(modelsocket.RetryPolicy{
+//	    MaxAttempts: 3,
+//	    Backoff:     500 * time.Millisecond,
+//	    Dedupe:      true,
+//	}))
+func WithGenerateRetry(policy RetryPolicy) GenOption {
+	return func(c *genConfig) {
+		c.retry = &policy
+	}
+}
+
+// WithHedge guards against slow generations by forking the sequence first
+// and, if no output arrives within delay, starting the same generation on the
+// fork. Whichever produces output first is streamed; the other is cancelled
+// and its sequence closed. When the fork wins, the original sequence is
+// closed and [GenStream.Seq] returns the fork, which holds the conversation
+// from then on.
+//
+// Hedging costs a fork per generation and, when it triggers, a duplicate
+// generation. It takes precedence over [WithGenerateRetry].
+func WithHedge(delay time.Duration) GenOption {
+	return func(c *genConfig) {
+		c.hedge = &delay
+	}
+}
+
+// WithCoalesce lets identical concurrent generations on the client share one
+// upstream generation. Generations are identical when their sequences have
+// the same model and history and the options are the same. The first call
+// generates; later calls stream the same output, which is then appended to
+// their own sequences as if they had generated it.
+//
+// Only deterministic generations are shared: those with [WithSeed] or a
+// temperature of 0, on sequences without a toolbox or tool call parser.
+// Other generations, and those using [WithHedge] or [WithGenerateRetry], run
+// normally.
+func WithCoalesce() GenOption {
+	return func(c *genConfig) {
+		c.coalesce = true
+	}
+}
+
+// WithZeroCopyChunks delivers chunk text in [GenChunk.Bytes], a buffer
+// taken from a pool shared by all streams, rather than in Text. It suits
+// high-throughput consumers that aggregate bytes themselves: buffers are
+// reused from chunk to chunk, so the consumer doesn't allocate a byte slice
+// per chunk to convert Text. Consumers must copy what they keep and call
+// [GenChunk.Release] once done with a chunk, after which Bytes is reused.
+// [GenStream.Text] handles this itself.
+func WithZeroCopyChunks() GenOption {
+	return func(c *genConfig) {
+		c.zeroCopy = true
+	}
+}
+
+// WithOnProgress calls fn with the output tokens streamed so far and the
+// time since the generation started, every [DefaultProgressInterval] or the
+// interval set with [WithProgressInterval], and once more when the stream
+// ends. It is called whether or not chunks arrive, so it can drive progress
+// bars and watchdogs that detect stalled generations. fn runs on its own
+// goroutine and must not block.
+func WithOnProgress(fn func(tokensSoFar int, elapsed time.Duration)) GenOption {
+	return func(c *genConfig) {
+		c.onProgress = fn
+	}
+}
+
+// WithProgressInterval sets how often [WithOnProgress] calls its function.
+func WithProgressInterval(d time.Duration) GenOption {
+	return func(c *genConfig) {
+		c.progressInterval = d
+	}
+}
+
+// WithGenPriority sets the generation's priority with
+// [WithPriorityScheduling]. Generations default to the sequence's priority,
+// or [PriorityInteractive].
+func WithGenPriority(p Priority) GenOption {
+	return func(c *genConfig) {
+		c.priority = &p
+	}
+}
+
+// WithBudget caps the tokens and cost of a single generation, including any
+// retries, as [WithClientBudget] does for a client.
+func WithBudget(maxInputTokens, maxOutputTokens int, maxCost float64) GenOption {
+	limit := Budget{MaxInputTokens: maxInputTokens, MaxOutputTokens: maxOutputTokens, MaxCost: maxCost}
+	return func(c *genConfig) {
+		c.budgetLimit = &limit
+	}
+}
+
 // Helper to convert genConfig to SeqGenData for wire format.
 func (c *genConfig) toSeqGenData() SeqGenData {
 	return SeqGenData{
@@ -220,5 +838,6 @@ func (c *genConfig) toSeqGenData() SeqGenData {
 		StopStrings:   c.stopStrings,
 		RegexMask:     c.regexMask,
 		Hidden:        c.hidden,
+		Suffix:        c.suffix,
 	}
 }
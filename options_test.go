@@ -1,6 +1,9 @@
 package modelsocket
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestGenOption_MaxTokens(t *testing.T) {
 	cfg := genConfig{}
@@ -92,6 +95,7 @@ func TestGenOption_Role(t *testing.T) {
 		{"User", GenerateAsUser(), RoleUser},
 		{"Assistant", GenerateAsAssistant(), RoleAssistant},
 		{"System", GenerateAsSystem(), RoleSystem},
+		{"Custom", GenerateAsRole("critic"), Role("critic")},
 	}
 
 	for _, tt := range tests {
@@ -114,6 +118,7 @@ func TestAppendOption_Role(t *testing.T) {
 		{"User", AsUser(), RoleUser},
 		{"Assistant", AsAssistant(), RoleAssistant},
 		{"System", AsSystem(), RoleSystem},
+		{"Custom", AsRole("function"), Role("function")},
 	}
 
 	for _, tt := range tests {
@@ -127,6 +132,15 @@ func TestAppendOption_Role(t *testing.T) {
 	}
 }
 
+func TestAppendOption_Hidden(t *testing.T) {
+	cfg := appendConfig{}
+	AppendHidden()(&cfg)
+
+	if !cfg.hidden {
+		t.Error("hidden = false, want true")
+	}
+}
+
 func TestAppendOption_Echo(t *testing.T) {
 	cfg := appendConfig{}
 	WithEcho()(&cfg)
@@ -147,14 +161,73 @@ func TestOpenOption_SkipPrelude(t *testing.T) {
 
 func TestOpenOption_Toolbox(t *testing.T) {
 	tb := NewToolbox()
+	tb.SetToolInstructions("instructions")
 	cfg := openConfig{}
 	WithToolbox(tb)(&cfg)
 
-	if cfg.toolbox != tb {
+	if cfg.tools == nil || cfg.tools.ToolInstructions() != "instructions" {
 		t.Error("toolbox not set correctly")
 	}
 }
 
+func TestOpenOption_Conflicts(t *testing.T) {
+	withInstructions := NewToolbox()
+	withInstructions.SetToolInstructions("instructions")
+
+	tests := []struct {
+		name     string
+		opts     []OpenOption
+		conflict bool
+	}{
+		{"tool prompt alone", []OpenOption{WithToolPrompt("prompt")}, false},
+		{"tool prompt fills toolbox", []OpenOption{WithToolbox(NewToolbox()), WithToolPrompt("prompt")}, false},
+		{"tool prompt and instructions", []OpenOption{WithToolbox(withInstructions), WithToolPrompt("prompt")}, true},
+		{"toolbox and tool set", []OpenOption{WithToolbox(NewToolbox()), WithToolSet(ToolSet{})}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := openConfig{}
+			for _, opt := range tt.opts {
+				opt(&cfg)
+			}
+
+			err := cfg.conflict()
+			if tt.conflict != errors.Is(err, ErrOptionConflict) {
+				t.Errorf("conflict() = %v, want conflict %v", err, tt.conflict)
+			}
+		})
+	}
+}
+
+func TestOpenOption_SeqTag(t *testing.T) {
+	cfg := openConfig{}
+	WithSeqTag("arm", "a")(&cfg)
+	first := cfg.tags
+	WithSeqTag("prompt", "greeting@v3")(&cfg)
+
+	if cfg.tags["arm"] != "a" || cfg.tags["prompt"] != "greeting@v3" {
+		t.Errorf("tags = %v, want arm and prompt", cfg.tags)
+	}
+	// Earlier maps aren't modified, so they can be shared
+	if len(first) != 1 {
+		t.Errorf("first tags = %v, want only arm", first)
+	}
+}
+
+func TestSeq_GenDefaults(t *testing.T) {
+	seq := &Seq{cfg: openConfig{}}
+	WithGenDefaults(WithTemperature(0.2), WithMaxTokens(10))(&seq.cfg)
+
+	cfg := seq.genConfig([]GenOption{WithTemperature(0.9)})
+	if cfg.temperature == nil || *cfg.temperature != 0.9 {
+		t.Errorf("temperature = %v, want call option 0.9", cfg.temperature)
+	}
+	if cfg.maxTokens == nil || *cfg.maxTokens != 10 {
+		t.Errorf("maxTokens = %v, want default 10", cfg.maxTokens)
+	}
+}
+
 func TestGenConfig_ToSeqGenData(t *testing.T) {
 	cfg := genConfig{}
 	GenerateAsAssistant()(&cfg)
@@ -177,3 +250,13 @@ func TestGenConfig_ToSeqGenData(t *testing.T) {
 		t.Errorf("StopStrings = %v, want [END]", data.StopStrings)
 	}
 }
+
+func TestGenOption_Suffix(t *testing.T) {
+	cfg := genConfig{}
+	WithSuffix("\n}\n")(&cfg)
+
+	data := cfg.toSeqGenData()
+	if data.Suffix == nil || *data.Suffix != "\n}\n" {
+		t.Errorf("Suffix = %v, want \"\\n}\\n\"", data.Suffix)
+	}
+}
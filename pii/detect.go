@@ -0,0 +1,160 @@
+package pii
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of PII found by the built-in detectors.
+const (
+	KindEmail      = "EMAIL"
+	KindPhone      = "PHONE"
+	KindCreditCard = "CARD"
+)
+
+// Match is PII found in text, as a byte range.
+type Match struct {
+	Start, End int
+	Kind       string
+}
+
+// Detector finds PII in text.
+type Detector interface {
+	Detect(text string) []Match
+}
+
+// DetectorFunc adapts a function to a [Detector].
+type DetectorFunc func(text string) []Match
+
+func (f DetectorFunc) Detect(text string) []Match {
+	return f(text)
+}
+
+// RegexDetector reports matches of re as kind.
+func RegexDetector(kind string, re *regexp.Regexp) Detector {
+	return DetectorFunc(func(text string) []Match {
+		var matches []Match
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			matches = append(matches, Match{Start: loc[0], End: loc[1], Kind: kind})
+		}
+		return matches
+	})
+}
+
+var (
+	emailRe = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+	// Phone numbers: an optional country code, an area code, then two
+	// groups of 3 or 4 digits, e.g. +44 20 7946 0958 or (555) 123-4567
+	phoneRe = regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{2,4}\)|\d{2,4})[\s.\-]?\d{3,4}[\s.\-]?\d{3,4}`)
+
+	cardRe = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+)
+
+// Email detects email addresses.
+func Email() Detector {
+	return RegexDetector(KindEmail, emailRe)
+}
+
+// Phone detects phone numbers in common international and national formats.
+func Phone() Detector {
+	return DetectorFunc(func(text string) []Match {
+		var matches []Match
+		for _, loc := range phoneRe.FindAllStringIndex(text, -1) {
+			if inLongerNumber(text, loc[0], loc[1]) {
+				continue
+			}
+			if n := countDigits(text[loc[0]:loc[1]]); n >= 7 && n <= 15 {
+				matches = append(matches, Match{Start: loc[0], End: loc[1], Kind: KindPhone})
+			}
+		}
+		return matches
+	})
+}
+
+// CreditCard detects card numbers of 13 to 19 digits, optionally grouped
+// with spaces or dashes, that pass the Luhn check.
+func CreditCard() Detector {
+	return DetectorFunc(func(text string) []Match {
+		var matches []Match
+		for _, loc := range cardRe.FindAllStringIndex(text, -1) {
+			if luhn(text[loc[0]:loc[1]]) {
+				matches = append(matches, Match{Start: loc[0], End: loc[1], Kind: KindCreditCard})
+			}
+		}
+		return matches
+	})
+}
+
+// DefaultDetectors returns the built-in detectors, with credit cards before
+// phone numbers so card numbers aren't reported as phones.
+func DefaultDetectors() []Detector {
+	return []Detector{Email(), CreditCard(), Phone()}
+}
+
+// detectAll runs detectors over text and returns non-overlapping matches in
+// order. Where matches overlap, the earlier detector wins.
+func detectAll(detectors []Detector, text string) []Match {
+	var found []Match
+	for _, d := range detectors {
+	next:
+		for _, m := range d.Detect(text) {
+			if m.Start < 0 || m.End > len(text) || m.Start >= m.End {
+				continue
+			}
+			for _, f := range found {
+				if m.Start < f.End && f.Start < m.End {
+					continue next
+				}
+			}
+			found = append(found, m)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+	return found
+}
+
+// inLongerNumber reports whether text[start:end] is part of a longer run of
+// digits, directly or across a single separator.
+func inLongerNumber(text string, start, end int) bool {
+	digitAt := func(i int) bool { return i >= 0 && i < len(text) && isDigit(text[i]) }
+	sepAt := func(i int) bool { return i >= 0 && i < len(text) && strings.IndexByte(" .-", text[i]) >= 0 }
+
+	return digitAt(start-1) || (sepAt(start-1) && digitAt(start-2)) ||
+		digitAt(end) || (sepAt(end) && digitAt(end+1))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func countDigits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if isDigit(s[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		if !isDigit(s[i]) {
+			continue
+		}
+		d := int(s[i] - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,62 @@
+package pii
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDetectors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string // Matched kinds and text
+	}{
+		{"email", "write to ada.l+x@example.co.uk now", []string{"EMAIL ada.l+x@example.co.uk"}},
+		{"phone us", "call (555) 123-4567.", []string{"PHONE (555) 123-4567"}},
+		{"phone intl", "ring +44 20 7946 0958", []string{"PHONE +44 20 7946 0958"}},
+		{"card", "card 4111 1111 1111 1111 exp 12/29", []string{"CARD 4111 1111 1111 1111"}},
+		{"card failing luhn", "order 4111 1111 1111 1112", nil},
+		{"date", "on 2024-01-15", nil},
+		{"long number", "id 12345678901234567890123", nil},
+		{"mixed", "a@b.io or 555.123.4567", []string{"EMAIL a@b.io", "PHONE 555.123.4567"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range detectAll(DefaultDetectors(), tt.text) {
+				got = append(got, m.Kind+" "+tt.text[m.Start:m.End])
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("matches = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("match %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDetectAll_Overlap(t *testing.T) {
+	first := RegexDetector("A", regexp.MustCompile(`abc`))
+	second := RegexDetector("B", regexp.MustCompile(`bcd|xyz`))
+
+	matches := detectAll([]Detector{first, second}, "abcd xyz")
+	if len(matches) != 2 || matches[0].Kind != "A" || matches[1].Kind != "B" || matches[1].Start != 5 {
+		t.Errorf("matches = %+v, want A at 0 and B at 5", matches)
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	for s, want := range map[string]bool{
+		"4111111111111111":    true,
+		"5500-0000-0000-0004": true,
+		"4111111111111112":    false,
+		"":                    false,
+	} {
+		if got := luhn(s); got != want {
+			t.Errorf("luhn(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Package pii masks personal data in text sent to and received from a
+// model. Detected values are replaced with tokens such as [EMAIL_1], and
+// the Masker keeps the mapping so authorized code can restore them:
+//
+//	m := pii.NewMasker()
+//	client, err := modelsocket.Connect(ctx, url, apiKey, m.ClientOptions()...)
+//	...
+//	text, err := stream.Text(ctx) // "I'll email [EMAIL_1] today."
+//	original := m.Unmask(text)    // "I'll email ada@example.com today."
+package pii
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// tokenRe matches tokens written by a Masker.
+var tokenRe = regexp.MustCompile(`\[[A-Z][A-Z0-9_]*_\d+\]`)
+
+// Masker replaces PII with tokens and remembers the originals. The same
+// value always gets the same token, so the model can still tell values
+// apart and refer back to them. It is safe for concurrent use.
+type Masker struct {
+	detectors []Detector
+
+	mu      sync.Mutex
+	tokens  map[string]string // Token to original
+	values  map[string]string // Original to token
+	counter map[string]int    // Tokens issued per kind
+}
+
+// NewMasker creates a masker using detectors, or [DefaultDetectors] if none
+// are given. Where detectors find overlapping matches, the earlier one wins.
+func NewMasker(detectors ...Detector) *Masker {
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors()
+	}
+	return &Masker{
+		detectors: detectors,
+		tokens:    make(map[string]string),
+		values:    make(map[string]string),
+		counter:   make(map[string]int),
+	}
+}
+
+// Mask returns text with detected PII replaced by tokens.
+func (m *Masker) Mask(text string) string {
+	matches := detectAll(m.detectors, text)
+	if len(matches) == 0 {
+		return text
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		b.WriteString(text[last:match.Start])
+		b.WriteString(m.tokenLocked(match.Kind, text[match.Start:match.End]))
+		last = match.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// tokenLocked returns the token for value, issuing one if needed.
+func (m *Masker) tokenLocked(kind, value string) string {
+	if token, ok := m.values[value]; ok {
+		return token
+	}
+	m.counter[kind]++
+	token := fmt.Sprintf("[%s_%d]", kind, m.counter[kind])
+	m.tokens[token] = value
+	m.values[value] = token
+	return token
+}
+
+// Unmask returns text with tokens issued by this masker replaced by the
+// original values. Unknown tokens are left as they are. Only code allowed
+// to see the personal data should call it.
+func (m *Masker) Unmask(text string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return tokenRe.ReplaceAllStringFunc(text, func(token string) string {
+		if value, ok := m.tokens[token]; ok {
+			return value
+		}
+		return token
+	})
+}
+
+// Tokens returns a copy of the token map, from token to original value.
+func (m *Masker) Tokens() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := make(map[string]string, len(m.tokens))
+	for token, value := range m.tokens {
+		tokens[token] = value
+	}
+	return tokens
+}
+
+// InputFilter masks appended text, for [modelsocket.WithInputFilter].
+func (m *Masker) InputFilter(text string, role modelsocket.Role) (string, error) {
+	return m.Mask(text), nil
+}
+
+// OutputFilter masks generated text, for [modelsocket.WithOutputFilter].
+// Chunks are masked one at a time, so a value split across chunks may be
+// missed; mask the complete text with [Masker.Mask] where that matters.
+// Token IDs are cleared from chunks that were masked, as they would
+// reveal the original text.
+func (m *Masker) OutputFilter(chunk *modelsocket.GenChunk) (*modelsocket.GenChunk, error) {
+	masked := m.Mask(chunk.Text)
+	if masked == chunk.Text {
+		return chunk, nil
+	}
+	out := *chunk
+	out.Text = masked
+	out.Tokens = nil
+	return &out, nil
+}
+
+// ClientOptions installs the masker's input and output filters. Use the
+// filters directly to combine them with other guardrails.
+func (m *Masker) ClientOptions() []modelsocket.ClientOption {
+	return []modelsocket.ClientOption{
+		modelsocket.WithInputFilter(m.InputFilter),
+		modelsocket.WithOutputFilter(m.OutputFilter),
+	}
+}
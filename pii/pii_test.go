@@ -0,0 +1,107 @@
+package pii
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+func TestMasker(t *testing.T) {
+	m := NewMasker()
+
+	masked := m.Mask("Email ada@example.com or bob@example.com, then ada@example.com again.")
+	want := "Email [EMAIL_1] or [EMAIL_2], then [EMAIL_1] again."
+	if masked != want {
+		t.Errorf("Mask = %q, want %q", masked, want)
+	}
+
+	// Tokens persist across calls
+	if got := m.Mask("cc bob@example.com"); got != "cc [EMAIL_2]" {
+		t.Errorf("Mask = %q, want the same token", got)
+	}
+
+	if got := m.Unmask("Reply to [EMAIL_2] and [EMAIL_9]."); got != "Reply to bob@example.com and [EMAIL_9]." {
+		t.Errorf("Unmask = %q", got)
+	}
+	if tokens := m.Tokens(); len(tokens) != 2 || tokens["[EMAIL_1]"] != "ada@example.com" {
+		t.Errorf("Tokens = %v", tokens)
+	}
+}
+
+func TestMasker_CustomDetector(t *testing.T) {
+	m := NewMasker(DetectorFunc(func(text string) []Match {
+		var matches []Match
+		for i := 0; i+4 <= len(text); i++ {
+			if text[i:i+4] == "Acme" {
+				matches = append(matches, Match{Start: i, End: i + 4, Kind: "ORG"})
+			}
+		}
+		return matches
+	}))
+
+	if got := m.Mask("Acme and ada@example.com"); got != "[ORG_1] and ada@example.com" {
+		t.Errorf("Mask = %q, want only the custom detector", got)
+	}
+}
+
+func TestMasker_OutputFilter(t *testing.T) {
+	m := NewMasker()
+
+	chunk := &modelsocket.GenChunk{Text: "no pii", Tokens: []int{1, 2}}
+	if got, _ := m.OutputFilter(chunk); got != chunk {
+		t.Error("unchanged chunk was copied")
+	}
+
+	chunk = &modelsocket.GenChunk{Text: "call 555-123-4567", Tokens: []int{1, 2, 3}}
+	got, err := m.OutputFilter(chunk)
+	if err != nil {
+		t.Fatalf("OutputFilter error: %v", err)
+	}
+	if got.Text != "call [PHONE_1]" || got.Tokens != nil {
+		t.Errorf("chunk = %+v, want masked text without tokens", got)
+	}
+	if chunk.Text != "call 555-123-4567" {
+		t.Error("original chunk was modified")
+	}
+}
+
+func TestMasker_ClientOptions(t *testing.T) {
+	m := NewMasker()
+	// The server echoes the appended address and one of its own
+	transport := mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		return mstest.Reply("I'll write to [EMAIL_1] and cc ", "eve@example.com.")
+	})
+	ctx := context.Background()
+
+	client := modelsocket.NewWithTransport(ctx, transport, m.ClientOptions()...)
+	defer client.Close(ctx)
+
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Append(ctx, "Email ada@example.com about it.", modelsocket.AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+
+	if appended := transport.Appended()[0].Text; appended != "Email [EMAIL_1] about it." {
+		t.Errorf("appended = %q, want masked", appended)
+	}
+
+	stream, err := seq.Generate(ctx, modelsocket.GenerateAsAssistant())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "I'll write to [EMAIL_1] and cc [EMAIL_2]." {
+		t.Errorf("text = %q, want generated PII masked", text)
+	}
+	if got := m.Unmask(text); got != "I'll write to ada@example.com and cc eve@example.com." {
+		t.Errorf("Unmask = %q", got)
+	}
+}
@@ -0,0 +1,201 @@
+// Package pipeline chains prompts on a single ModelSocket sequence. A
+// pipeline is a list of stages, such as generate, parse, transform and
+// generate again, each taking the previous stage's output as its input.
+//
+// Every generation but the last is hidden, along with its prompt, so the
+// sequence's transcript holds only the final prompt and answer. When a parse
+// stage fails, the generation before it can be retried.
+//
+//	p := pipeline.New(
+//	    pipeline.Generate("outline", func(in any) (string, error) {
+//	        return "List three points about " + in.(string) + " as JSON.", nil
+//	    }, modelsocket.WithRegexMask(`\[.*\]`)),
+//	    pipeline.Parse("points", func(text string) (any, error) {
+//	        var points []string
+//	        return points, json.Unmarshal([]byte(text), &points)
+//	    }).WithRetries(2),
+//	    pipeline.Generate("essay", func(in any) (string, error) {
+//	        return "Write a paragraph covering: " + strings.Join(in.([]string), "; "), nil
+//	    }),
+//	)
+//	essay, err := p.Run(ctx, seq, "tides")
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+type stageKind int
+
+const (
+	kindGenerate stageKind = iota
+	kindParse
+	kindTransform
+)
+
+// Stage is one step of a pipeline. Build stages with [Generate], [Parse]
+// and [Transform].
+type Stage struct {
+	name    string
+	kind    stageKind
+	prompt  func(input any) (string, error)
+	opts    []modelsocket.GenOption
+	parse   func(text string) (any, error)
+	fn      func(input any) (any, error)
+	retries int
+}
+
+// Generate returns a stage that appends the prompt built from its input as
+// the user and generates the assistant's reply. Its output is the generated
+// text.
+func Generate(name string, prompt func(input any) (string, error), opts ...modelsocket.GenOption) Stage {
+	return Stage{name: name, kind: kindGenerate, prompt: prompt, opts: opts}
+}
+
+// Parse returns a stage that converts the generated text it receives, e.g.
+// by decoding JSON. Its output is fn's result.
+func Parse(name string, fn func(text string) (any, error)) Stage {
+	return Stage{name: name, kind: kindParse, parse: fn}
+}
+
+// Transform returns a stage that computes its output from its input without
+// the model.
+func Transform(name string, fn func(input any) (any, error)) Stage {
+	return Stage{name: name, kind: kindTransform, fn: fn}
+}
+
+// WithRetries makes a parse stage regenerate the preceding generation up to
+// n times when parsing fails. It has no effect on other stages.
+func (s Stage) WithRetries(n int) Stage {
+	s.retries = n
+	return s
+}
+
+// StageError reports the stage that failed.
+type StageError struct {
+	Stage    string // Stage name
+	Index    int    // Index of the stage in the pipeline
+	Attempts int    // Attempts made, for parse stages with retries
+	Err      error
+}
+
+func (e *StageError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("pipeline: stage %q after %d attempts: %v", e.Stage, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("pipeline: stage %q: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Pipeline is a sequence of stages. It is safe to run concurrently on
+// different sequences.
+type Pipeline struct {
+	stages []Stage
+	final  int // Index of the last generate stage, whose output is visible
+}
+
+// New returns a pipeline running stages in order.
+func New(stages ...Stage) *Pipeline {
+	p := &Pipeline{stages: stages, final: -1}
+	for i, stage := range stages {
+		if stage.kind == kindGenerate {
+			p.final = i
+		}
+	}
+	return p
+}
+
+// Run executes the pipeline on seq with input as the first stage's input and
+// returns the last stage's output. It fails with a [*StageError].
+func (p *Pipeline) Run(ctx context.Context, seq *modelsocket.Seq, input any) (any, error) {
+	lastGen := -1 // Index of the most recent generate stage
+	attempts := 0 // Attempts of the current parse stage
+	regenerate := false
+
+	for i := 0; i < len(p.stages); i++ {
+		stage := p.stages[i]
+
+		var output any
+		var err error
+		switch stage.kind {
+		case kindGenerate:
+			lastGen = i
+			output, seq, err = p.generate(ctx, seq, i, input, regenerate)
+			regenerate = false
+
+		case kindParse:
+			text, ok := input.(string)
+			if !ok {
+				err = fmt.Errorf("input is %T, not generated text", input)
+				break
+			}
+			attempts++
+			output, err = stage.parse(text)
+			if err != nil && lastGen >= 0 && attempts <= stage.retries {
+				// Generate again and rerun the stages since
+				i, input, regenerate = lastGen-1, nil, true
+				continue
+			}
+
+		case kindTransform:
+			output, err = stage.fn(input)
+		}
+
+		if err != nil {
+			return nil, &StageError{Stage: stage.name, Index: i, Attempts: attempts, Err: err}
+		}
+		if stage.kind == kindParse {
+			attempts = 0
+		}
+		input = output
+	}
+	return input, nil
+}
+
+// generate runs generate stage i. When regenerating, the prompt is already
+// in the sequence and only the generation is repeated. It returns the
+// sequence later stages continue on.
+func (p *Pipeline) generate(ctx context.Context, seq *modelsocket.Seq, i int, input any, regenerate bool) (string, *modelsocket.Seq, error) {
+	stage := p.stages[i]
+	hidden := i != p.final
+
+	if !regenerate {
+		prompt, err := stage.prompt(input)
+		if err != nil {
+			return "", seq, err
+		}
+		appendOpts := []modelsocket.AppendOption{modelsocket.AsUser()}
+		if hidden {
+			appendOpts = append(appendOpts, modelsocket.AppendHidden())
+		}
+		if err := seq.Append(ctx, prompt, appendOpts...); err != nil {
+			return "", seq, err
+		}
+	}
+
+	opts := append([]modelsocket.GenOption{modelsocket.GenerateAsAssistant()}, stage.opts...)
+	if hidden {
+		opts = append(opts, modelsocket.WithHidden())
+	}
+	stream, err := seq.Generate(ctx, opts...)
+	if err != nil {
+		return "", seq, err
+	}
+
+	// Text skips hidden chunks, so collect them here
+	var text strings.Builder
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			return "", stream.Seq(), err
+		}
+		text.WriteString(chunk.Text)
+	}
+	return text.String(), stream.Seq(), nil
+}
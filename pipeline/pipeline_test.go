@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers generations with replies in
+// order, hidden if the generation is.
+func newServer(replies ...string) *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		text := mstest.Text(replies[0])
+		text.Hidden = g.Data.Hidden
+		replies = replies[1:]
+		return []*modelsocket.MSEvent{text, mstest.Finish(0, 0)}
+	})
+}
+
+func openSeq(t *testing.T, transport *mstest.Server) *modelsocket.Seq {
+	t.Helper()
+
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, transport)
+	t.Cleanup(func() { client.Close(ctx) })
+
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	return seq
+}
+
+// essayPipeline outlines a topic as JSON, parses it with retries and writes
+// an essay from the points.
+func essayPipeline(retries int) *Pipeline {
+	return New(
+		Generate("outline", func(in any) (string, error) {
+			return "Outline " + in.(string), nil
+		}),
+		Parse("points", func(text string) (any, error) {
+			var points []string
+			return points, json.Unmarshal([]byte(text), &points)
+		}).WithRetries(retries),
+		Transform("join", func(in any) (any, error) {
+			return strings.Join(in.([]string), "; "), nil
+		}),
+		Generate("essay", func(in any) (string, error) {
+			return "Write about " + in.(string), nil
+		}),
+	)
+}
+
+func TestPipeline_Run(t *testing.T) {
+	transport := newServer("not json", `["a","b"]`, "The essay.")
+	seq := openSeq(t, transport)
+
+	out, err := essayPipeline(1).Run(context.Background(), seq, "tides")
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if out != "The essay." {
+		t.Errorf("output = %v, want the essay", out)
+	}
+
+	// The outline prompt is appended once and hidden; the failed outline
+	// is regenerated
+	appended := transport.Appended()
+	if len(appended) != 2 {
+		t.Fatalf("appended = %+v, want 2 prompts", appended)
+	}
+	if a := appended[0]; a.Text != "Outline tides" || !a.Hidden {
+		t.Errorf("first prompt = %+v, want hidden outline prompt", a)
+	}
+	if a := appended[1]; a.Text != "Write about a; b" || a.Hidden {
+		t.Errorf("final prompt = %+v, want visible essay prompt", a)
+	}
+	gens := transport.Gens()
+	if len(gens) != 3 || !gens[0].Hidden || !gens[1].Hidden || gens[2].Hidden {
+		t.Errorf("gens = %+v, want two hidden outlines and a visible essay", gens)
+	}
+
+	// Only the final prompt and answer are in the transcript
+	var visible []string
+	for _, msg := range seq.History() {
+		if !msg.Hidden {
+			visible = append(visible, msg.Text)
+		}
+	}
+	if len(visible) != 2 || visible[0] != "Write about a; b" || visible[1] != "The essay." {
+		t.Errorf("visible history = %q", visible)
+	}
+}
+
+func TestPipeline_ParseRetriesExhausted(t *testing.T) {
+	transport := newServer("nope", "still nope")
+	seq := openSeq(t, transport)
+
+	_, err := essayPipeline(1).Run(context.Background(), seq, "tides")
+
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) {
+		t.Fatalf("Run error = %v, want StageError", err)
+	}
+	if stageErr.Stage != "points" || stageErr.Index != 1 || stageErr.Attempts != 2 {
+		t.Errorf("error = %+v, want points after 2 attempts", stageErr)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("error = %v, want it to wrap the parse error", err)
+	}
+}
+
+func TestPipeline_TransformError(t *testing.T) {
+	seq := openSeq(t, newServer())
+	boom := errors.New("boom")
+
+	p := New(
+		Transform("double", func(in any) (any, error) { return in.(int) * 2, nil }),
+		Transform("fail", func(in any) (any, error) { return nil, boom }),
+	)
+	_, err := p.Run(context.Background(), seq, 2)
+	if !errors.Is(err, boom) {
+		t.Errorf("Run error = %v, want boom", err)
+	}
+
+	out, err := New(Transform("double", func(in any) (any, error) { return in.(int) * 2, nil })).Run(context.Background(), seq, 2)
+	if err != nil || out != 4 {
+		t.Errorf("Run = %v, %v, want 4", out, err)
+	}
+}
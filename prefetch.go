@@ -0,0 +1,192 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Prefetch holds responses generated ahead of time for likely next user
+// messages. Create one with [Seq.Prefetch].
+type Prefetch struct {
+	mu      sync.Mutex
+	entries []*prefetched
+	taken   bool
+}
+
+// prefetched is a speculative response, buffered as it is generated so the
+// read loop is never blocked waiting for a consumer.
+type prefetched struct {
+	input  string
+	seq    *Seq
+	source *GenStream
+
+	mu     sync.Mutex
+	chunks []*GenChunk
+	done   bool
+	err    error
+	update chan struct{} // closed and replaced when chunks or done change
+}
+
+// Prefetch forks the sequence once per candidate user message and starts
+// generating a response to each, configured by opts. When the real message
+// arrives, [Prefetch.Take] returns the matching fork with its response
+// already underway, e.g. for suggestion chips or phone-tree style menus.
+//
+// The sequence itself is left unchanged. Every fork costs a generation, so
+// keep the candidate list short; forks that aren't taken are closed by Take
+// or [Prefetch.Close].
+func (s *Seq) Prefetch(ctx context.Context, candidateUserMessages []string, opts ...GenOption) (*Prefetch, error) {
+	p := &Prefetch{}
+	for _, input := range candidateUserMessages {
+		entry, err := s.prefetch(ctx, input, opts)
+		if err != nil {
+			p.Close(ctx)
+			return nil, err
+		}
+		p.entries = append(p.entries, entry)
+	}
+	return p, nil
+}
+
+// prefetch forks the sequence and starts generating a response to input.
+func (s *Seq) prefetch(ctx context.Context, input string, opts []GenOption) (*prefetched, error) {
+	fork, err := s.Fork(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := fork.Append(ctx, input, AsUser()); err != nil {
+		go fork.Close(fork.client.ctx)
+		return nil, err
+	}
+	// The response outlives ctx, until it is taken or discarded
+	stream, err := fork.Generate(context.WithoutCancel(ctx), opts...)
+	if err != nil {
+		go fork.Close(fork.client.ctx)
+		return nil, err
+	}
+
+	entry := &prefetched{
+		input:  input,
+		seq:    fork,
+		source: stream,
+		update: make(chan struct{}),
+	}
+	go entry.buffer()
+	return entry, nil
+}
+
+// Take returns the fork and response prefetched for input, if one of the
+// candidates matches it, ignoring case and surrounding whitespace. The
+// returned sequence holds the conversation including input and the response,
+// and replaces the original for later calls. All other forks are closed.
+// Take can only be called once; later calls report no match.
+func (p *Prefetch) Take(input string) (*Seq, *GenStream, bool) {
+	p.mu.Lock()
+	if p.taken {
+		p.mu.Unlock()
+		return nil, nil, false
+	}
+	p.taken = true
+	entries := p.entries
+	p.entries = nil
+	p.mu.Unlock()
+
+	var match *prefetched
+	for _, entry := range entries {
+		if match == nil && strings.EqualFold(strings.TrimSpace(entry.input), strings.TrimSpace(input)) {
+			match = entry
+			continue
+		}
+		entry.discard()
+	}
+	if match == nil {
+		return nil, nil, false
+	}
+
+	stream := newGenStream(match.seq, match.source.cid)
+	stream.ctx = match.source.ctx
+	stream.zeroCopy = match.source.zeroCopy
+	stream.markSent()
+	go stream.replay(match)
+
+	return match.seq, stream, true
+}
+
+// Close discards all prefetched responses that haven't been taken.
+func (p *Prefetch) Close(ctx context.Context) error {
+	p.mu.Lock()
+	entries := p.entries
+	p.entries = nil
+	p.taken = true
+	p.mu.Unlock()
+
+	var errs []error
+	for _, entry := range entries {
+		entry.source.handleAbort(nil)
+		if err := entry.seq.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// buffer reads the speculative response to the end.
+func (e *prefetched) buffer() {
+	for {
+		chunk, err := e.source.Next(e.source.ctx)
+
+		e.mu.Lock()
+		if chunk != nil {
+			e.chunks = append(e.chunks, chunk)
+		} else {
+			e.done = true
+			e.err = err
+		}
+		close(e.update)
+		e.update = make(chan struct{})
+		e.mu.Unlock()
+
+		if chunk == nil {
+			return
+		}
+	}
+}
+
+// discard cancels the speculative response and closes its fork.
+func (e *prefetched) discard() {
+	e.source.handleAbort(nil)
+	go e.seq.Close(e.seq.client.ctx)
+}
+
+// replay forwards the buffered response to g, followed by the rest of it as
+// it arrives.
+func (g *GenStream) replay(e *prefetched) {
+	for next := 0; ; {
+		e.mu.Lock()
+		if next < len(e.chunks) {
+			chunk := e.chunks[next]
+			e.mu.Unlock()
+			next++
+			g.forward(chunk)
+			continue
+		}
+		if e.done {
+			err := e.err
+			e.mu.Unlock()
+			if err != nil {
+				g.handleError(err)
+				return
+			}
+			g.handleFinish(&MSEvent{
+				InputTokens:  e.source.InputTokens(),
+				OutputTokens: e.source.OutputTokens(),
+			})
+			return
+		}
+		update := e.update
+		e.mu.Unlock()
+		<-update
+	}
+}
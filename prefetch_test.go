@@ -0,0 +1,106 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// prefetchServer forks into fork-1, fork-2, ... and answers each fork's
+// generation with the text appended to it.
+func prefetchServer() func(req *MSRequest) []*MSEvent {
+	forks := 0
+	appended := map[string]string{}
+	return func(req *MSRequest) []*MSEvent {
+		switch data := req.Data.(type) {
+		case forkCommandData:
+			forks++
+			child := fmt.Sprintf("fork-%d", forks)
+			return []*MSEvent{{Event: "seq_fork_finish", SeqID: req.SeqID, CID: req.CID, ChildSeqID: child}}
+		case appendCommandData:
+			appended[req.SeqID] = data.Text
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "You said "},
+				{Event: "seq_text", SeqID: req.SeqID, Text: appended[req.SeqID]},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, OutputTokens: 3},
+			}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		}
+		return nil
+	}
+}
+
+func TestSeq_Prefetch(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	seen := serveCommands(t, transport, prefetchServer())
+
+	prefetch, err := seq.Prefetch(ctx, []string{"Yes", "No"})
+	if err != nil {
+		t.Fatalf("Prefetch error: %v", err)
+	}
+
+	// Let the speculative responses finish before the user answers
+	time.Sleep(20 * time.Millisecond)
+
+	taken, stream, ok := prefetch.Take(" yes ")
+	if !ok {
+		t.Fatal("Take found no match")
+	}
+	if taken.ID() != "fork-1" {
+		t.Errorf("taken.ID() = %s, want fork-1", taken.ID())
+	}
+
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "You said Yes" {
+		t.Errorf("text = %q, want %q", text, "You said Yes")
+	}
+	if stream.OutputTokens() != 3 {
+		t.Errorf("OutputTokens = %d, want 3", stream.OutputTokens())
+	}
+
+	// The other fork is closed
+	if got := commandsFor(seen, "fork-2", 100*time.Millisecond); !slices.Contains(got, "close") {
+		t.Errorf("fork-2 commands = %v, want it closed", got)
+	}
+
+	if _, _, ok := prefetch.Take("Yes"); ok {
+		t.Error("second Take matched")
+	}
+}
+
+func TestSeq_Prefetch_NoMatch(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	seen := serveCommands(t, transport, prefetchServer())
+
+	prefetch, err := seq.Prefetch(ctx, []string{"Yes"})
+	if err != nil {
+		t.Fatalf("Prefetch error: %v", err)
+	}
+
+	if _, _, ok := prefetch.Take("Maybe"); ok {
+		t.Error("Take matched an input that wasn't prefetched")
+	}
+	if got := commandsFor(seen, "fork-1", 100*time.Millisecond); !slices.Contains(got, "close") {
+		t.Errorf("fork-1 commands = %v, want it closed", got)
+	}
+}
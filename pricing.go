@@ -0,0 +1,101 @@
+package modelsocket
+
+import "strings"
+
+// Price is what a model charges per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Pricing maps model names to prices. A key ending in "*" matches models
+// with that prefix; exact names take precedence, then the longest prefix.
+//
+//	pricing := modelsocket.Pricing{
+//	    "llama-3.1-8b": {Input: 0.10, Output: 0.20},
+//	    "llama-3.1-*":  {Input: 0.50, Output: 1.50},
+//	}
+type Pricing map[string]Price
+
+// Price returns the price of model, and whether the table has one.
+func (p Pricing) Price(model string) (Price, bool) {
+	return lookupModel(p, model)
+}
+
+// lookupModel returns the entry for model in a per-model table whose keys
+// may end in "*" to match a prefix: the exact name if present, else the
+// longest matching prefix.
+func lookupModel[V any](table map[string]V, model string) (V, bool) {
+	if v, ok := table[model]; ok {
+		return v, true
+	}
+
+	var best string
+	found := false
+	for key := range table {
+		prefix, ok := strings.CutSuffix(key, "*")
+		if ok && strings.HasPrefix(model, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	if !found {
+		var zero V
+		return zero, false
+	}
+	return table[best+"*"], true
+}
+
+// Cost returns the cost of tokens processed by model, or 0 if the table has
+// no price for it.
+func (p Pricing) Cost(model string, inputTokens, outputTokens int) float64 {
+	price, ok := p.Price(model)
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6
+}
+
+// Usage reports the tokens a generation consumed.
+type Usage struct {
+	Model        string `json:"model"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+
+	// Tags are the sequence's tags, set with [WithSeqTag]
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Prices usage, from the client's pricing
+	costFunc func(model string, inputTokens, outputTokens int) float64
+}
+
+// Cost returns the cost of the usage from the client's [WithPricing] table
+// or [WithCostFunc], or 0 without either.
+func (u Usage) Cost() float64 {
+	if u.costFunc == nil {
+		return 0
+	}
+	return u.costFunc(u.Model, u.InputTokens, u.OutputTokens)
+}
+
+// Usage returns the tokens the generation consumed on the model that
+// produced it. Only valid after the stream is exhausted.
+func (g *GenStream) Usage() Usage {
+	seq := g.Seq()
+	tags := seq.Tags()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return Usage{
+		Model:        seq.model,
+		InputTokens:  g.inputTokens,
+		OutputTokens: g.outputTokens,
+		Tags:         tags,
+		costFunc:     seq.client.cfg.costFunc,
+	}
+}
+
+// Cost returns the generation's cost, as [Usage.Cost]. Only valid after the
+// stream is exhausted.
+func (g *GenStream) Cost() float64 {
+	return g.Usage().Cost()
+}
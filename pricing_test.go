@@ -0,0 +1,75 @@
+package modelsocket
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestPricing_Price(t *testing.T) {
+	pricing := Pricing{
+		"llama-3.1-8b": {Input: 1, Output: 2},
+		"llama-3.1-*":  {Input: 3, Output: 4},
+		"llama-*":      {Input: 5, Output: 6},
+	}
+
+	tests := []struct {
+		model string
+		want  Price
+		ok    bool
+	}{
+		{"llama-3.1-8b", Price{1, 2}, true},
+		{"llama-3.1-70b", Price{3, 4}, true},
+		{"llama-2-7b", Price{5, 6}, true},
+		{"mistral-7b", Price{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := pricing.Price(tt.model)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Price(%q) = %v, %v, want %v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if got := pricing.Cost("llama-3.1-8b", 1_000_000, 500_000); got != 2 {
+		t.Errorf("Cost = %v, want 2", got)
+	}
+	if got := pricing.Cost("mistral-7b", 1_000_000, 500_000); got != 0 {
+		t.Errorf("Cost of unpriced model = %v, want 0", got)
+	}
+}
+
+func TestGenStream_Cost(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	finished := make(chan GenStats, 1)
+	client := NewWithTransport(ctx, transport,
+		WithPricing(Pricing{"test-model": {Input: 2, Output: 10}}),
+		WithOnGenFinish(func(seqID string, stats GenStats) { finished <- stats }),
+	)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, budgetServer("a", "b"))
+
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	usage := stream.Usage()
+	if usage.Model != "test-model" || usage.InputTokens != 10 || usage.OutputTokens != 2 {
+		t.Errorf("Usage() = %+v, want test-model with 10/2 tokens", usage)
+	}
+
+	want := (10*2.0 + 2*10.0) / 1e6
+	if got := stream.Cost(); math.Abs(got-want) > 1e-12 {
+		t.Errorf("Cost() = %v, want %v", got, want)
+	}
+	if stats := <-finished; math.Abs(stats.Cost-want) > 1e-12 {
+		t.Errorf("GenStats.Cost = %v, want %v", stats.Cost, want)
+	}
+}
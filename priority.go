@@ -0,0 +1,234 @@
+package modelsocket
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// Priority orders outbound requests when the client is created with
+// [WithPriorityScheduling]. Requests with a higher priority are sent first.
+type Priority int
+
+const (
+	// PriorityBackground is for bulk work that can wait, such as replaying
+	// history or batch appends.
+	PriorityBackground Priority = -1
+
+	// PriorityNormal is the default for requests other than generations.
+	PriorityNormal Priority = 0
+
+	// PriorityInteractive is the default for generations, tool returns and
+	// cancellations, which someone is usually waiting on.
+	PriorityInteractive Priority = 1
+)
+
+// requestPriority returns the priority of a request on the sequence: p if
+// set, else the sequence's priority, else def.
+func (s *Seq) requestPriority(p *Priority, def Priority) Priority {
+	switch {
+	case p != nil:
+		return *p
+	case s.cfg.priority != nil:
+		return *s.cfg.priority
+	}
+	return def
+}
+
+// sendItem is a request waiting in a sendQueue.
+type sendItem struct {
+	ctx      context.Context
+	req      *MSRequest
+	priority Priority
+	order    uint64 // Position in arrival order
+	index    int    // Position in the heap, or -1 once removed
+	done     chan error
+}
+
+// sendQueue holds requests until they can be sent, highest priority first.
+// Requests on the same sequence are sent in the order they were made: a
+// queued request is raised to the priority of a later one on its sequence,
+// so the later one can't overtake it.
+type sendQueue struct {
+	mu     sync.Mutex
+	items  sendHeap
+	bySeq  map[string][]*sendItem
+	order  uint64
+	ready  chan struct{}
+	closed error
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{
+		bySeq: make(map[string][]*sendItem),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// push queues a request, failing if the queue has been closed.
+func (q *sendQueue) push(ctx context.Context, req *MSRequest, priority Priority) (*sendItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed != nil {
+		return nil, q.closed
+	}
+
+	item := &sendItem{ctx: ctx, req: req, priority: priority, order: q.order, done: make(chan error, 1)}
+	q.order++
+
+	if req.SeqID != "" {
+		for _, earlier := range q.bySeq[req.SeqID] {
+			if earlier.priority < priority {
+				earlier.priority = priority
+				heap.Fix(&q.items, earlier.index)
+			}
+		}
+		q.bySeq[req.SeqID] = append(q.bySeq[req.SeqID], item)
+	}
+	heap.Push(&q.items, item)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return item, nil
+}
+
+// pop removes and returns the next request to send, or nil if the queue is
+// empty.
+func (q *sendQueue) pop() *sendItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.items.Len() == 0 {
+		return nil
+	}
+	item := heap.Pop(&q.items).(*sendItem)
+	q.forget(item)
+	return item
+}
+
+// remove takes a request out of the queue, reporting whether it was still
+// queued.
+func (q *sendQueue) remove(item *sendItem) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item.index < 0 {
+		return false
+	}
+	heap.Remove(&q.items, item.index)
+	q.forget(item)
+	return true
+}
+
+// forget drops a request that has left the heap from bySeq.
+func (q *sendQueue) forget(item *sendItem) {
+	seqID := item.req.SeqID
+	if seqID == "" {
+		return
+	}
+	items := q.bySeq[seqID]
+	for i, queued := range items {
+		if queued == item {
+			items = append(items[:i], items[i+1:]...)
+			break
+		}
+	}
+	if len(items) == 0 {
+		delete(q.bySeq, seqID)
+	} else {
+		q.bySeq[seqID] = items
+	}
+}
+
+// close fails queued and later requests with err.
+func (q *sendQueue) close(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = err
+	for _, item := range q.items {
+		item.index = -1
+		item.done <- err
+	}
+	q.items = nil
+	q.bySeq = make(map[string][]*sendItem)
+}
+
+// sendLoop sends queued requests one at a time until the client is closed.
+func (c *Client) sendLoop() {
+	q := c.sendQueue
+	for {
+		item := q.pop()
+		if item == nil {
+			select {
+			case <-c.ctx.Done():
+				q.close(ErrClosed)
+				return
+			case <-q.ready:
+				continue
+			}
+		}
+
+		if err := item.ctx.Err(); err != nil {
+			item.done <- err
+			continue
+		}
+		item.done <- c.transport.Send(item.ctx, item.req)
+	}
+}
+
+// sendQueued sends a request through the send queue and waits for it to be
+// written.
+func (c *Client) sendQueued(ctx context.Context, req *MSRequest) error {
+	item, err := c.sendQueue.push(ctx, req, req.priority)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-item.done:
+		return err
+	case <-ctx.Done():
+		if c.sendQueue.remove(item) {
+			return ctx.Err()
+		}
+		// Already being sent
+		return <-item.done
+	}
+}
+
+// sendHeap orders queued requests by priority, then arrival.
+type sendHeap []*sendItem
+
+func (h sendHeap) Len() int { return len(h) }
+
+func (h sendHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].order < h[j].order
+}
+
+func (h sendHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *sendHeap) Push(x any) {
+	item := x.(*sendItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *sendHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,210 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSendQueue_Order(t *testing.T) {
+	q := newSendQueue()
+	ctx := context.Background()
+
+	push := func(cid, seqID string, p Priority) {
+		t.Helper()
+		if _, err := q.push(ctx, &MSRequest{CID: cid, SeqID: seqID}, p); err != nil {
+			t.Fatalf("push error: %v", err)
+		}
+	}
+	push("bulk-1", "seq-1", PriorityBackground)
+	push("bulk-2", "seq-2", PriorityBackground)
+	push("append", "seq-3", PriorityNormal)
+	push("gen", "seq-4", PriorityInteractive)
+	// Raises bulk-1, which must be sent first on seq-1
+	push("gen-after-bulk", "seq-1", PriorityInteractive)
+
+	want := []string{"bulk-1", "gen", "gen-after-bulk", "append", "bulk-2"}
+	for i, cid := range want {
+		item := q.pop()
+		if item == nil {
+			t.Fatalf("pop %d = nil, want %s", i, cid)
+		}
+		if item.req.CID != cid {
+			t.Errorf("pop %d = %s, want %s", i, item.req.CID, cid)
+		}
+	}
+	if item := q.pop(); item != nil {
+		t.Errorf("pop = %s, want empty queue", item.req.CID)
+	}
+	if len(q.bySeq) != 0 {
+		t.Errorf("bySeq = %v, want empty", q.bySeq)
+	}
+}
+
+func TestSendQueue_RemoveAndClose(t *testing.T) {
+	q := newSendQueue()
+	ctx := context.Background()
+
+	first, _ := q.push(ctx, &MSRequest{CID: "c1", SeqID: "seq-1"}, PriorityNormal)
+	second, _ := q.push(ctx, &MSRequest{CID: "c2", SeqID: "seq-1"}, PriorityNormal)
+
+	if !q.remove(first) {
+		t.Error("remove = false, want true for a queued request")
+	}
+	if q.remove(first) {
+		t.Error("remove = true, want false once removed")
+	}
+
+	q.close(ErrClosed)
+	if err := <-second.done; !errors.Is(err, ErrClosed) {
+		t.Errorf("queued request error = %v, want ErrClosed", err)
+	}
+	if _, err := q.push(ctx, &MSRequest{CID: "c3"}, PriorityNormal); !errors.Is(err, ErrClosed) {
+		t.Errorf("push error = %v, want ErrClosed", err)
+	}
+}
+
+// gatedTransport holds each Send until it is released.
+type gatedTransport struct {
+	*mockTransport
+	entered chan *MSRequest
+	release chan struct{}
+}
+
+func (g *gatedTransport) Send(ctx context.Context, req *MSRequest) error {
+	g.entered <- req
+	<-g.release
+	return g.mockTransport.Send(ctx, req)
+}
+
+func TestClient_PriorityScheduling(t *testing.T) {
+	transport := &gatedTransport{
+		mockTransport: newMockTransport(),
+		entered:       make(chan *MSRequest, 10),
+		release:       make(chan struct{}),
+	}
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport, WithPriorityScheduling())
+	defer client.Close(ctx)
+
+	send := func(cid string, p Priority) chan error {
+		req := &MSRequest{Request: "seq_command", CID: cid, SeqID: cid, priority: p}
+		errc := make(chan error, 1)
+		go func() { errc <- client.send(ctx, req) }()
+		return errc
+	}
+
+	// The first request holds the sender while the others queue
+	first := send("first", PriorityNormal)
+	<-transport.entered
+
+	bulk := send("bulk", PriorityBackground)
+	waitQueued(t, client, 1)
+	gen := send("gen", PriorityInteractive)
+	waitQueued(t, client, 2)
+
+	var order []string
+	for range 3 {
+		transport.release <- struct{}{}
+		if len(order) < 2 {
+			order = append(order, (<-transport.entered).CID)
+		}
+	}
+	for _, errc := range []chan error{first, bulk, gen} {
+		if err := <-errc; err != nil {
+			t.Errorf("send error: %v", err)
+		}
+	}
+	if len(order) != 2 || order[0] != "gen" || order[1] != "bulk" {
+		t.Errorf("send order = %v, want [gen bulk]", order)
+	}
+}
+
+func TestClient_PrioritySchedulingCancel(t *testing.T) {
+	transport := &gatedTransport{
+		mockTransport: newMockTransport(),
+		entered:       make(chan *MSRequest, 10),
+		release:       make(chan struct{}),
+	}
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport, WithPriorityScheduling())
+	defer client.Close(ctx)
+
+	go client.send(ctx, &MSRequest{Request: "seq_command", CID: "first"})
+	<-transport.entered
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() { errc <- client.send(cancelCtx, &MSRequest{Request: "seq_command", CID: "cancelled"}) }()
+	waitQueued(t, client, 1)
+	cancel()
+
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("send error = %v, want context.Canceled", err)
+	}
+	if n := queued(client); n != 0 {
+		t.Errorf("queued = %d, want 0", n)
+	}
+	transport.release <- struct{}{}
+}
+
+// queued returns the number of requests in the client's send queue.
+func queued(c *Client) int {
+	c.sendQueue.mu.Lock()
+	defer c.sendQueue.mu.Unlock()
+	return c.sendQueue.items.Len()
+}
+
+// waitQueued waits for n requests to be queued.
+func waitQueued(t *testing.T, c *Client, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for queued(c) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", queued(c), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSeq_RequestPriority(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1", WithSeqPriority(PriorityBackground))
+	other := openTestSeq(t, client, transport, "seq-2")
+	serveCommands(t, transport, textServer("ok"))
+
+	gen := func(seq *Seq, opts ...GenOption) {
+		t.Helper()
+		stream, err := seq.Generate(ctx, opts...)
+		if err != nil {
+			t.Fatalf("Generate error: %v", err)
+		}
+		stream.Text(ctx)
+	}
+	gen(seq)
+	gen(seq, WithGenPriority(PriorityInteractive))
+	gen(other)
+
+	var got []Priority
+	for _, req := range transport.getRequests() {
+		got = append(got, req.priority)
+	}
+	want := []Priority{PriorityBackground, PriorityNormal, PriorityBackground, PriorityInteractive, PriorityInteractive}
+	if len(got) != len(want) {
+		t.Fatalf("priorities = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("priorities = %v, want %v", got, want)
+			break
+		}
+	}
+}
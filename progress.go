@@ -0,0 +1,46 @@
+package modelsocket
+
+import "time"
+
+// DefaultProgressInterval is how often [WithOnProgress] reports progress
+// unless [WithProgressInterval] sets another interval.
+const DefaultProgressInterval = 500 * time.Millisecond
+
+// watchProgress reports the tokens delivered since start to fn every
+// interval, and once more when the stream ends.
+func (g *GenStream) watchProgress(start time.Time, interval time.Duration, fn func(int, time.Duration)) {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fn(g.deliveredTokens(), time.Since(start))
+		case <-g.done:
+			fn(g.deliveredTokens(), time.Since(start))
+			return
+		}
+	}
+}
+
+// deliveredTokens returns the number of tokens delivered to the consumer.
+func (g *GenStream) deliveredTokens() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.delivered
+}
+
+// chunkTokens counts the tokens in a chunk. Text without token IDs is
+// counted as one token, as for budgets.
+func chunkTokens(chunk *GenChunk) int {
+	switch {
+	case len(chunk.Tokens) > 0:
+		return len(chunk.Tokens)
+	case chunk.Text != "" || len(chunk.Bytes) > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type progressReport struct {
+	tokens  int
+	elapsed time.Duration
+}
+
+func TestSeq_GenerateOnProgress(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	release := make(chan struct{})
+	serve := textServer("a", "b", "c")
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		<-release
+		return serve(req)
+	})
+
+	reports := make(chan progressReport, 100)
+	stream, err := seq.Generate(ctx,
+		WithOnProgress(func(tokens int, elapsed time.Duration) {
+			reports <- progressReport{tokens, elapsed}
+		}),
+		WithProgressInterval(5*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	// Progress is reported while nothing arrives, for watchdogs
+	select {
+	case r := <-reports:
+		if r.tokens != 0 || r.elapsed <= 0 {
+			t.Errorf("stalled report = %+v, want 0 tokens and elapsed time", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no progress reported while stalled")
+	}
+
+	close(release)
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	// The final report comes once the stream ends
+	var last progressReport
+	deadline := time.After(time.Second)
+	for last.tokens != 3 {
+		select {
+		case last = <-reports:
+		case <-deadline:
+			t.Fatalf("last report = %+v, want 3 tokens", last)
+		}
+	}
+}
+
+func TestChunkTokens(t *testing.T) {
+	tests := []struct {
+		chunk *GenChunk
+		want  int
+	}{
+		{&GenChunk{Text: "hi", Tokens: []int{1, 2}}, 2},
+		{&GenChunk{Text: "hi"}, 1},
+		{&GenChunk{ToolCalls: []ToolCall{{Name: "f"}}}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := chunkTokens(tt.chunk); got != tt.want {
+			t.Errorf("chunkTokens(%+v) = %d, want %d", tt.chunk, got, tt.want)
+		}
+	}
+}
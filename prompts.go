@@ -0,0 +1,186 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// PromptTag is the tag key [Seq.AppendPrompt] stamps with the prompt's
+// reference, e.g. "support_greeting@v3".
+const PromptTag = "prompt"
+
+// Prompt is a versioned prompt template.
+type Prompt struct {
+	Name    string
+	Version string
+
+	// Template is a text/template rendered with the data passed to
+	// [Seq.AppendPrompt]. Missing map keys are an error.
+	Template string
+
+	// Role the prompt is appended as. Defaults to RoleUser.
+	Role Role
+
+	// GenOptions are defaults for generations that follow the prompt.
+	GenOptions []GenOption
+}
+
+// Ref returns the prompt's reference, "name@version".
+func (p Prompt) Ref() string {
+	return p.Name + "@" + p.Version
+}
+
+// PromptRegistry holds versioned prompts. Register prompts at startup and
+// attach the registry to a client with [WithPromptRegistry]. It is safe for
+// concurrent use.
+type PromptRegistry struct {
+	mu       sync.RWMutex
+	prompts  map[string]*registeredPrompt // By ref
+	versions map[string][]string          // Versions of each name, in registration order
+}
+
+type registeredPrompt struct {
+	prompt   Prompt
+	template *template.Template
+}
+
+// NewPromptRegistry creates an empty registry.
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{
+		prompts:  make(map[string]*registeredPrompt),
+		versions: make(map[string][]string),
+	}
+}
+
+// Register adds a prompt. A name and version can only be registered once,
+// so a versioned prompt never changes once deployed.
+func (r *PromptRegistry) Register(p Prompt) error {
+	if p.Name == "" || p.Version == "" || strings.Contains(p.Name, "@") {
+		return fmt.Errorf("modelsocket: prompt needs a name without @ and a version, got %q", p.Ref())
+	}
+
+	tmpl, err := template.New(p.Ref()).Option("missingkey=error").Parse(p.Template)
+	if err != nil {
+		return fmt.Errorf("modelsocket: prompt %s: %w", p.Ref(), err)
+	}
+	if p.Role == "" {
+		p.Role = RoleUser
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.prompts[p.Ref()]; ok {
+		return fmt.Errorf("modelsocket: prompt %s already registered", p.Ref())
+	}
+	r.prompts[p.Ref()] = &registeredPrompt{prompt: p, template: tmpl}
+	r.versions[p.Name] = append(r.versions[p.Name], p.Version)
+	return nil
+}
+
+// MustRegister is like Register but panics on error.
+func (r *PromptRegistry) MustRegister(p Prompt) {
+	if err := r.Register(p); err != nil {
+		panic(err)
+	}
+}
+
+// Get returns the prompt for ref, either "name@version" or "name" for the
+// version registered last.
+func (r *PromptRegistry) Get(ref string) (Prompt, error) {
+	rp, err := r.lookup(ref)
+	if err != nil {
+		return Prompt{}, err
+	}
+	return rp.prompt, nil
+}
+
+// Versions returns the registered versions of name, oldest first.
+func (r *PromptRegistry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.versions[name]...)
+}
+
+// Render renders the prompt for ref with data.
+func (r *PromptRegistry) Render(ref string, data any) (string, Prompt, error) {
+	rp, err := r.lookup(ref)
+	if err != nil {
+		return "", Prompt{}, err
+	}
+
+	var b strings.Builder
+	if err := rp.template.Execute(&b, data); err != nil {
+		return "", Prompt{}, fmt.Errorf("modelsocket: render prompt %s: %w", rp.prompt.Ref(), err)
+	}
+	return b.String(), rp.prompt, nil
+}
+
+func (r *PromptRegistry) lookup(ref string) (*registeredPrompt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !strings.Contains(ref, "@") {
+		versions := r.versions[ref]
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, ref)
+		}
+		ref = ref + "@" + versions[len(versions)-1]
+	}
+
+	rp, ok := r.prompts[ref]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, ref)
+	}
+	return rp, nil
+}
+
+// AppendPrompt renders a prompt from the client's [WithPromptRegistry]
+// registry and appends it. ref is "name@version", or "name" for the latest
+// version. opts may override the prompt's role.
+//
+// Generations that follow use the prompt's GenOptions as defaults, and
+// their [GenStats] and [Usage] are tagged with the prompt's reference under
+// [PromptTag], until another prompt is appended:
+//
+//	err := seq.AppendPrompt(ctx, "support_greeting@v3", map[string]any{"Name": "Ada"})
+func (s *Seq) AppendPrompt(ctx context.Context, ref string, data any, opts ...AppendOption) error {
+	registry := s.client.cfg.prompts
+	if registry == nil {
+		return fmt.Errorf("%w: %s (no registry)", ErrPromptNotFound, ref)
+	}
+
+	text, prompt, err := registry.Render(ref, data)
+	if err != nil {
+		return err
+	}
+
+	cfg := appendConfig{role: prompt.Role}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.prompt = prompt.Ref()
+
+	if _, err := s.appendMessage(ctx, text, cfg); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.prompt = &prompt
+	s.mu.Unlock()
+	return nil
+}
+
+// Prompt returns the reference of the last prompt appended with
+// [Seq.AppendPrompt], or "" if there is none.
+func (s *Seq) Prompt() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.prompt == nil {
+		return ""
+	}
+	return s.prompt.Ref()
+}
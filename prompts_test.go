@@ -0,0 +1,147 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPromptRegistry(t *testing.T) {
+	r := NewPromptRegistry()
+	r.MustRegister(Prompt{Name: "greet", Version: "v1", Template: "Hi {{.Name}}"})
+	r.MustRegister(Prompt{Name: "greet", Version: "v2", Template: "Hello {{.Name}}", Role: RoleSystem})
+
+	text, p, err := r.Render("greet@v1", map[string]string{"Name": "Ada"})
+	if err != nil {
+		t.Fatalf("Render error: %v", err)
+	}
+	if text != "Hi Ada" || p.Role != RoleUser {
+		t.Errorf("Render = %q as %s, want Hi Ada as user", text, p.Role)
+	}
+
+	// A bare name is the latest version
+	if p, err := r.Get("greet"); err != nil || p.Version != "v2" {
+		t.Errorf("Get(greet) = %+v, %v, want v2", p, err)
+	}
+	if got := r.Versions("greet"); fmt.Sprint(got) != "[v1 v2]" {
+		t.Errorf("Versions = %v, want [v1 v2]", got)
+	}
+
+	if _, err := r.Get("greet@v3"); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("Get(greet@v3) error = %v, want ErrPromptNotFound", err)
+	}
+	if _, _, err := r.Render("greet@v1", map[string]string{}); err == nil {
+		t.Error("Render with missing key succeeded, want error")
+	}
+}
+
+func TestPromptRegistry_RegisterErrors(t *testing.T) {
+	r := NewPromptRegistry()
+	r.MustRegister(Prompt{Name: "greet", Version: "v1", Template: "Hi"})
+
+	for _, p := range []Prompt{
+		{Name: "greet", Version: "v1", Template: "Hi again"},
+		{Name: "greet", Template: "No version"},
+		{Name: "a@b", Version: "v1", Template: "Bad name"},
+		{Name: "bad", Version: "v1", Template: "{{.Unclosed"},
+	} {
+		if err := r.Register(p); err == nil {
+			t.Errorf("Register(%+v) succeeded, want error", p)
+		}
+	}
+}
+
+func TestSeq_AppendPrompt(t *testing.T) {
+	registry := NewPromptRegistry()
+	registry.MustRegister(Prompt{
+		Name:       "support_greeting",
+		Version:    "v3",
+		Template:   "Greet {{.Name}} warmly.",
+		GenOptions: []GenOption{WithTemperature(0.1), WithMaxTokens(20)},
+	})
+
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	finished := make(chan GenStats, 1)
+	client := NewWithTransport(ctx, transport,
+		WithPromptRegistry(registry),
+		WithOnGenFinish(func(seqID string, stats GenStats) { finished <- stats }),
+	)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1", WithSeqTag("team", "support"))
+
+	gens := make(chan genCommandData, 1)
+	appends := make(chan appendCommandData, 1)
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		switch data := req.Data.(type) {
+		case appendCommandData:
+			appends <- data
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			gens <- data
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "Hello Ada!"},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, OutputTokens: 3},
+			}
+		}
+		return nil
+	})
+
+	if err := seq.AppendPrompt(ctx, "support_greeting", map[string]string{"Name": "Ada"}); err != nil {
+		t.Fatalf("AppendPrompt error: %v", err)
+	}
+	if data := <-appends; data.Text != "Greet Ada warmly." || data.Role != string(RoleUser) {
+		t.Errorf("append = %+v, want rendered user prompt", data)
+	}
+	if seq.Prompt() != "support_greeting@v3" {
+		t.Errorf("Prompt = %q, want support_greeting@v3", seq.Prompt())
+	}
+
+	stream, err := seq.Generate(ctx, GenerateAsAssistant(), WithMaxTokens(5))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	// The prompt's options are defaults; the call's win
+	data := <-gens
+	if data.Temperature == nil || *data.Temperature != 0.1 {
+		t.Errorf("Temperature = %v, want prompt's 0.1", data.Temperature)
+	}
+	if data.MaxTokens == nil || *data.MaxTokens != 5 {
+		t.Errorf("MaxTokens = %v, want call's 5", data.MaxTokens)
+	}
+
+	usage := stream.Usage()
+	if usage.Tags[PromptTag] != "support_greeting@v3" || usage.Tags["team"] != "support" {
+		t.Errorf("usage tags = %v, want prompt and team", usage.Tags)
+	}
+	if stats := <-finished; stats.Tags[PromptTag] != "support_greeting@v3" {
+		t.Errorf("GenStats = %+v, want prompt tag", stats)
+	}
+
+	history := seq.History()
+	if len(history) != 2 || history[0].Prompt != "support_greeting@v3" || history[1].Prompt != "" {
+		t.Errorf("history = %+v, want prompt on the appended message", history)
+	}
+}
+
+func TestSeq_AppendPromptNoRegistry(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	err := seq.AppendPrompt(ctx, "greet@v1", nil)
+	if !errors.Is(err, ErrPromptNotFound) || !strings.Contains(err.Error(), "no registry") {
+		t.Errorf("err = %v, want ErrPromptNotFound without registry", err)
+	}
+}
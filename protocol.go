@@ -1,5 +1,7 @@
 package modelsocket
 
+import "encoding/json"
+
 // SeqState represents the state of a sequence.
 type SeqState string
 
@@ -12,13 +14,16 @@ const (
 	StateClosed     SeqState = "closed"
 )
 
-// Role represents the role of a message in a conversation.
+// Role represents the role of a message in a conversation. Servers may
+// support roles beyond the constants below; pass them with [AsRole] and
+// [GenerateAsRole].
 type Role string
 
 const (
 	RoleUser      Role = "user"
 	RoleAssistant Role = "assistant"
 	RoleSystem    Role = "system"
+	RoleTool      Role = "tool"
 )
 
 // --- Requests (Client -> Server) ---
@@ -29,6 +34,12 @@ type MSRequest struct {
 	CID     string      `json:"cid"`
 	SeqID   string      `json:"seq_id,omitempty"`
 	Data    interface{} `json:"data"`
+
+	// Priority with WithPriorityScheduling; not sent
+	priority Priority
+
+	// Run set with WithRunID, for logs; not sent
+	runID string
 }
 
 // SeqOpenData is the data for a seq_open request.
@@ -61,6 +72,7 @@ type SeqGenData struct {
 	RegexMask     *string  `json:"regex_mask,omitempty"`
 	Hidden        bool     `json:"hidden,omitempty"`
 	PrefillText   *string  `json:"prefill_text,omitempty"`
+	Suffix        *string  `json:"suffix,omitempty"`
 	ReturnTokens  *bool    `json:"return_tokens,omitempty"`
 }
 
@@ -89,6 +101,15 @@ type forkCommandData struct {
 	Command string `json:"command"`
 }
 
+type cancelCommandData struct {
+	Command string `json:"command"`
+}
+
+type scoreCommandData struct {
+	Command string `json:"command"`
+	Text    string `json:"text"`
+}
+
 type toolReturnCommandData struct {
 	Command string       `json:"command"`
 	Results []ToolResult `json:"results"`
@@ -154,6 +175,35 @@ func NewForkRequest(cid, seqID string) *MSRequest {
 	}
 }
 
+// NewCancelRequest creates a cancel command request for the generation
+// started with cid. Servers that don't support cancellation reply with an
+// error event.
+func NewCancelRequest(cid, seqID string) *MSRequest {
+	return &MSRequest{
+		Request: "seq_command",
+		CID:     cid,
+		SeqID:   seqID,
+		Data: cancelCommandData{
+			Command: "cancel",
+		},
+	}
+}
+
+// NewScoreRequest creates a score command request, asking the server for the
+// log probability of text as a continuation of the sequence without
+// appending it. Servers that don't support scoring reply with an error event.
+func NewScoreRequest(cid, seqID, text string) *MSRequest {
+	return &MSRequest{
+		Request: "seq_command",
+		CID:     cid,
+		SeqID:   seqID,
+		Data: scoreCommandData{
+			Command: "score",
+			Text:    text,
+		},
+	}
+}
+
 // NewToolReturnRequest creates a new tool_return command request.
 func NewToolReturnRequest(cid, seqID string, results []ToolResult, genOpts SeqGenData) *MSRequest {
 	return &MSRequest{
@@ -188,13 +238,22 @@ type MSEvent struct {
 	// SeqToolCall fields
 	ToolCalls []SeqToolCall `json:"tool_calls,omitempty"`
 
+	// SeqText and SeqGenFinish fields, from servers that moderate output
+	// or cite sources
+	Safety    []SafetyAnnotation `json:"safety,omitempty"`
+	Citations []Citation         `json:"citations,omitempty"`
+
 	// SeqForkFinish fields
 	ChildSeqID string `json:"child_seq_id,omitempty"`
 
+	// SeqScoreFinish fields
+	LogProb       float64   `json:"logprob,omitempty"`
+	TokenLogProbs []float64 `json:"token_logprobs,omitempty"`
+
 	// SeqState fields
 	State SeqState `json:"state,omitempty"`
 
-	// SeqClosed fields
+	// SeqClosed, SeqGenFinish and SeqAppendFinish fields
 	InputTokens  int    `json:"input_tokens,omitempty"`
 	OutputTokens int    `json:"output_tokens,omitempty"`
 	DurationMs   int64  `json:"duration_ms,omitempty"`
@@ -202,6 +261,11 @@ type MSEvent struct {
 
 	// Error fields
 	Message string `json:"message,omitempty"`
+
+	// Raw holds the frame for events that weren't fully decoded: unknown
+	// event types and frames with fields of the wrong type. See
+	// [DecodeEvent].
+	Raw json.RawMessage `json:"-"`
 }
 
 // SeqToolCall represents a tool call from the model.
@@ -245,6 +309,11 @@ func (e *MSEvent) IsSeqForkFinish() bool {
 	return e.Event == "seq_fork_finish"
 }
 
+// IsSeqScoreFinish returns true if this is a seq_score_finish event.
+func (e *MSEvent) IsSeqScoreFinish() bool {
+	return e.Event == "seq_score_finish"
+}
+
 // IsSeqState returns true if this is a seq_state event.
 func (e *MSEvent) IsSeqState() bool {
 	return e.Event == "seq_state"
@@ -259,3 +328,13 @@ func (e *MSEvent) IsSeqClosed() bool {
 func (e *MSEvent) IsError() bool {
 	return e.Event == "error"
 }
+
+// isCompletion reports whether the event ends the command with its CID.
+func (e *MSEvent) isCompletion() bool {
+	switch {
+	case e.IsSeqAppendFinish(), e.IsSeqGenFinish(), e.IsSeqForkFinish(),
+		e.IsSeqScoreFinish(), e.IsSeqClosed(), e.IsError():
+		return true
+	}
+	return false
+}
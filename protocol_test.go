@@ -2,6 +2,7 @@ package modelsocket
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -241,3 +242,99 @@ func TestNewForkRequest(t *testing.T) {
 		t.Errorf("data.command = %v, want fork", dataField["command"])
 	}
 }
+
+func TestNewCancelRequest(t *testing.T) {
+	req := NewCancelRequest("cid-1", "seq-1")
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	if parsed["cid"] != "cid-1" {
+		t.Errorf("cid = %v, want cid-1", parsed["cid"])
+	}
+
+	dataField := parsed["data"].(map[string]interface{})
+	if dataField["command"] != "cancel" {
+		t.Errorf("data.command = %v, want cancel", dataField["command"])
+	}
+}
+
+func TestNewScoreRequest(t *testing.T) {
+	req := NewScoreRequest("cid-1", "seq-1", "Paris")
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	dataField := parsed["data"].(map[string]interface{})
+	if dataField["command"] != "score" {
+		t.Errorf("data.command = %v, want score", dataField["command"])
+	}
+	if dataField["text"] != "Paris" {
+		t.Errorf("data.text = %v, want Paris", dataField["text"])
+	}
+}
+
+func TestMSEvent_ScoreFinish(t *testing.T) {
+	raw := `{"event":"seq_score_finish","seq_id":"seq-1","cid":"cid-1","logprob":-1.5,"token_logprobs":[-1.0,-0.5]}`
+
+	var event MSEvent
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	if !event.IsSeqScoreFinish() {
+		t.Errorf("IsSeqScoreFinish() = false, want true")
+	}
+	if event.LogProb != -1.5 {
+		t.Errorf("LogProb = %v, want -1.5", event.LogProb)
+	}
+	if len(event.TokenLogProbs) != 2 {
+		t.Errorf("len(TokenLogProbs) = %d, want 2", len(event.TokenLogProbs))
+	}
+}
+
+func BenchmarkGenRequest_MarshalJSON(b *testing.B) {
+	maxTokens := 256
+	temperature := 0.7
+	req := NewGenRequest("cid-1", "seq-1", SeqGenData{
+		Role:        "assistant",
+		MaxTokens:   &maxTokens,
+		Temperature: &temperature,
+		StopStrings: []string{"\n\nUser:"},
+	})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendRequest_MarshalJSON(b *testing.B) {
+	req := NewAppendRequest("cid-1", "seq-1", SeqAppendData{
+		Text: strings.Repeat("The quick brown fox jumps over the lazy dog. ", 50),
+		Role: "user",
+	})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+// Package relay lets browsers speak the ModelSocket protocol without holding
+// credentials. A relay accepts WebSocket connections from frontends and
+// forwards a restricted subset of the protocol to an upstream server,
+// authenticating with a key only the relay knows.
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/coder/websocket"
+)
+
+// Errors sent to the browser, as error events, for requests the relay
+// rejects.
+var (
+	ErrModelNotAllowed   = errors.New("relay: model not allowed")
+	ErrRequestNotAllowed = errors.New("relay: request not allowed")
+	ErrBudgetExhausted   = errors.New("relay: token budget exhausted")
+)
+
+// Options configures a relay.
+type Options struct {
+	// URL is the upstream ModelSocket server.
+	URL string
+
+	// APIKey authenticates with the upstream. It is never sent to
+	// browsers.
+	APIKey string
+
+	// DialOptions configure the upstream connection.
+	DialOptions *modelsocket.DialOptions
+
+	// Models lists the models browsers may open. Opens for any other model
+	// are rejected, so an empty list rejects them all.
+	Models []string
+
+	// MaxTokens caps each generation, overriding larger or missing
+	// max_tokens values. Zero leaves generations uncapped.
+	MaxTokens int
+
+	// TokenBudget limits the output tokens a single browser connection may
+	// use. Generations are capped to the remaining budget and rejected once
+	// it is spent. Zero means no limit.
+	TokenBudget int
+
+	// OriginPatterns lists the origins allowed to connect, as for
+	// websocket.AcceptOptions. By default only same-origin connections
+	// are accepted.
+	OriginPatterns []string
+
+	// Logger, if set, receives connection errors.
+	Logger *slog.Logger
+}
+
+// allowedCommands are the sequence commands browsers may send.
+var allowedCommands = []string{"append", "gen", "tool_return", "fork", "cancel", "close"}
+
+// relay serves browser connections.
+type relay struct {
+	opts Options
+}
+
+// Handler returns a handler that upgrades requests to WebSocket connections
+// and relays them upstream, one upstream connection per browser connection.
+//
+// Browser requests are checked and rebuilt before they are forwarded: only
+// seq_open for an allowed model and the commands append, gen, tool_return,
+// fork, cancel and close are accepted, generations are capped by MaxTokens
+// and TokenBudget, and fields the protocol doesn't define are dropped.
+// Nothing from the browser's handshake, such as its headers or cookies,
+// reaches the upstream. Each request needs a cid not used before on the
+// connection, except cancels, which name the generation they stop. Rejected
+// requests are answered with an error event carrying the request's cid.
+func Handler(opts Options) http.Handler {
+	return &relay{opts: opts}
+}
+
+// ServeHTTP relays a single browser connection.
+func (r *relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	conn, err := websocket.Accept(w, req, &websocket.AcceptOptions{
+		Subprotocols:   []string{"modelsocket.v0"},
+		OriginPatterns: r.opts.OriginPatterns,
+	})
+	if err != nil {
+		r.log("accept failed", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	upstream, err := modelsocket.Dial(ctx, r.opts.URL, r.opts.APIKey, r.opts.DialOptions)
+	if err != nil {
+		r.log("upstream dial failed", err)
+		conn.Close(websocket.StatusTryAgainLater, "upstream unavailable")
+		return
+	}
+	defer upstream.Close()
+
+	s := &session{
+		relay:    r,
+		conn:     conn,
+		upstream: upstream,
+		reserved: make(map[string]reservation),
+		seen:     make(map[string]struct{}),
+	}
+
+	go func() {
+		defer cancel()
+		s.forwardEvents(ctx)
+	}()
+
+	err = s.forwardRequests(ctx)
+	if websocket.CloseStatus(err) == -1 && ctx.Err() == nil {
+		r.log("relay failed", err)
+	}
+	conn.Close(websocket.StatusNormalClosure, "")
+}
+
+// log reports a connection error if a logger is configured.
+func (r *relay) log(msg string, err error) {
+	if r.opts.Logger != nil {
+		r.opts.Logger.Warn(msg, slog.Any("error", err))
+	}
+}
+
+// session is a single relayed connection.
+type session struct {
+	relay    *relay
+	conn     *websocket.Conn
+	upstream modelsocket.Transport
+
+	mu       sync.Mutex
+	used     int                    // output tokens used
+	reserved map[string]reservation // budget held by running generations, by cid
+	seen     map[string]struct{}    // cids of the browser's requests so far
+}
+
+// reservation is the budget held by a running generation.
+type reservation struct {
+	seqID  string
+	tokens int
+
+	// chain is the cid of the generation a tool return continues, or the
+	// reservation's own. The server finishes a generation and its
+	// continuations once, under any of their cids.
+	chain string
+
+	// shared is set once a cancel has used the cid, so an error event for
+	// it may be the cancel's rather than the generation's.
+	shared bool
+}
+
+// frame is a browser request with its data left undecoded.
+type frame struct {
+	Request string          `json:"request"`
+	CID     string          `json:"cid"`
+	SeqID   string          `json:"seq_id,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// forwardRequests reads browser requests until the connection fails,
+// forwarding the allowed ones upstream.
+func (s *session) forwardRequests(ctx context.Context) error {
+	for {
+		_, data, err := s.conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+
+		var f frame
+		if err := json.Unmarshal(data, &f); err != nil {
+			if err := s.reject(ctx, "", "", fmt.Errorf("%w: invalid JSON", ErrRequestNotAllowed)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		req, err := s.filter(&f)
+		if err != nil {
+			if err := s.reject(ctx, f.CID, f.SeqID, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.upstream.Send(ctx, req); err != nil {
+			return err
+		}
+	}
+}
+
+// forwardEvents relays upstream events to the browser, counting generated
+// tokens against the budget.
+func (s *session) forwardEvents(ctx context.Context) {
+	for {
+		event, err := s.upstream.Receive(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.relay.log("upstream read failed", err)
+			}
+			return
+		}
+
+		s.account(event)
+
+		if err := s.write(ctx, event); err != nil {
+			return
+		}
+	}
+}
+
+// filter checks a browser request and rebuilds it from the fields the
+// protocol defines.
+func (s *session) filter(f *frame) (*modelsocket.MSRequest, error) {
+	switch f.Request {
+	case "seq_open":
+		var data modelsocket.SeqOpenData
+		if err := json.Unmarshal(f.Data, &data); err != nil {
+			return nil, fmt.Errorf("%w: invalid seq_open data", ErrRequestNotAllowed)
+		}
+		if !slices.Contains(s.relay.opts.Models, data.Model) {
+			return nil, fmt.Errorf("%w: %s", ErrModelNotAllowed, data.Model)
+		}
+		if err := s.claim(f, ""); err != nil {
+			return nil, err
+		}
+		return modelsocket.NewSeqOpenRequest(f.CID, data), nil
+
+	case "seq_command":
+		var cmd struct {
+			Command string `json:"command"`
+		}
+		if err := json.Unmarshal(f.Data, &cmd); err != nil {
+			return nil, fmt.Errorf("%w: invalid seq_command data", ErrRequestNotAllowed)
+		}
+		if !slices.Contains(allowedCommands, cmd.Command) {
+			return nil, fmt.Errorf("%w: command %q", ErrRequestNotAllowed, cmd.Command)
+		}
+		if err := s.claim(f, cmd.Command); err != nil {
+			return nil, err
+		}
+		return s.command(f, cmd.Command)
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrRequestNotAllowed, f.Request)
+}
+
+// claim checks that a request's cid is new, so a browser can't take over
+// another request's events or budget reservation. Cancels name the
+// generation they stop by its cid, so they may reuse one.
+func (s *session) claim(f *frame, command string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, used := s.seen[f.CID]; !used {
+		s.seen[f.CID] = struct{}{}
+		return nil
+	}
+	if command != "cancel" {
+		return fmt.Errorf("%w: cid %q already used", ErrRequestNotAllowed, f.CID)
+	}
+	if r, ok := s.reserved[f.CID]; ok {
+		r.shared = true
+		s.reserved[f.CID] = r
+	}
+	return nil
+}
+
+// command rebuilds an allowed sequence command.
+func (s *session) command(f *frame, command string) (*modelsocket.MSRequest, error) {
+	switch command {
+	case "append":
+		var data modelsocket.SeqAppendData
+		if err := json.Unmarshal(f.Data, &data); err != nil {
+			return nil, fmt.Errorf("%w: invalid append data", ErrRequestNotAllowed)
+		}
+		return modelsocket.NewAppendRequest(f.CID, f.SeqID, data), nil
+
+	case "gen":
+		var data modelsocket.SeqGenData
+		if err := json.Unmarshal(f.Data, &data); err != nil {
+			return nil, fmt.Errorf("%w: invalid gen data", ErrRequestNotAllowed)
+		}
+		if err := s.limit(f, &data, false); err != nil {
+			return nil, err
+		}
+		return modelsocket.NewGenRequest(f.CID, f.SeqID, data), nil
+
+	case "tool_return":
+		var data struct {
+			Results []modelsocket.ToolResult `json:"results"`
+			GenOpts modelsocket.SeqGenData   `json:"gen_opts"`
+		}
+		if err := json.Unmarshal(f.Data, &data); err != nil {
+			return nil, fmt.Errorf("%w: invalid tool_return data", ErrRequestNotAllowed)
+		}
+		if err := s.limit(f, &data.GenOpts, true); err != nil {
+			return nil, err
+		}
+		return modelsocket.NewToolReturnRequest(f.CID, f.SeqID, data.Results, data.GenOpts), nil
+
+	case "fork":
+		return modelsocket.NewForkRequest(f.CID, f.SeqID), nil
+	case "cancel":
+		return modelsocket.NewCancelRequest(f.CID, f.SeqID), nil
+	default:
+		return modelsocket.NewCloseRequest(f.CID, f.SeqID), nil
+	}
+}
+
+// limit caps a generation's max_tokens by MaxTokens and the remaining
+// budget. With a budget, the generation's tokens are reserved until it
+// finishes, so concurrent generations can't overspend it. resumes is set
+// for tool returns, which continue the sequence's running generation. A
+// max_tokens below 1 is rejected, so it can't slip past either cap.
+func (s *session) limit(f *frame, data *modelsocket.SeqGenData, resumes bool) error {
+	if data.MaxTokens != nil && *data.MaxTokens <= 0 {
+		return fmt.Errorf("%w: max_tokens %d", ErrRequestNotAllowed, *data.MaxTokens)
+	}
+
+	limit := s.relay.opts.MaxTokens
+	if data.MaxTokens != nil && (limit == 0 || *data.MaxTokens < limit) {
+		limit = *data.MaxTokens
+	}
+
+	if budget := s.relay.opts.TokenBudget; budget > 0 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		remaining := budget - s.used
+		for _, r := range s.reserved {
+			remaining -= r.tokens
+		}
+		if remaining <= 0 {
+			return ErrBudgetExhausted
+		}
+		if limit == 0 || remaining < limit {
+			limit = remaining
+		}
+		r := reservation{seqID: f.SeqID, tokens: limit, chain: f.CID}
+		if resumes {
+			for _, running := range s.reserved {
+				if running.seqID == f.SeqID {
+					r.chain = running.chain
+					break
+				}
+			}
+		}
+		s.reserved[f.CID] = r
+	}
+
+	if limit > 0 {
+		data.MaxTokens = &limit
+	}
+	return nil
+}
+
+// account counts a finished generation's tokens against the budget and
+// releases reservations for generations that have ended.
+func (s *session) account(event *modelsocket.MSEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case event.IsSeqGenFinish():
+		s.used += event.OutputTokens
+		if r, ok := s.reserved[event.CID]; ok {
+			for cid, other := range s.reserved {
+				if other.chain == r.chain {
+					delete(s.reserved, cid)
+				}
+			}
+		}
+	case event.IsError():
+		if r, ok := s.reserved[event.CID]; ok && !r.shared {
+			delete(s.reserved, event.CID)
+		}
+	case event.IsSeqClosed():
+		for cid, r := range s.reserved {
+			if r.seqID == event.SeqID {
+				delete(s.reserved, cid)
+			}
+		}
+	}
+}
+
+// reject answers a request with an error event.
+func (s *session) reject(ctx context.Context, cid, seqID string, err error) error {
+	return s.write(ctx, &modelsocket.MSEvent{
+		Event:   "error",
+		CID:     cid,
+		SeqID:   seqID,
+		Message: err.Error(),
+	})
+}
+
+// write sends an event to the browser.
+func (s *session) write(ctx context.Context, event *modelsocket.MSEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.conn.Write(ctx, websocket.MessageText, data)
+}
@@ -0,0 +1,334 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/coder/websocket"
+)
+
+// upstream is a fake ModelSocket server that records the frames it receives.
+// Each generation produces "Hi" and reports three output tokens. With
+// toolCalls set, generations make a tool call instead, and tool returns
+// finish them under the generation's cid. Cancels are rejected.
+type upstream struct {
+	url string
+
+	mu        sync.Mutex
+	auth      []string
+	frames    []map[string]any
+	toolCalls bool
+	lastGen   string
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+
+	u := &upstream{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		u.auth = append(u.auth, r.Header.Get("Authorization"))
+		u.mu.Unlock()
+
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols: []string{"modelsocket.v0"},
+		})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+
+		ctx := r.Context()
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+
+			var frame map[string]any
+			json.Unmarshal(data, &frame)
+			cid, _ := frame["cid"].(string)
+			cmd, _ := frame["data"].(map[string]any)
+
+			u.mu.Lock()
+			u.frames = append(u.frames, frame)
+			toolCalls, lastGen := u.toolCalls, u.lastGen
+			if cmd["command"] == "gen" {
+				u.lastGen = cid
+			}
+			u.mu.Unlock()
+
+			switch {
+			case frame["request"] == "seq_open":
+				writeEvent(ctx, conn, modelsocket.MSEvent{Event: "seq_opened", CID: cid, SeqID: "s1"})
+			case cmd["command"] == "cancel":
+				writeEvent(ctx, conn, modelsocket.MSEvent{Event: "error", CID: cid, SeqID: "s1", Message: "unknown command"})
+			case cmd["command"] == "gen" && toolCalls:
+				writeEvent(ctx, conn, modelsocket.MSEvent{Event: "seq_tool_call", SeqID: "s1", ToolCalls: []modelsocket.SeqToolCall{{Name: "lookup", Args: "{}"}}})
+			case cmd["command"] == "tool_return":
+				writeEvent(ctx, conn, modelsocket.MSEvent{Event: "seq_text", SeqID: "s1", Text: "Hi"})
+				writeEvent(ctx, conn, modelsocket.MSEvent{Event: "seq_gen_finish", CID: lastGen, SeqID: "s1", OutputTokens: 3})
+			case cmd["command"] == "gen":
+				writeEvent(ctx, conn, modelsocket.MSEvent{Event: "seq_text", SeqID: "s1", Text: "Hi"})
+				writeEvent(ctx, conn, modelsocket.MSEvent{Event: "seq_gen_finish", CID: cid, SeqID: "s1", OutputTokens: 3})
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	u.url = "ws" + strings.TrimPrefix(srv.URL, "http")
+	return u
+}
+
+func (u *upstream) received() []map[string]any {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]map[string]any(nil), u.frames...)
+}
+
+func writeEvent(ctx context.Context, conn *websocket.Conn, event modelsocket.MSEvent) {
+	data, _ := json.Marshal(event)
+	conn.Write(ctx, websocket.MessageText, data)
+}
+
+// browser connects to a relay for opts and returns the connection.
+func browser(t *testing.T, opts Options) *websocket.Conn {
+	t.Helper()
+
+	srv := httptest.NewServer(Handler(opts))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), &websocket.DialOptions{
+		Subprotocols: []string{"modelsocket.v0"},
+		HTTPHeader:   http.Header{"Authorization": {"Bearer browser-key"}},
+	})
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, frame string) {
+	t.Helper()
+	if err := conn.Write(context.Background(), websocket.MessageText, []byte(frame)); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+}
+
+func recv(t *testing.T, conn *websocket.Conn) *modelsocket.MSEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+	var event modelsocket.MSEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	return &event
+}
+
+func TestRelay_Generate(t *testing.T) {
+	up := newUpstream(t)
+	conn := browser(t, Options{URL: up.url, APIKey: "relay-key", Models: []string{"m1"}, MaxTokens: 100})
+
+	send(t, conn, `{"request":"seq_open","cid":"c1","data":{"model":"m1"}}`)
+	if event := recv(t, conn); !event.IsSeqOpened() || event.SeqID != "s1" {
+		t.Fatalf("event = %+v, want seq_opened", event)
+	}
+
+	send(t, conn, `{"request":"seq_command","cid":"c2","seq_id":"s1","data":{"command":"gen","max_tokens":500,"api_key":"leak"}}`)
+	if event := recv(t, conn); event.Text != "Hi" {
+		t.Errorf("event = %+v, want text", event)
+	}
+	if event := recv(t, conn); !event.IsSeqGenFinish() {
+		t.Errorf("event = %+v, want seq_gen_finish", event)
+	}
+
+	up.mu.Lock()
+	auth := up.auth
+	up.mu.Unlock()
+	if len(auth) != 1 || auth[0] != "Bearer relay-key" {
+		t.Errorf("upstream Authorization = %q, want the relay's key", auth)
+	}
+
+	frames := up.received()
+	if len(frames) != 2 {
+		t.Fatalf("upstream frames = %d, want 2", len(frames))
+	}
+	gen := frames[1]["data"].(map[string]any)
+	if gen["max_tokens"] != float64(100) {
+		t.Errorf("max_tokens = %v, want 100", gen["max_tokens"])
+	}
+	if _, ok := gen["api_key"]; ok {
+		t.Error("unknown field forwarded upstream")
+	}
+}
+
+func TestRelay_Rejects(t *testing.T) {
+	up := newUpstream(t)
+	conn := browser(t, Options{URL: up.url, Models: []string{"m1"}})
+
+	tests := []struct {
+		name  string
+		frame string
+		want  string
+	}{
+		{"model", `{"request":"seq_open","cid":"c1","data":{"model":"m2"}}`, ErrModelNotAllowed.Error()},
+		{"command", `{"request":"seq_command","cid":"c2","seq_id":"s1","data":{"command":"score"}}`, ErrRequestNotAllowed.Error()},
+		{"request", `{"request":"admin","cid":"c3"}`, ErrRequestNotAllowed.Error()},
+		{"json", `{`, ErrRequestNotAllowed.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send(t, conn, tt.frame)
+			event := recv(t, conn)
+			if !event.IsError() || !strings.HasPrefix(event.Message, tt.want) {
+				t.Errorf("event = %+v, want error %q", event, tt.want)
+			}
+		})
+	}
+
+	if frames := up.received(); len(frames) != 0 {
+		t.Errorf("upstream frames = %v, want none", frames)
+	}
+}
+
+func TestRelay_TokenBudget(t *testing.T) {
+	up := newUpstream(t)
+	conn := browser(t, Options{URL: up.url, Models: []string{"m1"}, TokenBudget: 5})
+
+	send(t, conn, `{"request":"seq_open","cid":"c1","data":{"model":"m1"}}`)
+	recv(t, conn)
+
+	// The first generation is capped to the budget and uses 3 tokens
+	send(t, conn, `{"request":"seq_command","cid":"c2","seq_id":"s1","data":{"command":"gen"}}`)
+	recv(t, conn)
+	recv(t, conn)
+
+	// The second is capped to the 2 remaining
+	send(t, conn, `{"request":"seq_command","cid":"c3","seq_id":"s1","data":{"command":"gen","max_tokens":10}}`)
+	recv(t, conn)
+	recv(t, conn)
+
+	send(t, conn, `{"request":"seq_command","cid":"c4","seq_id":"s1","data":{"command":"gen"}}`)
+	event := recv(t, conn)
+	if !event.IsError() || event.CID != "c4" || event.Message != ErrBudgetExhausted.Error() {
+		t.Errorf("event = %+v, want budget error", event)
+	}
+
+	frames := up.received()
+	if len(frames) != 3 {
+		t.Fatalf("upstream frames = %d, want 3", len(frames))
+	}
+	for i, want := range []float64{5, 2} {
+		data := frames[i+1]["data"].(map[string]any)
+		if data["max_tokens"] != want {
+			t.Errorf("gen %d max_tokens = %v, want %v", i+1, data["max_tokens"], want)
+		}
+	}
+}
+
+func TestRelay_NonPositiveMaxTokens(t *testing.T) {
+	up := newUpstream(t)
+	conn := browser(t, Options{URL: up.url, Models: []string{"m1"}, MaxTokens: 5, TokenBudget: 10})
+
+	send(t, conn, `{"request":"seq_open","cid":"c1","data":{"model":"m1"}}`)
+	recv(t, conn)
+
+	// Neither value gets past the cap, nor reserves a negative amount
+	for i, maxTokens := range []string{"0", "-1"} {
+		cid := fmt.Sprintf("c%d", i+2)
+		send(t, conn, `{"request":"seq_command","cid":"`+cid+`","seq_id":"s1","data":{"command":"gen","max_tokens":`+maxTokens+`}}`)
+		if event := recv(t, conn); !event.IsError() || event.CID != cid || !strings.Contains(event.Message, ErrRequestNotAllowed.Error()) {
+			t.Errorf("max_tokens %s: event = %+v, want the request rejected", maxTokens, event)
+		}
+	}
+
+	send(t, conn, `{"request":"seq_command","cid":"c4","seq_id":"s1","data":{"command":"gen"}}`)
+	recv(t, conn)
+	frames := up.received()
+	if len(frames) != 2 {
+		t.Fatalf("upstream frames = %d, want the open and one gen", len(frames))
+	}
+	if data := frames[1]["data"].(map[string]any); data["max_tokens"] != float64(5) {
+		t.Errorf("max_tokens = %v, want the cap of 5", data["max_tokens"])
+	}
+}
+
+func TestRelay_TokenBudget_ReusedCID(t *testing.T) {
+	up := newUpstream(t)
+	up.mu.Lock()
+	up.toolCalls = true
+	up.mu.Unlock()
+	conn := browser(t, Options{URL: up.url, Models: []string{"m1"}, TokenBudget: 10})
+
+	send(t, conn, `{"request":"seq_open","cid":"c1","data":{"model":"m1"}}`)
+	recv(t, conn)
+	send(t, conn, `{"request":"seq_command","cid":"c2","seq_id":"s1","data":{"command":"gen"}}`)
+	recv(t, conn)
+
+	// Reusing the running generation's cid is rejected
+	for _, frame := range []string{
+		`{"request":"seq_command","cid":"c2","seq_id":"s1","data":{"command":"gen"}}`,
+		`{"request":"seq_command","cid":"c2","seq_id":"bad","data":{"command":"append","text":"x"}}`,
+	} {
+		send(t, conn, frame)
+		if event := recv(t, conn); !event.IsError() || !strings.Contains(event.Message, "already used") {
+			t.Errorf("event = %+v, want cid rejected", event)
+		}
+	}
+
+	// A rejected cancel doesn't release the generation's reservation
+	send(t, conn, `{"request":"seq_command","cid":"c2","seq_id":"s1","data":{"command":"cancel"}}`)
+	if event := recv(t, conn); !event.IsError() || event.Message != "unknown command" {
+		t.Fatalf("event = %+v, want the upstream's cancel error", event)
+	}
+	send(t, conn, `{"request":"seq_command","cid":"c3","seq_id":"s1","data":{"command":"gen"}}`)
+	if event := recv(t, conn); !event.IsError() || event.Message != ErrBudgetExhausted.Error() {
+		t.Errorf("event = %+v, want budget error", event)
+	}
+}
+
+func TestRelay_TokenBudget_ContinuationFinish(t *testing.T) {
+	up := newUpstream(t)
+	up.mu.Lock()
+	up.toolCalls = true
+	up.mu.Unlock()
+	conn := browser(t, Options{URL: up.url, Models: []string{"m1"}, TokenBudget: 10})
+
+	send(t, conn, `{"request":"seq_open","cid":"c1","data":{"model":"m1"}}`)
+	recv(t, conn)
+	send(t, conn, `{"request":"seq_command","cid":"c2","seq_id":"s1","data":{"command":"gen","max_tokens":4}}`)
+	recv(t, conn)
+
+	// The continuation finishes under the generation's cid, releasing both
+	// reservations
+	send(t, conn, `{"request":"seq_command","cid":"c3","seq_id":"s1","data":{"command":"tool_return","results":[],"gen_opts":{"max_tokens":4}}}`)
+	recv(t, conn)
+	if event := recv(t, conn); !event.IsSeqGenFinish() || event.CID != "c2" {
+		t.Fatalf("event = %+v, want finish under c2", event)
+	}
+
+	send(t, conn, `{"request":"seq_command","cid":"c4","seq_id":"s1","data":{"command":"gen"}}`)
+	recv(t, conn)
+	frames := up.received()
+	if data := frames[len(frames)-1]["data"].(map[string]any); data["max_tokens"] != float64(7) {
+		t.Errorf("max_tokens = %v, want the 7 left after 3 used", data["max_tokens"])
+	}
+}
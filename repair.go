@@ -0,0 +1,199 @@
+package modelsocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RepairJSON makes a best-effort attempt to turn malformed JSON, as commonly
+// emitted by small models for tool arguments, into valid JSON. Valid input is
+// returned unchanged. The repairs applied are:
+//
+//   - extracting the outermost object or array from surrounding prose or
+//     code fences
+//   - converting single-quoted strings to double-quoted strings
+//   - quoting bare object keys
+//   - converting Python literals (True, False, None) to JSON literals
+//   - removing trailing commas
+//   - closing unterminated strings, objects and arrays
+//
+// An error wrapping [ErrInvalidToolArgs] is returned if the result is still
+// not valid JSON.
+func RepairJSON(s string) (string, error) {
+	if json.Valid([]byte(s)) {
+		return s, nil
+	}
+
+	candidate := extractJSON(s)
+	if candidate == "" {
+		return "", fmt.Errorf("%w: no JSON value found", ErrInvalidToolArgs)
+	}
+
+	var out []byte
+	var stack []byte
+	for i := 0; i < len(candidate); {
+		c := candidate[i]
+		switch {
+		case c == '"' || c == '\'':
+			str, n := repairString(candidate[i:])
+			out = append(out, str...)
+			i += n
+			continue
+		case c == '{' || c == '[':
+			stack = append(stack, c)
+			out = append(out, c)
+		case c == '}' || c == ']':
+			out = trimTrailingComma(out)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			out = append(out, c)
+		case c == '-' || (c >= '0' && c <= '9'):
+			n := scanWhile(candidate[i:], isNumberByte)
+			out = append(out, candidate[i:i+n]...)
+			i += n
+			continue
+		case isIdentByte(c):
+			n := scanWhile(candidate[i:], isIdentByte)
+			out = append(out, repairWord(candidate[i:i+n])...)
+			i += n
+			continue
+		default:
+			out = append(out, c)
+		}
+		i++
+	}
+
+	out = trimTrailingComma(out)
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+	}
+
+	if !json.Valid(out) {
+		return "", fmt.Errorf("%w: unable to repair %q", ErrInvalidToolArgs, s)
+	}
+	return string(out), nil
+}
+
+// extractJSON returns the span from the first opening bracket to its last
+// matching closing bracket, or to the end of s if the value is truncated.
+func extractJSON(s string) string {
+	start := strings.IndexAny(s, "{[")
+	if start < 0 {
+		return ""
+	}
+	closing := byte('}')
+	if s[start] == '[' {
+		closing = ']'
+	}
+	if end := strings.LastIndexByte(s, closing); end > start {
+		return s[start : end+1]
+	}
+	return s[start:]
+}
+
+// repairString reads a single- or double-quoted string from the start of s
+// and returns it as a JSON string along with the number of bytes consumed.
+// Unterminated strings are closed.
+func repairString(s string) (string, int) {
+	quote := s[0]
+	var sb strings.Builder
+	sb.WriteByte('"')
+
+	i := 1
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			if s[i+1] == '\'' {
+				sb.WriteByte('\'')
+			} else {
+				sb.WriteByte(c)
+				sb.WriteByte(s[i+1])
+			}
+			i += 2
+			continue
+		case c == quote:
+			sb.WriteByte('"')
+			return sb.String(), i + 1
+		case c == '"':
+			sb.WriteString(`\"`)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		default:
+			sb.WriteByte(c)
+		}
+		i++
+	}
+
+	sb.WriteByte('"')
+	return sb.String(), i
+}
+
+// repairWord converts a bare word into a JSON literal or quoted string.
+func repairWord(word string) string {
+	switch word {
+	case "true", "false", "null":
+		return word
+	case "True":
+		return "true"
+	case "False":
+		return "false"
+	case "None":
+		return "null"
+	}
+	quoted, _ := json.Marshal(word)
+	return string(quoted)
+}
+
+// trimTrailingComma removes a trailing comma and any whitespace after it.
+func trimTrailingComma(b []byte) []byte {
+	trimmed := strings.TrimRight(string(b), " \t\r\n")
+	if strings.HasSuffix(trimmed, ",") {
+		return b[:len(trimmed)-1]
+	}
+	return b
+}
+
+func scanWhile(s string, fn func(byte) bool) int {
+	n := 0
+	for n < len(s) && fn(s[n]) {
+		n++
+	}
+	return n
+}
+
+func isNumberByte(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// DefaultInvalidArgsResult is the tool result sent back to the model when a
+// tool call's arguments cannot be repaired. It asks the model to re-emit the
+// call with valid JSON.
+//
+// The request goes back as the failed call's result, not as a separate
+// hidden turn: a tool_return must carry a result for every call the model
+// made, so the result is where the model looks for what happened to the
+// call. It is recorded in the history as that tool result.
+func DefaultInvalidArgsResult(call ToolCall, err error) string {
+	var argsErr *ToolArgsError
+	if errors.As(err, &argsErr) {
+		err = argsErr.Err
+	}
+	return fmt.Sprintf(
+		"error: the arguments for tool %q were not valid JSON (%v). Please re-emit the tool call with its arguments as a single valid JSON object.",
+		call.Name, err,
+	)
+}
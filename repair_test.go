@@ -0,0 +1,107 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"valid", `{"city": "NYC"}`, `{"city": "NYC"}`},
+		{"trailing comma", `{"a": 1, "b": [1, 2,],}`, `{"a": 1, "b": [1, 2]}`},
+		{"single quotes", `{'city': 'it\'s "NYC"'}`, `{"city": "it's \"NYC\""}`},
+		{"bare keys", `{city: "NYC", count: 2}`, `{"city": "NYC", "count": 2}`},
+		{"python literals", `{"a": True, "b": None}`, `{"a": true, "b": null}`},
+		{"prose", "Sure! ```json\n{\"a\": 1}\n``` hope that helps", `{"a": 1}`},
+		{"truncated", `{"a": {"b": "c`, `{"a": {"b": "c"}}`},
+		{"numbers", `{'n': -1.5e3,}`, `{"n": -1.5e3}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RepairJSON(tt.input)
+			if err != nil {
+				t.Fatalf("RepairJSON error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RepairJSON(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepairJSON_Unrepairable(t *testing.T) {
+	for _, input := range []string{"", "no json here", `{"a" "b"}`} {
+		_, err := RepairJSON(input)
+		if !errors.Is(err, ErrInvalidToolArgs) {
+			t.Errorf("RepairJSON(%q) err = %v, want ErrInvalidToolArgs", input, err)
+		}
+	}
+}
+
+func TestToolbox_ArgRepair(t *testing.T) {
+	tb := NewToolbox()
+	tb.SetArgRepair(true)
+
+	var got string
+	tb.Add(NewFuncTool(
+		ToolDefinition{Name: "echo"},
+		func(ctx context.Context, args string) (string, error) {
+			got = args
+			return "ok", nil
+		},
+	))
+
+	if _, err := tb.Call(context.Background(), "echo", `{'a': 1,}`); err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if got != `{"a": 1}` {
+		t.Errorf("args = %s, want {\"a\": 1}", got)
+	}
+
+	_, err := tb.Call(context.Background(), "echo", "not json")
+	var argsErr *ToolArgsError
+	if !errors.As(err, &argsErr) {
+		t.Fatalf("err = %v, want ToolArgsError", err)
+	}
+	if argsErr.Name != "echo" || argsErr.Args != "not json" {
+		t.Errorf("ToolArgsError = %+v", argsErr)
+	}
+	if !errors.Is(err, ErrInvalidToolArgs) {
+		t.Error("errors.Is(err, ErrInvalidToolArgs) = false")
+	}
+}
+
+func TestToolbox_CallTools_InvalidArgs(t *testing.T) {
+	tb := NewToolbox()
+	tb.SetArgRepair(true)
+	tb.Add(NewFuncTool(
+		ToolDefinition{Name: "echo"},
+		func(ctx context.Context, args string) (string, error) { return "ok", nil },
+	))
+
+	calls := []ToolCall{{Name: "echo", Args: "oops"}}
+
+	results, err := tb.CallTools(context.Background(), calls)
+	if err != nil {
+		t.Fatalf("CallTools error: %v", err)
+	}
+	if !strings.Contains(results[0].Result, "re-emit") {
+		t.Errorf("Result = %s, want re-emit instruction", results[0].Result)
+	}
+
+	tb.SetOnInvalidArgs(func(call ToolCall, err error) string {
+		return "retry " + call.Name
+	})
+
+	results, _ = tb.CallTools(context.Background(), calls)
+	if results[0].Result != "retry echo" {
+		t.Errorf("Result = %s, want retry echo", results[0].Result)
+	}
+}
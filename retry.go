@@ -0,0 +1,186 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// RetryPolicy configures how [WithGenerateRetry] recovers failed
+// generations.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles for each
+	// retry after that.
+	Backoff time.Duration
+
+	// Retryable reports whether a failed generation should be retried.
+	// Defaults to [IsRetryable].
+	Retryable func(err error) bool
+
+	// Reconnect returns a client to replay the conversation on when the
+	// original connection was lost. Without it, generations that fail
+	// because the connection dropped are not retried.
+	Reconnect func(ctx context.Context) (*Client, error)
+
+	// Dedupe skips as much retried text as was already delivered, so the
+	// consumer doesn't see the start of the response twice. This assumes
+	// the retry reproduces the same prefix, e.g. because the generation
+	// uses [WithSeed]; otherwise the skipped text is lost.
+	Dedupe bool
+}
+
+// IsRetryable reports whether err is a transient generation failure: the
+// connection was lost or the server closed the sequence with an error.
+func IsRetryable(err error) bool {
+	var seqErr *SeqError
+	return errors.Is(err, ErrConnectionLost) || errors.As(err, &seqErr)
+}
+
+// generateWithRetry starts a generation whose stream survives retryable
+// failures.
+func (s *Seq) generateWithRetry(ctx context.Context, cfg genConfig) (*GenStream, error) {
+	attempt, err := s.generate(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := newGenStream(s, attempt.cid)
+	stream.ctx = attempt.ctx
+	stream.markSent()
+
+	go stream.retry(ctx, attempt, cfg)
+
+	return stream, nil
+}
+
+// retry forwards chunks from attempt until the generation finishes. When an
+// attempt fails with a retryable error, the conversation is replayed into a
+// new sequence and generation starts again there, with ctx.
+func (g *GenStream) retry(ctx context.Context, attempt *GenStream, cfg genConfig) {
+	policy := cfg.retry
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	backoff := policy.Backoff
+
+	var delivered, skip int
+	for n := 1; ; {
+		chunk, err := attempt.Next(g.ctx)
+		if err == nil && chunk == nil {
+			g.handleFinish(&MSEvent{
+				InputTokens:  attempt.InputTokens(),
+				OutputTokens: attempt.OutputTokens(),
+			})
+			return
+		}
+
+		if err == nil {
+			if skip > 0 && !chunk.Hidden {
+				cut := min(skip, len(chunk.Text))
+				chunk.Text = chunk.Text[cut:]
+				skip -= cut
+				if chunk.Text == "" && len(chunk.ToolCalls) == 0 {
+					continue
+				}
+			}
+			if !chunk.Hidden {
+				delivered += len(chunk.Text)
+			}
+			g.forward(chunk)
+			continue
+		}
+
+		seq := g.Seq()
+		if n >= policy.MaxAttempts || !retryable(err) ||
+			(!seq.client.Healthy() && policy.Reconnect == nil) {
+			g.handleError(err)
+			return
+		}
+
+		n++
+		seq.client.log(slog.LevelWarn, "", "retrying generation",
+			slog.String(logKeySeqID, seq.id),
+			slog.String(logKeyCID, attempt.cid),
+			slog.Int(logKeyAttempt, n),
+			slog.Any(logKeyError, err),
+		)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			g.handleError(context.Cause(ctx))
+			return
+		case <-timer.C:
+		}
+		backoff *= 2
+
+		next, err := seq.replacement(ctx, policy)
+		if err == nil {
+			attempt, err = next.generate(ctx, cfg)
+			if err != nil {
+				go next.Close(next.client.ctx)
+			}
+		}
+		if err != nil {
+			g.handleError(fmt.Errorf("modelsocket: retry generation: %w", err))
+			return
+		}
+
+		g.mu.Lock()
+		g.seq = next
+		g.mu.Unlock()
+
+		if policy.Dedupe {
+			skip = delivered
+		}
+	}
+}
+
+// forward delivers a chunk produced by another stream.
+func (g *GenStream) forward(chunk *GenChunk) {
+	chunk = unpooledChunk(chunk)
+
+	g.mu.Lock()
+	if g.finished {
+		g.mu.Unlock()
+		return
+	}
+	g.timer.markText()
+	g.citations = append(g.citations, chunk.Citations...)
+	g.mu.Unlock()
+
+	g.deliver(chunk)
+}
+
+// replacement replays the sequence's history into a new sequence, on a new
+// connection if the current one was lost. The sequence itself is closed.
+func (s *Seq) replacement(ctx context.Context, policy *RetryPolicy) (*Seq, error) {
+	client := s.client
+	if client.Healthy() {
+		go s.Close(client.ctx)
+	} else {
+		var err error
+		if client, err = policy.Reconnect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err := client.replay(ctx, s.model, s.History(), s.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The replacement carries on the session the sequence was restored
+	// from, so parking it must not conflict
+	s.mu.RLock()
+	next.version = s.version
+	s.mu.RUnlock()
+	return next, nil
+}
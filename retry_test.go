@@ -0,0 +1,262 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSeq_GenerateRetry(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	go func() {
+		req := transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_append_finish", SeqID: "seq-1", CID: req.CID})
+	}()
+	if err := seq.Append(ctx, "Hi", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+
+	replayed := make(chan appendCommandData, 1)
+	go func() {
+		// The first attempt fails part way through
+		transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "Hel"})
+		transport.pushEvent(&MSEvent{Event: "seq_closed", SeqID: "seq-1", ErrorMsg: "worker crashed"})
+
+		// The conversation is replayed into a new sequence
+		req := transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_opened", CID: req.CID, SeqID: "seq-2"})
+		req = transport.waitForRequest(t, time.Second)
+		replayed <- req.Data.(appendCommandData)
+		transport.pushEvent(&MSEvent{Event: "seq_append_finish", SeqID: "seq-2", CID: req.CID})
+
+		req = transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-2", Text: "Hello"})
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-2", Text: " there"})
+		transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-2", CID: req.CID, OutputTokens: 2})
+	}()
+
+	stream, err := seq.Generate(ctx, WithGenerateRetry(RetryPolicy{MaxAttempts: 2, Dedupe: true}))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "Hello there" {
+		t.Errorf("text = %q, want %q", text, "Hello there")
+	}
+	if stream.OutputTokens() != 2 {
+		t.Errorf("OutputTokens = %d, want 2", stream.OutputTokens())
+	}
+	if id := stream.Seq().ID(); id != "seq-2" {
+		t.Errorf("Seq().ID() = %s, want seq-2", id)
+	}
+
+	data := <-replayed
+	if data.Text != "Hi" || data.Role != "user" {
+		t.Errorf("replayed append = %s %q, want user \"Hi\"", data.Role, data.Text)
+	}
+
+	history := stream.Seq().History()
+	if len(history) != 2 || history[1].Text != "Hello there" {
+		t.Errorf("History = %+v, want the user message and the retried response", history)
+	}
+}
+
+func TestSeq_GenerateRetry_NotRetryable(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	go func() {
+		transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_closed", SeqID: "seq-1", ErrorMsg: "bad request"})
+	}()
+
+	stream, err := seq.Generate(ctx, WithGenerateRetry(RetryPolicy{
+		MaxAttempts: 3,
+		Retryable:   func(error) bool { return false },
+	}))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	_, err = stream.Text(ctx)
+	var seqErr *SeqError
+	if !errors.Is(err, ErrSeqClosed) || !errors.As(err, &seqErr) {
+		t.Fatalf("err = %v, want ErrSeqClosed wrapping a SeqError", err)
+	}
+
+	select {
+	case req := <-transport.onSend:
+		t.Errorf("unexpected request after failure: %s", req.Request)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSeq_GenerateRetry_ConnectionLost(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	replacement := newMockTransport()
+	reconnected := NewWithTransport(ctx, replacement)
+	defer reconnected.Close(ctx)
+
+	go func() {
+		transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-1", Text: "Hel"})
+		transport.Close()
+
+		req := replacement.waitForRequest(t, time.Second)
+		replacement.pushEvent(&MSEvent{Event: "seq_opened", CID: req.CID, SeqID: "seq-2"})
+		req = replacement.waitForRequest(t, time.Second)
+		replacement.pushEvent(&MSEvent{Event: "seq_text", SeqID: "seq-2", Text: "Hello"})
+		replacement.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-2", CID: req.CID})
+	}()
+
+	stream, err := seq.Generate(ctx, WithGenerateRetry(RetryPolicy{
+		MaxAttempts: 2,
+		Reconnect: func(ctx context.Context) (*Client, error) {
+			return reconnected, nil
+		},
+	}))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	// Without Dedupe the retried response is streamed from the start
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "HelHello" {
+		t.Errorf("text = %q, want %q", text, "HelHello")
+	}
+	if stream.Seq().client != reconnected {
+		t.Error("stream.Seq() is not on the reconnected client")
+	}
+}
+
+func TestSeq_GenerateRetry_CancelDuringBackoff(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	go func() {
+		transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_closed", SeqID: "seq-1", ErrorMsg: "worker crashed"})
+	}()
+
+	genCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := seq.Generate(genCtx, WithGenerateRetry(RetryPolicy{MaxAttempts: 2, Backoff: time.Hour}))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.Text(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Text error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retry backoff ignored cancellation")
+	}
+}
+
+func TestSeq_GenerateRetry_ClosesFailedReplacement(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport, WithClientBudget(0, 5, 0))
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	closed := make(chan string, 1)
+	go func() {
+		// The first attempt spends the client's budget before failing
+		transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_gen_finish", SeqID: "seq-1", CID: "earlier", OutputTokens: 5})
+		transport.pushEvent(&MSEvent{Event: "seq_closed", SeqID: "seq-1", ErrorMsg: "worker crashed"})
+
+		// The replacement opens, but can't generate
+		req := transport.waitForRequest(t, time.Second)
+		transport.pushEvent(&MSEvent{Event: "seq_opened", CID: req.CID, SeqID: "seq-2"})
+
+		req = transport.waitForRequest(t, time.Second)
+		if _, ok := req.Data.(closeCommandData); ok {
+			closed <- req.SeqID
+		}
+		transport.pushEvent(&MSEvent{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID})
+	}()
+
+	stream, err := seq.Generate(ctx, WithGenerateRetry(RetryPolicy{MaxAttempts: 2}))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	var budgetErr *BudgetExceededError
+	if _, err := stream.Text(ctx); !errors.As(err, &budgetErr) {
+		t.Fatalf("Text error = %v, want the replacement's budget error", err)
+	}
+
+	select {
+	case id := <-closed:
+		if id != "seq-2" {
+			t.Errorf("closed %s, want the replacement seq-2", id)
+		}
+	case <-time.After(time.Second):
+		t.Error("replacement sequence not closed")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"seq error", &SeqError{SeqID: "s", Message: "crashed"}, true},
+		{"connection lost", ErrConnectionLost, true},
+		{"closed", ErrSeqClosed, false},
+		{"protocol", &ProtocolError{Message: "bad"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
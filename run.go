@@ -0,0 +1,46 @@
+package modelsocket
+
+import "context"
+
+// RunIDTag is the tag key sequences opened as part of a run are stamped
+// with, so [GenStats], [Usage] and audit records carry the run ID.
+const RunIDTag = "run_id"
+
+// runIDKey is the context key for a run ID.
+type runIDKey struct{}
+
+// ContextWithRunID returns a copy of ctx carrying the run ID id. Sequences
+// opened with it join the run, as with [WithRunID], so every model call made
+// for one user request, including those of sub-agents and chat sessions
+// opened with the context, can be correlated.
+func ContextWithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// RunIDFromContext returns the run ID carried by ctx, or "".
+func RunIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// NewRunID returns a new run ID from the client's ID generator, so
+// [SequentialIDs] makes run IDs deterministic as it does command IDs.
+func (c *Client) NewRunID() string {
+	return c.newID()
+}
+
+// WithRunID makes the sequence part of the run id, overriding the run ID
+// of the context it is opened with. The run ID is logged with the
+// sequence's opening and generation requests and added to its tags as
+// [RunIDTag]. Forks and replays of the sequence stay in the run, and tools
+// called by a [ChatSession] on it get it in their context.
+func WithRunID(id string) OpenOption {
+	return func(c *openConfig) {
+		c.runID = id
+	}
+}
+
+// RunID returns the ID of the run the sequence is part of, or "".
+func (s *Seq) RunID() string {
+	return s.cfg.runID
+}
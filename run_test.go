@@ -0,0 +1,109 @@
+package modelsocket
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+func TestRunID_Propagation(t *testing.T) {
+	ctx := ContextWithRunID(context.Background(), "run-1")
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectFork().Forked("seq-2")
+	sc.ExpectGenerate().StreamText("Hi").Finish()
+
+	h := &recordHandler{}
+	client := NewWithTransport(context.Background(), sc.transport, WithLogger(slog.New(h)))
+	defer client.Close(context.Background())
+
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+
+	// Forks stay in the run, whatever their context
+	fork, err := seq.Fork(context.Background())
+	if err != nil {
+		t.Fatalf("Fork error: %v", err)
+	}
+	if seq.RunID() != "run-1" || fork.RunID() != "run-1" {
+		t.Errorf("run IDs = %q, %q, want run-1", seq.RunID(), fork.RunID())
+	}
+
+	stream, err := fork.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(context.Background()); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if got := stream.Usage().Tags[RunIDTag]; got != "run-1" {
+		t.Errorf("usage run ID = %q, want run-1", got)
+	}
+
+	r, ok := h.find("generation finished")
+	if !ok {
+		t.Fatal("generation finish not logged")
+	}
+	if got := attrs(r)[logKeyRunID].String(); got != "run-1" {
+		t.Errorf("logged run ID = %q, want run-1", got)
+	}
+}
+
+func TestRunID_Option(t *testing.T) {
+	ctx := ContextWithRunID(context.Background(), "run-1")
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+
+	seq, err := sc.Client().Open(ctx, "test-model", WithRunID("run-2"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if seq.RunID() != "run-2" || seq.Tags()[RunIDTag] != "run-2" {
+		t.Errorf("RunID = %q, tags = %v, want the option's run-2", seq.RunID(), seq.Tags())
+	}
+}
+
+func TestChatSession_RunID(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var runIDs []string
+	client := NewWithTransport(ctx, transport, WithOnSend(func(req *MSRequest) {
+		if req.Request == "seq_open" {
+			mu.Lock()
+			runIDs = append(runIDs, req.runID)
+			mu.Unlock()
+		}
+	}))
+	defer client.Close(ctx)
+	serveCommands(t, transport, spawnServer())
+
+	// Sub-agents spawned by the session's tools join its run
+	toolbox := NewToolbox()
+	toolbox.Add(NewSpawnAgentTool(client, "test-model"))
+
+	chat, err := NewChatSession(ctx, client, "test-model",
+		WithChatOpenOptions(WithToolbox(toolbox), WithRunID("run-1")),
+	)
+	if err != nil {
+		t.Fatalf("NewChatSession error: %v", err)
+	}
+	stream, err := chat.Send(ctx, "delegate: sums")
+	if err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(runIDs) != 2 || runIDs[0] != "run-1" || runIDs[1] != "run-1" {
+		t.Errorf("opened with run IDs %q, want the session and its sub-agent in run-1", runIDs)
+	}
+}
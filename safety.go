@@ -0,0 +1,130 @@
+package modelsocket
+
+import (
+	"fmt"
+	"slices"
+)
+
+// SafetyAnnotation is a moderation result the server attached to a chunk
+// of text or to a whole generation, on servers that moderate output.
+type SafetyAnnotation struct {
+	Category string  `json:"category"`
+	Score    float64 `json:"score,omitempty"`
+	Flagged  bool    `json:"flagged,omitempty"`
+}
+
+// SafetyVerdict sums up the safety annotations of a generation so far.
+type SafetyVerdict struct {
+	// Flagged reports whether any annotation was flagged.
+	Flagged bool
+
+	// Categories are the flagged categories, in the order they were first
+	// flagged.
+	Categories []string
+
+	// Scores holds the highest score seen for each annotated category.
+	Scores map[string]float64
+}
+
+// add folds annotations into the verdict.
+func (v *SafetyVerdict) add(annotations []SafetyAnnotation) {
+	for _, a := range annotations {
+		if v.Scores == nil {
+			v.Scores = make(map[string]float64)
+		}
+		if score, ok := v.Scores[a.Category]; !ok || a.Score > score {
+			v.Scores[a.Category] = a.Score
+		}
+		if a.Flagged {
+			v.Flagged = true
+			if !slices.Contains(v.Categories, a.Category) {
+				v.Categories = append(v.Categories, a.Category)
+			}
+		}
+	}
+}
+
+// SafetyPolicy sets which chunk annotations stop a generation; see
+// [WithSafetyPolicy].
+type SafetyPolicy struct {
+	// Categories are the categories that stop the generation when an
+	// annotation for one is flagged. Empty means every category.
+	Categories []string
+
+	// Threshold, if positive, also stops the generation when an
+	// annotation for one of the categories scores at least this much,
+	// whether or not the server flagged it.
+	Threshold float64
+}
+
+// trips returns the first annotation that stops a generation under the
+// policy, or nil.
+func (p *SafetyPolicy) trips(annotations []SafetyAnnotation) *SafetyAnnotation {
+	for i, a := range annotations {
+		if len(p.Categories) > 0 && !slices.Contains(p.Categories, a.Category) {
+			continue
+		}
+		if a.Flagged || (p.Threshold > 0 && a.Score >= p.Threshold) {
+			return &annotations[i]
+		}
+	}
+	return nil
+}
+
+// SafetyError ends a generation stopped by a [SafetyPolicy]. The chunk
+// carrying the annotation isn't delivered.
+type SafetyError struct {
+	SeqID      string
+	CID        string
+	Annotation SafetyAnnotation
+}
+
+func (e *SafetyError) Error() string {
+	return fmt.Sprintf("modelsocket: generation %s stopped by safety policy: %s (score %.2f)", e.CID, e.Annotation.Category, e.Annotation.Score)
+}
+
+// WithSafetyPolicy stops the generation when the server annotates a chunk
+// with a category the policy covers. The server is asked to cancel the
+// generation, and the stream ends with a [*SafetyError]. Annotations on the
+// finished generation as a whole are reported by
+// [GenStream.SafetyVerdict] but can't stop it.
+func WithSafetyPolicy(policy SafetyPolicy) GenOption {
+	return func(c *genConfig) {
+		c.safety = &policy
+	}
+}
+
+// SafetyVerdict returns the safety annotations the server has sent for the
+// generation so far, with its chunks and when it finished. It is empty for
+// servers that don't moderate output.
+func (g *GenStream) SafetyVerdict() SafetyVerdict {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	v := g.verdict
+	v.Categories = slices.Clone(v.Categories)
+	if v.Scores != nil {
+		scores := make(map[string]float64, len(v.Scores))
+		for category, score := range v.Scores {
+			scores[category] = score
+		}
+		v.Scores = scores
+	}
+	return v
+}
+
+// noteSafety records a chunk's annotations and returns the error that stops
+// the generation under its policy, if any. Called with g.mu held.
+func (g *GenStream) noteSafety(event *MSEvent) error {
+	if len(event.Safety) == 0 {
+		return nil
+	}
+	g.verdict.add(event.Safety)
+	if g.safety == nil {
+		return nil
+	}
+	if a := g.safety.trips(event.Safety); a != nil {
+		return &SafetyError{SeqID: event.SeqID, CID: g.cid, Annotation: *a}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSafetyVerdict(t *testing.T) {
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectGenerate().
+		Respond(&MSEvent{Event: "seq_text", Text: "Hello", Safety: []SafetyAnnotation{{Category: "violence", Score: 0.2}}}).
+		Respond(&MSEvent{Event: "seq_text", Text: " there", Safety: []SafetyAnnotation{{Category: "violence", Score: 0.7, Flagged: true}}}).
+		Respond(&MSEvent{Event: "seq_gen_finish", Safety: []SafetyAnnotation{{Category: "hate", Score: 0.9, Flagged: true}}})
+	client := sc.Client()
+
+	ctx := context.Background()
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	var annotations [][]SafetyAnnotation
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		annotations = append(annotations, chunk.Safety)
+	}
+	if len(annotations) != 2 || len(annotations[1]) != 1 || !annotations[1][0].Flagged {
+		t.Errorf("chunk annotations = %+v, want them on each chunk", annotations)
+	}
+
+	got := stream.SafetyVerdict()
+	want := SafetyVerdict{
+		Flagged:    true,
+		Categories: []string{"violence", "hate"},
+		Scores:     map[string]float64{"violence": 0.7, "hate": 0.9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SafetyVerdict = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithSafetyPolicy(t *testing.T) {
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectGenerate().
+		Respond(&MSEvent{Event: "seq_text", Text: "Fine", Safety: []SafetyAnnotation{{Category: "hate", Score: 0.9, Flagged: true}}}).
+		Respond(&MSEvent{Event: "seq_text", Text: " text", Safety: []SafetyAnnotation{{Category: "violence", Score: 0.6}}}).
+		Respond(&MSEvent{Event: "seq_text", Text: " never delivered"})
+	cancel := sc.ExpectCancel()
+	client := sc.Client()
+
+	ctx := context.Background()
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	stream, err := seq.Generate(ctx, WithSafetyPolicy(SafetyPolicy{Categories: []string{"violence"}, Threshold: 0.5}))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	text, err := stream.Text(ctx)
+
+	var safetyErr *SafetyError
+	if !errors.As(err, &safetyErr) || safetyErr.Annotation.Category != "violence" {
+		t.Fatalf("Text error = %v, want a SafetyError for violence", err)
+	}
+	if text != "Fine" {
+		t.Errorf("text = %q, want the flagged chunk withheld", text)
+	}
+	if v := stream.SafetyVerdict(); v.Scores["violence"] != 0.6 {
+		t.Errorf("SafetyVerdict = %+v, want the stopping annotation recorded", v)
+	}
+	cancel.Request(t)
+}
+
+func TestSafetyPolicy_Trips(t *testing.T) {
+	annotations := []SafetyAnnotation{
+		{Category: "hate", Score: 0.4},
+		{Category: "violence", Score: 0.3, Flagged: true},
+	}
+	tests := []struct {
+		name   string
+		policy SafetyPolicy
+		want   string
+	}{
+		{"any flagged", SafetyPolicy{}, "violence"},
+		{"other category", SafetyPolicy{Categories: []string{"sexual"}}, ""},
+		{"threshold", SafetyPolicy{Categories: []string{"hate"}, Threshold: 0.4}, "hate"},
+		{"below threshold", SafetyPolicy{Categories: []string{"hate"}, Threshold: 0.5}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if a := tt.policy.trips(annotations); a != nil {
+				got = a.Category
+			}
+			if got != tt.want {
+				t.Errorf("trips = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scenario scripts the server side of a protocol-level test. Expectations
+// are met in order: each request the client sends must match the next one,
+// which then answers with its events. CID and SeqID are filled in from the
+// request where an event leaves them empty.
+//
+//	sc := newScenario(t)
+//	sc.ExpectOpen().Opened("seq-1")
+//	sc.ExpectGenerate().StreamText("Hello").ThenToolCall("get_weather", `{}`)
+//	client := sc.Client()
+type scenario struct {
+	t         *testing.T
+	transport *mockTransport
+
+	mu       sync.Mutex
+	expected []*expectation
+	next     int
+}
+
+// expectation is a request a scenario expects and the events it answers
+// with.
+type expectation struct {
+	kind     string // "open" or the command name, e.g. "gen"
+	events   []*MSEvent
+	received chan *MSRequest
+	cidOf    *expectation // Answer with the CID of its request instead
+}
+
+// newScenario starts serving a scenario on a mock transport. Expectations
+// that were never met fail the test when it ends.
+func newScenario(t *testing.T) *scenario {
+	sc := &scenario{t: t, transport: newMockTransport()}
+	go sc.serve()
+
+	t.Cleanup(func() {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+		for _, e := range sc.expected[sc.next:] {
+			t.Errorf("scenario: expected %s request was never sent", e.kind)
+		}
+	})
+	return sc
+}
+
+// Client returns a client connected to the scenario, closed when the test
+// ends.
+func (sc *scenario) Client() *Client {
+	client := NewWithTransport(context.Background(), sc.transport)
+	sc.t.Cleanup(func() { client.Close(context.Background()) })
+	return client
+}
+
+// ExpectOpen expects a seq_open request.
+func (sc *scenario) ExpectOpen() *expectation { return sc.expect("open") }
+
+// ExpectAppend expects an append command.
+func (sc *scenario) ExpectAppend() *expectation { return sc.expect("append") }
+
+// ExpectGenerate expects a gen command.
+func (sc *scenario) ExpectGenerate() *expectation { return sc.expect("gen") }
+
+// ExpectToolReturn expects a tool_return command.
+func (sc *scenario) ExpectToolReturn() *expectation { return sc.expect("tool_return") }
+
+// ExpectFork expects a fork command.
+func (sc *scenario) ExpectFork() *expectation { return sc.expect("fork") }
+
+// ExpectClose expects a close command.
+func (sc *scenario) ExpectClose() *expectation { return sc.expect("close") }
+
+// ExpectCancel expects a cancel command.
+func (sc *scenario) ExpectCancel() *expectation { return sc.expect("cancel") }
+
+func (sc *scenario) expect(kind string) *expectation {
+	e := &expectation{kind: kind, received: make(chan *MSRequest, 1)}
+	sc.mu.Lock()
+	sc.expected = append(sc.expected, e)
+	sc.mu.Unlock()
+	return e
+}
+
+// Respond answers with events.
+func (e *expectation) Respond(events ...*MSEvent) *expectation {
+	e.events = append(e.events, events...)
+	return e
+}
+
+// Opened answers a seq_open request by opening seqID.
+func (e *expectation) Opened(seqID string) *expectation {
+	return e.Respond(&MSEvent{Event: "seq_opened", SeqID: seqID})
+}
+
+// StreamText answers with a seq_text event for each text.
+func (e *expectation) StreamText(texts ...string) *expectation {
+	for _, text := range texts {
+		e.Respond(&MSEvent{Event: "seq_text", Text: text})
+	}
+	return e
+}
+
+// ThenToolCall answers with a tool call, after which the server waits for a
+// tool_return.
+func (e *expectation) ThenToolCall(name, args string) *expectation {
+	return e.Respond(&MSEvent{Event: "seq_tool_call", ToolCalls: []SeqToolCall{{Name: name, Args: args}}})
+}
+
+// Finish answers with the event that completes the expected command.
+func (e *expectation) Finish() *expectation {
+	switch e.kind {
+	case "append":
+		return e.Respond(&MSEvent{Event: "seq_append_finish"})
+	case "gen", "tool_return":
+		return e.Respond(&MSEvent{Event: "seq_gen_finish"})
+	case "close":
+		return e.Respond(&MSEvent{Event: "seq_closed"})
+	}
+	panic("scenario: no finish event for " + e.kind)
+}
+
+// Forked answers a fork command with the child sequence.
+func (e *expectation) Forked(childSeqID string) *expectation {
+	return e.Respond(&MSEvent{Event: "seq_fork_finish", ChildSeqID: childSeqID})
+}
+
+// Fail answers with an error event.
+func (e *expectation) Fail(message string) *expectation {
+	return e.Respond(&MSEvent{Event: "error", Message: message})
+}
+
+// UnderCIDOf answers with the CID of the request that met an earlier
+// expectation, as servers that continue a generation after a tool return
+// under the original generation's CID do.
+func (e *expectation) UnderCIDOf(earlier *expectation) *expectation {
+	e.cidOf = earlier
+	return e
+}
+
+// peek returns the request that met the expectation, which must have been
+// met.
+func (e *expectation) peek() *MSRequest {
+	req := <-e.received
+	e.received <- req
+	return req
+}
+
+// Request waits for the request that met the expectation.
+func (e *expectation) Request(t *testing.T) *MSRequest {
+	t.Helper()
+	select {
+	case req := <-e.received:
+		e.received <- req
+		return req
+	case <-time.After(time.Second):
+		t.Fatalf("scenario: expected %s request was never sent", e.kind)
+		return nil
+	}
+}
+
+// serve matches requests against the expectations until the transport is
+// closed.
+func (sc *scenario) serve() {
+	for req := range sc.transport.onSend {
+		kind := requestKind(req)
+
+		sc.mu.Lock()
+		if sc.next == len(sc.expected) {
+			sc.mu.Unlock()
+			sc.t.Errorf("scenario: unexpected %s request", kind)
+			continue
+		}
+		e := sc.expected[sc.next]
+		sc.next++
+		sc.mu.Unlock()
+
+		if e.kind != kind {
+			sc.t.Errorf("scenario: got %s request, want %s", kind, e.kind)
+			continue
+		}
+		e.received <- req
+
+		cid := req.CID
+		if e.cidOf != nil {
+			cid = e.cidOf.peek().CID
+		}
+		for _, event := range e.events {
+			reply := *event
+			if reply.CID == "" {
+				reply.CID = cid
+			}
+			if reply.SeqID == "" {
+				reply.SeqID = req.SeqID
+			}
+
+			sc.transport.mu.Lock()
+			closed := sc.transport.closed
+			sc.transport.mu.Unlock()
+			if closed {
+				return
+			}
+			sc.transport.pushEvent(&reply)
+		}
+	}
+}
+
+// requestKind returns "open" for seq_open requests and the command name for
+// seq_command requests.
+func requestKind(req *MSRequest) string {
+	switch data := req.Data.(type) {
+	case SeqOpenData:
+		return "open"
+	case appendCommandData:
+		return data.Command
+	case genCommandData:
+		return data.Command
+	case toolReturnCommandData:
+		return data.Command
+	case forkCommandData:
+		return data.Command
+	case closeCommandData:
+		return data.Command
+	case cancelCommandData:
+		return data.Command
+	case scoreCommandData:
+		return data.Command
+	}
+	return strings.TrimPrefix(req.Request, "seq_")
+}
+
+func TestScenario_ToolCall(t *testing.T) {
+	ctx := context.Background()
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectAppend().Finish()
+	sc.ExpectGenerate().StreamText("Let me check. ").ThenToolCall("get_weather", `{"city":"Paris"}`)
+	toolReturn := sc.ExpectToolReturn().StreamText("Sunny.").Finish()
+
+	client := sc.Client()
+	seq, err := client.Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Append(ctx, "Weather in Paris?", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+
+	stream, err := seq.Generate(ctx)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	var calls []ToolCall
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		if len(chunk.ToolCalls) > 0 {
+			calls = chunk.ToolCalls
+			break
+		}
+	}
+	if len(calls) != 1 || calls[0].Name != "get_weather" {
+		t.Fatalf("calls = %+v, want get_weather", calls)
+	}
+
+	resumed, err := seq.ToolReturn(ctx, []ToolResult{{Name: "get_weather", Result: "sunny"}})
+	if err != nil {
+		t.Fatalf("ToolReturn error: %v", err)
+	}
+	if text, err := resumed.Text(ctx); err != nil || text != "Sunny." {
+		t.Errorf("Text = %q, %v, want Sunny.", text, err)
+	}
+
+	data := toolReturn.Request(t).Data.(toolReturnCommandData)
+	if len(data.Results) != 1 || data.Results[0].Result != "sunny" {
+		t.Errorf("Results = %+v, want the tool's result", data.Results)
+	}
+}
+
+func TestScenario_Fail(t *testing.T) {
+	ctx := context.Background()
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectAppend().Fail("context full")
+
+	seq, err := sc.Client().Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+
+	var protoErr *ProtocolError
+	err = seq.Append(ctx, "Hello", AsUser())
+	if !errors.As(err, &protoErr) || protoErr.Message != "context full" {
+		t.Errorf("Append error = %v, want the scripted ProtocolError", err)
+	}
+}
@@ -0,0 +1,82 @@
+package modelsocket
+
+import (
+	"context"
+	"fmt"
+)
+
+// Step is one turn of a script run by [Seq.Run]: an append or a generation.
+// Build steps with [AppendStep] and [GenerateStep].
+type Step struct {
+	Role     Role
+	Text     string      // Text to append
+	Generate bool        // Generate instead of appending
+	Opts     []GenOption // Options for a generation
+}
+
+// AppendStep returns a step that appends text as role.
+func AppendStep(role Role, text string) Step {
+	return Step{Role: role, Text: text}
+}
+
+// GenerateStep returns a step that generates as role.
+func GenerateStep(role Role, opts ...GenOption) Step {
+	return Step{Role: role, Generate: true, Opts: opts}
+}
+
+// StepError reports the script step that failed.
+type StepError struct {
+	Step int // Index of the step in the script
+	Err  error
+
+	// Partial is the text a failed generation step produced before it
+	// failed.
+	Partial string
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("modelsocket: step %d: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Run executes script in order and returns the text of each generated step.
+// It stops at the first step that fails, returning the text generated
+// before it and a [*StepError].
+//
+//	texts, err := seq.Run(ctx, []modelsocket.Step{
+//	    modelsocket.AppendStep(modelsocket.RoleSystem, "Answer in one word."),
+//	    modelsocket.AppendStep(modelsocket.RoleUser, "What color is the sky?"),
+//	    modelsocket.GenerateStep(modelsocket.RoleAssistant, modelsocket.WithSeed(1)),
+//	    modelsocket.AppendStep(modelsocket.RoleUser, "And grass?"),
+//	    modelsocket.GenerateStep(modelsocket.RoleAssistant, modelsocket.WithSeed(1)),
+//	})
+func (s *Seq) Run(ctx context.Context, script []Step) ([]string, error) {
+	var texts []string
+	for i, step := range script {
+		if !step.Generate {
+			if err := s.Append(ctx, step.Text, AsRole(step.Role)); err != nil {
+				return texts, &StepError{Step: i, Err: err}
+			}
+			continue
+		}
+
+		opts := append([]GenOption{GenerateAsRole(step.Role)}, step.Opts...)
+		stream, err := s.Generate(ctx, opts...)
+		if err != nil {
+			return texts, &StepError{Step: i, Err: err}
+		}
+		text, err := stream.Text(ctx)
+		if err != nil {
+			return texts, &StepError{Step: i, Err: err, Partial: text}
+		}
+		texts = append(texts, text)
+
+		// Later steps continue on the sequence the generation finished on,
+		// which differs after a retry or hedge
+		s = stream.Seq()
+	}
+	return texts, nil
+}
@@ -0,0 +1,103 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// scriptServer completes appends and answers each generation with its
+// role, failing generations as the system partway through.
+func scriptServer(req *MSRequest) []*MSEvent {
+	switch data := req.Data.(type) {
+	case appendCommandData:
+		return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+	case genCommandData:
+		if data.Role == string(RoleSystem) {
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "partial"},
+				{Event: "error", SeqID: req.SeqID, CID: req.CID, Message: "no"},
+			}
+		}
+		return []*MSEvent{
+			{Event: "seq_text", SeqID: req.SeqID, Text: "as " + data.Role},
+			{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID},
+		}
+	}
+	return nil
+}
+
+func TestSeq_Run(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, scriptServer)
+
+	texts, err := seq.Run(ctx, []Step{
+		AppendStep(RoleUser, "question"),
+		GenerateStep(RoleAssistant, WithSeed(1)),
+		AppendStep(RoleUser, "follow-up"),
+		GenerateStep(RoleUser),
+	})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if len(texts) != 2 || texts[0] != "as assistant" || texts[1] != "as user" {
+		t.Errorf("texts = %q", texts)
+	}
+
+	var commands []string
+	for _, req := range transport.getRequests()[1:] {
+		switch data := req.Data.(type) {
+		case appendCommandData:
+			commands = append(commands, "append "+data.Role+" "+data.Text)
+		case genCommandData:
+			commands = append(commands, "gen "+data.Role)
+		}
+	}
+	want := []string{"append user question", "gen assistant", "append user follow-up", "gen user"}
+	if len(commands) != len(want) {
+		t.Fatalf("commands = %q, want %q", commands, want)
+	}
+	for i := range want {
+		if commands[i] != want[i] {
+			t.Errorf("command %d = %q, want %q", i, commands[i], want[i])
+		}
+	}
+}
+
+func TestSeq_Run_StepError(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, scriptServer)
+
+	texts, err := seq.Run(ctx, []Step{
+		GenerateStep(RoleAssistant),
+		GenerateStep(RoleSystem),
+		AppendStep(RoleUser, "never sent"),
+	})
+
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != 1 {
+		t.Fatalf("Run error = %v, want StepError for step 1", err)
+	}
+	if stepErr.Partial != "partial" {
+		t.Errorf("Partial = %q, want the text before the error", stepErr.Partial)
+	}
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) {
+		t.Errorf("Run error = %v, want it to wrap the ProtocolError", err)
+	}
+	if len(texts) != 1 || texts[0] != "as assistant" {
+		t.Errorf("texts = %q, want the first generation", texts)
+	}
+}
@@ -2,18 +2,23 @@ package modelsocket
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"maps"
 	"sync"
-
-	"github.com/google/uuid"
+	"time"
 )
 
 // Seq represents an active conversation sequence.
 // It is safe for concurrent use by multiple goroutines.
-// However, only one Generate call can be active at a time.
+// However, only one Generate call can be active at a time. A stream that is
+// abandoned keeps receiving its generation's output until the server
+// finishes it, so the next stream only sees its own.
 type Seq struct {
-	client  *Client
-	id      string
-	toolbox *Toolbox
+	client *Client
+	id     string
+	model  string
+	cfg    openConfig
 
 	mu       sync.RWMutex
 	state    SeqState
@@ -22,21 +27,97 @@ type Seq struct {
 
 	// Command tracking
 	cmdMu    sync.RWMutex
-	commands map[string]chan *MSEvent
+	commands map[string]*command
+
+	// Active generation streams, guarded by mu
+	gens genStreams
+
+	// Usage counters, guarded by mu
+	opened time.Time
+	stats  SeqStats
+
+	// Conversation history, guarded by mu
+	history []Message
+
+	// Version of the session the sequence was restored from, guarded by mu
+	version int64
+
+	// Last prompt appended with AppendPrompt, guarded by mu
+	prompt *Prompt
+
+	// Size of the context and the number of context thresholds crossed,
+	// guarded by mu
+	contextTokens int
+	contextWarned int
+
+	// Whether generations are captured for WithTrainingCapture, and the
+	// records held until the sequence closes, guarded by mu
+	capture  bool
+	captured []*TrainingRecord
+
+	// Wakes Wait when a generation or command ends, guarded by mu.
+	// finishing counts generations ended but not yet recorded.
+	activity  chan struct{}
+	finishing int
+}
 
-	// Active generation stream
-	genStream *GenStream
+// SeqStats summarizes a sequence's usage.
+type SeqStats struct {
+	// InputTokens is the size of the context. While the sequence is open it
+	// reflects the most recent generation; once closed it is the server's
+	// total.
+	InputTokens int
+
+	// OutputTokens is the number of generated tokens.
+	OutputTokens int
+
+	// DurationMs is how long the sequence has been open, as reported by the
+	// server once closed.
+	DurationMs int64
+
+	// Turns counts completed appends and generations.
+	Turns int
+
+	// ToolCalls counts tool calls made by the model.
+	ToolCalls int
 }
 
 // newSeq creates a new sequence.
-func newSeq(client *Client, id string, toolbox *Toolbox) *Seq {
+func newSeq(client *Client, id, model string, cfg openConfig) *Seq {
 	return &Seq{
 		client:   client,
 		id:       id,
-		toolbox:  toolbox,
+		model:    model,
+		cfg:      cfg,
 		state:    StateReady,
-		commands: make(map[string]chan *MSEvent),
+		commands: make(map[string]*command),
+		opened:   time.Now(),
+		activity: make(chan struct{}),
+		capture:  client.cfg.training != nil && client.cfg.training.sample(),
+	}
+}
+
+// genConfig applies the sequence's default generation options, those of the
+// last registered prompt appended, then opts.
+func (s *Seq) genConfig(opts []GenOption) genConfig {
+	cfg := genConfig{}
+	for _, opt := range s.cfg.genDefaults {
+		opt(&cfg)
+	}
+
+	s.mu.RLock()
+	prompt := s.prompt
+	s.mu.RUnlock()
+	if prompt != nil {
+		for _, opt := range prompt.GenOptions {
+			opt(&cfg)
+		}
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
 	}
+	return cfg
 }
 
 // ID returns the sequence ID.
@@ -44,6 +125,45 @@ func (s *Seq) ID() string {
 	return s.id
 }
 
+// Model returns the model the sequence was opened with.
+func (s *Seq) Model() string {
+	return s.model
+}
+
+// Label returns the label set with [WithSeqLabel].
+func (s *Seq) Label() string {
+	return s.cfg.label
+}
+
+// Tags returns a copy of the tags set with [WithSeqTag], along with
+// [PromptTag] after [Seq.AppendPrompt] and [RunIDTag] in a run.
+func (s *Seq) Tags() map[string]string {
+	tags := maps.Clone(s.cfg.tags)
+	if ref := s.Prompt(); ref != "" {
+		if tags == nil {
+			tags = make(map[string]string, 1)
+		}
+		tags[PromptTag] = ref
+	}
+	if s.cfg.runID != "" {
+		if tags == nil {
+			tags = make(map[string]string, 1)
+		}
+		tags[RunIDTag] = s.cfg.runID
+	}
+	return tags
+}
+
+// Tools returns the tools registered with [WithToolbox] or [WithToolSet], as
+// they were when the sequence opened. Dispatch tool calls with it to use the
+// same tools the model was told about.
+func (s *Seq) Tools() ToolSet {
+	if s.cfg.tools == nil {
+		return ToolSet{}
+	}
+	return *s.cfg.tools
+}
+
 // State returns the current sequence state.
 func (s *Seq) State() SeqState {
 	s.mu.RLock()
@@ -51,53 +171,167 @@ func (s *Seq) State() SeqState {
 	return s.state
 }
 
+// Stats returns the sequence's usage so far. After the sequence is closed by
+// the server, token counts and duration are the totals it reported.
+func (s *Seq) Stats() SeqStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := s.stats
+	if !s.closed {
+		stats.DurationMs = time.Since(s.opened).Milliseconds()
+	}
+	return stats
+}
+
 // Append adds text to the sequence.
 func (s *Seq) Append(ctx context.Context, text string, opts ...AppendOption) error {
+	_, err := s.AppendWithResult(ctx, text, opts...)
+	return err
+}
+
+// AppendResult describes a completed append.
+type AppendResult struct {
+	// InputTokens is the number of tokens the text added to the sequence's
+	// context, as reported by the server. It is zero if the server doesn't
+	// report it.
+	InputTokens int
+}
+
+// AppendWithResult appends text like [Seq.Append] and returns the number of
+// tokens it added, so context consumption can be tracked per message.
+func (s *Seq) AppendWithResult(ctx context.Context, text string, opts ...AppendOption) (AppendResult, error) {
+	cfg := appendConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return s.appendMessage(ctx, text, cfg)
+}
+
+// appendMessage filters, appends and records text.
+func (s *Seq) appendMessage(ctx context.Context, text string, cfg appendConfig) (AppendResult, error) {
 	s.mu.RLock()
 	if s.closed {
 		s.mu.RUnlock()
-		return ErrSeqClosed
+		return AppendResult{}, ErrSeqClosed
 	}
 	s.mu.RUnlock()
 
-	cfg := appendConfig{}
+	if filter := s.client.cfg.inputFilter; filter != nil {
+		filtered, err := filter(text, cfg.role)
+		if err != nil {
+			return AppendResult{}, err
+		}
+		text = filtered
+	}
+
+	inputTokens, err := s.append(ctx, text, cfg)
+	if err != nil {
+		return AppendResult{}, err
+	}
+	msg := Message{Role: cfg.role, Text: text, Hidden: cfg.hidden, Prompt: cfg.prompt}
+	s.record(msg)
+	s.auditMessage(AuditAppend, "", msg, inputTokens, 0)
+	return AppendResult{InputTokens: inputTokens}, nil
+}
+
+// AppendStream appends text like [Seq.Append], with [WithEcho] implied, and
+// returns a stream of the text as the server echoes it back. The stream ends
+// once the append completes, so appended content can be rendered with the
+// same code as generated content. It fails with ErrInvalidState while a
+// generation is in progress.
+func (s *Seq) AppendStream(ctx context.Context, text string, opts ...AppendOption) (*GenStream, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrSeqClosed
+	}
+	s.mu.RUnlock()
+
+	cfg := appendConfig{echo: true}
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 
-	cid := uuid.New().String()
-	ch := s.registerCommand(cid)
+	if filter := s.client.cfg.inputFilter; filter != nil {
+		filtered, err := filter(text, cfg.role)
+		if err != nil {
+			return nil, err
+		}
+		text = filtered
+	}
+
+	cid := s.client.newID()
+	stream := newGenStream(s, cid)
+	stream.ctx = context.WithoutCancel(ctx)
+	stream.echo = &Message{Role: cfg.role, Text: text, Hidden: cfg.hidden}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSeqClosed
+	}
+	if s.gens.busy() {
+		s.mu.Unlock()
+		return nil, ErrInvalidState
+	}
+	s.gens.add(stream)
+	s.mu.Unlock()
+
+	req := NewAppendRequest(cid, s.id, SeqAppendData{
+		Text:   text,
+		Role:   string(cfg.role),
+		Echo:   true,
+		Hidden: cfg.hidden,
+	})
+	req.priority = s.requestPriority(cfg.priority, PriorityNormal)
+
+	stream.markSent()
+	if err := s.client.send(ctx, req); err != nil {
+		s.mu.Lock()
+		s.gens.remove(cid)
+		s.wakeLocked()
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// append sends an append command and waits for it to complete.
+func (s *Seq) append(ctx context.Context, text string, cfg appendConfig) (int, error) {
+	cid := s.client.newID()
+	cmd, err := s.registerCommand(cid)
+	if err != nil {
+		return 0, err
+	}
 	defer s.unregisterCommand(cid)
 
 	data := SeqAppendData{
-		Text: text,
-		Role: string(cfg.role),
-		Echo: cfg.echo,
+		Text:   text,
+		Role:   string(cfg.role),
+		Echo:   cfg.echo,
+		Hidden: cfg.hidden,
 	}
 
 	req := NewAppendRequest(cid, s.id, data)
+	req.priority = s.requestPriority(cfg.priority, PriorityNormal)
 
 	if err := s.client.send(ctx, req); err != nil {
-		return err
+		return 0, err
 	}
 
-	// Wait for completion
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case event := <-ch:
-		if event.IsError() {
-			return &ProtocolError{
-				Message: event.Message,
-				SeqID:   event.SeqID,
-				CID:     event.CID,
-			}
-		}
-		return nil
+	event, err := cmd.wait(ctx)
+	if err != nil {
+		return 0, err
 	}
+	return event.InputTokens, nil
 }
 
-// Generate starts text generation and returns a stream.
+// Generate starts text generation and returns a stream. ctx covers the whole
+// generation: once it is done, the generation is cancelled on the server and
+// the stream ends with the context's error. Generations shared with
+// [WithCoalesce] aren't cancelled.
 func (s *Seq) Generate(ctx context.Context, opts ...GenOption) (*GenStream, error) {
 	s.mu.Lock()
 	if s.closed {
@@ -106,30 +340,74 @@ func (s *Seq) Generate(ctx context.Context, opts ...GenOption) (*GenStream, erro
 	}
 	s.mu.Unlock()
 
-	cfg := genConfig{}
-	for _, opt := range opts {
-		opt(&cfg)
+	cfg := s.genConfig(opts)
+	if cfg.budgetLimit != nil {
+		cfg.budget = newBudget(BudgetScopeCall, *cfg.budgetLimit)
+	}
+	if cfg.deadlineBudget {
+		s.capForDeadline(ctx, &cfg)
+	}
+	start := time.Now()
+
+	var stream *GenStream
+	var err error
+	switch {
+	case cfg.hedge != nil:
+		stream, err = s.generateHedged(ctx, cfg)
+	case cfg.retry != nil && cfg.retry.MaxAttempts > 1:
+		stream, err = s.generateWithRetry(ctx, cfg)
+	case cfg.coalesce && s.coalescable(cfg):
+		stream, err = s.generateCoalesced(ctx, cfg)
+	default:
+		stream, err = s.generate(ctx, cfg)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	cid := uuid.New().String()
+	// Only the consumer's stream pools chunks; streams it forwards from
+	// pass on chunks as they are
+	stream.zeroCopy = cfg.zeroCopy
+	if cfg.onProgress != nil {
+		go stream.watchProgress(start, cfg.progressInterval, cfg.onProgress)
+	}
+	return stream, nil
+}
+
+// generate sends a generate request and returns its stream.
+func (s *Seq) generate(ctx context.Context, cfg genConfig) (*GenStream, error) {
+	cid := s.client.newID()
 
 	// Create the stream
-	stream := newGenStream(s, cid)
+	stream := s.newStream(ctx, cid, cfg)
+	if err := stream.checkBudget(); err != nil {
+		return nil, err
+	}
 
+	// Checked again with the stream added, so Close can't miss it
 	s.mu.Lock()
-	s.genStream = stream
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSeqClosed
+	}
+	s.gens.add(stream)
 	s.mu.Unlock()
 
 	// Build request
 	data := cfg.toSeqGenData()
 	req := NewGenRequest(cid, s.id, data)
+	req.priority = s.requestPriority(cfg.priority, PriorityInteractive)
+	req.runID = s.cfg.runID
 
+	stream.markSent()
 	if err := s.client.send(ctx, req); err != nil {
 		s.mu.Lock()
-		s.genStream = nil
+		s.gens.remove(cid)
+		s.wakeLocked()
 		s.mu.Unlock()
 		return nil, err
 	}
+	stream.cancelWith(ctx)
 
 	return stream, nil
 }
@@ -143,40 +421,79 @@ func (s *Seq) Fork(ctx context.Context) (*Seq, error) {
 	}
 	s.mu.RUnlock()
 
-	cid := uuid.New().String()
-	ch := s.registerCommand(cid)
+	cid := s.client.newID()
+	cmd, err := s.registerCommand(cid)
+	if err != nil {
+		return nil, err
+	}
 	defer s.unregisterCommand(cid)
 
 	req := NewForkRequest(cid, s.id)
+	req.priority = s.requestPriority(nil, PriorityNormal)
 
 	if err := s.client.send(ctx, req); err != nil {
 		return nil, err
 	}
 
-	// Wait for completion
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case event := <-ch:
-		if event.IsError() {
-			return nil, &ProtocolError{
-				Message: event.Message,
-				SeqID:   event.SeqID,
-				CID:     event.CID,
-			}
-		}
-		if !event.IsSeqForkFinish() {
-			return nil, ErrUnexpectedEvent
-		}
+	event, err := cmd.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !event.IsSeqForkFinish() {
+		return nil, ErrUnexpectedEvent
+	}
+
+	// Create and register the new sequence
+	// The label stays with the parent
+	cfg := s.cfg
+	cfg.label = ""
+	forked := newSeq(s.client, event.ChildSeqID, s.model, cfg)
+	forked.history = s.History()
+	s.mu.RLock()
+	forked.prompt = s.prompt
+	forked.version = s.version
+	s.mu.RUnlock()
+	if err := s.client.registerSeq(forked); err != nil {
+		return nil, err
+	}
 
-		// Create and register the new sequence
-		forked := newSeq(s.client, event.ChildSeqID, s.toolbox)
-		s.client.mu.Lock()
-		s.client.seqs[forked.id] = forked
-		s.client.mu.Unlock()
+	return forked, nil
+}
 
-		return forked, nil
+// Score returns the log probability of text as a continuation of the
+// sequence, in total and per token, without appending it. It can be used to
+// rerank candidates, e.g. the outputs of several forks. Scoring needs server
+// support; servers without it return a [ProtocolError].
+func (s *Seq) Score(ctx context.Context, text string) (float64, []float64, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return 0, nil, ErrSeqClosed
+	}
+	s.mu.RUnlock()
+
+	cid := s.client.newID()
+	cmd, err := s.registerCommand(cid)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer s.unregisterCommand(cid)
+
+	req := NewScoreRequest(cid, s.id, text)
+	req.priority = s.requestPriority(nil, PriorityNormal)
+
+	if err := s.client.send(ctx, req); err != nil {
+		return 0, nil, err
 	}
+
+	event, err := cmd.wait(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !event.IsSeqScoreFinish() {
+		return 0, nil, ErrUnexpectedEvent
+	}
+	return event.LogProb, event.TokenLogProbs, nil
 }
 
 // Close closes the sequence.
@@ -188,34 +505,113 @@ func (s *Seq) Close(ctx context.Context) error {
 	}
 	s.mu.Unlock()
 
-	cid := uuid.New().String()
-	ch := s.registerCommand(cid)
+	cid := s.client.newID()
+	cmd, err := s.registerCommand(cid)
+	if err != nil {
+		// Closed in the meantime
+		return nil
+	}
 	defer s.unregisterCommand(cid)
 
 	req := NewCloseRequest(cid, s.id)
+	req.priority = s.requestPriority(nil, PriorityNormal)
 
 	if err := s.client.send(ctx, req); err != nil {
 		return err
 	}
 
-	// Wait for completion
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case event := <-ch:
-		if event.IsError() {
-			return &ProtocolError{
-				Message: event.Message,
-				SeqID:   event.SeqID,
-				CID:     event.CID,
-			}
+	// ErrSeqClosed means it was closed some other way in the meantime
+	if _, err := cmd.wait(ctx); err != nil && err != ErrSeqClosed {
+		return err
+	}
+	return nil
+}
+
+// ToolReturn sends tool call results back to the model. The server resumes
+// generation once the results are appended; the returned stream delivers
+// that continuation and opts configure it. Any stream still attached to the
+// sequence is ended without error. As with [Seq.Generate], the continuation
+// is cancelled once ctx is done.
+func (s *Seq) ToolReturn(ctx context.Context, results []ToolResult, opts ...GenOption) (*GenStream, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrSeqClosed
+	}
+	s.mu.RUnlock()
+
+	cfg := s.genConfig(opts)
+	start := time.Now()
+
+	cid := s.client.newID()
+	stream := s.newStream(ctx, cid, cfg)
+	if err := stream.checkBudget(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSeqClosed
+	}
+	prev, awaiting := s.gens.resumable()
+	s.gens.add(stream)
+	var handed *genEntry
+	if awaiting {
+		stream.resumes = prev.cid
+		if prev.resumes != "" {
+			stream.resumes = prev.resumes
 		}
-		return nil
+		handed = s.gens.handOver(prev.cid, cid)
 	}
+	s.mu.Unlock()
+
+	req := NewToolReturnRequest(cid, s.id, results, cfg.toSeqGenData())
+	req.priority = s.requestPriority(cfg.priority, PriorityInteractive)
+	req.runID = s.cfg.runID
+
+	stream.markSent()
+	if err := s.client.send(ctx, req); err != nil {
+		s.mu.Lock()
+		s.gens.remove(cid)
+		if handed != nil {
+			s.gens.restore(handed)
+		}
+		s.wakeLocked()
+		s.mu.Unlock()
+		return nil, err
+	}
+	stream.cancelWith(ctx)
+
+	// A stream that didn't have tool calls may have been finished or failed
+	// by the server in the meantime
+	if prev != nil && !awaiting {
+		s.mu.Lock()
+		prev = s.gens.remove(prev.cid)
+		s.mu.Unlock()
+	}
+	if prev != nil {
+		prev.handleResume()
+		msg := prev.generated()
+		s.captureGeneration(prev.cid, msg)
+		s.record(msg)
+		s.auditMessage(AuditGeneration, prev.cid, msg, 0, 0)
+	}
+	s.record(toolResultsMessage(results))
+	s.auditToolResults(cid, results)
+
+	stream.zeroCopy = cfg.zeroCopy
+	if cfg.onProgress != nil {
+		go stream.watchProgress(start, cfg.progressInterval, cfg.onProgress)
+	}
+	return stream, nil
 }
 
-// ToolReturn sends tool call results back to the model.
-func (s *Seq) ToolReturn(ctx context.Context, results []ToolResult) error {
+// AppendToolResult appends the result of a tool call as a tool message,
+// without starting a generation, for results gathered out of band. The
+// message is written and recorded as [Seq.ToolReturn] writes results, so a
+// later [Seq.Generate] sees it the same way.
+func (s *Seq) AppendToolResult(ctx context.Context, name, result string) error {
 	s.mu.RLock()
 	if s.closed {
 		s.mu.RUnlock()
@@ -223,11 +619,58 @@ func (s *Seq) ToolReturn(ctx context.Context, results []ToolResult) error {
 	}
 	s.mu.RUnlock()
 
-	cid := uuid.New().String()
+	results := []ToolResult{{Name: name, Result: result}}
+	msg := toolResultsMessage(results)
+	if _, err := s.append(ctx, msg.Text, appendConfig{role: RoleTool}); err != nil {
+		return err
+	}
+	s.record(msg)
+	s.auditToolResults("", results)
+	return nil
+}
 
-	req := NewToolReturnRequest(cid, s.id, results, SeqGenData{})
+// newStream creates a generation stream for this sequence, carrying the
+// values of the context that started it.
+func (s *Seq) newStream(ctx context.Context, cid string, cfg genConfig) *GenStream {
+	role := cfg.role
+	if role == "" {
+		role = RoleAssistant
+	}
 
-	return s.client.send(ctx, req)
+	stream := newGenStream(s, cid)
+	stream.ctx = context.WithoutCancel(ctx)
+	stream.message = Message{Role: role, Hidden: cfg.hidden}
+	stream.filter = s.client.cfg.outputFilter
+	stream.budgets = s.budgets(cfg)
+	stream.safety = cfg.safety
+	if s.cfg.toolCallParser != nil {
+		stream.parser = s.cfg.toolCallParser()
+	}
+	return stream
+}
+
+// cancelGeneration asks the server to stop the generation started with cid.
+// The generation's stream stays in the table until the server finishes it.
+// It doesn't block, so it is safe to call from the read loop.
+func (s *Seq) cancelGeneration(cid string) {
+	go func() {
+		s.mu.Lock()
+		s.gens.cancelSent(cid)
+		s.mu.Unlock()
+
+		req := NewCancelRequest(cid, s.id)
+		req.priority = PriorityInteractive
+		if err := s.client.send(s.client.ctx, req); err != nil {
+			s.mu.Lock()
+			s.gens.cancelRejected(cid)
+			s.mu.Unlock()
+			s.client.log(slog.LevelWarn, "", "cancel failed",
+				slog.String(logKeySeqID, s.id),
+				slog.String(logKeyCID, cid),
+				slog.Any(logKeyError, err),
+			)
+		}
+	}()
 }
 
 // handleEvent processes an incoming event for this sequence.
@@ -236,64 +679,178 @@ func (s *Seq) handleEvent(event *MSEvent) {
 	if event.IsSeqState() {
 		s.mu.Lock()
 		s.state = event.State
+		entry := s.gens.route(event)
 		s.mu.Unlock()
+
+		// State changes count towards the active generation's queue time
+		if entry != nil {
+			entry.stream.markEvent()
+		}
 	}
 
+	// Track usage
+	switch {
+	case event.IsSeqAppendFinish():
+		s.mu.Lock()
+		s.stats.Turns++
+		s.mu.Unlock()
+	case event.IsSeqToolCall():
+		s.mu.Lock()
+		s.stats.ToolCalls += len(event.ToolCalls)
+		s.mu.Unlock()
+	case event.IsSeqGenFinish():
+		s.mu.Lock()
+		s.stats.Turns++
+		s.stats.InputTokens = event.InputTokens
+		s.stats.OutputTokens += event.OutputTokens
+		s.mu.Unlock()
+	}
+	s.trackContext(event)
+
 	// Route text events to generation stream
 	if event.IsSeqText() {
+		if fn := s.client.cfg.onTextChunk; fn != nil {
+			fn(s.id, &GenChunk{
+				Text:            event.Text,
+				Hidden:          event.Hidden,
+				Tokens:          event.Tokens,
+				NumInputTokens:  event.NumInputTokens,
+				NumOutputTokens: event.NumOutputTokens,
+			})
+		}
+
 		s.mu.RLock()
-		stream := s.genStream
+		entry := s.gens.route(event)
 		s.mu.RUnlock()
-		if stream != nil {
-			stream.handleText(event)
+		if entry != nil {
+			s.client.noteResume(entry.stream, event.CID)
+			entry.stream.handleText(event)
 		}
 	}
 
 	// Route tool calls to generation stream
 	if event.IsSeqToolCall() {
-		s.mu.RLock()
-		stream := s.genStream
-		s.mu.RUnlock()
+		if fn := s.client.cfg.onToolCall; fn != nil {
+			fn(s.id, toToolCalls(event.ToolCalls))
+		}
+
+		// The stream gets no more text until it is resumed
+		var stream *GenStream
+		s.mu.Lock()
+		if entry := s.gens.route(event); entry != nil {
+			entry.state = genAwaitingTools
+			stream = entry.stream
+		}
+		s.mu.Unlock()
 		if stream != nil {
 			stream.handleToolCall(event)
 		}
 	}
 
+	// Finish a stream started by AppendStream
+	if event.IsSeqAppendFinish() {
+		s.mu.Lock()
+		stream := s.gens.get(event.CID)
+		if stream != nil && stream.echo != nil {
+			s.gens.remove(event.CID)
+			s.finishing++
+			s.mu.Unlock()
+			s.record(*stream.echo)
+			s.auditMessage(AuditAppend, event.CID, *stream.echo, event.InputTokens, 0)
+			stream.handleFinish(event)
+			s.finished()
+		} else {
+			s.mu.Unlock()
+		}
+	}
+
 	// Handle generation finish
 	if event.IsSeqGenFinish() {
 		s.mu.Lock()
-		stream := s.genStream
-		// Only close stream if CID matches (avoid closing wrong stream after tool_return)
-		if stream != nil && stream.cid == event.CID {
-			s.genStream = nil
+		stream := s.gens.remove(event.CID)
+		if stream != nil {
+			s.finishing++
 			s.mu.Unlock()
+			s.client.noteResume(stream, event.CID)
+			s.charge(stream.budgets, event.InputTokens, event.OutputTokens)
 			stream.handleFinish(event)
+			msg := stream.generated()
+			s.captureGeneration(event.CID, msg)
+			s.record(msg)
+			s.auditMessage(AuditGeneration, event.CID, msg, event.InputTokens, event.OutputTokens)
+			s.finished()
 		} else {
+			stream = nil
 			s.mu.Unlock()
+			s.charge(s.budgets(genConfig{}), event.InputTokens, event.OutputTokens)
+		}
+
+		stats := GenStats{
+			CID:          event.CID,
+			InputTokens:  event.InputTokens,
+			OutputTokens: event.OutputTokens,
+			Cost:         s.cost(event.InputTokens, event.OutputTokens),
+			Tags:         s.Tags(),
+		}
+		if stream != nil {
+			stats.Timings = stream.Timings()
+			s.client.rates.observe(s.model, event.OutputTokens, stats.Timings)
+		}
+
+		s.client.logGenFinish(s.id, stats)
+		if fn := s.client.cfg.onGenFinish; fn != nil {
+			fn(s.id, stats)
 		}
 	}
 
-	// Handle command completions
-	if cid := event.CID; cid != "" {
-		s.cmdMu.RLock()
-		ch, ok := s.commands[cid]
-		s.cmdMu.RUnlock()
-		if ok {
-			select {
-			case ch <- event:
-			default:
-			}
+	// Route errors for the active generation to its stream
+	if event.IsError() && event.CID != "" {
+		s.mu.Lock()
+		if s.gens.cancelRejected(event.CID) {
+			s.mu.Unlock()
+			s.client.log(slog.LevelWarn, "", "cancel rejected",
+				slog.String(logKeySeqID, s.id),
+				slog.String(logKeyCID, event.CID),
+				slog.String(logKeyError, event.Message),
+			)
+		} else if stream := s.gens.remove(event.CID); stream != nil {
+			s.wakeLocked()
+			s.mu.Unlock()
+			stream.handleError(&ProtocolError{
+				Message: event.Message,
+				SeqID:   event.SeqID,
+				CID:     event.CID,
+			})
+		} else {
+			s.mu.Unlock()
 		}
 	}
 
-	// Handle close
+	// Handle close before completing the command, so Close returns with the
+	// sequence's final state in place
 	if event.IsSeqClosed() {
 		s.handleClose(event)
 	}
+
+	// Handle command completions
+	if cid := event.CID; cid != "" && event.isCompletion() {
+		s.cmdMu.Lock()
+		if cmd, ok := s.commands[cid]; ok {
+			cmd.complete(event)
+		}
+		s.cmdMu.Unlock()
+	}
 }
 
 // handleClose handles sequence closure.
 func (s *Seq) handleClose(event *MSEvent) {
+	s.closeWith(event, nil)
+}
+
+// closeWith closes the sequence locally. cause is set when the sequence was
+// lost rather than closed, e.g. with its connection; an error in the closing
+// event takes its place.
+func (s *Seq) closeWith(event *MSEvent, cause error) {
 	s.mu.Lock()
 	if s.closed {
 		s.mu.Unlock()
@@ -302,28 +859,118 @@ func (s *Seq) handleClose(event *MSEvent) {
 	s.closed = true
 	s.state = StateClosed
 	if event != nil && event.ErrorMsg != "" {
-		s.closeErr = &SeqError{SeqID: s.id, Message: event.ErrorMsg}
+		cause = &SeqError{SeqID: s.id, Message: event.ErrorMsg}
+	}
+	s.closeErr = cause
+	s.stats.DurationMs = time.Since(s.opened).Milliseconds()
+	if event != nil && event.IsSeqClosed() {
+		s.stats.InputTokens = event.InputTokens
+		s.stats.OutputTokens = event.OutputTokens
+		s.stats.DurationMs = event.DurationMs
+	}
+	stats := s.stats
+	streams := s.gens.drain()
+	failed := s.closedErrLocked()
+	s.wakeLocked()
+
+	// Nothing will complete pending commands, apart from the closing
+	// event's own
+	s.cmdMu.Lock()
+	for cid, cmd := range s.commands {
+		if event == nil || cid != event.CID {
+			cmd.fail(failed)
+		}
 	}
-	stream := s.genStream
-	s.genStream = nil
+	s.cmdMu.Unlock()
 	s.mu.Unlock()
 
-	// Close any active generation stream
-	if stream != nil {
-		stream.handleClose()
+	// Close any active generation streams
+	for _, stream := range streams {
+		stream.handleClose(cause)
+	}
+	s.flushTraining()
+
+	if fn := s.client.cfg.onSeqClosed; fn != nil {
+		fn(s.id, stats)
 	}
 
 	// Remove from client
-	s.client.removeSeq(s.id)
+	s.client.removeSeq(s)
+}
+
+// command is a command waiting for the server to complete it.
+type command struct {
+	ch   chan *MSEvent // Buffered for the completion; closed on failure
+	err  error         // Set before ch is closed
+	done bool          // Set once completed or failed, guarded by Seq.cmdMu
+}
+
+// complete hands the command its completion. Only the first completion is
+// sent, so the send never blocks and is never dropped. s.cmdMu must be held.
+func (c *command) complete(event *MSEvent) {
+	if c.done {
+		return
+	}
+	c.done = true
+	c.ch <- event
 }
 
-// registerCommand registers a channel to receive a command response.
-func (s *Seq) registerCommand(cid string) chan *MSEvent {
-	ch := make(chan *MSEvent, 1)
+// fail ends the command with err unless it has completed. s.cmdMu must be
+// held.
+func (c *command) fail(err error) {
+	if c.done {
+		return
+	}
+	c.done = true
+	c.err = err
+	close(c.ch)
+}
+
+// wait blocks until the command completes, returning its completion, or
+// fails. Error events are returned as a [ProtocolError].
+func (c *command) wait(ctx context.Context) (*MSEvent, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case event, ok := <-c.ch:
+		if !ok {
+			return nil, c.err
+		}
+		if event.IsError() {
+			return nil, &ProtocolError{
+				Message: event.Message,
+				SeqID:   event.SeqID,
+				CID:     event.CID,
+			}
+		}
+		return event, nil
+	}
+}
+
+// registerCommand registers a command to receive its completion. It fails
+// once the sequence is closed, as nothing would complete the command.
+func (s *Seq) registerCommand(cid string) (*command, error) {
+	cmd := &command{ch: make(chan *MSEvent, 1)}
+
+	// Holding mu keeps closeWith from missing the command
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, s.closedErrLocked()
+	}
 	s.cmdMu.Lock()
-	s.commands[cid] = ch
+	s.commands[cid] = cmd
 	s.cmdMu.Unlock()
-	return ch
+	return cmd, nil
+}
+
+// closedErrLocked returns the error operations on the closed sequence fail
+// with: ErrSeqClosed, wrapping the cause if it was lost. s.mu must be held.
+func (s *Seq) closedErrLocked() error {
+	if s.closeErr != nil {
+		return fmt.Errorf("%w: %w", ErrSeqClosed, s.closeErr)
+	}
+	return ErrSeqClosed
 }
 
 // unregisterCommand removes a command channel.
@@ -331,4 +978,8 @@ func (s *Seq) unregisterCommand(cid string) {
 	s.cmdMu.Lock()
 	delete(s.commands, cid)
 	s.cmdMu.Unlock()
+
+	s.mu.Lock()
+	s.wakeLocked()
+	s.mu.Unlock()
 }
@@ -0,0 +1,148 @@
+package modelsocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Snapshot is a serializable record of a conversation, from which it can be
+// restored onto a new sequence with [Client.Restore].
+type Snapshot struct {
+	Model   string    `json:"model"`
+	History []Message `json:"history"`
+	SavedAt time.Time `json:"saved_at"`
+
+	// Version is maintained by [SessionStore] implementations for
+	// optimistic locking. It is zero for a conversation that has never
+	// been saved.
+	Version int64 `json:"version"`
+
+	// State is application state saved along with the conversation, such
+	// as a workflow's progress. The client doesn't interpret it.
+	State json.RawMessage `json:"state,omitempty"`
+}
+
+// SessionStore persists conversation snapshots by conversation ID, so idle
+// conversations can be parked without holding a sequence open and resumed
+// later, possibly by another process.
+//
+// Save stores snap only if the stored version still matches snap.Version,
+// or if there is no stored session and snap.Version is zero; otherwise it
+// returns ErrSessionConflict. On success it sets snap.Version to the new
+// version. Load returns ErrSessionNotFound for unknown IDs. Deleting an
+// unknown ID is not an error.
+type SessionStore interface {
+	Save(ctx context.Context, id string, snap *Snapshot) error
+	Load(ctx context.Context, id string) (*Snapshot, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Snapshot returns a record of the sequence's conversation so far. Open
+// options such as the toolbox aren't included; pass them again to
+// [Client.Restore].
+func (s *Seq) Snapshot() *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &Snapshot{
+		Model:   s.model,
+		History: append([]Message(nil), s.history...),
+		SavedAt: time.Now(),
+		Version: s.version,
+	}
+}
+
+// Restore opens a sequence holding the conversation in snap. See
+// [Client.Replay] for how the history is recreated.
+func (c *Client) Restore(ctx context.Context, snap *Snapshot, opts ...OpenOption) (*Seq, error) {
+	seq, err := c.Replay(ctx, snap.Model, snap.History, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	seq.mu.Lock()
+	seq.version = snap.Version
+	seq.mu.Unlock()
+	return seq, nil
+}
+
+// Park saves the sequence's conversation to store under id and closes the
+// sequence. Resume it later with [Client.Resume].
+func (s *Seq) Park(ctx context.Context, store SessionStore, id string) error {
+	snap := s.Snapshot()
+	if err := store.Save(ctx, id, snap); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.version = snap.Version
+	s.mu.Unlock()
+
+	return s.Close(ctx)
+}
+
+// Resume restores the conversation saved under id onto a new sequence.
+func (c *Client) Resume(ctx context.Context, store SessionStore, id string, opts ...OpenOption) (*Seq, error) {
+	snap, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return c.Restore(ctx, snap, opts...)
+}
+
+// MemorySessionStore is a SessionStore that keeps snapshots in memory. It
+// suits a single process; use a shared store when several instances serve
+// the same conversations.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Snapshot
+}
+
+// NewMemorySessionStore creates an empty in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Snapshot)}
+}
+
+// Save stores a copy of snap.
+func (m *MemorySessionStore) Save(ctx context.Context, id string, snap *Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.sessions[id]
+	if (ok && current.Version != snap.Version) || (!ok && snap.Version != 0) {
+		return ErrSessionConflict
+	}
+
+	snap.Version++
+	stored := *snap
+	stored.History = append([]Message(nil), snap.History...)
+	stored.State = bytes.Clone(snap.State)
+	m.sessions[id] = stored
+	return nil
+}
+
+// Load returns a copy of the snapshot stored under id.
+func (m *MemorySessionStore) Load(ctx context.Context, id string) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	stored.History = append([]Message(nil), stored.History...)
+	stored.State = bytes.Clone(stored.State)
+	return &stored, nil
+}
+
+// Delete removes the snapshot stored under id.
+func (m *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
@@ -0,0 +1,211 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemorySessionStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySessionStore()
+
+	if _, err := store.Load(ctx, "conv-1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Load error = %v, want ErrSessionNotFound", err)
+	}
+
+	snap := &Snapshot{Model: "m", History: []Message{{Role: RoleUser, Text: "Hi"}}}
+	if err := store.Save(ctx, "conv-1", snap); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if snap.Version != 1 {
+		t.Errorf("Version = %d, want 1", snap.Version)
+	}
+
+	// Two writers load the same version; only the first save wins
+	a, _ := store.Load(ctx, "conv-1")
+	b, _ := store.Load(ctx, "conv-1")
+	a.History = append(a.History, Message{Role: RoleAssistant, Text: "Hello"})
+	if err := store.Save(ctx, "conv-1", a); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if err := store.Save(ctx, "conv-1", b); !errors.Is(err, ErrSessionConflict) {
+		t.Errorf("stale Save error = %v, want ErrSessionConflict", err)
+	}
+
+	// A new conversation can't overwrite an existing one
+	if err := store.Save(ctx, "conv-1", &Snapshot{Model: "m"}); !errors.Is(err, ErrSessionConflict) {
+		t.Errorf("new Save error = %v, want ErrSessionConflict", err)
+	}
+
+	loaded, err := store.Load(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Version != 2 || len(loaded.History) != 2 {
+		t.Errorf("loaded = %+v, want version 2 with 2 messages", loaded)
+	}
+
+	if err := store.Delete(ctx, "conv-1"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if _, err := store.Load(ctx, "conv-1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Load after Delete error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSnapshot_JSON(t *testing.T) {
+	snap := Snapshot{
+		Model: "m",
+		History: []Message{
+			{Role: RoleAssistant, Text: "Checking.", ToolCalls: []ToolCall{{Name: "lookup", Args: `{}`}}},
+			{Role: RoleTool, Text: "[]", ToolResults: []ToolResult{{Name: "lookup", Result: "ok"}}},
+		},
+		Version: 3,
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	var decoded Snapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Version != 3 || len(decoded.History) != 2 {
+		t.Fatalf("decoded = %+v", decoded)
+	}
+	if decoded.History[0].ToolCalls[0].Name != "lookup" || decoded.History[1].ToolResults[0].Result != "ok" {
+		t.Errorf("decoded history = %+v", decoded.History)
+	}
+}
+
+func TestSeq_ParkAndResume(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	store := NewMemorySessionStore()
+
+	appended := make(chan appendCommandData, 2)
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		switch data := req.Data.(type) {
+		case appendCommandData:
+			appended <- data
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		}
+		if req.Request == "seq_open" {
+			return []*MSEvent{{Event: "seq_opened", CID: req.CID, SeqID: "seq-2"}}
+		}
+		return nil
+	})
+
+	if err := seq.Append(ctx, "Remember 42", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	<-appended
+
+	if err := seq.Park(ctx, store, "conv-1"); err != nil {
+		t.Fatalf("Park error: %v", err)
+	}
+	if seq.State() != StateClosed {
+		t.Errorf("State = %v, want closed", seq.State())
+	}
+
+	resumed, err := client.Resume(ctx, store, "conv-1")
+	if err != nil {
+		t.Fatalf("Resume error: %v", err)
+	}
+	if resumed.ID() != "seq-2" || resumed.Model() != "test-model" {
+		t.Errorf("resumed = %s/%s, want seq-2/test-model", resumed.ID(), resumed.Model())
+	}
+
+	select {
+	case data := <-appended:
+		if data.Text != "Remember 42" {
+			t.Errorf("replayed Text = %q, want %q", data.Text, "Remember 42")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("history was not replayed")
+	}
+
+	// Parking again updates the stored session rather than conflicting
+	if err := resumed.Park(ctx, store, "conv-1"); err != nil {
+		t.Errorf("second Park error: %v", err)
+	}
+}
+
+func TestSeq_ResumeRetryPark(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	store := NewMemorySessionStore()
+
+	var mu sync.Mutex
+	opened, gens := 1, 0
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Data.(type) {
+		case appendCommandData:
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			// The first generation fails, so it is retried on a replay
+			if gens++; gens == 1 {
+				return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, ErrorMsg: "worker crashed"}}
+			}
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "Hello"},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, OutputTokens: 1},
+			}
+		}
+		if req.Request == "seq_open" {
+			opened++
+			return []*MSEvent{{Event: "seq_opened", CID: req.CID, SeqID: fmt.Sprintf("seq-%d", opened)}}
+		}
+		return nil
+	})
+
+	if err := seq.Append(ctx, "Hi", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	if err := seq.Park(ctx, store, "conv-1"); err != nil {
+		t.Fatalf("Park error: %v", err)
+	}
+	resumed, err := client.Resume(ctx, store, "conv-1")
+	if err != nil {
+		t.Fatalf("Resume error: %v", err)
+	}
+
+	stream, err := resumed.Generate(ctx, WithGenerateRetry(RetryPolicy{MaxAttempts: 2}))
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if stream.Seq() == resumed {
+		t.Fatal("generation wasn't retried on a new sequence")
+	}
+
+	// The replacement continues the resumed session
+	if err := stream.Seq().Park(ctx, store, "conv-1"); err != nil {
+		t.Errorf("Park after retry error: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+module github.com/chrisboulton/modelsocket-go/sessionredis
+
+go 1.23
+
+require (
+	github.com/alicebob/miniredis/v2 v2.33.0
+	github.com/chrisboulton/modelsocket-go v0.0.0
+	github.com/redis/go-redis/v9 v9.7.3
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/coder/websocket v1.8.14 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
+
+// The root module has no tagged release yet, so v0.0.0 above is a
+// placeholder and this module builds against the working tree it ships in.
+// Require the first tagged release and drop the replace once there is one.
+replace github.com/chrisboulton/modelsocket-go => ../
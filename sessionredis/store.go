@@ -0,0 +1,144 @@
+// Package sessionredis implements modelsocket.SessionStore over Redis, for
+// deployments where several instances serve the same conversations.
+package sessionredis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultPrefix is prepended to conversation IDs to form Redis keys.
+const DefaultPrefix = "modelsocket:session:"
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithPrefix sets the prefix of the Redis keys sessions are stored under.
+func WithPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// WithTTL expires sessions that haven't been saved for ttl. Zero, the
+// default, keeps sessions until they are deleted.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Store) {
+		s.ttl = ttl
+	}
+}
+
+// Store is a modelsocket.SessionStore backed by Redis. Snapshots are stored
+// as JSON, and saves use WATCH/MULTI so that concurrent writers of the same
+// conversation get modelsocket.ErrSessionConflict instead of overwriting
+// each other.
+type Store struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+var _ modelsocket.SessionStore = (*Store)(nil)
+
+// New creates a Store using rdb.
+func New(rdb redis.UniversalClient, opts ...Option) *Store {
+	s := &Store{
+		rdb:    rdb,
+		prefix: DefaultPrefix,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Save stores snap if the stored version matches snap.Version, and sets
+// snap.Version to the new version.
+func (s *Store) Save(ctx context.Context, id string, snap *modelsocket.Snapshot) error {
+	key := s.prefix + id
+	next := *snap
+	next.Version++
+
+	data, err := json.Marshal(next)
+	if err != nil {
+		return fmt.Errorf("sessionredis: encode %s: %w", id, err)
+	}
+
+	err = s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := s.version(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if current != snap.Version {
+			return modelsocket.ErrSessionConflict
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, s.ttl)
+			return nil
+		})
+		return err
+	}, key)
+
+	switch {
+	case errors.Is(err, redis.TxFailedErr):
+		return modelsocket.ErrSessionConflict
+	case errors.Is(err, modelsocket.ErrSessionConflict):
+		return err
+	case err != nil:
+		return fmt.Errorf("sessionredis: save %s: %w", id, err)
+	}
+
+	snap.Version = next.Version
+	return nil
+}
+
+// version returns the version stored under key, or zero if there is none.
+func (s *Store) version(ctx context.Context, tx *redis.Tx, key string) (int64, error) {
+	data, err := tx.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var stored struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return 0, err
+	}
+	return stored.Version, nil
+}
+
+// Load returns the snapshot stored under id.
+func (s *Store) Load(ctx context.Context, id string) (*modelsocket.Snapshot, error) {
+	data, err := s.rdb.Get(ctx, s.prefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, modelsocket.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sessionredis: load %s: %w", id, err)
+	}
+
+	var snap modelsocket.Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("sessionredis: decode %s: %w", id, err)
+	}
+	return &snap, nil
+}
+
+// Delete removes the snapshot stored under id.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	if err := s.rdb.Del(ctx, s.prefix+id).Err(); err != nil {
+		return fmt.Errorf("sessionredis: delete %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package sessionredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestStore(t *testing.T, opts ...Option) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return New(rdb, opts...), mr
+}
+
+func TestStore_SaveLoad(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestStore(t)
+
+	if _, err := store.Load(ctx, "conv-1"); !errors.Is(err, modelsocket.ErrSessionNotFound) {
+		t.Fatalf("Load error = %v, want ErrSessionNotFound", err)
+	}
+
+	snap := &modelsocket.Snapshot{
+		Model:   "m",
+		History: []modelsocket.Message{{Role: modelsocket.RoleUser, Text: "Hi"}},
+	}
+	if err := store.Save(ctx, "conv-1", snap); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if snap.Version != 1 {
+		t.Errorf("Version = %d, want 1", snap.Version)
+	}
+	if !mr.Exists(DefaultPrefix + "conv-1") {
+		t.Errorf("key %s not set", DefaultPrefix+"conv-1")
+	}
+
+	loaded, err := store.Load(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Model != "m" || loaded.Version != 1 || len(loaded.History) != 1 || loaded.History[0].Text != "Hi" {
+		t.Errorf("loaded = %+v", loaded)
+	}
+
+	if err := store.Delete(ctx, "conv-1"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if _, err := store.Load(ctx, "conv-1"); !errors.Is(err, modelsocket.ErrSessionNotFound) {
+		t.Errorf("Load after Delete error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestStore_Conflict(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	if err := store.Save(ctx, "conv-1", &modelsocket.Snapshot{Model: "m"}); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	a, _ := store.Load(ctx, "conv-1")
+	b, _ := store.Load(ctx, "conv-1")
+	if err := store.Save(ctx, "conv-1", a); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if err := store.Save(ctx, "conv-1", b); !errors.Is(err, modelsocket.ErrSessionConflict) {
+		t.Errorf("stale Save error = %v, want ErrSessionConflict", err)
+	}
+	if err := store.Save(ctx, "conv-1", &modelsocket.Snapshot{Model: "m"}); !errors.Is(err, modelsocket.ErrSessionConflict) {
+		t.Errorf("new Save error = %v, want ErrSessionConflict", err)
+	}
+}
+
+func TestStore_TTL(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestStore(t, WithPrefix("test:"), WithTTL(time.Minute))
+
+	if err := store.Save(ctx, "conv-1", &modelsocket.Snapshot{Model: "m"}); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if ttl := mr.TTL("test:conv-1"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want 1m", ttl)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, err := store.Load(ctx, "conv-1"); !errors.Is(err, modelsocket.ErrSessionNotFound) {
+		t.Errorf("Load after expiry error = %v, want ErrSessionNotFound", err)
+	}
+}
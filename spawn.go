@@ -0,0 +1,188 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SpawnAgentToolName is the name of the tool returned by
+// [NewSpawnAgentTool].
+const SpawnAgentToolName = "spawn_agent"
+
+// DefaultSpawnMaxDepth is how deeply agents spawned by a [SpawnAgentTool]
+// may nest unless [WithSpawnMaxDepth] sets another limit.
+const DefaultSpawnMaxDepth = 2
+
+// SpawnOption configures a [SpawnAgentTool].
+type SpawnOption func(*spawnConfig)
+
+type spawnConfig struct {
+	maxDepth    int
+	budget      *budget // Created from budgetLimit by NewSpawnAgentTool
+	budgetLimit *Budget
+	toolbox     *Toolbox
+	chatOptions []ChatOption
+}
+
+// WithSpawnMaxDepth limits how deeply spawned agents nest: agents the model
+// spawns are at depth 1, agents they spawn at depth 2, and so on. Agents at
+// the limit aren't offered the tool. Defaults to [DefaultSpawnMaxDepth].
+func WithSpawnMaxDepth(n int) SpawnOption {
+	return func(c *spawnConfig) {
+		c.maxDepth = n
+	}
+}
+
+// WithSpawnBudget caps the tokens and cost consumed by all the agents the
+// tool spawns, at every depth, as [WithSeqBudget] does for one sequence. Once
+// it is used up, the tool fails with a [*BudgetExceededError], which the
+// model receives as the tool's result.
+func WithSpawnBudget(maxInputTokens, maxOutputTokens int, maxCost float64) SpawnOption {
+	limit := Budget{MaxInputTokens: maxInputTokens, MaxOutputTokens: maxOutputTokens, MaxCost: maxCost}
+	return func(c *spawnConfig) {
+		c.budgetLimit = &limit
+	}
+}
+
+// WithSpawnToolbox gives spawned agents the tools in toolbox, alongside the
+// spawn tool itself while they are below the depth limit.
+func WithSpawnToolbox(toolbox *Toolbox) SpawnOption {
+	return func(c *spawnConfig) {
+		c.toolbox = toolbox
+	}
+}
+
+// WithSpawnChatOptions configures the [ChatSession] each spawned agent runs
+// in, e.g. with [WithChatMaxToolRounds] or [WithChatGenOptions].
+func WithSpawnChatOptions(opts ...ChatOption) SpawnOption {
+	return func(c *spawnConfig) {
+		c.chatOptions = append(slices.Clip(c.chatOptions), opts...)
+	}
+}
+
+// SpawnAgentTool is a tool that delegates a task to a sub-agent: a new
+// sequence with the system prompt the model chooses, which works on the task
+// with its own tools and returns its final answer as the tool's result.
+//
+//	toolbox.Add(modelsocket.NewSpawnAgentTool(client, model,
+//	    modelsocket.WithSpawnMaxDepth(2),
+//	    modelsocket.WithSpawnBudget(0, 20_000, 0),
+//	))
+type SpawnAgentTool struct {
+	client *Client
+	model  string
+	cfg    spawnConfig
+}
+
+// spawnDepthKey is the context key for the depth of the agent whose tool
+// calls are being run.
+type spawnDepthKey struct{}
+
+// NewSpawnAgentTool returns a spawn_agent tool whose agents run on model.
+func NewSpawnAgentTool(client *Client, model string, opts ...SpawnOption) *SpawnAgentTool {
+	cfg := spawnConfig{maxDepth: DefaultSpawnMaxDepth}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.budgetLimit != nil {
+		cfg.budget = newBudget(BudgetScopeSpawn, *cfg.budgetLimit)
+	}
+	return &SpawnAgentTool{client: client, model: model, cfg: cfg}
+}
+
+// Definition returns the tool definition.
+func (t *SpawnAgentTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Name:        SpawnAgentToolName,
+		Description: "Delegate a self-contained task to a new assistant and get back its final answer.",
+		Parameters: ToolParameters{
+			Type: "object",
+			Properties: map[string]ToolProperty{
+				"task": {
+					Type:        "string",
+					Description: "The task, with everything the assistant needs to know to do it",
+				},
+				"system_prompt": {
+					Type:        "string",
+					Description: "Instructions that set up the assistant, such as its role",
+				},
+			},
+			Required: []string{"task"},
+		},
+	}
+}
+
+// Call spawns an agent for the task in args and returns its final answer:
+// the text it generated after its last tool call. It fails with
+// [ErrAgentDepth] when called by an agent at the depth limit.
+func (t *SpawnAgentTool) Call(ctx context.Context, args string) (string, error) {
+	var in struct {
+		Task         string `json:"task"`
+		SystemPrompt string `json:"system_prompt"`
+	}
+	if err := json.Unmarshal([]byte(args), &in); err != nil {
+		return "", &ToolArgsError{Name: SpawnAgentToolName, Args: args, Err: err}
+	}
+	if strings.TrimSpace(in.Task) == "" {
+		return "", &ToolArgsError{Name: SpawnAgentToolName, Args: args, Err: errors.New("task is required")}
+	}
+
+	depth, _ := ctx.Value(spawnDepthKey{}).(int)
+	depth++
+	if depth > t.cfg.maxDepth {
+		return "", fmt.Errorf("%w: %d", ErrAgentDepth, t.cfg.maxDepth)
+	}
+	ctx = context.WithValue(ctx, spawnDepthKey{}, depth)
+
+	chat, err := NewChatSession(ctx, t.client, t.model, t.chatOptions(depth, in.SystemPrompt)...)
+	if err != nil {
+		return "", err
+	}
+	defer chat.Close(context.WithoutCancel(ctx))
+
+	stream, err := chat.Send(ctx, in.Task)
+	if err != nil {
+		return "", err
+	}
+	var answer strings.Builder
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			return "", err
+		}
+		answer.WriteString(chunk.Text)
+		if len(chunk.ToolCalls) > 0 {
+			answer.Reset()
+		}
+	}
+	return strings.TrimSpace(answer.String()), nil
+}
+
+// chatOptions returns the options for the session of an agent at depth.
+func (t *SpawnAgentTool) chatOptions(depth int, systemPrompt string) []ChatOption {
+	var open []OpenOption
+	if t.cfg.budget != nil {
+		open = append(open, func(c *openConfig) { c.budget = t.cfg.budget })
+	}
+
+	toolbox := NewToolbox()
+	if t.cfg.toolbox != nil {
+		tools := t.cfg.toolbox.Freeze()
+		for _, def := range tools.Definitions() {
+			tool, _ := tools.Get(def.Name)
+			toolbox.Add(tool)
+		}
+	}
+	if depth < t.cfg.maxDepth {
+		toolbox.Add(t)
+	}
+	if len(toolbox.Definitions()) > 0 {
+		open = append(open, WithToolbox(toolbox))
+	}
+
+	opts := []ChatOption{WithChatSystemPrompt(systemPrompt), WithChatOpenOptions(open...)}
+	return append(opts, t.cfg.chatOptions...)
+}
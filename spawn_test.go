@@ -0,0 +1,117 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// spawnServer opens sequences seq-1, seq-2 and so on. Generations after
+// "delegate: <task>" call spawn_agent with the task and then report the
+// result; other generations answer the last appended text. Each generation
+// uses 10 output tokens.
+func spawnServer() func(req *MSRequest) []*MSEvent {
+	var opened int
+	last := make(map[string]string)
+	return func(req *MSRequest) []*MSEvent {
+		if req.Request == "seq_open" {
+			opened++
+			return []*MSEvent{{Event: "seq_opened", CID: req.CID, SeqID: fmt.Sprintf("seq-%d", opened)}}
+		}
+
+		switch data := req.Data.(type) {
+		case appendCommandData:
+			last[req.SeqID] = data.Text
+			return []*MSEvent{{Event: "seq_append_finish", SeqID: req.SeqID, CID: req.CID}}
+		case genCommandData:
+			if task, ok := strings.CutPrefix(last[req.SeqID], "delegate: "); ok {
+				args, _ := json.Marshal(map[string]string{"task": task})
+				return []*MSEvent{
+					{Event: "seq_text", SeqID: req.SeqID, Text: "Delegating. "},
+					{Event: "seq_tool_call", SeqID: req.SeqID, CID: req.CID, ToolCalls: []SeqToolCall{{Name: SpawnAgentToolName, Args: string(args)}}},
+				}
+			}
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "answered " + last[req.SeqID]},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, OutputTokens: 10},
+			}
+		case toolReturnCommandData:
+			return []*MSEvent{
+				{Event: "seq_text", SeqID: req.SeqID, Text: "relayed " + data.Results[0].Result},
+				{Event: "seq_gen_finish", SeqID: req.SeqID, CID: req.CID, OutputTokens: 10},
+			}
+		case closeCommandData:
+			return []*MSEvent{{Event: "seq_closed", SeqID: req.SeqID, CID: req.CID}}
+		}
+		return nil
+	}
+}
+
+func TestSpawnAgentTool_Call(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	seen := serveCommands(t, transport, spawnServer())
+
+	tool := NewSpawnAgentTool(client, "test-model")
+	answer, err := tool.Call(ctx, `{"task": "delegate: sums", "system_prompt": "You add."}`)
+	if err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+
+	// The agent delegated to one of its own, and answered with the text
+	// after its tool call
+	if answer != "relayed answered sums" {
+		t.Errorf("answer = %q, want the text after the tool call", answer)
+	}
+
+	// Only the agent below the depth limit was offered the tool
+	var offered []bool
+	for len(seen) > 0 {
+		if data, ok := (<-seen).Data.(SeqOpenData); ok {
+			offered = append(offered, data.ToolsEnabled)
+		}
+	}
+	if fmt.Sprint(offered) != "[true false]" {
+		t.Errorf("tools enabled = %v, want [true false]", offered)
+	}
+}
+
+func TestSpawnAgentTool_MaxDepth(t *testing.T) {
+	tool := NewSpawnAgentTool(nil, "test-model", WithSpawnMaxDepth(1))
+
+	ctx := context.WithValue(context.Background(), spawnDepthKey{}, 1)
+	if _, err := tool.Call(ctx, `{"task": "sums"}`); !errors.Is(err, ErrAgentDepth) {
+		t.Errorf("Call error = %v, want ErrAgentDepth", err)
+	}
+
+	var argsErr *ToolArgsError
+	if _, err := tool.Call(context.Background(), `{}`); !errors.As(err, &argsErr) {
+		t.Errorf("Call without a task error = %v, want *ToolArgsError", err)
+	}
+}
+
+func TestSpawnAgentTool_Budget(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+	serveCommands(t, transport, spawnServer())
+
+	// The budget is shared by every agent the tool spawns
+	tool := NewSpawnAgentTool(client, "test-model", WithSpawnBudget(0, 10, 0))
+	if _, err := tool.Call(ctx, `{"task": "sums"}`); err != nil {
+		t.Fatalf("first Call error: %v", err)
+	}
+
+	var budgetErr *BudgetExceededError
+	if _, err := tool.Call(ctx, `{"task": "more sums"}`); !errors.As(err, &budgetErr) || budgetErr.Scope != BudgetScopeSpawn {
+		t.Errorf("second Call error = %v, want the spawn scope's *BudgetExceededError", err)
+	}
+}
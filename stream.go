@@ -2,6 +2,7 @@ package modelsocket
 
 import (
 	"context"
+	"fmt"
 	"iter"
 	"strings"
 	"sync"
@@ -13,18 +14,58 @@ type GenChunk struct {
 	Hidden    bool
 	Tokens    []int
 	ToolCalls []ToolCall
+
+	// NumInputTokens and NumOutputTokens are the token counts the server
+	// reported with the chunk's text, for showing a live token counter.
+	// They are zero if the server didn't report them.
+	NumInputTokens  int
+	NumOutputTokens int
+
+	// Safety holds the server's moderation annotations for the chunk, if
+	// any. See [GenStream.SafetyVerdict].
+	Safety []SafetyAnnotation
+
+	// Citations are the citations the server completed with the chunk, if
+	// any. Their spans may begin in earlier chunks; see [Citation].
+	Citations []Citation
+
+	// Bytes holds the text instead of Text for streams generated with
+	// [WithZeroCopyChunks]. It is only valid until [GenChunk.Release].
+	Bytes []byte
+
+	pooled *[]byte
 }
 
 // ToolCall represents a tool call from the model.
 type ToolCall struct {
-	Name string
-	Args string
+	Name string `json:"name"`
+	Args string `json:"args"`
+}
+
+// GenStats summarizes a finished generation.
+type GenStats struct {
+	CID          string
+	InputTokens  int
+	OutputTokens int
+	Timings      GenTimings
+
+	// Cost is priced with [WithPricing] or [WithCostFunc], and 0 without.
+	Cost float64
+
+	// Tags are the sequence's tags, set with [WithSeqTag].
+	Tags map[string]string
 }
 
 // GenStream provides streaming access to generated content.
+//
+// The protocol has no flow control, so the server sends chunks as fast as it
+// generates them. A stream buffers up to 100 undelivered chunks; once the
+// buffer is full the client stops reading the connection until the consumer
+// catches up, which holds up every sequence on it. Consume streams promptly.
 type GenStream struct {
 	seq *Seq
 	cid string
+	ctx context.Context
 
 	mu       sync.Mutex
 	chunks   chan *GenChunk
@@ -34,9 +75,57 @@ type GenStream struct {
 
 	closeOnce sync.Once
 
+	// Held while delivering a chunk, so chunks isn't closed mid-send
+	sendMu       sync.RWMutex
+	chunksClosed bool
+
+	// Stops watching the context the generation was started with
+	stopCancel func() bool
+
+	// Optional client-side tool call detection
+	parser ToolCallParser
+
+	// Optional guardrail applied before chunks reach the consumer
+	filter func(*GenChunk) (*GenChunk, error)
+
+	// Deliver chunk text in pooled buffers, set with WithZeroCopyChunks
+	// before the stream is returned to the consumer
+	zeroCopy bool
+
 	// Stats from finish event
 	inputTokens  int
 	outputTokens int
+
+	timer genTimer
+
+	// For streams started by AppendStream, the appended message, recorded
+	// in place of the echoed text
+	echo *Message
+
+	// For continuations after a tool return, the CID of the generation
+	// they continue; see wireCID
+	resumes string
+
+	// Budgets the generation counts against, and the output tokens
+	// streamed so far
+	budgets  []*budget
+	streamed int
+
+	// Tokens delivered to the consumer, reported by WithOnProgress, and
+	// their visible text, returned by TextSoFar
+	delivered int
+	visible   strings.Builder
+
+	// The generated message as the server sees it, recorded in the
+	// sequence's history once the generation completes
+	message    Message
+	transcript strings.Builder
+
+	// Safety annotations so far, and the policy that stops the generation
+	safety  *SafetyPolicy
+	verdict SafetyVerdict
+
+	citations []Citation
 }
 
 // newGenStream creates a new generation stream.
@@ -44,8 +133,10 @@ func newGenStream(seq *Seq, cid string) *GenStream {
 	return &GenStream{
 		seq:    seq,
 		cid:    cid,
+		ctx:    context.Background(),
 		chunks: make(chan *GenChunk, 100),
 		done:   make(chan struct{}),
+		timer:  newGenTimer(),
 	}
 }
 
@@ -63,13 +154,13 @@ func (g *GenStream) Next(ctx context.Context) (*GenChunk, error) {
 			g.mu.Unlock()
 			return nil, err
 		}
-		return chunk, nil
+		return g.consume(chunk), nil
 	case <-g.done:
 		// Drain any remaining chunks
 		select {
 		case chunk, ok := <-g.chunks:
 			if ok {
-				return chunk, nil
+				return g.consume(chunk), nil
 			}
 		default:
 		}
@@ -80,6 +171,14 @@ func (g *GenStream) Next(ctx context.Context) (*GenChunk, error) {
 	}
 }
 
+// consume prepares a chunk for the consumer.
+func (g *GenStream) consume(chunk *GenChunk) *GenChunk {
+	if g.zeroCopy {
+		return pooledChunk(chunk)
+	}
+	return chunk
+}
+
 // Chunks returns an iterator over all chunks in the stream.
 func (g *GenStream) Chunks(ctx context.Context) iter.Seq2[*GenChunk, error] {
 	return func(yield func(*GenChunk, error) bool) {
@@ -99,36 +198,102 @@ func (g *GenStream) Chunks(ctx context.Context) iter.Seq2[*GenChunk, error] {
 	}
 }
 
-// Text collects all generated text and returns it.
+// Text collects all generated text and returns it. If the stream ends with
+// an error, e.g. because the connection dropped, or ctx is done first, Text
+// returns the text received until then along with the error, so partial
+// output can be salvaged. That includes chunks still buffered when ctx is
+// done.
 func (g *GenStream) Text(ctx context.Context) (string, error) {
 	var sb strings.Builder
 
-	for chunk, err := range g.Chunks(ctx) {
-		if err != nil {
-			return sb.String(), err
-		}
+	err := g.collect(ctx, func(chunk *GenChunk) {
 		if !chunk.Hidden {
 			sb.WriteString(chunk.Text)
+			sb.Write(chunk.Bytes)
 		}
-	}
-	return sb.String(), nil
+	})
+	return sb.String(), err
 }
 
-// TextAndTokens collects all generated text and tokens.
+// TextAndTokens collects all generated text and tokens. Like
+// [GenStream.Text], it returns what was received along with any error.
 func (g *GenStream) TextAndTokens(ctx context.Context) (string, []int, error) {
 	var sb strings.Builder
 	var tokens []int
 
-	for chunk, err := range g.Chunks(ctx) {
-		if err != nil {
-			return sb.String(), tokens, err
-		}
+	err := g.collect(ctx, func(chunk *GenChunk) {
 		if !chunk.Hidden {
 			sb.WriteString(chunk.Text)
+			sb.Write(chunk.Bytes)
 		}
 		tokens = append(tokens, chunk.Tokens...)
+	})
+	return sb.String(), tokens, err
+}
+
+// collect passes every chunk to fn and releases it. If ctx is done, chunks
+// already buffered are passed on before the error is returned.
+func (g *GenStream) collect(ctx context.Context, fn func(*GenChunk)) error {
+	for chunk, err := range g.Chunks(ctx) {
+		if err != nil {
+			if ctx.Err() != nil {
+				for _, chunk := range g.buffered() {
+					fn(chunk)
+					chunk.Release()
+				}
+			}
+			return err
+		}
+		fn(chunk)
+		chunk.Release()
+	}
+	return nil
+}
+
+// buffered returns the chunks received but not yet read, without waiting
+// for more.
+func (g *GenStream) buffered() []*GenChunk {
+	var chunks []*GenChunk
+	for {
+		select {
+		case chunk, ok := <-g.chunks:
+			if !ok {
+				return chunks
+			}
+			chunks = append(chunks, g.consume(chunk))
+		default:
+			return chunks
+		}
 	}
-	return sb.String(), tokens, nil
+}
+
+// TextSoFar returns the visible text delivered so far, including chunks not
+// yet read with [GenStream.Next]. It doesn't consume the stream, so it can be
+// called at any point, e.g. to checkpoint a long generation or to moderate
+// it mid-stream. Text is as the consumer sees it, after tool call parsing
+// and [WithOutputFilter].
+func (g *GenStream) TextSoFar() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.visible.String()
+}
+
+// Context returns a context carrying the values of the context the stream was
+// started with. It is never cancelled, so it can be used to call tools after
+// the original request has returned, e.g. from a background consumer:
+//
+//	results, err := toolbox.CallTools(stream.Context(), chunk.ToolCalls)
+func (g *GenStream) Context() context.Context {
+	return g.ctx
+}
+
+// Seq returns the sequence the stream generates on. With [WithGenerateRetry]
+// this changes when a failed generation is replayed onto a new sequence, and
+// later calls should be made on the returned sequence.
+func (g *GenStream) Seq() *Seq {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.seq
 }
 
 // InputTokens returns the input token count.
@@ -147,6 +312,28 @@ func (g *GenStream) OutputTokens() int {
 	return g.outputTokens
 }
 
+// Timings returns latency measurements for the generation so far. Total is
+// set once the stream has finished.
+func (g *GenStream) Timings() GenTimings {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.timer.timings()
+}
+
+// markSent records when the generate request was sent.
+func (g *GenStream) markSent() {
+	g.mu.Lock()
+	g.timer.markSent()
+	g.mu.Unlock()
+}
+
+// markEvent records that an event for the generation arrived.
+func (g *GenStream) markEvent() {
+	g.mu.Lock()
+	g.timer.markEvent()
+	g.mu.Unlock()
+}
+
 // handleText processes a text event.
 func (g *GenStream) handleText(event *MSEvent) {
 	g.mu.Lock()
@@ -154,20 +341,43 @@ func (g *GenStream) handleText(event *MSEvent) {
 		g.mu.Unlock()
 		return
 	}
+	g.timer.markText()
+	if err := g.noteSafety(event); err != nil {
+		g.mu.Unlock()
+		g.handleAbort(err)
+		return
+	}
+	if !event.Hidden {
+		g.transcript.WriteString(event.Text)
+	}
+	g.citations = append(g.citations, event.Citations...)
 	g.mu.Unlock()
 
+	// Text events without token IDs are counted as one token
+	tokens := len(event.Tokens)
+	if tokens == 0 {
+		tokens = 1
+	}
+	if err := g.countOutput(tokens); err != nil {
+		g.handleAbort(err)
+		return
+	}
+
 	chunk := &GenChunk{
-		Text:   event.Text,
-		Hidden: event.Hidden,
-		Tokens: event.Tokens,
+		Text:            event.Text,
+		Hidden:          event.Hidden,
+		Tokens:          event.Tokens,
+		NumInputTokens:  event.NumInputTokens,
+		NumOutputTokens: event.NumOutputTokens,
+		Safety:          event.Safety,
+		Citations:       event.Citations,
 	}
 
-	// Block until chunk is consumed (backpressure)
-	select {
-	case g.chunks <- chunk:
-	case <-g.done:
-		// Stream was closed
+	if g.parser != nil && !event.Hidden {
+		chunk.Text, chunk.ToolCalls = g.parser.Parse(event.Text)
 	}
+
+	g.deliver(chunk)
 }
 
 // handleToolCall processes a tool call event.
@@ -177,21 +387,56 @@ func (g *GenStream) handleToolCall(event *MSEvent) {
 		g.mu.Unlock()
 		return
 	}
+	g.timer.markEvent()
+	g.message.ToolCalls = append(g.message.ToolCalls, toToolCalls(event.ToolCalls)...)
 	g.mu.Unlock()
 
-	// Convert SeqToolCall to ToolCall
+	chunk := &GenChunk{
+		ToolCalls: toToolCalls(event.ToolCalls),
+	}
+
+	g.deliver(chunk)
+}
+
+// toToolCalls converts wire tool calls to ToolCalls.
+func toToolCalls(calls []SeqToolCall) []ToolCall {
 	var toolCalls []ToolCall
-	for _, tc := range event.ToolCalls {
+	for _, tc := range calls {
 		toolCalls = append(toolCalls, ToolCall{
 			Name: tc.Name,
 			Args: tc.Args,
 		})
 	}
+	return toolCalls
+}
 
-	chunk := &GenChunk{
-		ToolCalls: toolCalls,
+// deliver sends a chunk to the consumer.
+func (g *GenStream) deliver(chunk *GenChunk) {
+	if g.filter != nil {
+		filtered, err := g.filter(chunk)
+		if err != nil {
+			g.handleAbort(err)
+			return
+		}
+		if filtered == nil {
+			return
+		}
+		chunk = filtered
 	}
 
+	g.sendMu.RLock()
+	defer g.sendMu.RUnlock()
+	if g.chunksClosed {
+		return
+	}
+
+	g.mu.Lock()
+	g.delivered += chunkTokens(chunk)
+	if !chunk.Hidden {
+		g.visible.WriteString(chunk.Text)
+	}
+	g.mu.Unlock()
+
 	// Block until chunk is consumed (backpressure)
 	select {
 	case g.chunks <- chunk:
@@ -200,29 +445,134 @@ func (g *GenStream) handleToolCall(event *MSEvent) {
 	}
 }
 
+// closeChunks ends delivery. done is closed first to release any deliver
+// blocked on a full buffer.
+func (g *GenStream) closeChunks() {
+	close(g.done)
+
+	g.sendMu.Lock()
+	g.chunksClosed = true
+	close(g.chunks)
+	g.sendMu.Unlock()
+}
+
 // handleFinish processes a generation finish event.
 func (g *GenStream) handleFinish(event *MSEvent) {
+	// Deliver text the parser was holding back
+	g.mu.Lock()
+	finished := g.finished
+	g.mu.Unlock()
+	if g.parser != nil && !finished {
+		if text, calls := g.parser.Flush(); text != "" || len(calls) > 0 {
+			g.deliver(&GenChunk{Text: text, ToolCalls: calls})
+		}
+	}
+
+	// Input tokens are only known once the generation finishes, so an input
+	// cap is checked here, after the finish has been charged
+	overBudget := g.inputOverBudget()
+
 	g.closeOnce.Do(func() {
 		g.mu.Lock()
 		g.finished = true
+		if overBudget != nil {
+			g.err = overBudget
+		}
 		g.inputTokens = event.InputTokens
 		g.outputTokens = event.OutputTokens
+		g.verdict.add(event.Safety)
+		g.citations = append(g.citations, event.Citations...)
+		g.timer.markFinished()
+		stop := g.stopCancel
 		g.mu.Unlock()
 
-		close(g.chunks)
-		close(g.done)
+		if stop != nil {
+			stop()
+		}
+		g.closeChunks()
+	})
+}
+
+// cancelWith aborts the generation, here and on the server, once ctx is
+// done, ending the stream with the context's error. Abandoned generations
+// then stop using the server and billing tokens.
+func (g *GenStream) cancelWith(ctx context.Context) {
+	stop := context.AfterFunc(ctx, func() {
+		g.handleAbort(context.Cause(ctx))
 	})
+
+	g.mu.Lock()
+	if g.finished {
+		g.mu.Unlock()
+		stop()
+		return
+	}
+	g.stopCancel = stop
+	g.mu.Unlock()
+}
+
+// handleResume ends the stream without error when generation continues on a
+// new stream, e.g. after tool results are returned.
+func (g *GenStream) handleResume() {
+	g.end(nil)
 }
 
-// handleClose handles stream closure due to sequence close.
-func (g *GenStream) handleClose() {
+// handleAbort ends the stream with err and cancels the generation on the
+// server. Further events for the generation are discarded.
+func (g *GenStream) handleAbort(err error) {
+	if !g.end(err) {
+		return
+	}
+
+	if seq := g.Seq(); seq != nil {
+		seq.cancelGeneration(g.wireCID(seq))
+	}
+}
+
+// handleError ends the stream with an error reported by the server for the
+// generation.
+func (g *GenStream) handleError(err error) {
+	g.end(err)
+}
+
+// handleClose handles stream closure due to sequence close. cause explains
+// why the sequence closed, if it didn't close normally.
+func (g *GenStream) handleClose(cause error) {
+	err := ErrSeqClosed
+	if cause != nil {
+		err = fmt.Errorf("%w: %w", ErrSeqClosed, cause)
+	}
+	g.end(err)
+}
+
+// end closes the stream with err, which is nil for a clean end. It reports
+// whether the stream was still open.
+func (g *GenStream) end(err error) bool {
+	ended := false
 	g.closeOnce.Do(func() {
+		ended = true
 		g.mu.Lock()
 		g.finished = true
-		g.err = ErrSeqClosed
+		g.err = err
+		stop := g.stopCancel
 		g.mu.Unlock()
 
-		close(g.chunks)
-		close(g.done)
+		if stop != nil {
+			stop()
+		}
+		g.closeChunks()
 	})
+	return ended
+}
+
+// generated returns the message produced so far, as it will appear in the
+// sequence's history.
+func (g *GenStream) generated() Message {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	msg := g.message
+	msg.Text = g.transcript.String()
+	msg.ToolCalls = append([]ToolCall(nil), g.message.ToolCalls...)
+	return msg
 }
@@ -2,6 +2,9 @@ package modelsocket
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -63,6 +66,42 @@ func TestGenStream_Text(t *testing.T) {
 	}
 }
 
+func TestGenStream_TextPartialOnError(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	ctx := context.Background()
+
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "Hello "})
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "wor"})
+	stream.handleClose(ErrConnectionLost)
+
+	text, err := stream.Text(ctx)
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("Text error = %v, want ErrConnectionLost", err)
+	}
+	if text != "Hello wor" {
+		t.Errorf("text = %q, want the text before the error", text)
+	}
+}
+
+func TestGenStream_TextPartialOnContextDone(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "Hello ", Tokens: []int{1}})
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "wor", Tokens: []int{2}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Buffered chunks are returned even though ctx is done
+	text, tokens, err := stream.TextAndTokens(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("TextAndTokens error = %v, want Canceled", err)
+	}
+	if text != "Hello wor" || !slices.Equal(tokens, []int{1, 2}) {
+		t.Errorf("TextAndTokens = %q, %v, want the buffered text and tokens", text, tokens)
+	}
+}
+
 func TestGenStream_TextAndTokens(t *testing.T) {
 	stream := newGenStream(nil, "cid-1")
 	ctx := context.Background()
@@ -177,6 +216,32 @@ func TestGenStream_HiddenText(t *testing.T) {
 	}
 }
 
+func TestGenStream_TextSoFar(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	ctx := context.Background()
+
+	if got := stream.TextSoFar(); got != "" {
+		t.Errorf("TextSoFar before text = %q, want empty", got)
+	}
+
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "Hello"})
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "thinking", Hidden: true})
+	stream.handleText(&MSEvent{Event: "seq_text", Text: ", world"})
+
+	// Buffered chunks count before they are read
+	if got := stream.TextSoFar(); got != "Hello, world" {
+		t.Errorf("TextSoFar = %q, want Hello, world", got)
+	}
+
+	stream.handleFinish(&MSEvent{Event: "seq_gen_finish", CID: "cid-1"})
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if got := stream.TextSoFar(); got != "Hello, world" {
+		t.Errorf("TextSoFar after reading = %q, want Hello, world", got)
+	}
+}
+
 func TestGenStream_TokenCounts(t *testing.T) {
 	stream := newGenStream(nil, "cid-1")
 	ctx := context.Background()
@@ -204,13 +269,37 @@ func TestGenStream_TokenCounts(t *testing.T) {
 	}
 }
 
+func TestGenStream_ChunkTokenCounts(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	ctx := context.Background()
+
+	go func() {
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "a", NumInputTokens: 10, NumOutputTokens: 1})
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "b", NumInputTokens: 10, NumOutputTokens: 2})
+		stream.handleFinish(&MSEvent{Event: "seq_gen_finish", CID: "cid-1"})
+	}()
+
+	var counts [][2]int
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		counts = append(counts, [2]int{chunk.NumInputTokens, chunk.NumOutputTokens})
+	}
+
+	want := [][2]int{{10, 1}, {10, 2}}
+	if !slices.Equal(counts, want) {
+		t.Errorf("token counts = %v, want %v", counts, want)
+	}
+}
+
 func TestGenStream_Close(t *testing.T) {
 	stream := newGenStream(nil, "cid-1")
 	ctx := context.Background()
 
 	go func() {
 		stream.handleText(&MSEvent{Event: "seq_text", Text: "test"})
-		stream.handleClose()
+		stream.handleClose(nil)
 	}()
 
 	_, err := stream.Text(ctx)
@@ -223,7 +312,60 @@ func TestGenStream_DoubleClose(t *testing.T) {
 	stream := newGenStream(nil, "cid-1")
 
 	// Should not panic
-	stream.handleClose()
-	stream.handleClose()
+	stream.handleClose(nil)
+	stream.handleClose(nil)
 	stream.handleFinish(&MSEvent{Event: "seq_gen_finish"})
 }
+
+func TestGenStream_OutputFilter(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	stream.filter = func(chunk *GenChunk) (*GenChunk, error) {
+		if chunk.Text == "drop" {
+			return nil, nil
+		}
+		chunk.Text = strings.ReplaceAll(chunk.Text, "secret", "[redacted]")
+		return chunk, nil
+	}
+	ctx := context.Background()
+
+	go func() {
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "the secret "})
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "drop"})
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "is out"})
+		stream.handleFinish(&MSEvent{Event: "seq_gen_finish", CID: "cid-1"})
+	}()
+
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "the [redacted] is out" {
+		t.Errorf("text = %s, want the [redacted] is out", text)
+	}
+}
+
+func TestGenStream_OutputFilter_Abort(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	errPolicy := errors.New("policy violation")
+	stream.filter = func(chunk *GenChunk) (*GenChunk, error) {
+		if strings.Contains(chunk.Text, "bad") {
+			return nil, errPolicy
+		}
+		return chunk, nil
+	}
+	ctx := context.Background()
+
+	go func() {
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "ok "})
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "bad"})
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "more"})
+	}()
+
+	text, err := stream.Text(ctx)
+	if !errors.Is(err, errPolicy) {
+		t.Fatalf("err = %v, want policy violation", err)
+	}
+	if text != "ok " {
+		t.Errorf("text = %s, want 'ok '", text)
+	}
+}
@@ -0,0 +1,46 @@
+package modelsocket
+
+import (
+	"context"
+	"strings"
+)
+
+// DefaultSummaryPrompt is the instruction [Seq.Summarize] gives the model
+// unless called with another.
+const DefaultSummaryPrompt = "Summarize the conversation so far for your own later reference. " +
+	"Keep names, facts, decisions and open questions; leave out pleasantries. " +
+	"Reply with the summary only."
+
+// Summarize returns a summary of the sequence's conversation, generated on a
+// fork of it so the sequence itself is left as it was: prompt, or
+// [DefaultSummaryPrompt] if empty, is appended to the fork as a user message,
+// the summary is generated as the assistant with opts, and the fork is
+// closed.
+func (s *Seq) Summarize(ctx context.Context, prompt string, opts ...GenOption) (string, error) {
+	fork, err := s.Fork(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { go fork.Close(fork.client.ctx) }()
+	return fork.summarize(ctx, prompt, opts...)
+}
+
+// summarize appends prompt, or DefaultSummaryPrompt if empty, to s and
+// generates the summary on it.
+func (s *Seq) summarize(ctx context.Context, prompt string, opts ...GenOption) (string, error) {
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	if err := s.Append(ctx, prompt, AsUser()); err != nil {
+		return "", err
+	}
+	stream, err := s.Generate(ctx, append([]GenOption{GenerateAsAssistant()}, opts...)...)
+	if err != nil {
+		return "", err
+	}
+	text, err := stream.Text(ctx)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
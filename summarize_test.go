@@ -0,0 +1,41 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSeq_Summarize(t *testing.T) {
+	ctx := context.Background()
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectFork().Forked("seq-2")
+	prompt := sc.ExpectAppend().Finish()
+	sc.ExpectGenerate().StreamText(" The user said hello. ").Finish()
+	closed := sc.ExpectClose().Finish()
+
+	seq, err := sc.Client().Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	summary, err := seq.Summarize(ctx, "")
+	if err != nil {
+		t.Fatalf("Summarize error: %v", err)
+	}
+	if summary != "The user said hello." {
+		t.Errorf("Summarize = %q, want the trimmed summary", summary)
+	}
+
+	// The prompt went to the fork, which is closed afterwards
+	req := prompt.Request(t)
+	if data := req.Data.(appendCommandData); req.SeqID != "seq-2" || data.Text != DefaultSummaryPrompt {
+		t.Errorf("append = %s %q, want the summary prompt on the fork", req.SeqID, data.Text)
+	}
+	if req := closed.Request(t); req.SeqID != "seq-2" {
+		t.Errorf("closed %s, want the fork", req.SeqID)
+	}
+	if len(seq.History()) != 0 {
+		t.Errorf("History = %+v, want the sequence left as it was", seq.History())
+	}
+}
@@ -0,0 +1,81 @@
+package modelsocket
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// ThrottledStream paces a [GenStream] to a steady token rate, returned by
+// [GenStream.Throttle].
+type ThrottledStream struct {
+	stream   *GenStream
+	perToken time.Duration
+	next     time.Time // When the next chunk may be returned
+}
+
+// Throttle returns a wrapper that delivers the stream's chunks at no more
+// than tokensPerSecond, smoothing bursty output for typewriter-style
+// rendering. Text without token IDs counts as one token. Once the generation
+// has finished, chunks still buffered are delivered without delay, so
+// pacing never holds up the end of a response. A rate of zero or less
+// disables pacing.
+//
+// The wrapper consumes the stream; read chunks from one or the other.
+func (g *GenStream) Throttle(tokensPerSecond float64) *ThrottledStream {
+	t := &ThrottledStream{stream: g}
+	if tokensPerSecond > 0 {
+		t.perToken = time.Duration(float64(time.Second) / tokensPerSecond)
+	}
+	return t
+}
+
+// Next returns the next chunk once its turn comes, or nil if done, as
+// [GenStream.Next].
+func (t *ThrottledStream) Next(ctx context.Context) (*GenChunk, error) {
+	chunk, err := t.stream.Next(ctx)
+	if chunk == nil || t.perToken == 0 {
+		return chunk, err
+	}
+
+	if wait := time.Until(t.next); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			chunk.Release()
+			return nil, ctx.Err()
+		case <-t.stream.done:
+			// The generation has finished, so flush what's buffered
+			return chunk, nil
+		case <-timer.C:
+		}
+	}
+
+	start := time.Now()
+	if t.next.After(start) {
+		start = t.next
+	}
+	t.next = start.Add(time.Duration(chunkTokens(chunk)) * t.perToken)
+	return chunk, nil
+}
+
+// Chunks returns an iterator over the paced chunks, as [GenStream.Chunks].
+func (t *ThrottledStream) Chunks(ctx context.Context) iter.Seq2[*GenChunk, error] {
+	return func(yield func(*GenChunk, error) bool) {
+		for {
+			chunk, err := t.Next(ctx)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if chunk == nil {
+				return
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGenStream_Throttle(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	ctx := context.Background()
+
+	for _, text := range []string{"a", "b", "c"} {
+		stream.handleText(&MSEvent{Event: "seq_text", Text: text})
+	}
+
+	// 20ms per token: the first chunk is immediate, the rest are paced
+	throttled := stream.Throttle(50)
+	start := time.Now()
+	for range 3 {
+		if chunk, err := throttled.Next(ctx); chunk == nil || err != nil {
+			t.Fatalf("Next = %v, %v, want a chunk", chunk, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 chunks took %v, want at least 40ms", elapsed)
+	}
+
+	stream.handleFinish(&MSEvent{Event: "seq_gen_finish", CID: "cid-1"})
+	if chunk, err := throttled.Next(ctx); chunk != nil || err != nil {
+		t.Errorf("Next after finish = %v, %v, want nil, nil", chunk, err)
+	}
+}
+
+func TestGenStream_ThrottleFlushesOnFinish(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	ctx := context.Background()
+
+	for _, text := range []string{"a", "b", "c"} {
+		stream.handleText(&MSEvent{Event: "seq_text", Text: text})
+	}
+
+	// One token a second would take two seconds to deliver the rest
+	throttled := stream.Throttle(1)
+	if _, err := throttled.Next(ctx); err != nil {
+		t.Fatalf("Next error: %v", err)
+	}
+	stream.handleFinish(&MSEvent{Event: "seq_gen_finish", CID: "cid-1"})
+
+	start := time.Now()
+	var text string
+	for chunk, err := range throttled.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		text += chunk.Text
+	}
+	if text != "bc" {
+		t.Errorf("text = %q, want bc", text)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("flush took %v, want no pacing", elapsed)
+	}
+}
+
+func TestGenStream_ThrottleContextCancel(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "a"})
+	stream.handleText(&MSEvent{Event: "seq_text", Text: "b"})
+
+	throttled := stream.Throttle(1)
+	if _, err := throttled.Next(context.Background()); err != nil {
+		t.Fatalf("Next error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := throttled.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Next error = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,129 @@
+package modelsocket
+
+import (
+	"slices"
+	"time"
+)
+
+// GenTimings reports latency measurements for a generation. Durations are
+// measured from when the generate request was sent; values that haven't been
+// observed yet are zero.
+type GenTimings struct {
+	// Queue is the time until the server sent the first event for the
+	// generation, including state changes.
+	Queue time.Duration
+
+	// FirstToken is the time until the first text chunk (TTFT).
+	FirstToken time.Duration
+
+	// Total is the time until the generation finished.
+	Total time.Duration
+
+	// InterToken summarizes the gaps between consecutive text chunks.
+	InterToken LatencyStats
+}
+
+// LatencyStats summarizes a set of latency samples.
+type LatencyStats struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	Max   time.Duration
+}
+
+// newLatencyStats computes summary statistics for samples.
+func newLatencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+
+	return LatencyStats{
+		Count: len(sorted),
+		Mean:  sum / time.Duration(len(sorted)),
+		P50:   percentile(sorted, 50),
+		P95:   percentile(sorted, 95),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the p-th percentile of sorted samples using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// genTimer records the timestamps behind GenTimings. It is guarded by the
+// owning stream's mutex.
+type genTimer struct {
+	now        func() time.Time
+	sent       time.Time
+	firstEvent time.Time
+	firstText  time.Time
+	lastText   time.Time
+	finished   time.Time
+	gaps       []time.Duration
+}
+
+func newGenTimer() genTimer {
+	return genTimer{now: time.Now, sent: time.Now()}
+}
+
+// markSent records when the request was sent.
+func (t *genTimer) markSent() {
+	t.sent = t.now()
+}
+
+// markEvent records that an event arrived for the generation.
+func (t *genTimer) markEvent() time.Time {
+	now := t.now()
+	if t.firstEvent.IsZero() {
+		t.firstEvent = now
+	}
+	return now
+}
+
+// markText records a text chunk.
+func (t *genTimer) markText() {
+	now := t.markEvent()
+	if t.firstText.IsZero() {
+		t.firstText = now
+	} else {
+		t.gaps = append(t.gaps, now.Sub(t.lastText))
+	}
+	t.lastText = now
+}
+
+// markFinished records the end of the generation.
+func (t *genTimer) markFinished() {
+	t.finished = t.markEvent()
+}
+
+// timings returns the measurements recorded so far.
+func (t *genTimer) timings() GenTimings {
+	since := func(ts time.Time) time.Duration {
+		if ts.IsZero() {
+			return 0
+		}
+		return ts.Sub(t.sent)
+	}
+
+	return GenTimings{
+		Queue:      since(t.firstEvent),
+		FirstToken: since(t.firstText),
+		Total:      since(t.finished),
+		InterToken: newLatencyStats(t.gaps),
+	}
+}
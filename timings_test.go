@@ -0,0 +1,75 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	var samples []time.Duration
+	for i := 20; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	stats := newLatencyStats(samples)
+	if stats.Count != 20 {
+		t.Errorf("Count = %d, want 20", stats.Count)
+	}
+	if stats.Mean != 10500*time.Microsecond {
+		t.Errorf("Mean = %v, want 10.5ms", stats.Mean)
+	}
+	if stats.P50 != 10*time.Millisecond {
+		t.Errorf("P50 = %v, want 10ms", stats.P50)
+	}
+	if stats.P95 != 19*time.Millisecond {
+		t.Errorf("P95 = %v, want 19ms", stats.P95)
+	}
+	if stats.Max != 20*time.Millisecond {
+		t.Errorf("Max = %v, want 20ms", stats.Max)
+	}
+
+	if empty := newLatencyStats(nil); empty != (LatencyStats{}) {
+		t.Errorf("newLatencyStats(nil) = %+v, want zero", empty)
+	}
+}
+
+func TestGenStream_Timings(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	ctx := context.Background()
+
+	// Each clock reading advances 10ms
+	base := time.Now()
+	ticks := 0
+	stream.timer.now = func() time.Time {
+		ticks++
+		return base.Add(time.Duration(ticks) * 10 * time.Millisecond)
+	}
+	stream.markSent()  // 10ms
+	stream.markEvent() // 20ms: seq_state
+
+	go func() {
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "a"})            // 30ms
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "b"})            // 40ms
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "c"})            // 50ms
+		stream.handleFinish(&MSEvent{Event: "seq_gen_finish", CID: "cid-1"}) // 60ms
+	}()
+
+	if _, err := stream.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+
+	timings := stream.Timings()
+	if timings.Queue != 10*time.Millisecond {
+		t.Errorf("Queue = %v, want 10ms", timings.Queue)
+	}
+	if timings.FirstToken != 20*time.Millisecond {
+		t.Errorf("FirstToken = %v, want 20ms", timings.FirstToken)
+	}
+	if timings.Total != 50*time.Millisecond {
+		t.Errorf("Total = %v, want 50ms", timings.Total)
+	}
+	if timings.InterToken.Count != 2 || timings.InterToken.Mean != 10*time.Millisecond {
+		t.Errorf("InterToken = %+v, want 2 gaps of 10ms", timings.InterToken)
+	}
+}
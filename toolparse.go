@@ -0,0 +1,279 @@
+package modelsocket
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ToolCallParser extracts tool calls embedded in generated text. It is used
+// for models and servers that write tool calls into the text stream instead
+// of emitting seq_tool_call events.
+//
+// A parser is created per generation and fed text in arrival order. Parse
+// returns the text that is safe to deliver and any tool calls completed by
+// the fragment; text that may be the start of a tool call is held back until
+// it can be classified. Flush is called when generation finishes and returns
+// anything still held back.
+type ToolCallParser interface {
+	Parse(text string) (string, []ToolCall)
+	Flush() (string, []ToolCall)
+}
+
+const (
+	toolCallOpenTag  = "<tool_call>"
+	toolCallCloseTag = "</tool_call>"
+	jsonFenceOpen    = "```json"
+	jsonFenceClose   = "```"
+)
+
+type textParseMode int
+
+const (
+	parseText textParseMode = iota
+	parseTag
+	parseFence
+	parseJSON
+)
+
+// textToolCallParser recognizes <tool_call> tags, ```json fenced blocks and
+// bare JSON objects that start a line.
+type textToolCallParser struct {
+	buf       string
+	mode      textParseMode
+	lineStart bool
+}
+
+// NewTextToolCallParser returns a parser that recognizes the common ways
+// models write tool calls as text: <tool_call>...</tool_call> tags, ```json
+// fenced blocks, and bare JSON objects at the start of a line. A block is
+// treated as a tool call when it decodes to an object (or array of objects)
+// with a "name" and "arguments" or "parameters" field; anything else is
+// passed through as text.
+//
+// It has the signature expected by [WithToolCallParser].
+func NewTextToolCallParser() ToolCallParser {
+	return &textToolCallParser{lineStart: true}
+}
+
+// Parse consumes a fragment of generated text.
+func (p *textToolCallParser) Parse(text string) (string, []ToolCall) {
+	p.buf += text
+
+	var out strings.Builder
+	var calls []ToolCall
+	for {
+		var progressed bool
+		if p.mode == parseText {
+			progressed = p.scanText(&out)
+		} else {
+			var found []ToolCall
+			found, progressed = p.scanBlock(&out)
+			calls = append(calls, found...)
+		}
+		if !progressed {
+			break
+		}
+	}
+	return out.String(), calls
+}
+
+// Flush returns any held back text. Unterminated blocks are returned as text.
+func (p *textToolCallParser) Flush() (string, []ToolCall) {
+	text := p.buf
+	p.buf = ""
+	p.mode = parseText
+	p.lineStart = true
+	return text, nil
+}
+
+// scanText emits text up to the next block marker and switches mode. It
+// reports whether a marker was found.
+func (p *textToolCallParser) scanText(out *strings.Builder) bool {
+	idx, mode := -1, parseText
+	if i := strings.Index(p.buf, toolCallOpenTag); i >= 0 {
+		idx, mode = i, parseTag
+	}
+	if i := strings.Index(p.buf, jsonFenceOpen); i >= 0 && (idx < 0 || i < idx) {
+		idx, mode = i, parseFence
+	}
+	if i := p.lineStartBrace(); i >= 0 && (idx < 0 || i < idx) {
+		idx, mode = i, parseJSON
+	}
+
+	if idx < 0 {
+		hold := max(partialSuffix(p.buf, toolCallOpenTag), partialSuffix(p.buf, jsonFenceOpen))
+		p.emit(out, p.buf[:len(p.buf)-hold])
+		p.buf = p.buf[len(p.buf)-hold:]
+		return false
+	}
+
+	p.emit(out, p.buf[:idx])
+	p.buf = p.buf[idx:]
+	p.mode = mode
+	return true
+}
+
+// scanBlock tries to complete the current block. It reports whether the
+// block was terminated, whether or not it held tool calls.
+func (p *textToolCallParser) scanBlock(out *strings.Builder) ([]ToolCall, bool) {
+	var body, raw string
+
+	switch p.mode {
+	case parseTag, parseFence:
+		open, closing := toolCallOpenTag, toolCallCloseTag
+		if p.mode == parseFence {
+			open, closing = jsonFenceOpen, jsonFenceClose
+		}
+		end := strings.Index(p.buf[len(open):], closing)
+		if end < 0 {
+			return nil, false
+		}
+		body = p.buf[len(open) : len(open)+end]
+		raw = p.buf[:len(open)+end+len(closing)]
+	case parseJSON:
+		// A JSON object's first token is a quoted key; anything else is prose.
+		rest := strings.TrimLeft(p.buf[1:], " \t\r\n")
+		if rest != "" && rest[0] != '"' && rest[0] != '}' {
+			p.mode = parseText
+			p.emit(out, p.buf[:1])
+			p.buf = p.buf[1:]
+			return nil, true
+		}
+		end := jsonObjectEnd(p.buf)
+		if end < 0 {
+			return nil, false
+		}
+		body = p.buf[:end]
+		raw = body
+	}
+
+	p.buf = p.buf[len(raw):]
+	p.mode = parseText
+
+	calls, ok := parseToolCallJSON(body)
+	if !ok {
+		p.emit(out, raw)
+		return nil, true
+	}
+	return calls, true
+}
+
+// emit writes text to out and tracks whether the next character starts a line.
+func (p *textToolCallParser) emit(out *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	out.WriteString(text)
+
+	tail := text
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		tail = text[i+1:]
+		p.lineStart = true
+	}
+	p.lineStart = p.lineStart && strings.TrimLeft(tail, " \t") == ""
+}
+
+// lineStartBrace returns the index of the first '{' in the buffer that is
+// the first non-blank character on its line, or -1.
+func (p *textToolCallParser) lineStartBrace() int {
+	atStart := p.lineStart
+	for i := 0; i < len(p.buf); i++ {
+		switch c := p.buf[i]; {
+		case c == '\n':
+			atStart = true
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '{' && atStart:
+			return i
+		default:
+			atStart = false
+		}
+	}
+	return -1
+}
+
+// partialSuffix returns the length of the longest suffix of s that is a
+// proper prefix of marker.
+func partialSuffix(s, marker string) int {
+	for n := min(len(s), len(marker)-1); n > 0; n-- {
+		if strings.HasSuffix(s, marker[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// jsonObjectEnd returns the index just past the object that opens s, or -1
+// if the object is not yet complete.
+func jsonObjectEnd(s string) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// parseToolCallJSON decodes a tool call object or array of tool call objects.
+func parseToolCallJSON(body string) ([]ToolCall, bool) {
+	body = strings.TrimSpace(body)
+
+	var raws []json.RawMessage
+	if strings.HasPrefix(body, "[") {
+		if err := json.Unmarshal([]byte(body), &raws); err != nil || len(raws) == 0 {
+			return nil, false
+		}
+	} else {
+		raws = []json.RawMessage{json.RawMessage(body)}
+	}
+
+	calls := make([]ToolCall, 0, len(raws))
+	for _, raw := range raws {
+		var obj struct {
+			Name       string          `json:"name"`
+			Arguments  json.RawMessage `json:"arguments"`
+			Parameters json.RawMessage `json:"parameters"`
+		}
+		if err := json.Unmarshal(raw, &obj); err != nil || obj.Name == "" {
+			return nil, false
+		}
+
+		args := obj.Arguments
+		if args == nil {
+			args = obj.Parameters
+		}
+		if args == nil {
+			return nil, false
+		}
+
+		// Some models string-encode the arguments object.
+		var encoded string
+		if err := json.Unmarshal(args, &encoded); err == nil {
+			args = json.RawMessage(encoded)
+		}
+
+		calls = append(calls, ToolCall{Name: obj.Name, Args: string(args)})
+	}
+	return calls, true
+}
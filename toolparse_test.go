@@ -0,0 +1,136 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+)
+
+// parseAll feeds fragments through a fresh parser and collects the output.
+func parseAll(fragments ...string) (string, []ToolCall) {
+	p := NewTextToolCallParser()
+	var text string
+	var calls []ToolCall
+	for _, f := range fragments {
+		t, c := p.Parse(f)
+		text += t
+		calls = append(calls, c...)
+	}
+	t, c := p.Flush()
+	return text + t, append(calls, c...)
+}
+
+func TestTextToolCallParser_Tag(t *testing.T) {
+	text, calls := parseAll(
+		"Let me check. <tool",
+		`_call>{"name": "get_weather", "arguments": {"city": "NYC"}}</tool`,
+		"_call> Done.",
+	)
+
+	if text != "Let me check.  Done." {
+		t.Errorf("text = %q, want %q", text, "Let me check.  Done.")
+	}
+	if len(calls) != 1 {
+		t.Fatalf("len(calls) = %d, want 1", len(calls))
+	}
+	if calls[0].Name != "get_weather" {
+		t.Errorf("Name = %s, want get_weather", calls[0].Name)
+	}
+	if calls[0].Args != `{"city": "NYC"}` {
+		t.Errorf("Args = %s, want {\"city\": \"NYC\"}", calls[0].Args)
+	}
+}
+
+func TestTextToolCallParser_Fence(t *testing.T) {
+	text, calls := parseAll(
+		"Calling:\n```js",
+		"on\n[{\"name\": \"a\", \"parameters\": {}}, {\"name\": \"b\", \"arguments\": \"{\\\"x\\\":1}\"}]\n``",
+		"`",
+	)
+
+	if text != "Calling:\n" {
+		t.Errorf("text = %q, want %q", text, "Calling:\n")
+	}
+	if len(calls) != 2 {
+		t.Fatalf("len(calls) = %d, want 2", len(calls))
+	}
+	if calls[0].Name != "a" || calls[0].Args != "{}" {
+		t.Errorf("calls[0] = %+v, want {a {}}", calls[0])
+	}
+	if calls[1].Name != "b" || calls[1].Args != `{"x":1}` {
+		t.Errorf("calls[1] = %+v, want {b {\"x\":1}}", calls[1])
+	}
+}
+
+func TestTextToolCallParser_BareJSON(t *testing.T) {
+	text, calls := parseAll(`{"name": "lookup", "parameters": {"q": "a}b"`, `}}`)
+
+	if text != "" {
+		t.Errorf("text = %q, want empty", text)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("len(calls) = %d, want 1", len(calls))
+	}
+	if calls[0].Args != `{"q": "a}b"}` {
+		t.Errorf("Args = %s", calls[0].Args)
+	}
+}
+
+func TestTextToolCallParser_PassThrough(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+	}{
+		{"plain", []string{"Hello ", "world!"}},
+		{"mid-line brace", []string{"use {name} here"}},
+		{"prose brace", []string{"{ not json }\nok"}},
+		{"non-tool json", []string{"```json\n{\"a\": 1}\n```"}},
+		{"unterminated tag", []string{"<tool_call>{\"name\":"}},
+		{"partial marker", []string{"a <tool"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want string
+			for _, f := range tt.input {
+				want += f
+			}
+			text, calls := parseAll(tt.input...)
+			if text != want {
+				t.Errorf("text = %q, want %q", text, want)
+			}
+			if len(calls) != 0 {
+				t.Errorf("len(calls) = %d, want 0", len(calls))
+			}
+		})
+	}
+}
+
+func TestGenStream_ToolCallParser(t *testing.T) {
+	stream := newGenStream(nil, "cid-1")
+	stream.parser = NewTextToolCallParser()
+	ctx := context.Background()
+
+	go func() {
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "Sure.\n"})
+		stream.handleText(&MSEvent{Event: "seq_text", Text: `<tool_call>{"name": "t", "arguments": {}}`})
+		stream.handleText(&MSEvent{Event: "seq_text", Text: "</tool_call>\n<to"})
+		stream.handleFinish(&MSEvent{Event: "seq_gen_finish", CID: "cid-1"})
+	}()
+
+	var text string
+	var calls []ToolCall
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		text += chunk.Text
+		calls = append(calls, chunk.ToolCalls...)
+	}
+
+	if text != "Sure.\n\n<to" {
+		t.Errorf("text = %q, want %q", text, "Sure.\n\n<to")
+	}
+	if len(calls) != 1 || calls[0].Name != "t" {
+		t.Errorf("calls = %+v, want one call to t", calls)
+	}
+}
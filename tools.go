@@ -3,7 +3,10 @@ package modelsocket
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -40,6 +43,13 @@ type Toolbox struct {
 	tools                map[string]Tool
 	toolInstructions     string
 	toolDefinitionPrompt string
+
+	repairArgs    bool
+	onInvalidArgs func(call ToolCall, err error) string
+	contextValues func(ctx context.Context) context.Context
+
+	callStore ToolCallStore
+	callKey   func(ctx context.Context, call ToolCall) string
 }
 
 // NewToolbox creates an empty toolbox.
@@ -67,20 +77,159 @@ func (t *Toolbox) Get(name string) (Tool, bool) {
 
 // Call executes a tool by name with the given arguments.
 func (t *Toolbox) Call(ctx context.Context, name string, args string) (string, error) {
-	tool, ok := t.Get(name)
+	return t.Freeze().Call(ctx, name, args)
+}
+
+// CallTools executes multiple tool calls and returns results.
+func (t *Toolbox) CallTools(ctx context.Context, calls []ToolCall) ([]ToolResult, error) {
+	return t.Freeze().CallTools(ctx, calls)
+}
+
+// Definitions returns all tool definitions, sorted by name.
+func (t *Toolbox) Definitions() []ToolDefinition {
+	return t.Freeze().Definitions()
+}
+
+// SetArgRepair enables best-effort repair of malformed JSON arguments before
+// tools are called (see [RepairJSON]). Arguments that cannot be repaired fail
+// with a [ToolArgsError] instead of reaching the tool.
+func (t *Toolbox) SetArgRepair(enabled bool) {
+	t.mu.Lock()
+	t.repairArgs = enabled
+	t.mu.Unlock()
+}
+
+// SetOnInvalidArgs sets the hook that builds the result returned to the model
+// by CallTools when a call's arguments cannot be repaired. The default is
+// [DefaultInvalidArgsResult], which asks the model to re-emit the call. The
+// text is sent as the call's tool result rather than a hidden turn.
+func (t *Toolbox) SetOnInvalidArgs(fn func(call ToolCall, err error) string) {
+	t.mu.Lock()
+	t.onInvalidArgs = fn
+	t.mu.Unlock()
+}
+
+// SetContextValues sets a function that derives the context passed to tool
+// handlers from the caller's context, e.g. to attach a user ID, auth token or
+// tracing span. Pair it with [GenStream.Context] to run tools with the values
+// of the Generate call that produced them.
+func (t *Toolbox) SetContextValues(fn func(ctx context.Context) context.Context) {
+	t.mu.Lock()
+	t.contextValues = fn
+	t.mu.Unlock()
+}
+
+// SetToolInstructions sets the tool prompt sent to the server when a
+// sequence opens.
+func (t *Toolbox) SetToolInstructions(instructions string) {
+	t.mu.Lock()
+	t.toolInstructions = instructions
+	t.mu.Unlock()
+}
+
+// ToolInstructions returns the tool instructions.
+func (t *Toolbox) ToolInstructions() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.toolInstructions
+}
+
+// SetToolDefinitionPrompt replaces the generated prompt describing the tools.
+func (t *Toolbox) SetToolDefinitionPrompt(prompt string) {
+	t.mu.Lock()
+	t.toolDefinitionPrompt = prompt
+	t.mu.Unlock()
+}
+
+// ToolDefinitionPrompt returns the tool prompt. If a custom prompt was set
+// via SetToolDefinitionPrompt, it returns that; otherwise it returns an
+// auto-generated prompt describing all tools.
+func (t *Toolbox) ToolDefinitionPrompt() string {
+	return t.Freeze().ToolDefinitionPrompt()
+}
+
+// Freeze returns a snapshot of the toolbox. Tools and settings added to the
+// toolbox later don't affect the snapshot, so a sequence's prompts and
+// dispatch stay consistent while a shared toolbox is changed.
+func (t *Toolbox) Freeze() ToolSet {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	tools := make(map[string]Tool, len(t.tools))
+	for name, tool := range t.tools {
+		tools[name] = tool
+	}
+
+	return ToolSet{
+		tools:                tools,
+		toolInstructions:     t.toolInstructions,
+		toolDefinitionPrompt: t.toolDefinitionPrompt,
+		repairArgs:           t.repairArgs,
+		onInvalidArgs:        t.onInvalidArgs,
+		contextValues:        t.contextValues,
+		callStore:            t.callStore,
+		callKey:              t.callKey,
+	}
+}
+
+// ToolSet is an immutable snapshot of a [Toolbox], made with
+// [Toolbox.Freeze]. It is safe for concurrent use. The zero value has no
+// tools.
+type ToolSet struct {
+	tools                map[string]Tool
+	toolInstructions     string
+	toolDefinitionPrompt string
+
+	repairArgs    bool
+	onInvalidArgs func(call ToolCall, err error) string
+	contextValues func(ctx context.Context) context.Context
+
+	callStore ToolCallStore
+	callKey   func(ctx context.Context, call ToolCall) string
+}
+
+// Get retrieves a tool by name.
+func (s ToolSet) Get(name string) (Tool, bool) {
+	tool, ok := s.tools[name]
+	return tool, ok
+}
+
+// Call executes a tool by name with the given arguments.
+func (s ToolSet) Call(ctx context.Context, name string, args string) (string, error) {
+	tool, ok := s.Get(name)
 	if !ok {
 		return "", fmt.Errorf("%w: %s", ErrToolNotFound, name)
 	}
+
+	if s.repairArgs && strings.TrimSpace(args) != "" {
+		repaired, err := RepairJSON(args)
+		if err != nil {
+			return "", &ToolArgsError{Name: name, Args: args, Err: err}
+		}
+		args = repaired
+	}
+
+	if s.contextValues != nil {
+		ctx = s.contextValues(ctx)
+	}
+
+	if s.callStore != nil && isSideEffecting(tool) {
+		return s.callOnce(ctx, tool, ToolCall{Name: name, Args: args})
+	}
 	return tool.Call(ctx, args)
 }
 
 // CallTools executes multiple tool calls and returns results.
-func (t *Toolbox) CallTools(ctx context.Context, calls []ToolCall) ([]ToolResult, error) {
+func (s ToolSet) CallTools(ctx context.Context, calls []ToolCall) ([]ToolResult, error) {
 	results := make([]ToolResult, 0, len(calls))
 
 	for _, call := range calls {
-		result, err := t.Call(ctx, call.Name, call.Args)
-		if err != nil {
+		result, err := s.Call(ctx, call.Name, call.Args)
+		var argsErr *ToolArgsError
+		if errors.As(err, &argsErr) {
+			// Ask the model to re-emit the call
+			result = s.invalidArgsResult(call, err)
+		} else if err != nil {
 			// Return error as result instead of failing
 			result = fmt.Sprintf("error: %v", err)
 		}
@@ -93,46 +242,49 @@ func (t *Toolbox) CallTools(ctx context.Context, calls []ToolCall) ([]ToolResult
 	return results, nil
 }
 
-// Definitions returns all tool definitions.
-func (t *Toolbox) Definitions() []ToolDefinition {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
+// Definitions returns all tool definitions, sorted by name.
+func (s ToolSet) Definitions() []ToolDefinition {
+	names := make([]string, 0, len(s.tools))
+	for name := range s.tools {
+		names = append(names, name)
+	}
+	slices.Sort(names)
 
-	defs := make([]ToolDefinition, 0, len(t.tools))
-	for _, tool := range t.tools {
-		defs = append(defs, tool.Definition())
+	defs := make([]ToolDefinition, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, s.tools[name].Definition())
 	}
 	return defs
 }
 
-func (t *Toolbox) SetToolInstructions(instructions string) {
-	t.toolInstructions = instructions
-}
-
 // ToolInstructions returns the tool instructions.
-func (t *Toolbox) ToolInstructions() string {
-	return t.toolInstructions
+func (s ToolSet) ToolInstructions() string {
+	return s.toolInstructions
 }
 
-func (t *Toolbox) SetToolDefinitionPrompt(prompt string) {
-	t.toolDefinitionPrompt = prompt
-}
-
-// ToolPrompt returns the tool prompt. If a custom prompt was set via SetToolPrompt,
-// it returns that; otherwise it returns an auto-generated prompt describing all tools.
-func (t *Toolbox) ToolDefinitionPrompt() string {
-	if t.toolDefinitionPrompt != "" {
-		return t.toolDefinitionPrompt
+// ToolDefinitionPrompt returns the tool prompt, as
+// [Toolbox.ToolDefinitionPrompt].
+func (s ToolSet) ToolDefinitionPrompt() string {
+	if s.toolDefinitionPrompt != "" {
+		return s.toolDefinitionPrompt
 	}
 
-	defs := t.Definitions()
+	defs := s.Definitions()
 	if len(defs) == 0 {
 		return ""
 	}
 
 	data, _ := json.MarshalIndent(defs, "", "  ")
 	return fmt.Sprintf("You have access to the following tools:\n\n%s\n\nTo use a tool, respond with a tool call in the appropriate format.", string(data))
+}
 
+// invalidArgsResult returns the tool result for a call with invalid arguments.
+func (s ToolSet) invalidArgsResult(call ToolCall, err error) string {
+	fn := s.onInvalidArgs
+	if fn == nil {
+		fn = DefaultInvalidArgsResult
+	}
+	return fn(call, err)
 }
 
 // FuncTool wraps a function as a Tool.
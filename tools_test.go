@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -313,3 +315,80 @@ func TestToolDefinition_JSON(t *testing.T) {
 		t.Errorf("len(Required) = %d, want 1", len(parsed.Parameters.Required))
 	}
 }
+
+type testCtxKey struct{}
+
+func TestToolbox_SetContextValues(t *testing.T) {
+	tb := NewToolbox()
+	tb.SetContextValues(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, testCtxKey{}, "user-1")
+	})
+
+	tb.Add(NewFuncTool(
+		ToolDefinition{Name: "whoami"},
+		func(ctx context.Context, args string) (string, error) {
+			user, _ := ctx.Value(testCtxKey{}).(string)
+			return user, nil
+		},
+	))
+
+	result, err := tb.Call(context.Background(), "whoami", "")
+	if err != nil {
+		t.Fatalf("Call error: %v", err)
+	}
+	if result != "user-1" {
+		t.Errorf("result = %s, want user-1", result)
+	}
+}
+
+func TestToolbox_Freeze(t *testing.T) {
+	tb := NewToolbox()
+	tb.Add(NewFuncTool(ToolDefinition{Name: "first"}, func(ctx context.Context, args string) (string, error) {
+		return "first", nil
+	}))
+	tb.SetToolInstructions("before")
+
+	set := tb.Freeze()
+
+	// Changes to the toolbox don't reach the snapshot
+	tb.Add(NewFuncTool(ToolDefinition{Name: "second"}, func(ctx context.Context, args string) (string, error) {
+		return "second", nil
+	}))
+	tb.SetToolInstructions("after")
+
+	if _, ok := set.Get("second"); ok {
+		t.Error("snapshot has a tool added after Freeze")
+	}
+	if got := set.ToolInstructions(); got != "before" {
+		t.Errorf("ToolInstructions() = %q, want before", got)
+	}
+	if result, err := set.Call(context.Background(), "first", "{}"); err != nil || result != "first" {
+		t.Errorf("Call = %q, %v, want first", result, err)
+	}
+	if defs := tb.Definitions(); len(defs) != 2 || defs[0].Name != "first" || defs[1].Name != "second" {
+		t.Errorf("Definitions() = %+v, want first and second in order", defs)
+	}
+}
+
+func TestToolbox_FreezeConcurrent(t *testing.T) {
+	tb := NewToolbox()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			tb.Add(NewFuncTool(ToolDefinition{Name: fmt.Sprintf("tool-%d", i)}, nil))
+			tb.SetToolInstructions(fmt.Sprintf("instructions %d", i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			set := tb.Freeze()
+			_ = set.ToolDefinitionPrompt()
+			_ = tb.ToolInstructions()
+		}
+	}()
+	wg.Wait()
+}
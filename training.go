@@ -0,0 +1,221 @@
+package modelsocket
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// TrainingRecord is a generation captured by [WithTrainingCapture]: the
+// context it was generated from, what the model produced, and the ratings
+// given to it. As JSON it is a line of a chat fine-tuning dataset: the
+// prompt and completion are "messages" in the OpenAI format, tool calls and
+// results included, next to the record's metadata.
+type TrainingRecord struct {
+	ID    string // CID of the generation
+	Time  time.Time
+	SeqID string
+	Model string
+
+	// Prompt is the conversation before the generation, without hidden
+	// messages.
+	Prompt     []Message
+	Completion Message
+
+	// Ratings are the ratings given with [Seq.Rate] before the sequence
+	// closed.
+	Ratings []Rating
+
+	Tags map[string]string
+}
+
+// MarshalJSON writes the record in the fine-tuning schema.
+func (r TrainingRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID       string            `json:"id"`
+		Time     time.Time         `json:"time"`
+		SeqID    string            `json:"seq_id"`
+		Model    string            `json:"model"`
+		Messages []openAIMessage   `json:"messages"`
+		Ratings  []Rating          `json:"ratings,omitempty"`
+		Tags     map[string]string `json:"tags,omitempty"`
+	}{
+		ID:       r.ID,
+		Time:     r.Time,
+		SeqID:    r.SeqID,
+		Model:    r.Model,
+		Messages: openAIMessages(append(append([]Message(nil), r.Prompt...), r.Completion)),
+		Ratings:  r.Ratings,
+		Tags:     r.Tags,
+	})
+}
+
+// Rating is feedback on a generation, such as a user's thumbs up.
+type Rating struct {
+	Score   float64 `json:"score"`
+	Label   string  `json:"label,omitempty"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+// TrainingSink receives training records. WriteTraining is called from
+// multiple goroutines as sequences close.
+type TrainingSink interface {
+	WriteTraining(rec TrainingRecord) error
+}
+
+// TrainingSinkFunc adapts a function to a [TrainingSink].
+type TrainingSinkFunc func(rec TrainingRecord) error
+
+func (f TrainingSinkFunc) WriteTraining(rec TrainingRecord) error {
+	return f(rec)
+}
+
+// jsonTrainingSink writes records as JSON lines.
+type jsonTrainingSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONTrainingSink returns a sink writing each record as a line of JSON
+// to w. Writes are serialized, so w need not be safe for concurrent use.
+func NewJSONTrainingSink(w io.Writer) TrainingSink {
+	return &jsonTrainingSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonTrainingSink) WriteTraining(rec TrainingRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(rec)
+}
+
+// TrainingPolicy configures [WithTrainingCapture].
+type TrainingPolicy struct {
+	// SampleRate is the share of sequences captured, from 0 to 1. Every
+	// generation of a sampled sequence is captured, so conversations are
+	// kept whole. Zero captures every sequence.
+	SampleRate float64
+
+	// Redaction redacts the text and tool fields of captured messages, as
+	// it does audit records.
+	Redaction AuditPolicy
+}
+
+// training is the client's training capture configuration.
+type training struct {
+	sink   TrainingSink
+	policy TrainingPolicy
+}
+
+// sample reports whether a new sequence is captured.
+func (t *training) sample() bool {
+	rate := t.policy.SampleRate
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// redact returns msg with the policy's redactions applied.
+func (t *training) redact(msg Message) Message {
+	p := &t.policy.Redaction
+	text := p.Text
+	if r, ok := p.TextByRole[msg.Role]; ok {
+		text = r
+	}
+	redact(&msg.Text, text)
+
+	msg.ToolCalls = append([]ToolCall(nil), msg.ToolCalls...)
+	for i := range msg.ToolCalls {
+		redact(&msg.ToolCalls[i].Name, p.ToolNames)
+		redact(&msg.ToolCalls[i].Args, p.ToolArgs)
+	}
+	if len(msg.ToolResults) > 0 {
+		results := append([]ToolResult(nil), msg.ToolResults...)
+		for i := range results {
+			redact(&results[i].Name, p.ToolNames)
+			redact(&results[i].Result, p.ToolResults)
+		}
+		// The text of tool messages is the results
+		msg.Text = toolResultsMessage(results).Text
+		msg.ToolResults = results
+	}
+	return msg
+}
+
+// Rate attaches a rating to the sequence's latest generation, for the
+// training records written by [WithTrainingCapture] when the sequence
+// closes. It does nothing if the sequence isn't captured, and fails with
+// ErrInvalidState before any generation has finished.
+func (s *Seq) Rate(rating Rating) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSeqClosed
+	}
+	if !s.capture {
+		return nil
+	}
+	if len(s.captured) == 0 {
+		return ErrInvalidState
+	}
+	rec := s.captured[len(s.captured)-1]
+	rec.Ratings = append(rec.Ratings, rating)
+	return nil
+}
+
+// captureGeneration holds a finished generation's training record until
+// the sequence closes. Called before msg is recorded in the history.
+func (s *Seq) captureGeneration(cid string, msg Message) {
+	if !s.capture || (msg.Text == "" && len(msg.ToolCalls) == 0) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prompt []Message
+	for _, m := range s.history {
+		if !m.Hidden {
+			prompt = append(prompt, m)
+		}
+	}
+	s.captured = append(s.captured, &TrainingRecord{
+		ID:         cid,
+		Time:       time.Now(),
+		SeqID:      s.id,
+		Model:      s.model,
+		Prompt:     prompt,
+		Completion: msg,
+	})
+}
+
+// flushTraining redacts and writes the sequence's captured records. Sink
+// failures are logged and never interrupt the client.
+func (s *Seq) flushTraining() {
+	t := s.client.cfg.training
+	if !s.capture || t == nil {
+		return
+	}
+
+	s.mu.Lock()
+	captured := s.captured
+	s.captured = nil
+	s.mu.Unlock()
+
+	tags := s.Tags()
+	for _, rec := range captured {
+		for i, msg := range rec.Prompt {
+			rec.Prompt[i] = t.redact(msg)
+		}
+		rec.Completion = t.redact(rec.Completion)
+		rec.Tags = tags
+
+		if err := t.sink.WriteTraining(*rec); err != nil {
+			s.client.log(slog.LevelWarn, "", "training write failed",
+				slog.String(logKeySeqID, s.id),
+				slog.Any(logKeyError, err),
+			)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package modelsocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWithTrainingCapture(t *testing.T) {
+	ctx := context.Background()
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	sc.ExpectAppend().Finish()
+	sc.ExpectGenerate().StreamText("Checking.").ThenToolCall("get_weather", `{"city":"Paris"}`)
+	sc.ExpectToolReturn().StreamText("Sunny.").Finish()
+	sc.ExpectClose().Finish()
+
+	var out bytes.Buffer
+	client := NewWithTransport(ctx, sc.transport, WithTrainingCapture(NewJSONTrainingSink(&out), TrainingPolicy{
+		Redaction: AuditPolicy{ToolArgs: RedactDrop},
+	}))
+	defer client.Close(ctx)
+
+	seq, err := client.Open(ctx, "test-model", WithSeqTag("tenant", "acme"))
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Rate(Rating{Score: 1}); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Rate before a generation error = %v, want ErrInvalidState", err)
+	}
+	if err := seq.Append(ctx, "Weather in Paris?", AsUser()); err != nil {
+		t.Fatalf("Append error: %v", err)
+	}
+	stream, err := seq.Generate(ctx, GenerateAsAssistant())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		if len(chunk.ToolCalls) > 0 {
+			break
+		}
+	}
+	resumed, err := seq.ToolReturn(ctx, []ToolResult{{Name: "get_weather", Result: "sunny"}}, GenerateAsAssistant())
+	if err != nil {
+		t.Fatalf("ToolReturn error: %v", err)
+	}
+	if _, err := resumed.Text(ctx); err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if err := seq.Wait(ctx); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	if err := seq.Rate(Rating{Score: 1, Label: "helpful"}); err != nil {
+		t.Fatalf("Rate error: %v", err)
+	}
+
+	// Nothing is written until the sequence closes
+	if out.Len() != 0 {
+		t.Fatalf("records written before close: %s", out.String())
+	}
+	if err := seq.Close(ctx); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d records, want one per generation:\n%s", len(lines), out.String())
+	}
+	var rec struct {
+		Messages []struct {
+			Role      string  `json:"role"`
+			Content   *string `json:"content"`
+			ToolCalls []struct {
+				Function struct {
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"messages"`
+		Ratings []Rating          `json:"ratings"`
+		Tags    map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	// The second generation's prompt has the tool call, with its arguments
+	// redacted, and the result
+	var roles []string
+	for _, m := range rec.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "user,assistant,tool,assistant" {
+		t.Fatalf("roles = %s, want the conversation and completion", got)
+	}
+	if args := rec.Messages[1].ToolCalls[0].Function.Arguments; args != "" {
+		t.Errorf("tool args = %q, want them dropped", args)
+	}
+	if got := *rec.Messages[3].Content; got != "Sunny." {
+		t.Errorf("completion = %q, want Sunny.", got)
+	}
+	if len(rec.Ratings) != 1 || rec.Ratings[0].Label != "helpful" || rec.Tags["tenant"] != "acme" {
+		t.Errorf("ratings %+v, tags %v, want the rating and tags", rec.Ratings, rec.Tags)
+	}
+}
+
+func TestTrainingPolicy_SampleRate(t *testing.T) {
+	tr := &training{policy: TrainingPolicy{SampleRate: 0.25}}
+	var sampled int
+	for range 10000 {
+		if tr.sample() {
+			sampled++
+		}
+	}
+	if share := float64(sampled) / 10000; math.Abs(share-0.25) > 0.03 {
+		t.Errorf("sampled %.3f of sequences, want about 0.25", share)
+	}
+
+	all := &training{}
+	if !all.sample() {
+		t.Error("a zero SampleRate should capture every sequence")
+	}
+}
+
+func TestSeq_Rate_NotCaptured(t *testing.T) {
+	ctx := context.Background()
+
+	sc := newScenario(t)
+	sc.ExpectOpen().Opened("seq-1")
+	seq, err := sc.Client().Open(ctx, "test-model")
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := seq.Rate(Rating{Score: -1}); err != nil {
+		t.Errorf("Rate error = %v, want nil without capture", err)
+	}
+}
@@ -1,10 +1,17 @@
 package modelsocket
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/coder/websocket"
 )
@@ -17,6 +24,28 @@ type Transport interface {
 	Close() error
 }
 
+// Pinger is implemented by transports that can measure round-trip latency to
+// the server. It is used by [Client.Ping].
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DefaultReadLimit is the largest frame the WebSocket transport reads when
+// DialOptions.ReadLimit is zero.
+const DefaultReadLimit = 32 * 1024 * 1024
+
+// DefaultWriteTimeout bounds each frame write when DialOptions.WriteTimeout
+// is zero.
+const DefaultWriteTimeout = 30 * time.Second
+
+// WriteStats describes a frame write, as reported to
+// DialOptions.OnSlowWrite.
+type WriteStats struct {
+	Encode time.Duration // Marshaling the request
+	Write  time.Duration // Writing the frame, including waiting for other frames
+	Bytes  int
+}
+
 // DialOptions configures the WebSocket connection.
 type DialOptions struct {
 	// HTTPHeader specifies additional HTTP headers to send during handshake.
@@ -25,6 +54,35 @@ type DialOptions struct {
 	// HTTPClient is the HTTP client used for the handshake.
 	// If nil, http.DefaultClient is used.
 	HTTPClient *http.Client
+
+	// WireLogger, if set, receives every raw frame at debug level along with
+	// its size and encode/decode timings.
+	WireLogger *slog.Logger
+
+	// RedactWireText replaces text fields in frames logged to WireLogger
+	// with their length.
+	RedactWireText bool
+
+	// StrictDecoding rejects malformed frames and unknown events instead of
+	// decoding what it can. See [DecodeOptions].
+	StrictDecoding bool
+
+	// ReadLimit is the largest frame accepted, in bytes. Defaults to
+	// [DefaultReadLimit]. Larger frames are discarded and reported as a
+	// [*FrameTooLargeError]; the connection stays open.
+	ReadLimit int64
+
+	// WriteTimeout bounds each frame write. Defaults to
+	// [DefaultWriteTimeout]; negative disables it. A write that times out
+	// fails with a [*WriteTimeoutError] and closes the connection, as the
+	// frame may have been partly written.
+	WriteTimeout time.Duration
+
+	// OnSlowWrite, if set, is called for sends that take longer than
+	// SlowWriteThreshold, including time spent waiting for other frames, so
+	// a congested uplink can be detected before writes time out.
+	OnSlowWrite        func(WriteStats)
+	SlowWriteThreshold time.Duration
 }
 
 // Dial connects to a ModelSocket server and returns a Transport.
@@ -50,70 +108,200 @@ func Dial(ctx context.Context, url string, apiKey string, opts *DialOptions) (Tr
 		return nil, &ConnectionError{Op: "dial", URL: url, Err: err}
 	}
 
-	// Set a large read limit for potentially large responses
-	conn.SetReadLimit(32 * 1024 * 1024) // 32MB
+	t := &wsTransport{conn: conn, readLimit: DefaultReadLimit, writeTimeout: DefaultWriteTimeout}
+	if opts != nil {
+		t.wireLogger = opts.WireLogger
+		t.redact = opts.RedactWireText
+		t.decode.Strict = opts.StrictDecoding
+		if opts.ReadLimit > 0 {
+			t.readLimit = opts.ReadLimit
+		}
+		if opts.WriteTimeout != 0 {
+			t.writeTimeout = opts.WriteTimeout
+		}
+		t.onSlowWrite = opts.OnSlowWrite
+		t.slowWrite = opts.SlowWriteThreshold
+	}
+	t.decode.MaxSize = int(min(t.readLimit, math.MaxInt))
+
+	// The transport enforces the limit itself, so an oversized frame can be
+	// skipped rather than closing the connection
+	conn.SetReadLimit(-1)
 
-	return &wsTransport{conn: conn}, nil
+	return t, nil
 }
 
 // wsTransport implements Transport over WebSocket.
 type wsTransport struct {
 	conn   *websocket.Conn
-	mu     sync.Mutex
-	closed bool
+	closed atomic.Bool
+
+	wireLogger *slog.Logger
+	redact     bool
+	decode     DecodeOptions
+	readLimit  int64
+
+	writeTimeout time.Duration
+	onSlowWrite  func(WriteStats)
+	slowWrite    time.Duration
 }
 
-// Send sends a request to the server.
+// Send sends a request to the server. It is safe to call concurrently: the
+// request is marshaled without holding any lock, and the connection
+// serializes frame writes itself.
 func (t *wsTransport) Send(ctx context.Context, req *MSRequest) error {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	if t.closed {
+	if t.closed.Load() {
 		return ErrClosed
 	}
 
+	start := time.Now()
 	data, err := json.Marshal(req)
 	if err != nil {
 		return &SendError{Op: "marshal", Err: err}
 	}
+	encoded := time.Now()
 
-	if err := t.conn.Write(ctx, websocket.MessageText, data); err != nil {
-		return &ConnectionError{Op: "write", Err: err}
+	if err := t.write(ctx, data); err != nil {
+		if t.closed.Load() {
+			return ErrClosed
+		}
+		return err
+	}
+	written := time.Now()
+
+	if t.wireLogger != nil {
+		t.logFrame("ws send", data,
+			slog.Duration("encode", encoded.Sub(start)),
+			slog.Duration("write", written.Sub(encoded)),
+		)
+	}
+	if t.onSlowWrite != nil && written.Sub(start) > t.slowWrite {
+		t.onSlowWrite(WriteStats{
+			Encode: encoded.Sub(start),
+			Write:  written.Sub(encoded),
+			Bytes:  len(data),
+		})
 	}
 
 	return nil
 }
 
+// write writes a frame within the write timeout.
+func (t *wsTransport) write(ctx context.Context, data []byte) error {
+	writeCtx := ctx
+	if t.writeTimeout > 0 {
+		var cancel context.CancelFunc
+		writeCtx, cancel = context.WithTimeout(ctx, t.writeTimeout)
+		defer cancel()
+	}
+
+	if err := t.conn.Write(writeCtx, websocket.MessageText, data); err != nil {
+		// Only the write deadline expiring is a timeout; the caller's own
+		// context is reported as is
+		if ctx.Err() == nil && writeCtx.Err() != nil {
+			err = &WriteTimeoutError{Timeout: t.writeTimeout, Bytes: len(data)}
+		}
+		return &ConnectionError{Op: "write", Err: err}
+	}
+	return nil
+}
+
 // Receive receives an event from the server.
 func (t *wsTransport) Receive(ctx context.Context) (*MSEvent, error) {
-	_, data, err := t.conn.Read(ctx)
+	buf, err := t.read(ctx)
 	if err != nil {
-		t.mu.Lock()
-		closed := t.closed
-		t.mu.Unlock()
-		if closed {
+		var tooLarge *FrameTooLargeError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+
+		if t.closed.Load() {
 			return nil, ErrClosed
 		}
+		var closeErr websocket.CloseError
+		if errors.As(err, &closeErr) {
+			err = &CloseError{Code: int(closeErr.Code), Reason: closeErr.Reason}
+		}
 		return nil, &ConnectionError{Op: "read", Err: err}
 	}
+	// Decoding copies everything it keeps, so the buffer can be reused
+	defer putReadBuffer(buf)
+	data := buf.Bytes()
+
+	start := time.Now()
+	event, err := DecodeEvent(data, t.decode)
+	if err != nil {
+		if t.wireLogger != nil {
+			t.logFrame("ws recv", data, slog.Any("error", err))
+		}
+		return nil, err
+	}
 
-	var event MSEvent
-	if err := json.Unmarshal(data, &event); err != nil {
-		return nil, &SendError{Op: "unmarshal", Err: err}
+	if t.wireLogger != nil {
+		t.logFrame("ws recv", data, slog.Duration("decode", time.Since(start)))
 	}
 
-	return &event, nil
+	return event, nil
+}
+
+// read reads a frame of at most readLimit bytes into a pooled buffer, to be
+// returned with putReadBuffer. A larger frame is read to the end and
+// discarded, to measure it and keep the connection usable.
+func (t *wsTransport) read(ctx context.Context) (*bytes.Buffer, error) {
+	_, r, err := t.conn.Reader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := readBuffers.Get().(*bytes.Buffer)
+	n, err := buf.ReadFrom(io.LimitReader(r, t.readLimit+1))
+	if err != nil {
+		putReadBuffer(buf)
+		return nil, err
+	}
+	if n <= t.readLimit {
+		return buf, nil
+	}
+	putReadBuffer(buf)
+
+	rest, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &FrameTooLargeError{Limit: t.readLimit, Size: n + rest}
+}
+
+// maxPooledReadBuffer is the largest read buffer kept for reuse, so an
+// occasional large frame doesn't pin its buffer for the connection's life.
+const maxPooledReadBuffer = 64 * 1024
+
+// readBuffers holds buffers for reading frames, shared by all connections.
+var readBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// putReadBuffer returns a buffer to readBuffers.
+func putReadBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledReadBuffer {
+		return
+	}
+	buf.Reset()
+	readBuffers.Put(buf)
+}
+
+// Ping sends a WebSocket ping and waits for the pong. It relies on the
+// client's read loop to process the pong.
+func (t *wsTransport) Ping(ctx context.Context) error {
+	if err := t.conn.Ping(ctx); err != nil {
+		return &ConnectionError{Op: "ping", Err: err}
+	}
+	return nil
 }
 
 // Close closes the transport.
 func (t *wsTransport) Close() error {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	if t.closed {
+	if !t.closed.CompareAndSwap(false, true) {
 		return nil
 	}
-	t.closed = true
-
 	return t.conn.Close(websocket.StatusNormalClosure, "")
 }
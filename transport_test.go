@@ -0,0 +1,371 @@
+package modelsocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// newTestServer starts a WebSocket server running handler for each
+// connection and returns its URL.
+func newTestServer(t *testing.T, handler func(ctx context.Context, conn *websocket.Conn)) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols: []string{"modelsocket.v0"},
+		})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		handler(r.Context(), conn)
+	}))
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// replyText answers the first frame with a seq_text event.
+func replyText(ctx context.Context, conn *websocket.Conn) {
+	_, _, err := conn.Read(ctx)
+	if err != nil {
+		return
+	}
+	conn.Write(ctx, websocket.MessageText, []byte(`{"event":"seq_text","seq_id":"s1","text":"secret words"}`))
+	conn.Read(ctx)
+}
+
+func TestDial_WireDebug(t *testing.T) {
+	url := newTestServer(t, replyText)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	transport, err := Dial(ctx, url, "key", &DialOptions{WireLogger: logger, RedactWireText: true})
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer transport.Close()
+
+	req := NewAppendRequest("cid-1", "s1", SeqAppendData{Text: "hello there"})
+	if err := transport.Send(ctx, req); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	event, err := transport.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if event.Text != "secret words" {
+		t.Errorf("Text = %s, want secret words", event.Text)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"ws send", "ws recv", "bytes=", "encode=", "decode=", "[redacted 11 bytes]", "[redacted 12 bytes]"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("wire log missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret words") || strings.Contains(out, "hello there") {
+		t.Errorf("wire log contains unredacted text:\n%s", out)
+	}
+}
+
+func TestRedactFrame(t *testing.T) {
+	got := redactFrame([]byte(`{"data":{"results":[{"name":"t","result":"abc"}]},"text":"hi"}`))
+	want := `{"data":{"results":[{"name":"t","result":"[redacted 3 bytes]"}]},"text":"[redacted 2 bytes]"}`
+	if got != want {
+		t.Errorf("redactFrame = %s, want %s", got, want)
+	}
+
+	if got := redactFrame([]byte("not json")); got != "[redacted 8 bytes]" {
+		t.Errorf("redactFrame = %s, want [redacted 8 bytes]", got)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	url := newTestServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		// Reading processes pings and replies with pongs
+		for {
+			if _, _, err := conn.Read(ctx); err != nil {
+				return
+			}
+		}
+	})
+	ctx := context.Background()
+
+	client, err := Connect(ctx, url, "key")
+	if err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	if !client.Healthy() {
+		t.Error("Healthy() = false, want true")
+	}
+
+	rtt, err := client.Ping(ctx)
+	if err != nil {
+		t.Fatalf("Ping error: %v", err)
+	}
+	if rtt <= 0 {
+		t.Errorf("rtt = %v, want > 0", rtt)
+	}
+
+	client.Close(ctx)
+	if client.Healthy() {
+		t.Error("Healthy() = true after Close, want false")
+	}
+	if _, err := client.Ping(ctx); err != ErrClosed {
+		t.Errorf("Ping after Close err = %v, want ErrClosed", err)
+	}
+}
+
+func TestDial_ReadLimit(t *testing.T) {
+	big := `{"event":"seq_text","seq_id":"s1","text":"` + strings.Repeat("x", 2000) + `"}`
+	url := newTestServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		conn.Write(ctx, websocket.MessageText, []byte(big))
+		conn.Write(ctx, websocket.MessageText, []byte(`{"event":"seq_text","seq_id":"s1","text":"small"}`))
+		conn.Read(ctx)
+	})
+	ctx := context.Background()
+
+	transport, err := Dial(ctx, url, "", &DialOptions{ReadLimit: 1024})
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer transport.Close()
+
+	_, err = transport.Receive(ctx)
+	var tooLarge *FrameTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Receive error = %v, want *FrameTooLargeError", err)
+	}
+	if tooLarge.Limit != 1024 || tooLarge.Size != int64(len(big)) {
+		t.Errorf("error = %+v, want limit 1024 and size %d", tooLarge, len(big))
+	}
+
+	// The connection is still usable
+	event, err := transport.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive error: %v", err)
+	}
+	if event.Text != "small" {
+		t.Errorf("Text = %q, want small", event.Text)
+	}
+}
+
+func TestClient_WithReadLimit(t *testing.T) {
+	url := newTestServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		var req MSRequest
+		json.Unmarshal(data, &req)
+
+		conn.Write(ctx, websocket.MessageText, []byte(`{"event":"seq_text","seq_id":"s1","text":"`+strings.Repeat("x", 200)+`"}`))
+		conn.Write(ctx, websocket.MessageText, []byte(`{"event":"seq_opened","cid":"`+req.CID+`","seq_id":"s1"}`))
+		conn.Read(ctx)
+	})
+	ctx := context.Background()
+
+	h := &recordHandler{}
+	client, err := Connect(ctx, url, "", WithReadLimit(100), WithLogger(slog.New(h)))
+	if err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	defer client.Close(ctx)
+
+	if _, err := client.Open(ctx, "test-model"); err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	r, ok := h.find("discarding oversized frame")
+	if !ok {
+		t.Fatal("oversized frame not logged")
+	}
+	if got := attrs(r)["limit"].Int64(); got != 100 {
+		t.Errorf("logged limit = %d, want 100", got)
+	}
+}
+
+func TestDial_WriteTimeout(t *testing.T) {
+	// The server never reads, so writes block once buffers fill
+	url := newTestServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		<-ctx.Done()
+	})
+	ctx := context.Background()
+
+	transport, err := Dial(ctx, url, "", &DialOptions{WriteTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer transport.Close()
+
+	req := &MSRequest{Request: "seq_command", Data: strings.Repeat("x", 1<<20)}
+	for i := 0; i < 256; i++ {
+		if err = transport.Send(ctx, req); err != nil {
+			break
+		}
+	}
+
+	var timeout *WriteTimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("Send error = %v, want *WriteTimeoutError", err)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Error("errors.Is(err, ErrTimeout) = false")
+	}
+	if timeout.Timeout != 50*time.Millisecond {
+		t.Errorf("Timeout = %v, want 50ms", timeout.Timeout)
+	}
+}
+
+func TestDial_OnSlowWrite(t *testing.T) {
+	url := newTestServer(t, replyText)
+	ctx := context.Background()
+
+	slow := make(chan WriteStats, 1)
+	transport, err := Dial(ctx, url, "", &DialOptions{
+		OnSlowWrite: func(s WriteStats) { slow <- s },
+	})
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer transport.Close()
+
+	req := &MSRequest{Request: "seq_open", CID: "c1"}
+	if err := transport.Send(ctx, req); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	data, _ := json.Marshal(req)
+	select {
+	case s := <-slow:
+		if s.Bytes != len(data) {
+			t.Errorf("Bytes = %d, want %d", s.Bytes, len(data))
+		}
+	default:
+		t.Fatal("OnSlowWrite not called with a zero threshold")
+	}
+}
+
+func TestDial_ConcurrentSend(t *testing.T) {
+	const senders, each = 8, 50
+	received := make(chan int, 1)
+	url := newTestServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		n := 0
+		for n < senders*each {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				break
+			}
+			var req MSRequest
+			if json.Unmarshal(data, &req) == nil {
+				n++
+			}
+		}
+		received <- n
+	})
+	ctx := context.Background()
+
+	transport, err := Dial(ctx, url, "", nil)
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer transport.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				req := &MSRequest{Request: "seq_command", CID: fmt.Sprintf("c%d-%d", i, j)}
+				if err := transport.Send(ctx, req); err != nil {
+					t.Errorf("Send error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := <-received; n != senders*each {
+		t.Errorf("server received %d frames, want %d", n, senders*each)
+	}
+}
+
+func TestDial_ReceiveReusesBuffers(t *testing.T) {
+	texts := []string{strings.Repeat("a", 5000), "b", strings.Repeat("c", 100*1024), "d"}
+	url := newTestServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		for _, text := range texts {
+			conn.Write(ctx, websocket.MessageText, []byte(`{"event":"seq_text","seq_id":"s1","text":"`+text+`"}`))
+		}
+		conn.Read(ctx)
+	})
+	ctx := context.Background()
+
+	transport, err := Dial(ctx, url, "", nil)
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer transport.Close()
+
+	// Events must not share memory with buffers reused for later frames
+	var events []*MSEvent
+	for range texts {
+		event, err := transport.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive error: %v", err)
+		}
+		events = append(events, event)
+	}
+	for i, event := range events {
+		if event.Text != texts[i] {
+			t.Errorf("event %d Text has %d bytes, want %d", i, len(event.Text), len(texts[i]))
+		}
+	}
+}
+
+func TestClient_ServerCloseCode(t *testing.T) {
+	url := newTestServer(t, func(ctx context.Context, conn *websocket.Conn) {
+		conn.Close(websocket.StatusGoingAway, "restarting")
+	})
+	ctx := context.Background()
+
+	disconnected := make(chan error, 1)
+	client, err := Connect(ctx, url, "", WithOnDisconnect(func(err error) { disconnected <- err }))
+	if err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	defer client.Close(ctx)
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrServerShutdown) {
+			t.Errorf("OnDisconnect error = %v, want ErrServerShutdown", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+
+	var closeErr *CloseError
+	if !errors.As(client.Err(), &closeErr) {
+		t.Fatalf("Err = %v, want *CloseError", client.Err())
+	}
+	if closeErr.Code != 1001 || closeErr.Reason != "restarting" {
+		t.Errorf("CloseError = %+v, want 1001 restarting", closeErr)
+	}
+}
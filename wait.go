@@ -0,0 +1,49 @@
+package modelsocket
+
+import "context"
+
+// Wait blocks until the sequence has no generation or command in progress,
+// or ctx is done. Generations count until the server finishes them, whether
+// or not their streams have been read, and their output is in the history
+// once Wait returns. It is meant for orchestration code that hands streams
+// to background consumers and must let them finish before calling
+// [Seq.Fork] or [Seq.Close]. Wait returns nil once the sequence is closed.
+func (s *Seq) Wait(ctx context.Context) error {
+	for {
+		s.mu.RLock()
+		activity := s.activity
+		closed := s.closed
+		busy := s.gens.busy() || s.finishing > 0
+		s.mu.RUnlock()
+
+		if !busy {
+			s.cmdMu.RLock()
+			busy = len(s.commands) > 0
+			s.cmdMu.RUnlock()
+		}
+		if closed || !busy {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-activity:
+		}
+	}
+}
+
+// wakeLocked wakes callers of Wait to check the sequence again. s.mu must be
+// held.
+func (s *Seq) wakeLocked() {
+	close(s.activity)
+	s.activity = make(chan struct{})
+}
+
+// finished marks a generation ended by the server as recorded.
+func (s *Seq) finished() {
+	s.mu.Lock()
+	s.finishing--
+	s.wakeLocked()
+	s.mu.Unlock()
+}
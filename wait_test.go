@@ -0,0 +1,122 @@
+package modelsocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSeq_Wait(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	release := make(chan struct{})
+	serve := textServer("Hello")
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		<-release
+		return serve(req)
+	})
+
+	// The stream is never read, as if handed to a background consumer
+	if _, err := seq.Generate(ctx); err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := seq.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait during generation = %v, want DeadlineExceeded", err)
+	}
+
+	close(release)
+	waitCtx, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := seq.Wait(waitCtx); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+
+	history := seq.History()
+	if len(history) == 0 || history[len(history)-1].Text != "Hello" {
+		t.Errorf("History = %+v, want the generation recorded", history)
+	}
+}
+
+func TestSeq_WaitCommand(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	release := make(chan struct{})
+	serveCommands(t, transport, func(req *MSRequest) []*MSEvent {
+		<-release
+		return []*MSEvent{{Event: "seq_fork_finish", SeqID: req.SeqID, CID: req.CID, ChildSeqID: "seq-2"}}
+	})
+
+	forked := make(chan error, 1)
+	go func() {
+		_, err := seq.Fork(ctx)
+		forked <- err
+	}()
+
+	// Wait for the fork to be sent before checking it holds Wait up
+	deadline := time.Now().Add(time.Second)
+	for {
+		seq.cmdMu.RLock()
+		pending := len(seq.commands)
+		seq.cmdMu.RUnlock()
+		if pending > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fork not sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := seq.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait during fork = %v, want DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := <-forked; err != nil {
+		t.Fatalf("Fork error: %v", err)
+	}
+	waitCtx, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := seq.Wait(waitCtx); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+}
+
+func TestSeq_WaitIdle(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := seq.Wait(canceled); err != nil {
+		t.Errorf("Wait on idle sequence = %v, want nil", err)
+	}
+
+	seq.closeWith(&MSEvent{Event: "seq_closed", SeqID: "seq-1"}, nil)
+	if err := seq.Wait(canceled); err != nil {
+		t.Errorf("Wait on closed sequence = %v, want nil", err)
+	}
+}
@@ -0,0 +1,62 @@
+package modelsocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// redactedWireFields are the frame fields replaced when wire redaction is on.
+var redactedWireFields = map[string]bool{
+	"text":         true,
+	"prefill_text": true,
+	"result":       true,
+}
+
+// logFrame logs a raw frame to the wire logger.
+func (t *wsTransport) logFrame(msg string, data []byte, attrs ...slog.Attr) {
+	frame := string(data)
+	if t.redact {
+		frame = redactFrame(data)
+	}
+
+	attrs = append(attrs,
+		slog.Int("bytes", len(data)),
+		slog.String("frame", frame),
+	)
+	t.wireLogger.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
+
+// redactFrame replaces text fields anywhere in a JSON frame with their
+// length. Frames that aren't valid JSON are replaced entirely.
+func redactFrame(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Sprintf("[redacted %d bytes]", len(data))
+	}
+
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("[redacted %d bytes]", len(data))
+	}
+	return string(out)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if s, ok := field.(string); ok && redactedWireFields[k] {
+				v[k] = fmt.Sprintf("[redacted %d bytes]", len(s))
+				continue
+			}
+			v[k] = redactValue(field)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = redactValue(elem)
+		}
+	}
+	return v
+}
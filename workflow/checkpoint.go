@@ -0,0 +1,118 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// checkpoint is the state of a run saved in a snapshot's State.
+type checkpoint struct {
+	Outputs     map[string]json.RawMessage       `json:"outputs"`
+	Transcripts map[string][]modelsocket.Message `json:"transcripts,omitempty"`
+}
+
+// checkpointing reports whether the run saves checkpoints.
+func (r *run) checkpointing() bool {
+	return r.opts.Store != nil && r.opts.CheckpointID != ""
+}
+
+// resume restores the outputs and transcripts of the nodes that had
+// finished when the run's checkpoint was saved, if there is one, and
+// returns the names of those nodes.
+func (r *run) resume(ctx context.Context) (map[string]bool, error) {
+	if !r.checkpointing() {
+		return nil, nil
+	}
+	snap, err := r.opts.Store.Load(ctx, r.opts.CheckpointID)
+	if errors.Is(err, modelsocket.ErrSessionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(snap.State, &cp); err != nil {
+		return nil, fmt.Errorf("workflow: decoding checkpoint %q: %w", r.opts.CheckpointID, err)
+	}
+	restored := make(map[string]bool, len(cp.Outputs))
+	r.version = snap.Version
+	for name, output := range cp.Outputs {
+		if _, ok := r.done[name]; !ok {
+			continue // The workflow has changed since
+		}
+		r.outputs[name] = output
+		close(r.done[name])
+		restored[name] = true
+	}
+	for name, history := range cp.Transcripts {
+		r.transcripts[name] = history
+	}
+	return restored, nil
+}
+
+// save checkpoints the outputs so far.
+func (r *run) save(ctx context.Context) error {
+	if !r.checkpointing() {
+		return nil
+	}
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	cp := checkpoint{
+		Outputs:     make(map[string]json.RawMessage),
+		Transcripts: make(map[string][]modelsocket.Message),
+	}
+	r.mu.Lock()
+	for name, output := range r.outputs {
+		raw, err := json.Marshal(output)
+		if err != nil {
+			r.mu.Unlock()
+			return fmt.Errorf("checkpointing output of %q: %w", name, err)
+		}
+		cp.Outputs[name] = raw
+	}
+	for name, history := range r.transcripts {
+		cp.Transcripts[name] = history
+	}
+	r.mu.Unlock()
+
+	state, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	snap := &modelsocket.Snapshot{Model: r.opts.Model, State: state, Version: r.version}
+	if err := r.opts.Store.Save(ctx, r.opts.CheckpointID, snap); err != nil {
+		return err
+	}
+	r.version = snap.Version
+	return nil
+}
+
+// promptSeq returns the sequence of the finished prompt node name,
+// restoring it from its transcript if it finished before the run resumed.
+func (r *run) promptSeq(ctx context.Context, name string) (*modelsocket.Seq, error) {
+	r.restoreMu.Lock()
+	defer r.restoreMu.Unlock()
+
+	r.mu.Lock()
+	seq, history := r.seqs[name], r.transcripts[name]
+	r.mu.Unlock()
+	if seq != nil {
+		return seq, nil
+	}
+
+	snap := &modelsocket.Snapshot{Model: r.opts.Model, History: history}
+	seq, err := r.client.Restore(ctx, snap, r.opts.OpenOptions...)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.seqs[name] = seq
+	r.mu.Unlock()
+	return seq, nil
+}
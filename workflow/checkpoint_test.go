@@ -0,0 +1,121 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+func TestRun_ResumeFromCheckpoint(t *testing.T) {
+	store := modelsocket.NewMemorySessionStore()
+
+	var charges atomic.Int32
+	charge := modelsocket.NewFuncTool(modelsocket.ToolDefinition{Name: "charge"}, func(ctx context.Context, args string) (string, error) {
+		return "charged " + args, nil
+	})
+	var crashed atomic.Bool
+
+	w, err := New(
+		Prompt("outline", func(in Inputs) (string, error) {
+			return "outline " + in.Run.(string), nil
+		}),
+		Tool("charge", charge, func(in Inputs) (string, error) {
+			charges.Add(1)
+			return "once", nil
+		}).After("outline"),
+		Prompt("expand", func(in Inputs) (string, error) {
+			// The first run crashes here
+			if !crashed.Swap(true) {
+				return "", errors.New("worker crashed")
+			}
+			charged, err := Input[string](in, "charge")
+			return "expand " + charged, err
+		}).After("outline", "charge"),
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	opts := Options{Model: "test-model", Store: store, CheckpointID: "job-1"}
+
+	transport := newServer()
+	if _, err := w.Run(context.Background(), newClient(t, transport), "tides", opts); err == nil {
+		t.Fatal("first Run succeeded, want the crash")
+	}
+
+	// Another process resumes the run
+	results, err := w.Run(context.Background(), newClient(t, newServer()), "tides", opts)
+	if err != nil {
+		t.Fatalf("resumed Run error: %v", err)
+	}
+	if n := charges.Load(); n != 1 {
+		t.Errorf("tool called %d times, want once", n)
+	}
+
+	// expand continued the restored outline conversation
+	expand, _ := results["expand"].(string)
+	if !strings.HasPrefix(expand, "outline tides|") || !strings.HasSuffix(expand, "|expand charged once") {
+		t.Errorf("expand = %q, want the outline's conversation continued", expand)
+	}
+	if outline, err := Input[string](Inputs{outputs: results}, "outline"); err != nil || outline != "outline tides" {
+		t.Errorf("restored outline = %q, %v", outline, err)
+	}
+
+	if _, err := store.Load(context.Background(), "job-1"); !errors.Is(err, modelsocket.ErrSessionNotFound) {
+		t.Errorf("Load after success error = %v, want the checkpoint deleted", err)
+	}
+}
+
+// crashingStore is a session store whose nth save fails, as if the worker
+// crashed before checkpointing.
+type crashingStore struct {
+	modelsocket.SessionStore
+	n     int32
+	saves atomic.Int32
+}
+
+func (s *crashingStore) Save(ctx context.Context, id string, snap *modelsocket.Snapshot) error {
+	if s.saves.Add(1) == s.n {
+		return errors.New("worker crashed")
+	}
+	return s.SessionStore.Save(ctx, id, snap)
+}
+
+func TestRun_ResumeAfterToolCall(t *testing.T) {
+	var charges atomic.Int32
+	charge := modelsocket.SideEffecting(modelsocket.NewFuncTool(modelsocket.ToolDefinition{Name: "charge"}, func(ctx context.Context, args string) (string, error) {
+		return fmt.Sprintf("charge %d", charges.Add(1)), nil
+	}))
+
+	w, err := New(
+		Func("order", func(ctx context.Context, in Inputs) (any, error) {
+			return "order 1", nil
+		}),
+		Tool("charge", charge, func(in Inputs) (string, error) {
+			return `{"amount": 5}`, nil
+		}).After("order"),
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	// The worker crashes after charging, before the charge is checkpointed
+	store := &crashingStore{SessionStore: modelsocket.NewMemorySessionStore(), n: 2}
+	opts := Options{Store: store, CheckpointID: "job-1", ToolCallStore: modelsocket.NewMemoryToolCallStore()}
+	if _, err := w.Run(context.Background(), nil, nil, opts); err == nil {
+		t.Fatal("first Run succeeded, want the crash")
+	}
+
+	// The resumed run gets the recorded result
+	results, err := w.Run(context.Background(), nil, nil, opts)
+	if err != nil {
+		t.Fatalf("resumed Run error: %v", err)
+	}
+	if n := charges.Load(); n != 1 || results["charge"] != "charge 1" {
+		t.Errorf("tool called %d times with result %v, want once", n, results["charge"])
+	}
+}
@@ -0,0 +1,461 @@
+// Package workflow runs a graph of prompts, tools and Go functions. Each
+// node names the nodes whose outputs it takes as inputs, and runs as soon as
+// they have finished, concurrently with any other node that is ready.
+//
+// Prompt nodes map onto sequences: a prompt node that takes the output of
+// another prompt node continues that node's conversation on a fork of its
+// sequence, and one that doesn't opens a new sequence.
+//
+//	w, err := workflow.New(
+//	    workflow.Prompt("outline", func(in workflow.Inputs) (string, error) {
+//	        return "Outline an essay on " + in.Run.(string), nil
+//	    }),
+//	    workflow.Func("sections", func(ctx context.Context, in workflow.Inputs) (any, error) {
+//	        outline, err := workflow.Input[string](in, "outline")
+//	        return strings.Split(outline, "\n"), err
+//	    }).After("outline"),
+//	    workflow.Prompt("intro", func(in workflow.Inputs) (string, error) {
+//	        sections, err := workflow.Input[[]string](in, "sections")
+//	        if err != nil {
+//	            return "", err
+//	        }
+//	        return "Write the introduction to: " + sections[0], nil
+//	    }).After("outline", "sections"),
+//	)
+//	results, err := w.Run(ctx, client, "tides", workflow.Options{Model: model})
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/chrisboulton/modelsocket-go"
+)
+
+// DefaultConcurrency is how many nodes run at once unless
+// Options.Concurrency sets another limit.
+const DefaultConcurrency = 4
+
+type nodeKind int
+
+const (
+	kindPrompt nodeKind = iota
+	kindTool
+	kindFunc
+)
+
+// Node is a step of a workflow. Build nodes with [Prompt], [Tool] and
+// [Func].
+type Node struct {
+	name   string
+	kind   nodeKind
+	deps   []string
+	prompt func(in Inputs) (string, error)
+	opts   []modelsocket.GenOption
+	tool   modelsocket.Tool
+	args   func(in Inputs) (string, error)
+	fn     func(ctx context.Context, in Inputs) (any, error)
+}
+
+// Prompt returns a node that appends the prompt built from its inputs as the
+// user and generates the assistant's reply. Its output is the generated
+// text, as a string.
+func Prompt(name string, prompt func(in Inputs) (string, error), opts ...modelsocket.GenOption) Node {
+	return Node{name: name, kind: kindPrompt, prompt: prompt, opts: opts}
+}
+
+// Tool returns a node that calls tool with the arguments built from its
+// inputs. Its output is the tool's result, as a string. A
+// [modelsocket.SideEffecting] tool is guarded by [Options.ToolCallStore],
+// so a resumed run doesn't call it again if the worker crashed after the
+// call but before the node was checkpointed.
+func Tool(name string, tool modelsocket.Tool, args func(in Inputs) (string, error)) Node {
+	return Node{name: name, kind: kindTool, tool: tool, args: args}
+}
+
+// Func returns a node whose output is fn's result.
+func Func(name string, fn func(ctx context.Context, in Inputs) (any, error)) Node {
+	return Node{name: name, kind: kindFunc, fn: fn}
+}
+
+// After makes the node take the outputs of the named nodes as inputs, and
+// run once they have finished. A prompt node continues the conversation of
+// the first prompt node it names.
+func (n Node) After(names ...string) Node {
+	n.deps = append(n.deps[:len(n.deps):len(n.deps)], names...)
+	return n
+}
+
+// Inputs are a node's inputs: the run's input and the outputs of the nodes
+// it runs after.
+type Inputs struct {
+	Run     any // The input passed to Workflow.Run
+	outputs map[string]any
+}
+
+// Get returns the output of the named node, or nil if the node doesn't run
+// after it. Outputs restored from a checkpoint are json.RawMessage; use
+// [Input] to read them as the type the node returned.
+func (in Inputs) Get(name string) any {
+	return in.outputs[name]
+}
+
+// Input returns the output of the named node as a T, decoding it if it was
+// restored from a checkpoint. It fails with a [*TypeError] if the node's
+// output isn't one.
+func Input[T any](in Inputs, name string) (T, error) {
+	output, ok := in.outputs[name]
+	if raw, isRaw := output.(json.RawMessage); isRaw {
+		var v T
+		if err := json.Unmarshal(raw, &v); err == nil {
+			return v, nil
+		}
+	}
+	v, isT := output.(T)
+	if !ok || !isT {
+		return v, &TypeError{Node: name, Want: reflect.TypeFor[T]().String(), Got: output}
+	}
+	return v, nil
+}
+
+// TypeError reports a node output of the wrong type.
+type TypeError struct {
+	Node string
+	Want string
+	Got  any
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("workflow: output of %q is %T, not %s", e.Node, e.Got, e.Want)
+}
+
+// NodeError reports the node that failed.
+type NodeError struct {
+	Node string
+	Err  error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("workflow: node %q: %v", e.Node, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// Errors returned by New for malformed graphs.
+var (
+	ErrDuplicateNode = errors.New("workflow: duplicate node")
+	ErrUnknownNode   = errors.New("workflow: unknown node")
+	ErrCycle         = errors.New("workflow: cycle")
+)
+
+// Options configures Workflow.Run.
+type Options struct {
+	// Model is the model prompt nodes open sequences with.
+	Model string
+
+	// OpenOptions apply to every sequence prompt nodes open.
+	OpenOptions []modelsocket.OpenOption
+
+	// Concurrency is how many nodes run at once. Defaults to
+	// DefaultConcurrency.
+	Concurrency int
+
+	// Store and CheckpointID, if both set, checkpoint the run: after each
+	// node finishes, the outputs so far and the conversations of prompt
+	// nodes are saved to Store under CheckpointID. A run started with a
+	// checkpoint in the store resumes from it, without rerunning the nodes
+	// that had finished, so side-effecting tools aren't called twice. The
+	// checkpoint is deleted when the run succeeds. Outputs must encode as
+	// JSON; those restored from a checkpoint are json.RawMessage, which
+	// [Input] decodes.
+	Store        modelsocket.SessionStore
+	CheckpointID string
+
+	// ToolCallStore, if set along with CheckpointID, guards the calls of
+	// tool nodes whose tools are [modelsocket.SideEffecting]. Each call is
+	// keyed by CheckpointID and the node's name, so a resumed run gets the
+	// recorded result of a call made before the crash rather than calling
+	// the tool again. Results outlive the checkpoint, so use a new
+	// CheckpointID for each run.
+	ToolCallStore modelsocket.ToolCallStore
+}
+
+// Results are the outputs of a run's nodes, by name.
+type Results map[string]any
+
+// Workflow is a validated graph of nodes. It is safe to run concurrently.
+type Workflow struct {
+	nodes []Node
+}
+
+// New returns a workflow of nodes. It fails if two nodes share a name, a
+// node runs after one that isn't in the workflow, or the nodes form a cycle.
+func New(nodes ...Node) (*Workflow, error) {
+	byName := make(map[string]Node, len(nodes))
+	for _, n := range nodes {
+		if _, ok := byName[n.name]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateNode, n.name)
+		}
+		byName[n.name] = n
+	}
+	for _, n := range nodes {
+		for _, dep := range n.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("%w: %q runs after %q", ErrUnknownNode, n.name, dep)
+			}
+		}
+	}
+
+	// Depth-first search for a path back to a node being visited
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(nodes))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrCycle, strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range byName[name].deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, n := range nodes {
+		if err := visit(n.name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Workflow{nodes: nodes}, nil
+}
+
+// Run runs the workflow with input as every node's Inputs.Run, and returns
+// the outputs of all nodes. It stops at the first failed node with a
+// [*NodeError]. The sequences it opens are closed before it returns.
+func (w *Workflow) Run(ctx context.Context, client *modelsocket.Client, input any, opts Options) (Results, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &run{
+		client:      client,
+		opts:        opts,
+		input:       input,
+		kinds:       make(map[string]nodeKind, len(w.nodes)),
+		done:        make(map[string]chan struct{}, len(w.nodes)),
+		outputs:     make(Results, len(w.nodes)),
+		seqs:        make(map[string]*modelsocket.Seq),
+		transcripts: make(map[string][]modelsocket.Message),
+	}
+	defer r.close(ctx)
+	for _, n := range w.nodes {
+		r.kinds[n.name] = n.kind
+		r.done[n.name] = make(chan struct{})
+	}
+	restored, err := r.resume(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	for _, n := range w.nodes {
+		if restored[n.name] {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for _, dep := range n.deps {
+				select {
+				case <-r.done[dep]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			if err := r.runNode(ctx, n); err != nil {
+				errOnce.Do(func() {
+					firstErr = &NodeError{Node: n.name, Err: err}
+					cancel()
+				})
+				return
+			}
+			close(r.done[n.name])
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.checkpointing() {
+		if err := opts.Store.Delete(ctx, opts.CheckpointID); err != nil {
+			return nil, err
+		}
+	}
+	return r.outputs, nil
+}
+
+// run is the state of one call to Workflow.Run.
+type run struct {
+	client *modelsocket.Client
+	opts   Options
+	input  any
+	kinds  map[string]nodeKind
+	done   map[string]chan struct{} // Closed when the node has finished
+
+	mu          sync.Mutex
+	outputs     Results
+	seqs        map[string]*modelsocket.Seq      // Of prompt nodes
+	transcripts map[string][]modelsocket.Message // Of finished prompt nodes
+
+	restoreMu sync.Mutex // Held while restoring a prompt node's sequence
+	saveMu    sync.Mutex // Held while saving a checkpoint
+	version   int64      // Of the last checkpoint, guarded by saveMu
+}
+
+// runNode runs n, whose dependencies have finished, and records its output.
+func (r *run) runNode(ctx context.Context, n Node) error {
+	in := Inputs{Run: r.input, outputs: make(map[string]any, len(n.deps))}
+	r.mu.Lock()
+	for _, dep := range n.deps {
+		in.outputs[dep] = r.outputs[dep]
+	}
+	r.mu.Unlock()
+
+	var output any
+	var err error
+	switch n.kind {
+	case kindPrompt:
+		output, err = r.runPrompt(ctx, n, in)
+	case kindTool:
+		var args string
+		if args, err = n.args(in); err == nil {
+			output, err = r.callTool(ctx, n, args)
+		}
+	case kindFunc:
+		output, err = n.fn(ctx, in)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.outputs[n.name] = output
+	if seq := r.seqs[n.name]; seq != nil {
+		r.transcripts[n.name] = seq.History()
+	}
+	r.mu.Unlock()
+	return r.save(ctx)
+}
+
+// callTool calls a tool node's tool, through a toolbox guarded by the run's
+// ToolCallStore if it has one.
+func (r *run) callTool(ctx context.Context, n Node, args string) (string, error) {
+	if r.opts.ToolCallStore == nil || r.opts.CheckpointID == "" {
+		return n.tool.Call(ctx, args)
+	}
+
+	toolbox := modelsocket.NewToolbox()
+	toolbox.Add(n.tool)
+	toolbox.SetToolCallStore(r.opts.ToolCallStore)
+	toolbox.SetToolCallKey(func(ctx context.Context, call modelsocket.ToolCall) string {
+		return r.opts.CheckpointID + ":" + n.name
+	})
+	return toolbox.Call(ctx, n.tool.Definition().Name, args)
+}
+
+// runPrompt generates a prompt node's reply, on a fork of the sequence of
+// the first prompt node it runs after or on a new sequence.
+func (r *run) runPrompt(ctx context.Context, n Node, in Inputs) (string, error) {
+	prompt, err := n.prompt(in)
+	if err != nil {
+		return "", err
+	}
+
+	var parent *modelsocket.Seq
+	for _, dep := range n.deps {
+		if r.kinds[dep] == kindPrompt {
+			if parent, err = r.promptSeq(ctx, dep); err != nil {
+				return "", err
+			}
+			break
+		}
+	}
+
+	var seq *modelsocket.Seq
+	if parent != nil {
+		seq, err = parent.Fork(ctx)
+	} else {
+		seq, err = r.client.Open(ctx, r.opts.Model, r.opts.OpenOptions...)
+	}
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.seqs[n.name] = seq
+	r.mu.Unlock()
+
+	if err := seq.Append(ctx, prompt, modelsocket.AsUser()); err != nil {
+		return "", err
+	}
+	opts := append([]modelsocket.GenOption{modelsocket.GenerateAsAssistant()}, n.opts...)
+	stream, err := seq.Generate(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	text, err := stream.Text(ctx)
+
+	// A retried or hedged generation can finish on another sequence and
+	// close seq, so keep the one holding the reply for later nodes to fork
+	r.mu.Lock()
+	r.seqs[n.name] = stream.Seq()
+	r.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// close closes the sequences opened by the run.
+func (r *run) close(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, seq := range r.seqs {
+		seq.Close(context.WithoutCancel(ctx))
+	}
+}
@@ -0,0 +1,256 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chrisboulton/modelsocket-go"
+	"github.com/chrisboulton/modelsocket-go/internal/mstest"
+)
+
+// newServer returns a server that answers each generation with the
+// sequence's appended texts, joined by "|", so forks show the conversation
+// they continue.
+func newServer() *mstest.Server {
+	return mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		return mstest.Reply(strings.Join(g.Texts(), "|"))
+	})
+}
+
+func newClient(t *testing.T, transport *mstest.Server) *modelsocket.Client {
+	t.Helper()
+
+	ctx := context.Background()
+	client := modelsocket.NewWithTransport(ctx, transport)
+	t.Cleanup(func() { client.Close(ctx) })
+	return client
+}
+
+func TestRun(t *testing.T) {
+	transport := newServer()
+	client := newClient(t, transport)
+
+	count := modelsocket.NewFuncTool(modelsocket.ToolDefinition{Name: "count"}, func(ctx context.Context, args string) (string, error) {
+		return "counted " + args, nil
+	})
+
+	w, err := New(
+		Prompt("outline", func(in Inputs) (string, error) {
+			return "outline " + in.Run.(string), nil
+		}),
+		Func("words", func(ctx context.Context, in Inputs) (any, error) {
+			outline, err := Input[string](in, "outline")
+			return strings.Fields(outline), err
+		}).After("outline"),
+		Tool("count", count, func(in Inputs) (string, error) {
+			words, err := Input[[]string](in, "words")
+			return fmt.Sprint(len(words)), err
+		}).After("words"),
+		Prompt("expand", func(in Inputs) (string, error) {
+			return "expand " + in.Get("count").(string), nil
+		}).After("outline", "count"),
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	results, err := w.Run(context.Background(), client, "tides", Options{Model: "test-model"})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	// expand continued the outline's conversation on a fork
+	want := Results{
+		"outline": "outline tides",
+		"words":   []string{"outline", "tides"},
+		"count":   "counted 2",
+		"expand":  "outline tides|expand counted 2",
+	}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+
+	seqs := transport.Opened() + transport.Forks()
+	if forks, closed := transport.Forks(), transport.Closed(); seqs != 2 || forks != 1 || closed != 2 {
+		t.Errorf("%d sequences, %d forks, %d closed, want 2, 1, 2", seqs, forks, closed)
+	}
+}
+
+func TestRun_Retry(t *testing.T) {
+	// The first generation fails, so it is retried on a replacement
+	var gens atomic.Int32
+	transport := mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		if gens.Add(1) == 1 {
+			return []*modelsocket.MSEvent{{Event: "seq_closed", ErrorMsg: "worker crashed"}}
+		}
+		return mstest.Reply(strings.Join(g.Texts(), "|"))
+	})
+	client := newClient(t, transport)
+
+	retry := modelsocket.WithGenerateRetry(modelsocket.RetryPolicy{MaxAttempts: 2})
+	w, err := New(
+		Prompt("outline", func(in Inputs) (string, error) {
+			return "outline", nil
+		}, retry),
+		Prompt("expand", func(in Inputs) (string, error) {
+			return "expand", nil
+		}).After("outline"),
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	// expand forks the replacement, which holds the outline's reply
+	results, err := w.Run(context.Background(), client, nil, Options{Model: "test-model"})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if results["expand"] != "outline|expand" {
+		t.Errorf("expand = %v, want the outline's conversation continued", results["expand"])
+	}
+}
+
+func TestRun_Hedge(t *testing.T) {
+	// The first sequence never answers, so the hedge on its fork wins
+	transport := mstest.NewServer(func(g *mstest.Gen) []*modelsocket.MSEvent {
+		if g.SeqID == "seq-1" {
+			return nil
+		}
+		return mstest.Reply(strings.Join(g.Texts(), "|"))
+	})
+	client := newClient(t, transport)
+
+	w, err := New(
+		Prompt("outline", func(in Inputs) (string, error) {
+			return "outline", nil
+		}, modelsocket.WithHedge(10*time.Millisecond)),
+		Prompt("expand", func(in Inputs) (string, error) {
+			return "expand", nil
+		}).After("outline"),
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	results, err := w.Run(context.Background(), client, nil, Options{Model: "test-model"})
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if results["expand"] != "outline|expand" {
+		t.Errorf("expand = %v, want the outline's conversation continued", results["expand"])
+	}
+
+	// The run closes the winner it kept, and the hedge the loser
+	deadline := time.Now().Add(time.Second)
+	for transport.Closed() != 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if seqs, closed := transport.Opened()+transport.Forks(), transport.Closed(); seqs != 3 || closed != 3 {
+		t.Errorf("%d sequences, %d closed, want all 3 closed", seqs, closed)
+	}
+}
+
+func TestRun_Parallel(t *testing.T) {
+	// Each node waits for the other, so they only finish if run together
+	var wg sync.WaitGroup
+	wg.Add(2)
+	both := func(ctx context.Context, in Inputs) (any, error) {
+		wg.Done()
+		done := make(chan struct{})
+		go func() { wg.Wait(); close(done) }()
+		select {
+		case <-done:
+			return "ok", nil
+		case <-time.After(time.Second):
+			return nil, errors.New("ran alone")
+		}
+	}
+
+	w, err := New(Func("a", both), Func("b", both))
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	if _, err := w.Run(context.Background(), nil, nil, Options{}); err != nil {
+		t.Errorf("Run error: %v", err)
+	}
+}
+
+func TestRun_NodeError(t *testing.T) {
+	var ran bool
+	w, err := New(
+		Func("a", func(ctx context.Context, in Inputs) (any, error) {
+			return 1, nil
+		}),
+		Func("b", func(ctx context.Context, in Inputs) (any, error) {
+			_, err := Input[string](in, "a")
+			return nil, err
+		}).After("a"),
+		Func("c", func(ctx context.Context, in Inputs) (any, error) {
+			ran = true
+			return nil, nil
+		}).After("b"),
+	)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	_, err = w.Run(context.Background(), nil, nil, Options{})
+	var nodeErr *NodeError
+	var typeErr *TypeError
+	if !errors.As(err, &nodeErr) || nodeErr.Node != "b" || !errors.As(err, &typeErr) {
+		t.Fatalf("err = %v, want b's *TypeError in a *NodeError", err)
+	}
+	if typeErr.Want != "string" {
+		t.Errorf("TypeError.Want = %q, want string", typeErr.Want)
+	}
+	if ran {
+		t.Error("c ran after b failed")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	fn := func(ctx context.Context, in Inputs) (any, error) { return nil, nil }
+
+	tests := []struct {
+		name  string
+		nodes []Node
+		want  error
+	}{
+		{"duplicate", []Node{Func("a", fn), Func("a", fn)}, ErrDuplicateNode},
+		{"unknown", []Node{Func("a", fn).After("b")}, ErrUnknownNode},
+		{"cycle", []Node{Func("a", fn).After("c"), Func("b", fn).After("a"), Func("c", fn).After("b")}, ErrCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.nodes...); !errors.Is(err, tt.want) {
+				t.Errorf("New error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInput(t *testing.T) {
+	in := Inputs{outputs: map[string]any{
+		"live":     []string{"a", "b"},
+		"restored": json.RawMessage(`["a","b"]`),
+		"text":     "a",
+	}}
+
+	// Restored outputs decode to the type the node returned
+	for _, name := range []string{"live", "restored"} {
+		if got, err := Input[[]string](in, name); err != nil || strings.Join(got, ",") != "a,b" {
+			t.Errorf("Input(%s) = %q, %v, want [a b]", name, got, err)
+		}
+	}
+
+	var typeErr *TypeError
+	if _, err := Input[[]string](in, "text"); !errors.As(err, &typeErr) || typeErr.Node != "text" {
+		t.Errorf("Input(text) error = %v, want a TypeError", err)
+	}
+}
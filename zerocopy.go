@@ -0,0 +1,92 @@
+package modelsocket
+
+import "sync"
+
+// maxPooledChunkBuffer is the largest chunk buffer kept for reuse.
+const maxPooledChunkBuffer = 16 * 1024
+
+// chunkBuffers holds the released buffers of chunks delivered with
+// [WithZeroCopyChunks], shared by all streams. It is a stack rather than a
+// sync.Pool, which may drop what it holds at any time, so a released buffer
+// is the next one handed out.
+var chunkBuffers struct {
+	mu   sync.Mutex
+	free []*[]byte
+}
+
+// maxFreeChunkBuffers caps the released buffers kept for reuse.
+const maxFreeChunkBuffers = 64
+
+// getChunkBuffer returns an empty buffer, reusing a released one if there
+// is one.
+func getChunkBuffer() *[]byte {
+	chunkBuffers.mu.Lock()
+	defer chunkBuffers.mu.Unlock()
+
+	if n := len(chunkBuffers.free); n > 0 {
+		buf := chunkBuffers.free[n-1]
+		chunkBuffers.free = chunkBuffers.free[:n-1]
+		return buf
+	}
+	buf := make([]byte, 0, 256)
+	return &buf
+}
+
+// putChunkBuffer keeps buf for reuse, unless it is too large or enough are
+// kept already.
+func putChunkBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledChunkBuffer {
+		return
+	}
+	*buf = (*buf)[:0]
+
+	chunkBuffers.mu.Lock()
+	defer chunkBuffers.mu.Unlock()
+	if len(chunkBuffers.free) < maxFreeChunkBuffers {
+		chunkBuffers.free = append(chunkBuffers.free, buf)
+	}
+}
+
+// Release returns the chunk's Bytes for reuse by later chunks. Bytes must
+// not be used afterwards. It does nothing for chunks delivered without
+// [WithZeroCopyChunks], and is safe to call more than once.
+func (c *GenChunk) Release() {
+	if c.pooled == nil {
+		return
+	}
+	putChunkBuffer(c.pooled)
+	c.pooled = nil
+	c.Bytes = nil
+}
+
+// pooledChunk returns chunk with its text moved into a pooled buffer.
+func pooledChunk(chunk *GenChunk) *GenChunk {
+	if chunk.Text == "" {
+		return chunk
+	}
+
+	buf := getChunkBuffer()
+	*buf = append(*buf, chunk.Text...)
+
+	// Chunks may be shared with other streams, e.g. when coalesced, so the
+	// consumer gets its own
+	pooled := *chunk
+	pooled.Text = ""
+	pooled.Bytes = *buf
+	pooled.pooled = buf
+	return &pooled
+}
+
+// unpooledChunk returns a pooled chunk with its text back in Text,
+// releasing its buffer, for streams that forward chunks from another.
+func unpooledChunk(chunk *GenChunk) *GenChunk {
+	if chunk.pooled == nil {
+		return chunk
+	}
+	plain := *chunk
+	plain.Text = string(chunk.Bytes)
+	plain.Bytes = nil
+	plain.pooled = nil
+	chunk.Release()
+	return &plain
+}
@@ -0,0 +1,86 @@
+package modelsocket
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSeq_GenerateZeroCopy(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, textServer("Hello", ", ", "world"))
+
+	stream, err := seq.Generate(ctx, WithZeroCopyChunks())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	var got []byte
+	var released *byte
+	for chunk, err := range stream.Chunks(ctx) {
+		if err != nil {
+			t.Fatalf("Chunks error: %v", err)
+		}
+		if chunk.Text != "" {
+			t.Errorf("Text = %q, want text in Bytes", chunk.Text)
+		}
+
+		// Each chunk reuses the buffer the one before released
+		buf := &chunk.Bytes[:1][0]
+		if released != nil && buf != released {
+			t.Error("chunk didn't reuse the released buffer")
+		}
+		released = buf
+
+		got = append(got, chunk.Bytes...)
+		chunk.Release()
+		chunk.Release()
+		if chunk.Bytes != nil {
+			t.Error("Bytes set after Release")
+		}
+	}
+	if string(got) != "Hello, world" {
+		t.Errorf("text = %q, want Hello, world", got)
+	}
+
+	// The history is recorded as usual
+	if history := seq.History(); len(history) != 1 || history[0].Text != "Hello, world" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestGenStream_TextZeroCopy(t *testing.T) {
+	transport := newMockTransport()
+	ctx := context.Background()
+
+	client := NewWithTransport(ctx, transport)
+	defer client.Close(ctx)
+
+	seq := openTestSeq(t, client, transport, "seq-1")
+	serveCommands(t, transport, textServer("a", "b", "c"))
+
+	stream, err := seq.Generate(ctx, WithZeroCopyChunks())
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	text, err := stream.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text error: %v", err)
+	}
+	if text != "abc" {
+		t.Errorf("text = %q, want abc", text)
+	}
+}
+
+func TestGenChunk_ReleaseUnpooled(t *testing.T) {
+	chunk := &GenChunk{Text: "hi"}
+	chunk.Release()
+	if chunk.Text != "hi" {
+		t.Errorf("Text = %q, want hi", chunk.Text)
+	}
+}